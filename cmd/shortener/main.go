@@ -2,9 +2,9 @@ package main
 
 import (
 	"fmt"
-	"net/http"
 
 	"github.com/kupriyanovkk/shortener/internal/app"
+	"github.com/kupriyanovkk/shortener/internal/metrics"
 )
 
 var buildVersion string = "N/A"
@@ -23,7 +23,9 @@ func init() {
 }
 
 func main() {
-	go http.ListenAndServe(":9900", nil)
-
-	app.Start()
+	app.Start(metrics.BuildInfo{
+		Version: buildVersion,
+		Date:    buildDate,
+		Commit:  buildCommit,
+	})
 }
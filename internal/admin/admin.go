@@ -0,0 +1,144 @@
+// Package admin protects the admin listener serving pprof, metrics, internal
+// statistics and admin operations.
+//
+// Access may be restricted by trusted subnets of clients, a bearer token and
+// client certificates signed by the admin CA (mTLS). All configured restrictions
+// apply together.
+package admin
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+)
+
+// TokenHeader is an alternative to the Authorization header for the admin token.
+const TokenHeader = "X-Admin-Token"
+
+// Options configures access to the admin listener.
+type Options struct {
+	// Token is a secret expected as "Authorization: Bearer <token>" or in TokenHeader.
+	Token string
+	// TrustedSubnets is a comma separated list of CIDRs of allowed clients.
+	TrustedSubnets string
+	// Resolver resolves IPs of clients behind trusted proxies, connection addresses are used when it is nil.
+	Resolver *clientip.Resolver
+	// CertFile and KeyFile are the server certificate and key, the listener serves plain HTTP without them.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile is a path to PEM encoded CAs verifying required client certificates.
+	ClientCAFile string
+}
+
+// Guard checks access to the admin listener.
+type Guard struct {
+	token    string
+	subnets  clientip.Subnets
+	resolver *clientip.Resolver
+	tls      *tls.Config
+}
+
+// New returns Guard configured by opts.
+func New(opts Options) (*Guard, error) {
+	subnets, err := clientip.ParseSubnets(opts.TrustedSubnets)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin trusted subnet: %w", err)
+	}
+
+	g := &Guard{token: opts.Token, subnets: subnets, resolver: opts.Resolver}
+
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, errors.New("both admin certificate and key are required for TLS")
+	}
+	if opts.ClientCAFile != "" && opts.CertFile == "" {
+		return nil, errors.New("admin client CA requires the admin certificate and key")
+	}
+
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load admin certificate: %w", err)
+		}
+		g.tls = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	if opts.ClientCAFile != "" {
+		data, err := os.ReadFile(opts.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read admin client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates in admin client CA")
+		}
+		g.tls.ClientCAs = pool
+		g.tls.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return g, nil
+}
+
+// TLSConfig returns TLS configuration of the listener, or nil for plain HTTP.
+func (g *Guard) TLSConfig() *tls.Config {
+	return g.tls
+}
+
+// Protected reports whether any restriction is configured.
+func (g *Guard) Protected() bool {
+	return g.token != "" || len(g.subnets) > 0 || (g.tls != nil && g.tls.ClientCAs != nil)
+}
+
+// Middleware rejects requests from clients outside the trusted subnets with 403 Forbidden
+// and requests without the valid token with 401 Unauthorized.
+// Client certificates are verified by the TLS handshake.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !g.trusted(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if !g.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// trusted reports whether the client is in a trusted subnet. Forwarding headers
+// are taken into account only for connections from trusted proxies.
+func (g *Guard) trusted(r *http.Request) bool {
+	if len(g.subnets) == 0 {
+		return true
+	}
+
+	return g.subnets.Contains(g.resolver.FromRequest(r))
+}
+
+func (g *Guard) authorized(r *http.Request) bool {
+	if g.token == "" {
+		return true
+	}
+
+	token := r.Header.Get(TokenHeader)
+	if auth := r.Header.Get("Authorization"); token == "" && len(auth) > len("Bearer ") &&
+		strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		token = auth[len("Bearer "):]
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1
+}
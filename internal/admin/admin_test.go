@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestMiddleware(t *testing.T) {
+	resolver, err := clientip.New("172.16.0.0/12")
+	require.NoError(t, err)
+	guard, err := New(Options{Token: "secret", TrustedSubnets: "10.0.0.0/8, 192.168.1.0/24, fd00::/8", Resolver: resolver})
+	require.NoError(t, err)
+	assert.True(t, guard.Protected())
+	assert.Nil(t, guard.TLSConfig())
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{name: "Bearer", remoteAddr: "10.1.2.3:1234", headers: map[string]string{"Authorization": "Bearer secret"}, want: http.StatusOK},
+		{name: "Token header", remoteAddr: "192.168.1.10:1234", headers: map[string]string{TokenHeader: "secret"}, want: http.StatusOK},
+		{name: "IPv6", remoteAddr: "[fd00::1]:1234", headers: map[string]string{TokenHeader: "secret"}, want: http.StatusOK},
+		{name: "Wrong token", remoteAddr: "10.1.2.3:1234", headers: map[string]string{"Authorization": "Bearer guess"}, want: http.StatusUnauthorized},
+		{name: "No token", remoteAddr: "10.1.2.3:1234", want: http.StatusUnauthorized},
+		{name: "Untrusted subnet", remoteAddr: "203.0.113.1:1234", headers: map[string]string{TokenHeader: "secret"}, want: http.StatusForbidden},
+		{name: "Spoofed header", remoteAddr: "203.0.113.1:1234", headers: map[string]string{TokenHeader: "secret", "X-Forwarded-For": "10.0.0.1"}, want: http.StatusForbidden},
+		{name: "Behind trusted proxy", remoteAddr: "172.16.0.1:1234", headers: map[string]string{TokenHeader: "secret", "X-Forwarded-For": "10.0.0.1"}, want: http.StatusOK},
+		{name: "Untrusted client behind trusted proxy", remoteAddr: "172.16.0.1:1234", headers: map[string]string{TokenHeader: "secret", "X-Forwarded-For": "203.0.113.1"}, want: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.RemoteAddr = test.remoteAddr
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			guard.Middleware(ok).ServeHTTP(w, r)
+			assert.Equal(t, test.want, w.Code)
+		})
+	}
+
+	open, err := New(Options{})
+	require.NoError(t, err)
+	assert.False(t, open.Protected())
+}
+
+func TestNewInvalid(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, _, _ := writeCerts(t, dir)
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "Subnet", opts: Options{TrustedSubnets: "10.0.0.1"}},
+		{name: "Key without cert", opts: Options{KeyFile: key}},
+		{name: "Client CA without cert", opts: Options{ClientCAFile: cert}},
+		{name: "Missing cert", opts: Options{CertFile: filepath.Join(dir, "missing"), KeyFile: key}},
+		{name: "Malformed client CA", opts: Options{CertFile: cert, KeyFile: key, ClientCAFile: key}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New(test.opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	cert, key, ca, client := writeCerts(t, t.TempDir())
+
+	guard, err := New(Options{CertFile: cert, KeyFile: key, ClientCAFile: ca})
+	require.NoError(t, err)
+	assert.True(t, guard.Protected())
+
+	server := httptest.NewUnstartedServer(guard.Middleware(ok))
+	server.TLS = guard.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	caData, err := os.ReadFile(ca)
+	require.NoError(t, err)
+	require.True(t, pool.AppendCertsFromPEM(caData))
+
+	get := func(certs []tls.Certificate) (*http.Response, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: certs},
+		}}
+		return c.Get(server.URL + "/metrics")
+	}
+
+	resp, err := get([]tls.Certificate{client})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = get(nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	assert.Error(t, err, "client certificate is required")
+}
+
+// writeCerts writes a CA, the server certificate signed by it for 127.0.0.1 and its key,
+// and returns their paths along with a client certificate signed by the CA.
+func writeCerts(t *testing.T, dir string) (certFile, keyFile, caFile string, client tls.Certificate) {
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		return key
+	}
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600))
+		return path
+	}
+
+	caKey := newKey()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "admin CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key := newKey()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "admin"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		return der, key
+	}
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	require.NoError(t, err)
+
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+
+	return write("server.crt", "CERTIFICATE", serverDER),
+		write("server.key", "EC PRIVATE KEY", serverKeyDER),
+		write("ca.crt", "CERTIFICATE", caDER),
+		tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+}
@@ -2,68 +2,645 @@ package app
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/admin"
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/canonical"
+	"github.com/kupriyanovkk/shortener/internal/clicks"
+	"github.com/kupriyanovkk/shortener/internal/clientip"
 	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/generator"
 	"github.com/kupriyanovkk/shortener/internal/grpc"
 	"github.com/kupriyanovkk/shortener/internal/handlers"
+	"github.com/kupriyanovkk/shortener/internal/health"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/metrics"
 	"github.com/kupriyanovkk/shortener/internal/middlewares"
-	"github.com/kupriyanovkk/shortener/internal/store/db"
-	infile "github.com/kupriyanovkk/shortener/internal/store/in_file"
-	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	"github.com/kupriyanovkk/shortener/internal/outbox"
+	"github.com/kupriyanovkk/shortener/internal/policy"
+	"github.com/kupriyanovkk/shortener/internal/quota"
+	"github.com/kupriyanovkk/shortener/internal/ratelimit"
+	"github.com/kupriyanovkk/shortener/internal/scanner"
+	"github.com/kupriyanovkk/shortener/internal/store/cache"
+	_ "github.com/kupriyanovkk/shortener/internal/store/db"
+	_ "github.com/kupriyanovkk/shortener/internal/store/in_file"
+	_ "github.com/kupriyanovkk/shortener/internal/store/in_memory"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	redisstore "github.com/kupriyanovkk/shortener/internal/store/redis"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+	"github.com/kupriyanovkk/shortener/internal/tracing"
+	"github.com/kupriyanovkk/shortener/internal/webhooks"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
 )
 
+const (
+	// certCacheDir is the directory where certificates issued by Let's Encrypt are kept.
+	certCacheDir = "assets"
+	// certHost is the host name of the HTTPS certificate.
+	certHost = "localhost"
+	// minCertValidity is the time before expiration when the certificate fails readiness.
+	minCertValidity = 24 * time.Hour
+	// maxDeletionBacklog is the max number of requests in the shared deletion queue
+	// before readiness fails.
+	maxDeletionBacklog = 10000
+	// defaultShutdownDelay is the time between failing readiness and stopping servers,
+	// it should exceed the period of readiness probes.
+	defaultShutdownDelay = 5 * time.Second
+)
+
 // Start initializes the application, sets up the router, parses flags, sets up the store,
-// creates an application instance, and starts the server.
-func Start() {
+// creates an application instance, and starts the server. Build info is exported in metrics.
+func Start(build metrics.BuildInfo) {
 	router := chi.NewRouter()
 	flags, err := config.ParseFlags(os.Args[0], os.Args[1:])
 	if err != nil {
 		panic(err)
 	}
 
-	store := getStore(flags)
+	logger, err := logging.New(logging.Options{
+		Format: flags.LogFormat,
+		Level:  flags.LogLevel,
+	})
+	if err != nil {
+		panic(err)
+	}
+	defer logger.Sync()
+	zap.ReplaceGlobals(logger)
+
+	accessLog, err := getAccessLog(flags)
+	if err != nil {
+		panic(err)
+	}
+	defer accessLog.Close()
+
+	auditLog, err := audit.New(audit.Options{File: flags.AuditLog})
+	if err != nil {
+		panic(err)
+	}
+	defer auditLog.Close()
+	if flags.AuditLog == "" {
+		logger.Warn("audit trail is kept in memory only and is lost on restart, set -audit-log to keep it")
+	}
+
+	var appMetrics *metrics.Metrics
+	if flags.AdminAddress != "" {
+		appMetrics = metrics.New(build)
+	}
+
+	appTracing, err := tracing.New(context.Background(), tracing.Options{
+		Exporter:       flags.TraceExporter,
+		Endpoint:       flags.TraceEndpoint,
+		Insecure:       flags.TraceInsecure,
+		ServiceVersion: build.Version,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	redisClient, redisPrefix := getRedis(flags)
+	store := getStore(flags, redisClient, redisPrefix, appMetrics, appTracing)
+
+	canonicalizer, err := getCanonicalizer(flags)
+	if err != nil {
+		panic(err)
+	}
+
+	policyEngine, err := getPolicy(flags)
+	if err != nil {
+		panic(err)
+	}
+
+	scannerService, err := getScanner(flags, store)
+	if err != nil {
+		panic(err)
+	}
+
+	resolver, err := clientip.New(flags.TrustedProxies)
+	if err != nil {
+		panic(err)
+	}
+
+	limiter, err := getLimiter(flags, resolver)
+	if err != nil {
+		panic(err)
+	}
+
+	trustedSubnets, err := clientip.ParseSubnets(flags.TrustedSubnet)
+	if err != nil {
+		panic(err)
+	}
+
+	idGenerator, err := getIDStrategy(flags, store)
+	if err != nil {
+		panic(err)
+	}
+
+	webhookService, err := webhooks.New(store, webhooks.Options{
+		BaseURL:      flags.BaseURL,
+		File:         flags.WebhooksFile,
+		AllowPrivate: flags.AllowPrivateURLs,
+		Logger:       logger,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	relay, err := getOutbox(flags, store, logger)
+	if err != nil {
+		panic(err)
+	}
 
 	app := &config.App{
-		Flags:   flags,
-		Store:   store,
-		URLChan: make(chan storeInterface.DeletedURLs, 10),
+		Flags:         flags,
+		Store:         store,
+		URLChan:       make(chan storeInterface.DeletedURLs, 10),
+		Canonicalizer: canonicalizer,
+		Policy:        policyEngine,
+		Scanner:       scannerService,
+		Limiter:       limiter,
+		DeleteQueue:   getDeleteQueue(flags, redisClient, redisPrefix),
+		Clicks:        clicks.New(store, clicks.DefaultInterval, webhookService.Clicked),
+		Events:        events.NewBus(events.DefaultBuffer),
+		Webhooks:      webhookService,
+		Outbox:        relay,
+		Audit:         auditLog,
+		Generator:     idGenerator,
+		Metrics:       appMetrics,
+		Tracing:       appTracing,
+		Logger:        logger,
+		AccessLog:     accessLog,
+		ClientIP:      resolver,
+		Trusted:       trustedSubnets,
+		Quota: quota.New(store, quota.Options{
+			Default: quota.Limits{
+				MaxLinks:  flags.QuotaMaxLinks,
+				MaxBatch:  flags.QuotaMaxBatch,
+				MaxPerDay: flags.QuotaMaxPerDay,
+			},
+			Users: flags.QuotaUsers,
+		}),
 	}
 
-	setupMiddlewares(router)
+	appMetrics.RegisterQueue(func() int { return len(app.URLChan) })
+	app.Health = getHealth(flags, app, redisClient)
+
+	setupMiddlewares(router, app)
 	setupRoutes(router, app)
 
-	runServer(flags, router, app)
+	guard, err := admin.New(admin.Options{
+		Token:          flags.AdminToken,
+		TrustedSubnets: flags.TrustedSubnet,
+		Resolver:       resolver,
+		CertFile:       flags.AdminCert,
+		KeyFile:        flags.AdminKey,
+		ClientCAFile:   flags.AdminClientCA,
+	})
+	if err != nil {
+		panic(err)
+	}
+	if flags.AdminAddress != "" && !guard.Protected() {
+		logger.Warn("admin listener is not protected by a token, trusted subnet or client certificates")
+	}
+
+	adminRouter := chi.NewRouter()
+	setupAdminRoutes(adminRouter, app, guard)
+
+	shutdownDelay, err := getShutdownDelay(flags)
+	if err != nil {
+		panic(err)
+	}
+
+	runServer(flags, router, adminRouter, guard.TLSConfig(), app, shutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := appTracing.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Tracing Shutdown", zap.Error(err))
+	}
+}
+
+// getRedis returns a client of Redis used by the shared cache and deletion queue, if it is configured.
+func getRedis(flags *config.ConfigFlags) (*goredis.Client, string) {
+	if flags.RedisURL == "" {
+		if flags.RedisCache || flags.RedisDeleteQueue {
+			panic("Redis URI is required for the shared cache and deletion queue")
+		}
+		return nil, ""
+	}
+
+	client, prefix, err := redisstore.NewClient(flags.RedisURL)
+	if err != nil {
+		panic(err)
+	}
+
+	return client, prefix
+}
+
+// getStore returns a store opened by the driver registered for the storage URI scheme,
+// traced, measured by metrics and wrapped by the redirect cache when it is enabled.
+func getStore(flags *config.ConfigFlags, redisClient *goredis.Client, redisPrefix string, appMetrics *metrics.Metrics, appTracing *tracing.Tracing) storeInterface.Store {
+	dedup, err := storeInterface.ParseDedupMode(flags.DedupMode)
+	if err != nil {
+		panic(err)
+	}
+
+	uri := flags.GetStorageURI()
+	store, err := registry.Open(uri, storeInterface.Options{
+		Dedup:           dedup,
+		CaseInsensitive: flags.CaseInsensitive,
+		Outbox:          flags.OutboxSink != "",
+	})
+	if err != nil {
+		panic(err)
+	}
+	backend := uri[:strings.Index(uri, ":")]
+	store = appMetrics.WrapStore(appTracing.WrapStore(store, backend), backend)
+
+	if flags.CacheSize <= 0 && !flags.RedisCache {
+		return store
+	}
+
+	opts := cache.Options{Size: flags.CacheSize, CaseInsensitive: flags.CaseInsensitive}
+	if flags.RedisCache {
+		opts.Shared = redisstore.NewCache(redisClient, redisPrefix)
+	}
+	if opts.TTL, err = parseDuration(flags.CacheTTL); err != nil {
+		panic(err)
+	}
+	if opts.NegativeTTL, err = parseDuration(flags.CacheNegativeTTL); err != nil {
+		panic(err)
+	}
+
+	return cache.New(store, opts)
+}
+
+// getOutbox returns the relay publishing events of the store outbox to the sink,
+// or nil when the sink isn't configured.
+func getOutbox(flags *config.ConfigFlags, store storeInterface.Store, logger *zap.Logger) (*outbox.Relay, error) {
+	if flags.OutboxSink == "" {
+		return nil, nil
+	}
+
+	for {
+		wrapper, ok := store.(interface{ Unwrap() storeInterface.Store })
+		if !ok {
+			break
+		}
+		store = wrapper.Unwrap()
+	}
+
+	source, ok := store.(storeInterface.Outbox)
+	if !ok {
+		return nil, errors.New("the store doesn't support the outbox")
+	}
+
+	sink, err := outbox.Open(flags.OutboxSink)
+	if err != nil {
+		return nil, err
+	}
+
+	return outbox.NewRelay(source, sink, outbox.Options{Logger: logger}), nil
+}
+
+// getDeleteQueue returns the deletion queue shared in Redis, or nil when URLs are deleted by this instance only.
+func getDeleteQueue(flags *config.ConfigFlags, redisClient *goredis.Client, redisPrefix string) storeInterface.DeletionQueue {
+	if !flags.RedisDeleteQueue {
+		return nil
+	}
+
+	return redisstore.NewQueue(redisClient, redisPrefix)
+}
+
+// getIDStrategy returns the strategy of short IDs selected by the flags.
+// Sequential IDs are numbered by the store when it supports sequences,
+// otherwise by a local counter starting after the number of stored links.
+// IDs containing words of the blocklist are regenerated.
+func getIDStrategy(flags *config.ConfigFlags, store storeInterface.Store) (generator.Strategy, error) {
+	alphabet := generator.Alphabet(flags.IDAlphabet)
+	if flags.CaseInsensitive {
+		if alphabet == "" {
+			alphabet = generator.LowerAlphabet
+		}
+		if strings.ToLower(alphabet) != alphabet {
+			return nil, errors.New("ID alphabet must be lower-case for case-insensitive lookup")
+		}
+	}
+
+	random, err := generator.New(generator.Options{
+		Length:   flags.IDLength,
+		Alphabet: alphabet,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := getIDFilter(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		wrapper, ok := store.(interface{ Unwrap() storeInterface.Store })
+		if !ok {
+			break
+		}
+		store = wrapper.Unwrap()
+	}
+
+	switch flags.IDStrategy {
+	case "", generator.StrategyRandom:
+		return filter(random), nil
+	case generator.StrategySequential:
+		obfuscator, err := generator.NewObfuscator(alphabet, flags.IDSalt, flags.IDLength)
+		if err != nil {
+			return nil, err
+		}
+
+		if sequence, ok := store.(storeInterface.Sequence); ok {
+			return filter(generator.NewSequential(generator.CounterFunc(sequence.NextID), obfuscator)), nil
+		}
+
+		stats, err := store.GetInternalStats(context.Background(), storeInterface.StatsOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		return filter(generator.NewSequential(generator.NewLocalCounter(uint64(stats.URLs)), obfuscator)), nil
+	case generator.StrategySnowflake:
+		snowflake, err := generator.NewSnowflake(flags.IDNode, alphabet)
+		if err != nil {
+			return nil, err
+		}
+
+		return filter(snowflake), nil
+	case generator.StrategyWords:
+		return filter(generator.NewWords(0)), nil
+	case generator.StrategyPool:
+		return generator.NewPool(filter(random), flags.IDPoolSize, func(ctx context.Context, id string) (bool, error) {
+			_, err := store.GetOriginalURL(ctx, id)
+			if errors.Is(err, failure.ErrNotFound) {
+				return true, nil
+			}
+			if err != nil && !errors.Is(err, failure.ErrURLDeleted) &&
+				!errors.Is(err, failure.ErrURLFlagged) && !errors.Is(err, failure.ErrURLBlocked) {
+				return false, err
+			}
+
+			return false, nil
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unknown ID strategy %q", flags.IDStrategy)
+}
+
+// getIDFilter returns a function wrapping ID strategies by the blocklist filter,
+// or leaving them as is when no blocklist is configured.
+func getIDFilter(flags *config.ConfigFlags) (func(generator.Strategy) generator.Strategy, error) {
+	if flags.IDBlocklist == "" {
+		return func(s generator.Strategy) generator.Strategy { return s }, nil
+	}
+
+	var blocked []string
+	if flags.IDBlocklist != "default" {
+		var err error
+		if blocked, err = generator.LoadBlocklist(flags.IDBlocklist); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(s generator.Strategy) generator.Strategy {
+		return generator.NewFilter(s, blocked)
+	}, nil
+}
+
+// parseDuration parses optional duration, empty value means zero.
+func parseDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// getShutdownDelay returns the drain delay configured by the flags, defaultShutdownDelay by default.
+func getShutdownDelay(flags *config.ConfigFlags) (time.Duration, error) {
+	if flags.ShutdownDelay == "" {
+		return defaultShutdownDelay, nil
+	}
+
+	delay, err := time.ParseDuration(flags.ShutdownDelay)
+	if err != nil {
+		return 0, fmt.Errorf("invalid shutdown delay: %w", err)
+	}
+
+	return delay, nil
+}
+
+// getAccessLog returns the access log configured by the flags.
+func getAccessLog(flags *config.ConfigFlags) (*logging.AccessLog, error) {
+	interval, err := parseDuration(flags.AccessLogRotate)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge, err := parseDuration(flags.AccessLogMaxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.NewAccessLog(logging.AccessOptions{
+		Format:   flags.AccessLogFormat,
+		Output:   flags.AccessLog,
+		Sampling: flags.AccessLogSampling,
+		Rotate: logging.RotateOptions{
+			MaxSize:    int64(flags.AccessLogMaxSize) << 20,
+			Interval:   interval,
+			MaxBackups: flags.AccessLogBackups,
+			MaxAge:     maxAge,
+		},
+	})
+}
+
+// getHealth returns the readiness checker of the store, Redis, the deletion queue
+// and the TLS certificate, depending on what is configured.
+func getHealth(flags *config.ConfigFlags, app *config.App, redisClient *goredis.Client) *health.Checker {
+	checker := health.New(0)
+	checker.Add("store", health.Ping(app.Store.Ping))
+
+	for store := app.Store; store != nil; {
+		if file, ok := store.(interface{ Path() string }); ok {
+			checker.Add("file", health.Writable(file.Path()))
+		}
+
+		unwrapper, ok := store.(interface{ Unwrap() storeInterface.Store })
+		if !ok {
+			break
+		}
+		store = unwrapper.Unwrap()
+	}
+
+	if redisClient != nil {
+		checker.Add("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		})
+	}
+
+	maxBacklog := maxDeletionBacklog
+	if app.DeleteQueue == nil {
+		// Handlers block on the full channel.
+		maxBacklog = cap(app.URLChan) - 1
+	}
+	checker.Add("deletion_queue", health.Backlog(app.DeletionBacklog, maxBacklog))
+
+	if flags.EnableHTTPS {
+		cache := autocert.DirCache(certCacheDir)
+		checker.Add("certificate", health.Certificate(func(ctx context.Context) ([]byte, error) {
+			data, err := cache.Get(ctx, certHost)
+			if errors.Is(err, autocert.ErrCacheMiss) {
+				return nil, health.ErrNoCertificate
+			}
+			return data, err
+		}, minCertValidity))
+	}
+
+	return checker
+}
+
+// getCanonicalizer returns a canonicalizer with steps listed in the flags.
+func getCanonicalizer(flags *config.ConfigFlags) (*canonical.Canonicalizer, error) {
+	var steps []string
+	if flags.CanonicalSteps != "" {
+		steps = strings.Split(flags.CanonicalSteps, ",")
+	}
+
+	return canonical.New(canonical.Options{
+		Steps:          steps,
+		TrackingParams: flags.TrackingParams,
+	})
+}
+
+// getPolicy returns a destination URL policy engine configured by the flags.
+func getPolicy(flags *config.ConfigFlags) (*policy.Engine, error) {
+	var schemes []string
+	if flags.AllowedSchemes != "" {
+		schemes = strings.Split(flags.AllowedSchemes, ",")
+	}
+
+	return policy.New(policy.Options{
+		Schemes:      schemes,
+		ListFile:     flags.DomainListFile,
+		AllowPrivate: flags.AllowPrivateURLs,
+		Resolve:      flags.ResolveHosts,
+		BaseURL:      flags.BaseURL,
+	})
 }
 
-// getStore returns a store based on the provided flags.
-func getStore(flags *config.ConfigFlags) storeInterface.Store {
-	if flags.DatabaseDSN != "" {
-		return db.NewStore(flags.DatabaseDSN)
-	} else if flags.FileStoragePath != "" {
-		return infile.NewStore(flags.FileStoragePath)
+// getScanner returns a service scanning shortened URLs, or nil when no scanner is configured.
+func getScanner(flags *config.ConfigFlags, store storeInterface.Store) (*scanner.Service, error) {
+	var chain scanner.Chain
+
+	if flags.ScanListFile != "" {
+		list, err := scanner.NewHashList(flags.ScanListFile, 0)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, list)
+	}
+
+	if flags.ScanWebhookURL != "" {
+		chain = append(chain, scanner.NewWebhook(flags.ScanWebhookURL, flags.ScanWebhookToken, 0))
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
 	}
-	return inmemory.NewStore()
+
+	return scanner.NewService(chain, store, scanner.Options{
+		Sync:    flags.ScanSync,
+		Workers: flags.ScanWorkers,
+	}), nil
+}
+
+// getLimiter returns a rate limiter, or nil when no limits are configured.
+func getLimiter(flags *config.ConfigFlags, resolver *clientip.Resolver) (*ratelimit.Limiter, error) {
+	if flags.RateLimit == "" && len(flags.RateLimitRoutes) == 0 {
+		return nil, nil
+	}
+
+	key, err := ratelimit.ParseKey(flags.RateLimitKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return ratelimit.New(ratelimit.Options{
+		Key:      key,
+		Default:  flags.RateLimit,
+		Routes:   flags.RateLimitRoutes,
+		APIKeys:  flags.RateLimitAPIKeys,
+		Resolver: resolver,
+	})
 }
 
 // setupMiddlewares sets up middleware for the router.
-func setupMiddlewares(router *chi.Mux) {
+func setupMiddlewares(router *chi.Mux, app *config.App) {
 	router.Use(
-		middlewares.Logger,
+		app.Tracing.Middleware,
+		middlewares.RequestID(app.Log()),
+		app.ClientIP.Middleware,
+		middlewares.AccessLog(app.AccessLog),
+		app.Metrics.Middleware,
 		middlewares.Gzip,
 		middlewares.Auth,
+		app.Limiter.Middleware,
+	)
+}
+
+// setupAdminRoutes sets up routes of the admin listener: metrics, pprof,
+// internal statistics and admin operations, all behind the guard.
+func setupAdminRoutes(router *chi.Mux, app *config.App, guard *admin.Guard) {
+	router.Use(
+		guard.Middleware,
+		middlewares.RequestID(app.Log()),
+		app.ClientIP.Middleware,
 	)
+	router.Handle("/metrics", app.Metrics.Handler())
 	router.Mount("/debug", middleware.Profiler())
+
+	router.Get("/api/internal/stats", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetInternalStats(w, r, app)
+	})
+
+	router.Route("/api/admin", func(r chi.Router) {
+		r.Put("/urls/{id}/verdict", func(w http.ResponseWriter, r *http.Request) {
+			handlers.PutAdminURLVerdict(w, r, app)
+		})
+		r.Get("/cache", func(w http.ResponseWriter, r *http.Request) {
+			handlers.GetAdminCache(w, r, app)
+		})
+		r.Get("/users/{userID}/quota", func(w http.ResponseWriter, r *http.Request) {
+			handlers.GetAdminUserQuota(w, r, app)
+		})
+		r.Get("/audit", func(w http.ResponseWriter, r *http.Request) {
+			handlers.GetAdminAudit(w, r, app)
+		})
+	})
 }
 
 // setupRoutes sets up routes for the router.
@@ -78,6 +655,12 @@ func setupRoutes(router *chi.Mux, app *config.App) {
 	router.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
 		handlers.GetPing(w, r, app)
 	})
+	router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetHealthz(w, r, app)
+	})
+	router.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		handlers.GetReadyz(w, r, app)
+	})
 }
 
 // setupAPIRoutes sets up API routes for the router.
@@ -102,28 +685,60 @@ func setupAPIRoutes(router *chi.Mux, app *config.App) {
 					handlers.DeleteAPIUserURLs(w, r, app)
 				})
 			})
-		})
 
-		r.Route("/internal/stats", func(r chi.Router) {
-			r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-				handlers.GetInternalStats(w, r, app)
+			r.Get("/quota", func(w http.ResponseWriter, r *http.Request) {
+				handlers.GetAPIUserQuota(w, r, app)
+			})
+
+			r.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+				handlers.GetAPIUserEvents(w, r, app)
+			})
+
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+					handlers.GetAPIUserWebhooks(w, r, app)
+				})
+				r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+					handlers.PostAPIUserWebhooks(w, r, app)
+				})
+				r.Delete("/{webhookID}", func(w http.ResponseWriter, r *http.Request) {
+					handlers.DeleteAPIUserWebhook(w, r, app)
+				})
+				r.Post("/{webhookID}/test", func(w http.ResponseWriter, r *http.Request) {
+					handlers.PostAPIUserWebhookTest(w, r, app)
+				})
+				r.Get("/{webhookID}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+					handlers.GetAPIUserWebhookDeliveries(w, r, app)
+				})
+				r.Post("/{webhookID}/deliveries/{deliveryID}/replay", func(w http.ResponseWriter, r *http.Request) {
+					handlers.PostAPIUserWebhookReplay(w, r, app)
+				})
 			})
 		})
 	})
 }
 
-func runServer(flags *config.ConfigFlags, router http.Handler, app *config.App) {
+func runServer(flags *config.ConfigFlags, router, admin http.Handler, adminTLS *tls.Config, app *config.App, shutdownDelay time.Duration) {
 	shutdownTimeout := 5 * time.Second
 
 	server := &http.Server{
 		Addr:    flags.ServerAddress,
 		Handler: router,
 	}
+	adminServer := &http.Server{
+		Addr:      flags.AdminAddress,
+		Handler:   admin,
+		TLSConfig: adminTLS,
+	}
 
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(8)
+
+	signalCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	defer stop()
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	// Background workers and the gRPC server stop after the drain delay.
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	go func() {
@@ -132,27 +747,82 @@ func runServer(flags *config.ConfigFlags, router http.Handler, app *config.App)
 		handlers.FlushDeletedURLs(app, ctx)
 	}()
 
+	go func() {
+		defer wg.Done()
+
+		app.Policy.Watch(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		app.Clicks.Run(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		app.Webhooks.Run(ctx, app.Events)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		app.Outbox.Run(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		app.Scanner.Run(ctx)
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		pool, _ := app.Generator.(*generator.Pool)
+		pool.Run(ctx)
+	}()
+
 	go func() {
 		defer wg.Done()
 
 		if flags.EnableHTTPS {
 			manager := &autocert.Manager{
-				Cache:      autocert.DirCache("assets"),
+				Cache:      autocert.DirCache(certCacheDir),
 				Prompt:     autocert.AcceptTOS,
-				HostPolicy: autocert.HostWhitelist("localhost"),
+				HostPolicy: autocert.HostWhitelist(certHost),
 			}
 			server.TLSConfig = manager.TLSConfig()
 
 			if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
-				log.Fatalf("HTTP server ListenAndServeTLS: %v", err)
+				app.Log().Fatal("HTTP server ListenAndServeTLS", zap.Error(err))
 			}
 		} else {
 			if err := server.ListenAndServe(); err != http.ErrServerClosed {
-				log.Fatalf("HTTP server ListenAndServe: %v", err)
+				app.Log().Fatal("HTTP server ListenAndServe", zap.Error(err))
 			}
 		}
 	}()
 
+	if flags.AdminAddress != "" {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			var err error
+			if adminTLS != nil {
+				err = adminServer.ListenAndServeTLS("", "")
+			} else {
+				err = adminServer.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				app.Log().Fatal("Admin server ListenAndServe", zap.Error(err))
+			}
+		}()
+	}
+
 	if flags.GRPCServerAddress != "" {
 		wg.Add(1)
 
@@ -161,22 +831,35 @@ func runServer(flags *config.ConfigFlags, router http.Handler, app *config.App)
 
 			gRPCServer, err := grpc.NewShortenerGRPCServer(app)
 			if err != nil {
-				log.Fatalf("NewShortenerGRPCServer return error: %v", err)
+				app.Log().Fatal("NewShortenerGRPCServer return error", zap.Error(err))
 			}
 
 			gRPCServer.Run(ctx, &wg)
 		}()
 	}
 
-	<-ctx.Done()
+	<-signalCtx.Done()
+	// The next signal terminates the process without waiting for the drain.
+	stop()
 
+	// Servers keep serving until load balancers notice failing readiness and stop routing requests.
+	app.Health.Shutdown()
+	if shutdownDelay > 0 {
+		app.Log().Info("draining before shutdown", zap.Duration("delay", shutdownDelay))
+		time.Sleep(shutdownDelay)
+	}
+	// Event streams are long-lived, so they are ended before servers wait for active requests.
+	app.Events.Close()
 	cancel()
 
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancelShutdown()
 
 	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("HTTP server Shutdown: %v", err)
+		app.Log().Error("HTTP server Shutdown", zap.Error(err))
+	}
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		app.Log().Error("Admin server Shutdown", zap.Error(err))
 	}
 
 	wg.Wait()
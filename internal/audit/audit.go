@@ -0,0 +1,266 @@
+// Package audit records who changed links and subscriptions, when and from where.
+//
+// Entries are appended to a JSON lines file, which is never rewritten, so the
+// trail can be shipped or made immutable by the file system. Without the file
+// the latest entries are kept in memory and lost on restart. Deletions are applied
+// to the store asynchronously, they are recorded once the store confirms them and
+// list only the links actually deleted.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+)
+
+// ErrClosed is returned by Record after Close.
+var ErrClosed = errors.New("audit: log is closed")
+
+// Action is a kind of recorded changes.
+type Action string
+
+// Recorded actions.
+const (
+	ActionCreate        Action = "link.create"
+	ActionDelete        Action = "link.delete"
+	ActionUpdate        Action = "link.update"
+	ActionWebhookCreate Action = "webhook.create"
+	ActionWebhookDelete Action = "webhook.delete"
+)
+
+// ActorAdmin is the actor of actions performed through the admin listener,
+// which authenticates operators by a shared token or client certificates.
+const ActorAdmin = "admin"
+
+// Default settings.
+const (
+	DefaultMemorySize = 10000
+	DefaultLimit      = 1000
+	MaxLimit          = 10000
+)
+
+// Entry is a recorded action.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action Action    `json:"action"`
+	// Actor is the ID of the user performing the action or ActorAdmin.
+	Actor     string   `json:"actor"`
+	IP        string   `json:"ip,omitempty"`
+	RequestID string   `json:"request_id,omitempty"`
+	Shorts    []string `json:"shorts,omitempty"`
+	// Details describes the change, e.g. the new verdict of the link.
+	Details string `json:"details,omitempty"`
+}
+
+// Filter selects entries, zero fields match all entries.
+type Filter struct {
+	// From and To limit the time of entries, To is exclusive.
+	From   time.Time
+	To     time.Time
+	Action Action
+	Actor  string
+	Short  string
+	// Limit is the maximum number of returned entries, DefaultLimit by default, up to MaxLimit.
+	// The oldest matching entries are returned, later ones are read by moving From to the time
+	// of the last returned entry, From is inclusive so entries of that time are returned again.
+	Limit int
+}
+
+func (f Filter) match(e Entry) bool {
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.Time.Before(f.To) {
+		return false
+	}
+	if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if f.Short == "" {
+		return true
+	}
+
+	for _, short := range e.Shorts {
+		if short == f.Short {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Options are settings of Log.
+type Options struct {
+	// File is the path of the JSON lines file entries are appended to.
+	File string
+	// MemorySize limits the number of entries kept in memory without File, DefaultMemorySize by default.
+	MemorySize int
+}
+
+// Log is the audit trail. Nil Log records nothing.
+type Log struct {
+	path string
+	size int
+
+	mu   sync.Mutex
+	file *os.File
+	// entries is a ring buffer in memory mode, the oldest entry is at start once it is full.
+	entries []Entry
+	start   int
+}
+
+// New returns Log appending entries to the file, or keeping them in memory without it.
+func New(opts Options) (*Log, error) {
+	if opts.MemorySize <= 0 {
+		opts.MemorySize = DefaultMemorySize
+	}
+
+	l := &Log{path: opts.File, size: opts.MemorySize}
+	if opts.File == "" {
+		return l, nil
+	}
+
+	file, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	l.file = file
+
+	return l, nil
+}
+
+// Record appends the entry. The time and the request ID are taken from the clock
+// and the context unless they are set.
+func (l *Log) Record(ctx context.Context, e Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	if e.RequestID == "" {
+		e.RequestID = logging.RequestID(ctx)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.path == "" {
+		if len(l.entries) < l.size {
+			l.entries = append(l.entries, e)
+			return nil
+		}
+		l.entries[l.start] = e
+		l.start = (l.start + 1) % l.size
+		return nil
+	}
+	if l.file == nil {
+		return ErrClosed
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// A single write of the whole line keeps lines intact even if other
+	// processes append to the file.
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	return nil
+}
+
+// Query returns entries matching the filter in the order they were recorded. It also
+// reports whether more entries match the filter than its limit.
+func (l *Log) Query(filter Filter) ([]Entry, bool, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultLimit
+	}
+	if filter.Limit > MaxLimit {
+		filter.Limit = MaxLimit
+	}
+
+	result := []Entry{}
+	if l == nil {
+		return result, false, nil
+	}
+
+	if l.path == "" {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		for i := range l.entries {
+			e := l.entries[(l.start+i)%len(l.entries)]
+			if filter.match(e) {
+				if len(result) == filter.Limit {
+					return result, true, nil
+				}
+				result = append(result, e)
+			}
+		}
+
+		return result, false, nil
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, false, fmt.Errorf("audit: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, false, fmt.Errorf("audit: corrupted entry: %w", err)
+		}
+		if filter.match(e) {
+			if len(result) == filter.Limit {
+				return result, true, nil
+			}
+			result = append(result, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("audit: %w", err)
+	}
+
+	return result, false, nil
+}
+
+// Close closes the file of the log.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	return nil
+}
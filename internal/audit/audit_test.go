@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var base = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func record(t *testing.T, l *Log) {
+	ctx := logging.WithRequest(context.Background(), zap.NewNop(), "req1")
+	entries := []Entry{
+		{Time: base, Action: ActionCreate, Actor: "user1", IP: "192.0.2.1", Shorts: []string{"abc"}},
+		{Time: base.Add(time.Hour), Action: ActionDelete, Actor: "user1", Shorts: []string{"abc", "def"}},
+		{Time: base.Add(2 * time.Hour), Action: ActionUpdate, Actor: ActorAdmin, Shorts: []string{"def"}, Details: `verdict="block"`},
+		{Time: base.Add(3 * time.Hour), Action: ActionWebhookCreate, Actor: "user2", RequestID: "req2"},
+	}
+	for _, e := range entries {
+		require.NoError(t, l.Record(ctx, e))
+	}
+}
+
+func testQuery(t *testing.T, l *Log) {
+	all, truncated, err := l.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	assert.False(t, truncated)
+	assert.Equal(t, "req1", all[0].RequestID, "request ID is taken from the context")
+	assert.Equal(t, "req2", all[3].RequestID)
+	assert.Equal(t, "192.0.2.1", all[0].IP)
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		want      []Action
+		truncated bool
+	}{
+		{name: "Time range", filter: Filter{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)}, want: []Action{ActionDelete, ActionUpdate}},
+		{name: "Action", filter: Filter{Action: ActionDelete}, want: []Action{ActionDelete}},
+		{name: "Actor", filter: Filter{Actor: "user1"}, want: []Action{ActionCreate, ActionDelete}},
+		{name: "Short", filter: Filter{Short: "def"}, want: []Action{ActionDelete, ActionUpdate}},
+		{name: "Limit", filter: Filter{Limit: 1}, want: []Action{ActionCreate}, truncated: true},
+		{name: "Limit of all", filter: Filter{Actor: "user1", Limit: 2}, want: []Action{ActionCreate, ActionDelete}},
+		{name: "Nothing", filter: Filter{From: base.Add(time.Hour), Actor: "user2", Action: ActionCreate}, want: []Action{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, truncated, err := l.Query(test.filter)
+			require.NoError(t, err)
+			assert.Equal(t, test.truncated, truncated)
+
+			actions := []Action{}
+			for _, e := range entries {
+				actions = append(actions, e.Action)
+			}
+			assert.Equal(t, test.want, actions)
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	l, err := New(Options{})
+	require.NoError(t, err)
+	record(t, l)
+	testQuery(t, l)
+
+	small, err := New(Options{MemorySize: 3})
+	require.NoError(t, err)
+	record(t, small)
+	entries, _, err := small.Query(Filter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "the oldest entries are dropped")
+	assert.Equal(t, ActionDelete, entries[0].Action)
+	assert.Equal(t, ActionWebhookCreate, entries[2].Action)
+
+	record(t, small)
+	entries, _, err = small.Query(Filter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, []Action{ActionDelete, ActionUpdate}, []Action{entries[0].Action, entries[1].Action}, "entries are returned oldest first")
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := New(Options{File: path})
+	require.NoError(t, err)
+	record(t, l)
+	testQuery(t, l)
+	require.NoError(t, l.Close())
+	assert.ErrorIs(t, l.Record(context.Background(), Entry{Action: ActionCreate}), ErrClosed)
+
+	reopened, err := New(Options{File: path})
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.NoError(t, reopened.Record(context.Background(), Entry{Action: ActionDelete, Actor: "user3"}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 5, strings.Count(string(data), "\n"), "entries are appended")
+
+	entries, _, err := reopened.Query(Filter{Actor: "user3"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.WithinDuration(t, time.Now(), entries[0].Time, time.Minute, "time is set when recorded")
+}
+
+func TestNil(t *testing.T) {
+	var l *Log
+	assert.NoError(t, l.Record(context.Background(), Entry{Action: ActionCreate}))
+	entries, _, err := l.Query(Filter{})
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.NoError(t, l.Close())
+}
@@ -0,0 +1,255 @@
+// Package canonical brings URLs to a canonical form, so equal links
+// written differently are stored and deduplicated as one.
+package canonical
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Names of the canonicalization steps.
+const (
+	StepLowercase = "lowercase"
+	StepPort      = "port"
+	StepPath      = "path"
+	StepIDN       = "idn"
+	StepQuery     = "query"
+	StepTracking  = "tracking"
+)
+
+// DefaultSteps are applied when no steps are configured explicitly.
+// Tracking parameters are kept by default because some services rely on them.
+var DefaultSteps = []string{StepLowercase, StepPort, StepPath, StepIDN, StepQuery}
+
+// TrackingParams are query parameters removed by the tracking step.
+// Parameters ending with '*' are matched by prefix.
+var TrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"yclid",
+	"msclkid",
+	"mc_cid",
+	"mc_eid",
+	"_openstat",
+	"igshid",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+	"ws":    "80",
+	"wss":   "443",
+}
+
+// Step is a single canonicalization step modifying URL in place.
+type Step func(u *url.URL) error
+
+// Options configures Canonicalizer.
+type Options struct {
+	// Steps lists names of the steps in order of application, DefaultSteps if empty.
+	Steps []string
+	// TrackingParams are added to the default TrackingParams list.
+	TrackingParams []string
+}
+
+// Canonicalizer applies configured steps to URLs.
+type Canonicalizer struct {
+	steps []Step
+}
+
+// New returns Canonicalizer configured by opts.
+func New(opts Options) (*Canonicalizer, error) {
+	names := opts.Steps
+	if len(names) == 0 {
+		names = DefaultSteps
+	}
+
+	c := &Canonicalizer{}
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case StepLowercase:
+			c.steps = append(c.steps, Lowercase)
+		case StepPort:
+			c.steps = append(c.steps, RemoveDefaultPort)
+		case StepPath:
+			c.steps = append(c.steps, CleanPath)
+		case StepIDN:
+			c.steps = append(c.steps, Punycode)
+		case StepQuery:
+			c.steps = append(c.steps, SortQuery)
+		case StepTracking:
+			names := make([]string, 0, len(TrackingParams)+len(opts.TrackingParams))
+			c.steps = append(c.steps, StripParams(append(append(names, TrackingParams...), opts.TrackingParams...)))
+		default:
+			return nil, fmt.Errorf("unknown canonicalization step %q", name)
+		}
+	}
+
+	return c, nil
+}
+
+// Canonicalize parses raw URL and applies the steps to it.
+// Nil Canonicalizer only validates the URL.
+func (c *Canonicalizer) Canonicalize(raw string) (string, error) {
+	u, err := url.ParseRequestURI(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if c != nil {
+		for _, step := range c.steps {
+			if err := step(u); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return u.String(), nil
+}
+
+// Lowercase converts scheme and host to lower case.
+func Lowercase(u *url.URL) error {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	return nil
+}
+
+// RemoveDefaultPort removes the port if it is default for the scheme.
+func RemoveDefaultPort(u *url.URL) error {
+	port := u.Port()
+	if port != "" && defaultPorts[strings.ToLower(u.Scheme)] == port {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+
+	return nil
+}
+
+// CleanPath resolves dot segments and duplicate slashes,
+// empty path of URL with host becomes "/". The trailing slash is kept.
+func CleanPath(u *url.URL) error {
+	escaped := u.EscapedPath()
+	if escaped == "" {
+		if u.Host != "" {
+			u.Path, u.RawPath = "/", ""
+		}
+		return nil
+	}
+
+	cleaned := path.Clean(escaped)
+	if strings.HasSuffix(escaped, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+
+	unescaped, err := url.PathUnescape(cleaned)
+	if err != nil {
+		return err
+	}
+	u.Path = unescaped
+	u.RawPath = cleaned
+
+	return nil
+}
+
+// hostProfile maps hosts like idna.Lookup, but allows characters outside of STD3
+// rules, e.g. underscores, which are common in real host names.
+var hostProfile = idna.New(idna.MapForLookup(), idna.Transitional(false), idna.StrictDomainName(false))
+
+// Punycode converts internationalized domain name to ASCII form.
+func Punycode(u *url.URL) error {
+	host, port := u.Hostname(), u.Port()
+	if host == "" || net.ParseIP(host) != nil {
+		return nil
+	}
+
+	ascii, err := hostProfile.ToASCII(host)
+	if err != nil {
+		return fmt.Errorf("invalid host %q: %w", host, err)
+	}
+
+	if port != "" {
+		u.Host = net.JoinHostPort(ascii, port)
+	} else {
+		u.Host = ascii
+	}
+
+	return nil
+}
+
+// SortQuery sorts query parameters by name, order of repeated parameters is kept.
+func SortQuery(u *url.URL) error {
+	if u.RawQuery == "" {
+		return nil
+	}
+
+	pairs := strings.Split(u.RawQuery, "&")
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return queryName(pairs[i]) < queryName(pairs[j])
+	})
+	u.RawQuery = strings.Join(pairs, "&")
+
+	return nil
+}
+
+// StripParams returns a step removing query parameters listed in names.
+// Names are case-insensitive, names ending with '*' are matched by prefix.
+func StripParams(names []string) Step {
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			normalized = append(normalized, name)
+		}
+	}
+	names = normalized
+
+	return func(u *url.URL) error {
+		if u.RawQuery == "" {
+			return nil
+		}
+
+		pairs := strings.Split(u.RawQuery, "&")
+		kept := pairs[:0]
+		for _, pair := range pairs {
+			if pair != "" && !matchParam(names, queryName(pair)) {
+				kept = append(kept, pair)
+			}
+		}
+		u.RawQuery = strings.Join(kept, "&")
+		u.ForceQuery = false
+
+		return nil
+	}
+}
+
+func queryName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+
+	return name
+}
+
+func matchParam(names []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, n := range names {
+		if prefix, ok := strings.CutSuffix(n, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if n == name {
+			return true
+		}
+	}
+
+	return false
+}
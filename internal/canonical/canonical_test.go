@@ -0,0 +1,66 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	defaults, err := New(Options{})
+	require.NoError(t, err)
+
+	tracking, err := New(Options{
+		Steps:          append(DefaultSteps, StepTracking),
+		TrackingParams: []string{"ref", " UTM_Foo ", "MC_*"},
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		canonicalizer *Canonicalizer
+		input         string
+		expected      string
+	}{
+		{name: "lowercase", canonicalizer: defaults, input: "HTTP://Example.COM/Path", expected: "http://example.com/Path"},
+		{name: "default port", canonicalizer: defaults, input: "https://example.com:443/a", expected: "https://example.com/a"},
+		{name: "custom port", canonicalizer: defaults, input: "https://example.com:8443/a", expected: "https://example.com:8443/a"},
+		{name: "empty path", canonicalizer: defaults, input: "http://example.com", expected: "http://example.com/"},
+		{name: "dot segments", canonicalizer: defaults, input: "http://example.com/a/../b/./c//d", expected: "http://example.com/b/c/d"},
+		{name: "trailing slash", canonicalizer: defaults, input: "http://example.com/a/b/", expected: "http://example.com/a/b/"},
+		{name: "escaped path", canonicalizer: defaults, input: "http://example.com/a%2Fb/../c", expected: "http://example.com/c"},
+		{name: "idn", canonicalizer: defaults, input: "http://Пример.рф:8080/", expected: "http://xn--e1afmkfd.xn--p1ai:8080/"},
+		{name: "underscore host", canonicalizer: defaults, input: "http://My_Site.example.com/a", expected: "http://my_site.example.com/a"},
+		{name: "idn with underscore", canonicalizer: defaults, input: "http://my_сайт.рф/", expected: "http://xn--my_-8cd9b6bj.xn--p1ai/"},
+		{name: "ip host", canonicalizer: defaults, input: "http://127.0.0.1:80/", expected: "http://127.0.0.1/"},
+		{name: "sort query", canonicalizer: defaults, input: "http://example.com/?b=2&a=1&b=1", expected: "http://example.com/?a=1&b=2&b=1"},
+		{name: "tracking kept", canonicalizer: defaults, input: "http://example.com/?utm_source=x", expected: "http://example.com/?utm_source=x"},
+		{name: "tracking stripped", canonicalizer: tracking, input: "HTTP://Example.com:80/a/../b?utm_source=x", expected: "http://example.com/b"},
+		{name: "extra tracking", canonicalizer: tracking, input: "http://example.com/?ref=1&id=2&FBCLID=3", expected: "http://example.com/?id=2"},
+		{name: "mixed-case tracking", canonicalizer: tracking, input: "http://example.com/?utm_foo=1&id=2&mc_cid=3", expected: "http://example.com/?id=2"},
+		{name: "nil canonicalizer", canonicalizer: nil, input: "HTTP://Example.com:80/a/../b", expected: "http://Example.com:80/a/../b"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.canonicalizer.Canonicalize(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	c, err := New(Options{})
+	require.NoError(t, err)
+
+	_, err = c.Canonicalize("invalid-url")
+	assert.Error(t, err)
+
+	_, err = c.Canonicalize("http://exa mple.com/")
+	assert.Error(t, err)
+
+	_, err = New(Options{Steps: []string{"unknown"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+// Package clicks counts redirects by short links.
+//
+// Redirects are counted in memory and added to the store in batches, so they
+// don't wait for store writes. Counts not flushed because of store errors are
+// kept until the next flush. Listeners get the totals kept by the store, which
+// are shared by all instances and survive restarts.
+package clicks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+)
+
+// DefaultInterval is the default period of flushing counts to the store.
+const DefaultInterval = 10 * time.Second
+
+// Listener is called after a flush with the numbers of redirects added to links
+// and their totals in the store. Links missing in the store are omitted.
+type Listener func(ctx context.Context, added, totals map[string]int64)
+
+// Counter counts redirects. Nil Counter counts nothing.
+type Counter struct {
+	store     storeInterface.Store
+	interval  time.Duration
+	listeners []Listener
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// New returns Counter flushing counts to the store every interval, DefaultInterval by default,
+// and passing the updated totals to the listeners.
+func New(store storeInterface.Store, interval time.Duration, listeners ...Listener) *Counter {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	return &Counter{
+		store:     store,
+		interval:  interval,
+		listeners: listeners,
+		counts:    make(map[string]int64),
+	}
+}
+
+// Add counts a redirect by the short link.
+func (c *Counter) Add(short string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts[short]++
+}
+
+// Flush adds counted redirects to the store and notifies the listeners.
+func (c *Counter) Flush(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = make(map[string]int64, len(counts))
+	c.mu.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	totals, err := c.store.AddClicks(ctx, counts)
+	if err != nil {
+		c.mu.Lock()
+		for short, n := range counts {
+			c.counts[short] += n
+		}
+		c.mu.Unlock()
+
+		return err
+	}
+
+	for _, listener := range c.listeners {
+		listener(ctx, counts, totals)
+	}
+
+	return nil
+}
+
+// Run flushes counts periodically until ctx is done, then flushes the rest.
+func (c *Counter) Run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				zap.L().Error("clicks: cannot flush counts", zap.Error(err))
+			}
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := c.Flush(flushCtx); err != nil {
+				zap.L().Error("clicks: cannot flush counts on shutdown", zap.Error(err))
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package clicks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingStore struct {
+	storeInterface.Store
+	err error
+}
+
+func (s *failingStore) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.Store.AddClicks(ctx, clicks)
+}
+
+func newStore(t *testing.T) storeInterface.Store {
+	store := inmemory.NewStore()
+	_, err := store.AddValue(context.Background(), storeInterface.AddValueOptions{
+		Original: "https://example.com",
+		Short:    "short1",
+		UserID:   "user1",
+	})
+	require.NoError(t, err)
+
+	return store
+}
+
+func clicks(t *testing.T, store storeInterface.Store) int64 {
+	stats, err := store.GetInternalStats(context.Background(), storeInterface.StatsOptions{})
+	require.NoError(t, err)
+
+	return stats.Clicks
+}
+
+func TestCounter(t *testing.T) {
+	ctx := context.Background()
+	store := &failingStore{Store: newStore(t), err: errors.New("store is down")}
+	var added, totals []map[string]int64
+	c := New(store, 0, func(_ context.Context, a, t map[string]int64) {
+		added = append(added, a)
+		totals = append(totals, t)
+	})
+
+	c.Add("short1")
+	c.Add("short1")
+	assert.Equal(t, int64(0), clicks(t, store), "counts are not flushed yet")
+
+	assert.ErrorIs(t, c.Flush(ctx), store.err)
+	assert.Equal(t, int64(0), clicks(t, store))
+
+	store.err = nil
+	c.Add("short1")
+	require.NoError(t, c.Flush(ctx))
+	assert.Equal(t, int64(3), clicks(t, store), "counts failed to flush are kept")
+	assert.Equal(t, []map[string]int64{{"short1": 3}}, added, "listeners are notified of stored counts only")
+
+	_, err := store.Store.AddClicks(ctx, map[string]int64{"short1": 10})
+	require.NoError(t, err)
+	c.Add("short1")
+	c.Add("missing")
+	require.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]int64{"short1": 1, "missing": 1}, added[1])
+	assert.Equal(t, map[string]int64{"short1": 14}, totals[1], "totals include clicks added by other instances")
+
+	require.NoError(t, c.Flush(ctx))
+	assert.Equal(t, int64(14), clicks(t, store), "counts are flushed once")
+	assert.Len(t, added, 2)
+}
+
+func TestRun(t *testing.T) {
+	store := newStore(t)
+	c := New(store, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(ctx)
+	}()
+
+	c.Add("short1")
+	cancel()
+	<-done
+
+	assert.Equal(t, int64(1), clicks(t, store), "counts are flushed on shutdown")
+}
+
+func TestNilCounter(t *testing.T) {
+	var c *Counter
+
+	c.Add("short1")
+	assert.NoError(t, c.Flush(context.Background()))
+	c.Run(context.Background())
+}
@@ -0,0 +1,217 @@
+// Package clientip resolves IPs of clients behind reverse proxies.
+//
+// Forwarding headers can be set by anyone, so they are used only when the
+// connection comes from a trusted proxy. The Forwarded header (RFC 7239) takes
+// precedence over X-Forwarded-For, which takes precedence over X-Real-IP. Proxy
+// chains are walked from the right, skipping trusted proxies, so the result is
+// the address of the last hop outside the trusted network.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Subnets is a list of networks, IPv4 and IPv6 ones may be mixed.
+type Subnets []*net.IPNet
+
+// ParseSubnets parses CIDRs, each of them may be a comma separated list.
+func ParseSubnets(cidrs ...string) (Subnets, error) {
+	var subnets Subnets
+
+	for _, list := range cidrs {
+		for _, cidr := range strings.Split(list, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, err
+			}
+			subnets = append(subnets, ipNet)
+		}
+	}
+
+	return subnets, nil
+}
+
+// Contains reports whether the IP belongs to any of the subnets.
+// IPv4-mapped IPv6 addresses match IPv4 subnets.
+func (s Subnets) Contains(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, ipNet := range s {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Headers are forwarding headers of a request or gRPC call.
+type Headers struct {
+	Forwarded    string
+	ForwardedFor string
+	RealIP       string
+}
+
+// Resolver resolves client IPs trusting forwarding headers of trusted proxies only.
+// Nil Resolver trusts no proxies.
+type Resolver struct {
+	proxies Subnets
+}
+
+// New returns Resolver trusting proxies in the CIDRs.
+func New(trustedProxies ...string) (*Resolver, error) {
+	proxies, err := ParseSubnets(trustedProxies...)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxy: %w", err)
+	}
+
+	return &Resolver{proxies: proxies}, nil
+}
+
+// Resolve returns the IP of the client connected from remoteAddr, or an empty string
+// when remoteAddr is not a valid address.
+func (r *Resolver) Resolve(remoteAddr string, h Headers) string {
+	ip := hostIP(remoteAddr)
+	if !r.trusted(ip) {
+		return ip
+	}
+
+	if h.Forwarded != "" {
+		return r.walk(ip, forwardedFor(h.Forwarded))
+	}
+
+	if h.ForwardedFor != "" {
+		return r.walk(ip, strings.Split(h.ForwardedFor, ","))
+	}
+
+	if real := hostIP(strings.TrimSpace(h.RealIP)); real != "" {
+		return real
+	}
+
+	return ip
+}
+
+// FromRequest returns the IP of the client of the HTTP request.
+func (r *Resolver) FromRequest(req *http.Request) string {
+	return r.Resolve(req.RemoteAddr, Headers{
+		Forwarded:    strings.Join(req.Header.Values("Forwarded"), ","),
+		ForwardedFor: strings.Join(req.Header.Values("X-Forwarded-For"), ","),
+		RealIP:       req.Header.Get("X-Real-IP"),
+	})
+}
+
+// ipKey is the context key of the IP resolved by Middleware.
+type ipKey struct{}
+
+// Middleware puts the IP of the client into the request context, so code shared
+// by HTTP handlers and gRPC calls gets it by FromContext.
+func (r *Resolver) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := context.WithValue(req.Context(), ipKey{}, r.FromRequest(req))
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// FromContext returns the IP put into the context by Middleware, otherwise
+// the IP of the client of the gRPC call by its peer address and metadata.
+func (r *Resolver) FromContext(ctx context.Context) string {
+	if ip, ok := ctx.Value(ipKey{}).(string); ok {
+		return ip
+	}
+
+	var remoteAddr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	return r.Resolve(remoteAddr, Headers{
+		Forwarded:    strings.Join(md.Get("forwarded"), ","),
+		ForwardedFor: strings.Join(md.Get("x-forwarded-for"), ","),
+		RealIP:       first("x-real-ip"),
+	})
+}
+
+func (r *Resolver) trusted(ip string) bool {
+	if r == nil {
+		return false
+	}
+
+	return r.proxies.Contains(ip)
+}
+
+// walk returns the rightmost hop which is not a trusted proxy. It stops at the first
+// invalid hop, returning the last valid one, as hops before it can't be verified.
+func (r *Resolver) walk(ip string, hops []string) string {
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := hostIP(strings.TrimSpace(hops[i]))
+		if hop == "" {
+			break
+		}
+		ip = hop
+		if !r.trusted(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// forwardedFor returns "for" parameters of elements of the Forwarded header, e.g.
+// `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`. Elements without
+// the parameter are returned as empty strings, so they stop the walk.
+func forwardedFor(header string) []string {
+	var hops []string
+
+	for _, element := range strings.Split(header, ",") {
+		var hop string
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hop = strings.Trim(value, `"`)
+				break
+			}
+		}
+		hops = append(hops, hop)
+	}
+
+	return hops
+}
+
+// hostIP strips the port and IPv6 brackets from the address,
+// it returns an empty string for invalid IPs.
+func hostIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
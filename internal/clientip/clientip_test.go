@@ -0,0 +1,110 @@
+package clientip
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestResolve(t *testing.T) {
+	r, err := New("10.0.0.0/8, fd00::/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    Headers
+		want       string
+	}{
+		{"Direct", "203.0.113.1:1234", Headers{}, "203.0.113.1"},
+		{"Untrusted proxy", "203.0.113.1:1234", Headers{ForwardedFor: "198.51.100.1"}, "203.0.113.1"},
+		{"Trusted proxy", "10.0.0.1:1234", Headers{ForwardedFor: "198.51.100.1"}, "198.51.100.1"},
+		{"Proxy chain", "10.0.0.1:1234", Headers{ForwardedFor: "1.1.1.1, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"Only trusted hops", "10.0.0.1:1234", Headers{ForwardedFor: "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"Invalid hop", "10.0.0.1:1234", Headers{ForwardedFor: "garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"Real IP", "10.0.0.1:1234", Headers{RealIP: "198.51.100.2"}, "198.51.100.2"},
+		{"IPv6", "[fd00::1]:1234", Headers{ForwardedFor: "2001:db8::1"}, "2001:db8::1"},
+		{"IPv4-mapped IPv6", "[::ffff:10.0.0.1]:1234", Headers{ForwardedFor: "198.51.100.1"}, "198.51.100.1"},
+		{"Forwarded", "10.0.0.1:1234", Headers{Forwarded: `for=198.51.100.1;proto=https, for=10.0.0.2;by=10.0.0.1`}, "198.51.100.1"},
+		{"Forwarded IPv6", "10.0.0.1:1234", Headers{Forwarded: `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"Forwarded obfuscated", "10.0.0.1:1234", Headers{Forwarded: `for=_hidden, for=10.0.0.2`}, "10.0.0.2"},
+		{"Forwarded takes precedence", "10.0.0.1:1234", Headers{Forwarded: "for=198.51.100.1", ForwardedFor: "198.51.100.9"}, "198.51.100.1"},
+		{"Invalid remote address", "pipe", Headers{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.Resolve(tt.remoteAddr, tt.headers))
+		})
+	}
+
+	var untrusting *Resolver
+	assert.Equal(t, "10.0.0.1", untrusting.Resolve("10.0.0.1:1234", Headers{ForwardedFor: "198.51.100.1"}))
+
+	_, err = New("10.0.0.1")
+	assert.Error(t, err)
+}
+
+func TestFromRequest(t *testing.T) {
+	r, err := New("10.0.0.0/8")
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Add("X-Forwarded-For", "198.51.100.1")
+	req.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	assert.Equal(t, "198.51.100.1", r.FromRequest(req), "repeated headers are joined")
+}
+
+func TestFromContext(t *testing.T) {
+	r, err := New("10.0.0.0/8")
+	require.NoError(t, err)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}})
+	assert.Equal(t, "10.0.0.1", r.FromContext(ctx))
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "198.51.100.1"))
+	assert.Equal(t, "198.51.100.1", r.FromContext(ctx))
+
+	assert.Equal(t, "", r.FromContext(context.Background()), "no peer")
+}
+
+func TestMiddleware(t *testing.T) {
+	r, err := New("10.0.0.0/8")
+	require.NoError(t, err)
+
+	var ip string
+	h := r.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip = r.FromContext(req.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "198.51.100.1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "198.51.100.1", ip)
+}
+
+func TestSubnets(t *testing.T) {
+	subnets, err := ParseSubnets("192.168.0.0/16, 2001:db8::/32", "10.0.0.0/8")
+	require.NoError(t, err)
+
+	assert.True(t, subnets.Contains("192.168.1.1"))
+	assert.True(t, subnets.Contains("10.1.1.1"))
+	assert.True(t, subnets.Contains("2001:db8::1"))
+	assert.True(t, subnets.Contains("::ffff:192.168.1.1"))
+	assert.False(t, subnets.Contains("172.16.0.1"))
+	assert.False(t, subnets.Contains(""))
+
+	_, err = ParseSubnets("192.168.0.0/33")
+	assert.Error(t, err)
+}
@@ -2,22 +2,101 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"flag"
-	"log"
+	"fmt"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/canonical"
+	"github.com/kupriyanovkk/shortener/internal/clicks"
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/generator"
+	"github.com/kupriyanovkk/shortener/internal/health"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/metrics"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	"github.com/kupriyanovkk/shortener/internal/outbox"
+	"github.com/kupriyanovkk/shortener/internal/policy"
+	"github.com/kupriyanovkk/shortener/internal/quota"
+	"github.com/kupriyanovkk/shortener/internal/ratelimit"
+	"github.com/kupriyanovkk/shortener/internal/scanner"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/tracing"
+	"github.com/kupriyanovkk/shortener/internal/webhooks"
+	"go.uber.org/zap"
 )
 
 // ConfigFlags contains flags for app.
 type ConfigFlags struct {
-	ServerAddress     string `json:"server_address"`
-	BaseURL           string `json:"base_url"`
-	FileStoragePath   string `json:"file_storage_path"`
-	DatabaseDSN       string `json:"database_dsn"`
-	EnableHTTPS       bool   `json:"enable_https"`
-	TrustedSubnet     string `json:"trusted_subnet"`
+	ServerAddress     string                  `json:"server_address"`
+	BaseURL           string                  `json:"base_url"`
+	FileStoragePath   string                  `json:"file_storage_path"`
+	DatabaseDSN       string                  `json:"database_dsn"`
+	StorageURI        string                  `json:"storage_uri"`
+	DedupMode         string                  `json:"dedup_mode"`
+	CanonicalSteps    string                  `json:"canonical_steps"`
+	TrackingParams    []string                `json:"tracking_params"`
+	AllowedSchemes    string                  `json:"allowed_schemes"`
+	DomainListFile    string                  `json:"domain_list_file"`
+	AllowPrivateURLs  bool                    `json:"allow_private_urls"`
+	ResolveHosts      bool                    `json:"resolve_hosts"`
+	ScanListFile      string                  `json:"scan_list_file"`
+	ScanWebhookURL    string                  `json:"scan_webhook_url"`
+	ScanWebhookToken  string                  `json:"scan_webhook_token"`
+	ScanSync          bool                    `json:"scan_sync"`
+	ScanWorkers       int                     `json:"scan_workers"`
+	RateLimit         string                  `json:"rate_limit"`
+	RateLimitKey      string                  `json:"rate_limit_key"`
+	RateLimitRoutes   map[string]string       `json:"rate_limit_routes"`
+	RateLimitAPIKeys  []string                `json:"rate_limit_api_keys"`
+	TrustedProxies    string                  `json:"trusted_proxies"`
+	QuotaMaxLinks     int                     `json:"quota_max_links"`
+	QuotaMaxBatch     int                     `json:"quota_max_batch"`
+	QuotaMaxPerDay    int                     `json:"quota_max_per_day"`
+	QuotaUsers        map[string]quota.Limits `json:"quota_users"`
+	CacheSize         int                     `json:"cache_size"`
+	CacheTTL          string                  `json:"cache_ttl"`
+	CacheNegativeTTL  string                  `json:"cache_negative_ttl"`
+	RedisURL          string                  `json:"redis_url"`
+	RedisCache        bool                    `json:"redis_cache"`
+	RedisDeleteQueue  bool                    `json:"redis_delete_queue"`
+	IDLength          int                     `json:"id_length"`
+	IDAlphabet        string                  `json:"id_alphabet"`
+	IDStrategy        string                  `json:"id_strategy"`
+	IDSalt            string                  `json:"id_salt"`
+	IDNode            int                     `json:"id_node"`
+	IDPoolSize        int                     `json:"id_pool_size"`
+	IDBlocklist       string                  `json:"id_blocklist"`
+	CaseInsensitive   bool                    `json:"case_insensitive"`
+	AdminAddress      string                  `json:"admin_address"`
+	AdminToken        string                  `json:"admin_token"`
+	AdminCert         string                  `json:"admin_cert"`
+	AdminKey          string                  `json:"admin_key"`
+	AdminClientCA     string                  `json:"admin_client_ca"`
+	TraceExporter     string                  `json:"trace_exporter"`
+	TraceEndpoint     string                  `json:"trace_endpoint"`
+	TraceInsecure     bool                    `json:"trace_insecure"`
+	LogFormat         string                  `json:"log_format"`
+	LogLevel          string                  `json:"log_level"`
+	AccessLog         string                  `json:"access_log"`
+	AccessLogFormat   string                  `json:"access_log_format"`
+	AccessLogSampling string                  `json:"access_log_sampling"`
+	AccessLogMaxSize  int                     `json:"access_log_max_size"`
+	AccessLogRotate   string                  `json:"access_log_rotate"`
+	AccessLogBackups  int                     `json:"access_log_backups"`
+	AccessLogMaxAge   string                  `json:"access_log_max_age"`
+	EnableHTTPS       bool                    `json:"enable_https"`
+	TrustedSubnet     string                  `json:"trusted_subnet"`
+	WebhooksFile      string                  `json:"webhooks_file"`
+	OutboxSink        string                  `json:"outbox_sink"`
+	AuditLog          string                  `json:"audit_log"`
+	ShutdownDelay     string                  `json:"shutdown_delay"`
 	ConfigFile        string
 	GRPCServerAddress string
 }
@@ -33,10 +112,57 @@ func ParseFlags(progname string, args []string) (*ConfigFlags, error) {
 		baseURL         string
 		fileStoragePath string
 		databaseDSN     string
+		storageURI      string
+		dedupMode       string
+		canonicalSteps  string
+		trackingParams  string
+		allowedSchemes  string
+		domainListFile  string
+		scanListFile    string
+		scanWebhookURL  string
+		scanSync        bool
+		rateLimit       string
+		rateLimitKey    string
+		trustedProxies  string
+		quotaMaxLinks   int
+		quotaMaxBatch   int
+		quotaMaxPerDay  int
+		cacheSize       int
+		cacheTTL        string
+		shutdownDelay   string
+		redisURL        string
+		redisCache      bool
+		redisQueue      bool
+		idLength        int
+		idAlphabet      string
+		idStrategy      string
+		idNode          int
+		idPoolSize      int
+		idBlocklist     string
+		caseInsensitive bool
+		adminAddress    string
+		adminCert       string
+		adminKey        string
+		adminClientCA   string
+		traceExporter   string
+		traceEndpoint   string
+		traceInsecure   bool
+		logFormat       string
+		logLevel        string
+		accessLog       string
+		accessFormat    string
+		accessSampling  string
+		accessMaxSize   int
+		accessRotate    string
+		accessBackups   int
+		accessMaxAge    string
 		enableHTTPS     bool
 		configFile      string
 		trustedSubnet   string
 		grpcServerAddr  string
+		webhooksFile    string
+		outboxSink      string
+		auditLog        string
 	)
 
 	parsedFlags := ConfigFlags{}
@@ -45,10 +171,57 @@ func ParseFlags(progname string, args []string) (*ConfigFlags, error) {
 	flags.StringVar(&baseURL, "b", "", "the address of the resulting shortened URL")
 	flags.StringVar(&fileStoragePath, "f", "", "the full name of the file where the data is saved in JSON")
 	flags.StringVar(&databaseDSN, "d", "", "the address for DB connection")
+	flags.StringVar(&storageURI, "storage", "", "storage URI, e.g. memory://, file:///var/lib/short.jsonl or postgres://...")
+	flags.StringVar(&dedupMode, "dedup", "", "deduplication of original URLs: global (default), user or off")
+	flags.StringVar(&canonicalSteps, "canonical", "", "comma separated URL canonicalization steps: lowercase,port,path,idn,query,tracking")
+	flags.StringVar(&trackingParams, "tracking-params", "", "comma separated query parameters stripped by the tracking step in addition to the built-in ones, names ending with * match by prefix")
+	flags.StringVar(&allowedSchemes, "schemes", "", "comma separated list of allowed URL schemes, http,https by default")
+	flags.StringVar(&domainListFile, "domain-list", "", "path to the file with allow/deny domain rules")
+	flags.StringVar(&scanListFile, "scan-list", "", "path to the file with hashes of malicious URLs")
+	flags.StringVar(&scanWebhookURL, "scan-webhook", "", "URL of the HTTP service returning verdicts for shortened URLs")
+	flags.BoolVar(&scanSync, "scan-sync", false, "scan URLs before shortening and reject blocked ones")
+	flags.StringVar(&rateLimit, "rate-limit", "", "default rate limit of clients, e.g. 10/s or 600/m:50")
+	flags.StringVar(&rateLimitKey, "rate-limit-key", "", "rate limit clients by ip (default), user or apikey, API keys are set by RATE_LIMIT_API_KEYS or rate_limit_api_keys of the config file")
+	flags.StringVar(&trustedProxies, "trusted-proxies", "", "comma separated CIDRs of proxies trusted to set X-Forwarded-For")
+	flags.IntVar(&quotaMaxLinks, "quota-links", 0, "max number of links per user, unlimited by default")
+	flags.IntVar(&quotaMaxBatch, "quota-batch", 0, "max number of links in a batch request, unlimited by default")
+	flags.IntVar(&quotaMaxPerDay, "quota-daily", 0, "max number of links created by user per day, unlimited by default")
+	flags.IntVar(&cacheSize, "cache-size", 0, "number of redirects cached in memory, cache is disabled by default")
+	flags.StringVar(&cacheTTL, "cache-ttl", "", "time to live of cached redirects, 5m by default")
+	flags.StringVar(&redisURL, "redis", "", "Redis URI for the shared redirect cache and deletion queue, e.g. redis://localhost:6379/0")
+	flags.BoolVar(&redisCache, "redis-cache", false, "share the redirect cache between instances in Redis")
+	flags.BoolVar(&redisQueue, "redis-queue", false, "share the deletion queue between instances in Redis")
+	flags.IntVar(&idLength, "id-length", 0, "length of generated short IDs, 10 by default, min length of sequential IDs")
+	flags.StringVar(&idAlphabet, "id-alphabet", "", "characters of generated short IDs or alphabet name: url (default), readable or lower")
+	flags.StringVar(&idStrategy, "id-strategy", "", "short ID strategy: random (default), sequential, snowflake, pool or words")
+	flags.IntVar(&idNode, "id-node", 0, "node number of this instance for snowflake IDs, from 0 to 1023")
+	flags.IntVar(&idPoolSize, "id-pool-size", 0, "number of IDs generated in advance by the pool strategy, 1000 by default")
+	flags.StringVar(&idBlocklist, "id-blocklist", "", "path to the file with words rejected in short IDs, or default for the built-in list")
+	flags.BoolVar(&caseInsensitive, "case-insensitive", false, "look short IDs up case-insensitively, IDs are generated lower-case")
+	flags.StringVar(&adminAddress, "admin", "", "address and port of the admin listener serving metrics, pprof, stats and admin operations, disabled by default")
+	flags.StringVar(&adminCert, "admin-cert", "", "path to the TLS certificate of the admin listener")
+	flags.StringVar(&adminKey, "admin-key", "", "path to the TLS key of the admin listener")
+	flags.StringVar(&adminClientCA, "admin-client-ca", "", "path to the CA verifying client certificates required by the admin listener")
+	flags.StringVar(&traceExporter, "trace-exporter", "", "exporter of trace spans: otlp or stdout, tracing is disabled by default")
+	flags.StringVar(&traceEndpoint, "trace-endpoint", "", "address of the OTLP gRPC collector, e.g. localhost:4317")
+	flags.BoolVar(&traceInsecure, "trace-insecure", false, "connect to the OTLP collector without TLS")
+	flags.StringVar(&logFormat, "log-format", "", "format of log lines: console (default) or json")
+	flags.StringVar(&logLevel, "log-level", "", "minimal level of logged lines: debug, info (default), warn or error")
+	flags.StringVar(&accessLog, "access-log", "", "path to the access log file, or - for stdout, requests are logged by the application logger by default")
+	flags.StringVar(&accessFormat, "access-log-format", "", "format of access log lines: combined (default), common, json or a Go template")
+	flags.StringVar(&accessSampling, "access-log-sampling", "", "sampling rates of access log lines by status, e.g. 3xx=0.01,404=0.1")
+	flags.IntVar(&accessMaxSize, "access-log-max-size", 0, "size in megabytes after which the access log file is rotated, unlimited by default")
+	flags.StringVar(&accessRotate, "access-log-rotate", "", "period of access log file rotation, e.g. 24h, disabled by default")
+	flags.IntVar(&accessBackups, "access-log-backups", 0, "number of rotated access log files kept, all by default")
+	flags.StringVar(&accessMaxAge, "access-log-max-age", "", "max age of rotated access log files kept, e.g. 168h, unlimited by default")
 	flags.BoolVar(&enableHTTPS, "s", false, "enable HTTPS support")
 	flags.StringVar(&configFile, "c", "", "path to config file")
 	flags.StringVar(&configFile, "config", "", "path to config file")
-	flags.StringVar(&trustedSubnet, "t", "", "trusted subnet")
+	flags.StringVar(&trustedSubnet, "t", "", "comma separated CIDRs of clients allowed to access internal statistics and the admin listener")
+	flags.StringVar(&webhooksFile, "webhooks-file", "", "path to the JSON file webhook subscriptions are saved to, they are kept in memory by default")
+	flags.StringVar(&auditLog, "audit-log", "", "path to the append-only JSON lines file of the audit trail, the latest entries are kept in memory and lost on restart by default")
+	flags.StringVar(&outboxSink, "outbox", "", "URI of the sink link events recorded in the store outbox are published to, e.g. nats://localhost:4222?subject=shortener, kafka://localhost:9092/shortener or file:///tmp/outbox.jsonl")
+	flags.StringVar(&shutdownDelay, "shutdown-delay", "", "time between failing readiness and stopping servers on shutdown, so load balancers stop routing requests, 5s by default")
 	flags.StringVar(&grpcServerAddr, "g", ":3200", "address and port to run gRPC server")
 
 	err := flags.Parse(args)
@@ -67,12 +240,12 @@ func ParseFlags(progname string, args []string) (*ConfigFlags, error) {
 	if configFile != "" {
 		configData, err := os.ReadFile(configFile)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("reading config file: %w", err)
 		}
 
 		err = json.Unmarshal(configData, &parsedFlags)
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("parsing config file %s: %w", configFile, err)
 		}
 	}
 
@@ -88,11 +261,126 @@ func ParseFlags(progname string, args []string) (*ConfigFlags, error) {
 	updateIfNotEmpty(baseURL, os.Getenv("BASE_URL"), &parsedFlags.BaseURL)
 	updateIfNotEmpty(fileStoragePath, os.Getenv("FILE_STORAGE_PATH"), &parsedFlags.FileStoragePath)
 	updateIfNotEmpty(databaseDSN, os.Getenv("DATABASE_DSN"), &parsedFlags.DatabaseDSN)
+	updateIfNotEmpty(storageURI, os.Getenv("STORAGE_URI"), &parsedFlags.StorageURI)
+	updateIfNotEmpty(dedupMode, os.Getenv("DEDUP_MODE"), &parsedFlags.DedupMode)
+	updateIfNotEmpty(canonicalSteps, os.Getenv("CANONICAL_STEPS"), &parsedFlags.CanonicalSteps)
+	updateIfNotEmpty(trackingParams, os.Getenv("TRACKING_PARAMS"), &trackingParams)
+	if trackingParams != "" {
+		parsedFlags.TrackingParams = strings.Split(trackingParams, ",")
+	}
+	updateIfNotEmpty(allowedSchemes, os.Getenv("ALLOWED_SCHEMES"), &parsedFlags.AllowedSchemes)
+	updateIfNotEmpty(domainListFile, os.Getenv("DOMAIN_LIST_FILE"), &parsedFlags.DomainListFile)
+	updateIfNotEmpty(scanListFile, os.Getenv("SCAN_LIST_FILE"), &parsedFlags.ScanListFile)
+	updateIfNotEmpty(scanWebhookURL, os.Getenv("SCAN_WEBHOOK_URL"), &parsedFlags.ScanWebhookURL)
+	updateIfNotEmpty("", os.Getenv("SCAN_WEBHOOK_TOKEN"), &parsedFlags.ScanWebhookToken)
+	updateIfNotEmpty(rateLimit, os.Getenv("RATE_LIMIT"), &parsedFlags.RateLimit)
+	updateIfNotEmpty(rateLimitKey, os.Getenv("RATE_LIMIT_KEY"), &parsedFlags.RateLimitKey)
+	if apiKeys := os.Getenv("RATE_LIMIT_API_KEYS"); apiKeys != "" {
+		parsedFlags.RateLimitAPIKeys = strings.Split(apiKeys, ",")
+	}
+	updateIfNotEmpty(trustedProxies, os.Getenv("TRUSTED_PROXIES"), &parsedFlags.TrustedProxies)
+	updateIfNotEmpty(cacheTTL, os.Getenv("CACHE_TTL"), &parsedFlags.CacheTTL)
+	updateIfNotEmpty(shutdownDelay, os.Getenv("SHUTDOWN_DELAY"), &parsedFlags.ShutdownDelay)
+	updateIfNotEmpty("", os.Getenv("CACHE_NEGATIVE_TTL"), &parsedFlags.CacheNegativeTTL)
+	updateIfNotEmpty(redisURL, os.Getenv("REDIS_URL"), &parsedFlags.RedisURL)
+	updateIfNotEmpty(idAlphabet, os.Getenv("ID_ALPHABET"), &parsedFlags.IDAlphabet)
+	updateIfNotEmpty(idStrategy, os.Getenv("ID_STRATEGY"), &parsedFlags.IDStrategy)
+	updateIfNotEmpty("", os.Getenv("ID_SALT"), &parsedFlags.IDSalt)
+	updateIfNotEmpty(idBlocklist, os.Getenv("ID_BLOCKLIST"), &parsedFlags.IDBlocklist)
 	updateIfNotEmpty(trustedSubnet, os.Getenv("TRUSTED_SUBNET"), &parsedFlags.TrustedSubnet)
+	updateIfNotEmpty(adminAddress, os.Getenv("ADMIN_ADDRESS"), &parsedFlags.AdminAddress)
+	updateIfNotEmpty("", os.Getenv("ADMIN_TOKEN"), &parsedFlags.AdminToken)
+	updateIfNotEmpty(adminCert, os.Getenv("ADMIN_CERT"), &parsedFlags.AdminCert)
+	updateIfNotEmpty(adminKey, os.Getenv("ADMIN_KEY"), &parsedFlags.AdminKey)
+	updateIfNotEmpty(adminClientCA, os.Getenv("ADMIN_CLIENT_CA"), &parsedFlags.AdminClientCA)
+	updateIfNotEmpty(traceExporter, os.Getenv("TRACE_EXPORTER"), &parsedFlags.TraceExporter)
+	updateIfNotEmpty(traceEndpoint, os.Getenv("TRACE_ENDPOINT"), &parsedFlags.TraceEndpoint)
+	updateIfNotEmpty(logFormat, os.Getenv("LOG_FORMAT"), &parsedFlags.LogFormat)
+	updateIfNotEmpty(logLevel, os.Getenv("LOG_LEVEL"), &parsedFlags.LogLevel)
+	updateIfNotEmpty(accessLog, os.Getenv("ACCESS_LOG"), &parsedFlags.AccessLog)
+	updateIfNotEmpty(accessFormat, os.Getenv("ACCESS_LOG_FORMAT"), &parsedFlags.AccessLogFormat)
+	updateIfNotEmpty(accessSampling, os.Getenv("ACCESS_LOG_SAMPLING"), &parsedFlags.AccessLogSampling)
+	updateIfNotEmpty(accessRotate, os.Getenv("ACCESS_LOG_ROTATE"), &parsedFlags.AccessLogRotate)
+	updateIfNotEmpty(accessMaxAge, os.Getenv("ACCESS_LOG_MAX_AGE"), &parsedFlags.AccessLogMaxAge)
+	updateIfNotEmpty(webhooksFile, os.Getenv("WEBHOOKS_FILE"), &parsedFlags.WebhooksFile)
+	updateIfNotEmpty(outboxSink, os.Getenv("OUTBOX_SINK"), &parsedFlags.OutboxSink)
+	updateIfNotEmpty(auditLog, os.Getenv("AUDIT_LOG"), &parsedFlags.AuditLog)
 
 	if envEnableHTTPS := os.Getenv("ENABLE_HTTPS"); envEnableHTTPS != "" {
 		parsedFlags.EnableHTTPS = envEnableHTTPS == "true"
 	}
+	if envAllowPrivate := os.Getenv("ALLOW_PRIVATE_URLS"); envAllowPrivate != "" {
+		parsedFlags.AllowPrivateURLs = envAllowPrivate == "true"
+	}
+	if envResolveHosts := os.Getenv("RESOLVE_HOSTS"); envResolveHosts != "" {
+		parsedFlags.ResolveHosts = envResolveHosts == "true"
+	}
+
+	if scanSync {
+		parsedFlags.ScanSync = true
+	}
+	if envScanSync := os.Getenv("SCAN_SYNC"); envScanSync != "" {
+		parsedFlags.ScanSync = envScanSync == "true"
+	}
+	if redisCache {
+		parsedFlags.RedisCache = true
+	}
+	if envRedisCache := os.Getenv("REDIS_CACHE"); envRedisCache != "" {
+		parsedFlags.RedisCache = envRedisCache == "true"
+	}
+	if caseInsensitive {
+		parsedFlags.CaseInsensitive = true
+	}
+	if envCaseInsensitive := os.Getenv("CASE_INSENSITIVE"); envCaseInsensitive != "" {
+		parsedFlags.CaseInsensitive = envCaseInsensitive == "true"
+	}
+	if traceInsecure {
+		parsedFlags.TraceInsecure = true
+	}
+	if envTraceInsecure := os.Getenv("TRACE_INSECURE"); envTraceInsecure != "" {
+		parsedFlags.TraceInsecure = envTraceInsecure == "true"
+	}
+	if redisQueue {
+		parsedFlags.RedisDeleteQueue = true
+	}
+	if envRedisQueue := os.Getenv("REDIS_DELETE_QUEUE"); envRedisQueue != "" {
+		parsedFlags.RedisDeleteQueue = envRedisQueue == "true"
+	}
+
+	updateIntIfNotEmpty := func(value int, envName string, field *int) error {
+		if envValue := os.Getenv(envName); envValue != "" {
+			n, err := strconv.Atoi(envValue)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", envName, err)
+			}
+			*field = n
+		} else if value != 0 {
+			*field = value
+		}
+		return nil
+	}
+
+	intFields := []struct {
+		value   int
+		envName string
+		field   *int
+	}{
+		{0, "SCAN_WORKERS", &parsedFlags.ScanWorkers},
+		{quotaMaxLinks, "QUOTA_MAX_LINKS", &parsedFlags.QuotaMaxLinks},
+		{quotaMaxBatch, "QUOTA_MAX_BATCH", &parsedFlags.QuotaMaxBatch},
+		{quotaMaxPerDay, "QUOTA_MAX_PER_DAY", &parsedFlags.QuotaMaxPerDay},
+		{cacheSize, "CACHE_SIZE", &parsedFlags.CacheSize},
+		{idLength, "ID_LENGTH", &parsedFlags.IDLength},
+		{idNode, "ID_NODE", &parsedFlags.IDNode},
+		{idPoolSize, "ID_POOL_SIZE", &parsedFlags.IDPoolSize},
+		{accessMaxSize, "ACCESS_LOG_MAX_SIZE", &parsedFlags.AccessLogMaxSize},
+		{accessBackups, "ACCESS_LOG_BACKUPS", &parsedFlags.AccessLogBackups},
+	}
+	for _, f := range intFields {
+		if err := updateIntIfNotEmpty(f.value, f.envName, f.field); err != nil {
+			return nil, err
+		}
+	}
 
 	if parsedFlags.ServerAddress == "" {
 		parsedFlags.ServerAddress = "localhost:8080"
@@ -104,9 +392,127 @@ func ParseFlags(progname string, args []string) (*ConfigFlags, error) {
 	return &parsedFlags, nil
 }
 
-// App structure contains flags, store and URLchan.
+// GetStorageURI returns the storage URI. When it is not set explicitly,
+// the URI is built from DatabaseDSN or FileStoragePath, memory storage is used otherwise.
+func (f *ConfigFlags) GetStorageURI() string {
+	switch {
+	case f.StorageURI != "":
+		return f.StorageURI
+	case f.DatabaseDSN != "":
+		return postgresURI(f.DatabaseDSN)
+	case f.FileStoragePath != "":
+		return (&url.URL{Scheme: "file", Path: f.FileStoragePath}).String()
+	}
+
+	return "memory://"
+}
+
+// postgresURI returns the DSN as the storage URI. URLs are returned as is, while
+// lib/pq key=value DSNs like "host=localhost dbname=db" are converted to the
+// postgres URI carrying all the settings in the query, which lib/pq accepts.
+// Malformed DSNs are returned as is, so opening the store reports them.
+func postgresURI(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		return dsn
+	}
+
+	query := url.Values{}
+	for rest := strings.TrimSpace(dsn); rest != ""; rest = strings.TrimSpace(rest) {
+		key, value, ok := strings.Cut(rest, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t\n") {
+			return dsn
+		}
+		rest = strings.TrimLeft(value, " \t\n")
+
+		// Values are quoted to contain spaces, backslashes escape the next character.
+		var b strings.Builder
+		quoted := strings.HasPrefix(rest, "'")
+		i := 0
+		if quoted {
+			i = 1
+		}
+		for ; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				b.WriteByte(rest[i])
+				continue
+			}
+			if quoted && c == '\'' || !quoted && strings.IndexByte(" \t\n", c) >= 0 {
+				break
+			}
+			b.WriteByte(c)
+		}
+		if quoted {
+			if i == len(rest) {
+				return dsn
+			}
+			i++
+		}
+		rest = rest[i:]
+		query.Set(key, b.String())
+	}
+
+	return (&url.URL{Scheme: "postgres", Path: "/", RawQuery: query.Encode()}).String()
+}
+
+// App structure contains flags, store, URLchan and URL processing dependencies.
 type App struct {
-	Flags   *ConfigFlags
-	Store   storeInterface.Store
-	URLChan chan storeInterface.DeletedURLs
+	Flags         *ConfigFlags
+	Store         storeInterface.Store
+	URLChan       chan storeInterface.DeletedURLs
+	DeleteQueue   storeInterface.DeletionQueue
+	Canonicalizer *canonical.Canonicalizer
+	Policy        *policy.Engine
+	Scanner       *scanner.Service
+	Limiter       *ratelimit.Limiter
+	Quota         *quota.Manager
+	Clicks        *clicks.Counter
+	Events        *events.Bus
+	Webhooks      *webhooks.Service
+	Outbox        *outbox.Relay
+	Audit         *audit.Log
+	Generator     generator.Strategy
+	Metrics       *metrics.Metrics
+	Tracing       *tracing.Tracing
+	Logger        *zap.Logger
+	AccessLog     *logging.AccessLog
+	Health        *health.Checker
+	ClientIP      *clientip.Resolver
+	// Trusted are subnets of clients allowed to get internal statistics.
+	Trusted clientip.Subnets
+}
+
+// Log returns the application logger, or the global logger when it is not set.
+func (app *App) Log() *zap.Logger {
+	if app.Logger == nil {
+		return zap.L()
+	}
+
+	return app.Logger
+}
+
+// DeletionBacklog returns the number of deletion requests waiting to be applied,
+// in the shared deletion queue if it is configured.
+func (app *App) DeletionBacklog(ctx context.Context) (int, error) {
+	if queue, ok := app.DeleteQueue.(interface {
+		Len(ctx context.Context) (int, error)
+	}); ok {
+		return queue.Len(ctx)
+	}
+
+	return len(app.URLChan), nil
+}
+
+// InternalStats returns statistics of the store along with the deletion backlog.
+func (app *App) InternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	stats, err := app.Store.GetInternalStats(ctx, opts)
+	if err != nil {
+		return models.InternalStats{}, err
+	}
+
+	stats.QueueBacklog, err = app.DeletionBacklog(ctx)
+
+	return stats, err
 }
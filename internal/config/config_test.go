@@ -2,9 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseFlags_Args(t *testing.T) {
@@ -19,6 +22,21 @@ func TestParseFlags_Args(t *testing.T) {
 	assert.Equal(t, true, flags.EnableHTTPS, "EnableHTTPS not parsed correctly")
 }
 
+func TestParseFlags_TrackingParams(t *testing.T) {
+	os.Clearenv()
+
+	flags, err := ParseFlags(os.Args[0], []string{"-tracking-params", "ref,utm_*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ref", "utm_*"}, flags.TrackingParams)
+
+	os.Setenv("TRACKING_PARAMS", "src")
+	defer os.Unsetenv("TRACKING_PARAMS")
+
+	flags, err = ParseFlags(os.Args[0], []string{"-tracking-params", "ref,utm_*"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"src"}, flags.TrackingParams, "environment takes precedence")
+}
+
 func TestParseFlags_JSON(t *testing.T) {
 	os.Clearenv()
 
@@ -69,3 +87,45 @@ func TestParseFlags_ENV(t *testing.T) {
 	assert.Equal(t, "env_database_dsn", flags.DatabaseDSN, "DatabaseDSN not parsed correctly")
 	assert.Equal(t, true, flags.EnableHTTPS, "EnableHTTPS not parsed correctly")
 }
+
+func TestPostgresURI(t *testing.T) {
+	dsn := `host=localhost port=5433 user=app password='it\'s secret' dbname=db sslmode=disable`
+	parsed, err := pq.ParseURL(postgresURI(dsn))
+	require.NoError(t, err)
+	assert.Equal(t, `dbname='db' host='localhost' password='it\'s secret' port='5433' sslmode='disable' user='app'`, parsed,
+		"lib/pq gets the same settings")
+}
+
+func TestGetStorageURI(t *testing.T) {
+	testCases := []struct {
+		name     string
+		flags    ConfigFlags
+		expected string
+	}{
+		{name: "default", flags: ConfigFlags{}, expected: "memory://"},
+		{name: "file", flags: ConfigFlags{FileStoragePath: "/tmp/short-url-db.json"}, expected: "file:///tmp/short-url-db.json"},
+		{name: "database", flags: ConfigFlags{FileStoragePath: "/tmp/db.json", DatabaseDSN: "postgres://localhost/db"}, expected: "postgres://localhost/db"},
+		{name: "storage URI", flags: ConfigFlags{DatabaseDSN: "postgres://localhost/db", StorageURI: "memory://"}, expected: "memory://"},
+		{name: "key-value DSN", flags: ConfigFlags{DatabaseDSN: "host=localhost user=app dbname=db"}, expected: "postgres:///?dbname=db&host=localhost&user=app"},
+		{name: "quoted DSN", flags: ConfigFlags{DatabaseDSN: ` host = /var/run/postgresql password='it\'s secret' sslmode=disable`}, expected: "postgres:///?host=%2Fvar%2Frun%2Fpostgresql&password=it%27s+secret&sslmode=disable"},
+		{name: "malformed DSN", flags: ConfigFlags{DatabaseDSN: "host=localhost password='secret"}, expected: "host=localhost password='secret"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.flags.GetStorageURI())
+		})
+	}
+}
+
+func TestParseFlags_InvalidConfigFile(t *testing.T) {
+	os.Clearenv()
+
+	_, err := ParseFlags(os.Args[0], []string{"-c", filepath.Join(t.TempDir(), "missing.json")})
+	assert.Error(t, err, "missing config file is reported")
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(configFile, []byte("{"), 0644))
+	_, err = ParseFlags(os.Args[0], []string{"-c", configFile})
+	assert.ErrorContains(t, err, configFile, "malformed config file is reported")
+}
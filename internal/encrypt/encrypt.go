@@ -14,20 +14,19 @@ type Encrypt struct {
 }
 
 // Get is a helping function returns the specified 128-bit block cipher.
+// Errors are returned to callers, which log them with the request logger.
 func Get() (Encrypt, error) {
 	password := "SECRET_PASSWORD"
 	key := sha256.Sum256([]byte(password))
 
 	aesblock, err := aes.NewCipher(key[:])
 	if err != nil {
-		fmt.Printf("aes.NewCipher error: %v\n", err)
-		return Encrypt{}, err
+		return Encrypt{}, fmt.Errorf("aes.NewCipher: %w", err)
 	}
 
 	aesgcm, err := cipher.NewGCM(aesblock)
 	if err != nil {
-		fmt.Printf("cipher.NewGCM error: %v\n", err)
-		return Encrypt{}, err
+		return Encrypt{}, fmt.Errorf("cipher.NewGCM: %w", err)
 	}
 
 	nonce := key[len(key)-aesgcm.NonceSize():]
@@ -0,0 +1,262 @@
+// Package events is an in-process bus of link events: creation, deletion and
+// redirects.
+//
+// Publishers never block. Every subscription has a bounded buffer, events not
+// fitting into it are dropped, and the subscriber is told how many events it
+// missed by an event of TypeDropped delivered before the next one.
+package events
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is a type of events.
+type Type string
+
+// Types of events.
+const (
+	TypeCreated  Type = "created"
+	TypeDeleted  Type = "deleted"
+	TypeRedirect Type = "redirect"
+	// TypeDropped reports events dropped because the subscriber was too slow.
+	TypeDropped Type = "dropped"
+)
+
+// DefaultBuffer is the default number of events buffered for a subscriber.
+const DefaultBuffer = 64
+
+// Event is an event of a link.
+type Event struct {
+	ID       uint64    `json:"id"`
+	Type     Type      `json:"type"`
+	Short    string    `json:"short,omitempty"`
+	Original string    `json:"original,omitempty"`
+	Dropped  uint64    `json:"dropped,omitempty"`
+	Time     time.Time `json:"time"`
+	// UserID is the owner of the link, if it is known by the publisher.
+	UserID string `json:"-"`
+}
+
+// Filter selects events delivered to a subscription.
+type Filter func(e Event) bool
+
+// And returns the filter passing events passed by all filters, which are called in order.
+func And(filters ...Filter) Filter {
+	return func(e Event) bool {
+		for _, filter := range filters {
+			if !filter(e) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// ParseTypes returns the comma separated types of events, nil if the list is empty.
+func ParseTypes(list string) ([]Type, error) {
+	var types []Type
+	for _, name := range strings.Split(list, ",") {
+		t := Type(strings.TrimSpace(name))
+		switch t {
+		case "":
+		case TypeCreated, TypeDeleted, TypeRedirect:
+			types = append(types, t)
+		default:
+			return nil, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+
+	return types, nil
+}
+
+// ForUser returns the filter of events of the user's links. Publishers set owners of
+// links in events, so redirects to any of the user's links pass.
+func ForUser(userID string) Filter {
+	return func(e Event) bool {
+		return e.UserID == userID
+	}
+}
+
+// Bus delivers published events to subscribers. Nil Bus drops all events.
+type Bus struct {
+	buffer int
+
+	mu     sync.Mutex
+	lastID uint64
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBus returns Bus buffering up to buffer events per subscriber, DefaultBuffer by default.
+func NewBus(buffer int) *Bus {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+
+	return &Bus{buffer: buffer, subs: make(map[*Subscription]struct{})}
+}
+
+// Publish delivers the event to subscribers whose filters pass it. The event is numbered
+// and timestamped by the bus, so subscribers receive events in the order of their IDs.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	for sub := range b.subs {
+		if sub.receives(e.Type) && (sub.filter == nil || sub.filter(e)) {
+			sub.deliver(e)
+		}
+	}
+}
+
+// Watched reports whether any subscription receives events of the type, so publishers
+// can skip preparing events nobody receives.
+func (b *Bus) Watched(t Type) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.receives(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Subscribe returns the subscription to events of the types passed by the filter, nil filter
+// passes all events and no types mean all types. The filter isn't called for events of other
+// types. The subscription must be closed when it is not needed anymore. Subscriptions to nil
+// or closed Bus receive no events.
+func (b *Bus) Subscribe(filter Filter, types ...Type) *Subscription {
+	if b == nil {
+		sub := &Subscription{events: make(chan Event)}
+		close(sub.events)
+		return sub
+	}
+
+	sub := &Subscription{
+		bus:    b,
+		filter: filter,
+		events: make(chan Event, b.buffer),
+	}
+	if len(types) > 0 {
+		sub.types = make(map[Type]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.events)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Close closes all subscriptions, so subscribers stop waiting for events, e.g. on shutdown.
+func (b *Bus) Close() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Subscribers returns the number of subscriptions.
+func (b *Bus) Subscribers() int {
+	if b == nil {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
+
+// Subscription receives events of the bus.
+type Subscription struct {
+	bus    *Bus
+	filter Filter
+	// types are types of received events, nil for all types.
+	types  map[Type]bool
+	events chan Event
+	// dropped is guarded by the lock of the bus.
+	dropped uint64
+}
+
+// Events returns the channel of events, which is closed along with the subscription.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close unsubscribes from the bus.
+func (s *Subscription) Close() {
+	if s.bus == nil {
+		return
+	}
+
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subs[s]; ok {
+		delete(s.bus.subs, s)
+		close(s.events)
+	}
+}
+
+// receives reports whether the subscription receives events of the type.
+func (s *Subscription) receives(t Type) bool {
+	return s.types == nil || s.types[t]
+}
+
+// deliver sends the event without blocking, preceded by the number of dropped events if any.
+// It is called with the lock of the bus held, so the channel is not closed meanwhile.
+func (s *Subscription) deliver(e Event) {
+	if s.dropped > 0 {
+		select {
+		case s.events <- Event{Type: TypeDropped, Dropped: s.dropped, Time: e.Time}:
+			s.dropped = 0
+		default:
+			s.dropped++
+			return
+		}
+	}
+
+	select {
+	case s.events <- e:
+	default:
+		s.dropped++
+	}
+}
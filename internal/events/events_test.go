@@ -0,0 +1,146 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receive returns events buffered for the subscription.
+func receive(sub *Subscription) []Event {
+	var result []Event
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return result
+			}
+			result = append(result, e)
+		default:
+			return result
+		}
+	}
+}
+
+func types(events []Event) []Type {
+	result := make([]Type, 0, len(events))
+	for _, e := range events {
+		result = append(result, e.Type)
+	}
+
+	return result
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus(0)
+	all := bus.Subscribe(nil)
+	defer all.Close()
+
+	created, err := ParseTypes("created")
+	require.NoError(t, err)
+	onlyCreated := bus.Subscribe(func(e Event) bool {
+		assert.Equal(t, TypeCreated, e.Type, "the filter is called for subscribed types only")
+		return true
+	}, created...)
+	defer onlyCreated.Close()
+
+	bus.Publish(Event{Type: TypeCreated, Short: "a"})
+	bus.Publish(Event{Type: TypeRedirect, Short: "a"})
+
+	events := receive(all)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(1), events[0].ID)
+	assert.Equal(t, uint64(2), events[1].ID)
+	assert.False(t, events[0].Time.IsZero())
+
+	assert.Equal(t, []Type{TypeCreated}, types(receive(onlyCreated)))
+
+	all.Close()
+	assert.True(t, bus.Watched(TypeCreated))
+	assert.False(t, bus.Watched(TypeRedirect), "no subscription receives redirects")
+
+	onlyCreated.Close()
+	onlyCreated.Close()
+	assert.Equal(t, 0, bus.Subscribers())
+	all = bus.Subscribe(nil)
+
+	bus.Close()
+	_, ok := <-all.Events()
+	assert.False(t, ok, "subscriptions are closed with the bus")
+
+	late := bus.Subscribe(nil)
+	_, ok = <-late.Events()
+	assert.False(t, ok)
+	bus.Publish(Event{Type: TypeCreated})
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	bus := NewBus(2)
+	sub := bus.Subscribe(nil)
+	defer sub.Close()
+
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Type: TypeRedirect})
+	}
+
+	events := receive(sub)
+	assert.Equal(t, []uint64{1, 2}, []uint64{events[0].ID, events[1].ID}, "publisher doesn't block")
+
+	bus.Publish(Event{Type: TypeCreated})
+	events = receive(sub)
+	require.Len(t, events, 2)
+	assert.Equal(t, Event{Type: TypeDropped, Dropped: 3, Time: events[0].Time}, events[0])
+	assert.Equal(t, uint64(6), events[1].ID)
+
+	bus.Publish(Event{Type: TypeRedirect})
+	bus.Publish(Event{Type: TypeRedirect})
+	bus.Publish(Event{Type: TypeRedirect})
+	events = receive(sub)
+	assert.Equal(t, []Type{TypeRedirect, TypeRedirect}, types(events))
+
+	bus.Publish(Event{Type: TypeRedirect})
+	events = receive(sub)
+	assert.Equal(t, []Type{TypeDropped, TypeRedirect}, types(events))
+	assert.Equal(t, uint64(1), events[0].Dropped)
+}
+
+func TestForUser(t *testing.T) {
+	filter := ForUser("user1")
+
+	assert.True(t, filter(Event{Type: TypeRedirect, Short: "a", UserID: "user1"}))
+	assert.False(t, filter(Event{Type: TypeRedirect, Short: "a"}), "redirects without owners don't pass")
+	assert.False(t, filter(Event{Type: TypeCreated, Short: "b", UserID: "user2"}))
+	assert.True(t, filter(Event{Type: TypeDeleted, Short: "a", UserID: "user1"}))
+}
+
+func TestParseTypes(t *testing.T) {
+	types, err := ParseTypes("")
+	require.NoError(t, err)
+	assert.Nil(t, types)
+
+	types, err = ParseTypes("created, deleted")
+	require.NoError(t, err)
+	assert.Equal(t, []Type{TypeCreated, TypeDeleted}, types)
+
+	_, err = ParseTypes("created,clicked")
+	assert.Error(t, err)
+
+	both := And(func(e Event) bool { return e.Type == TypeCreated }, func(e Event) bool { return e.Short == "a" })
+	assert.True(t, both(Event{Type: TypeCreated, Short: "a"}))
+	assert.False(t, both(Event{Type: TypeCreated, Short: "b"}))
+	assert.False(t, both(Event{Type: TypeDeleted, Short: "a"}))
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+
+	bus.Publish(Event{Type: TypeCreated})
+	sub := bus.Subscribe(nil)
+	_, ok := <-sub.Events()
+	assert.False(t, ok)
+	sub.Close()
+	bus.Close()
+	assert.Equal(t, 0, bus.Subscribers())
+	assert.False(t, bus.Watched(TypeCreated))
+}
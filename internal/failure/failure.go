@@ -7,3 +7,36 @@ var ErrConflict = errors.New("data conflict")
 
 // ErrEmptyOrigURL for empty original URL case
 var ErrEmptyOrigURL = errors.New("original URL cannot be empty")
+
+// ErrNotFound for case when short URL doesn't exist
+var ErrNotFound = errors.New("value doesn't exist")
+
+// ErrURLDeleted for case when short URL was deleted by owner
+var ErrURLDeleted = errors.New("URL is deleted")
+
+// ErrInvalidURL for case when original URL cannot be parsed or canonicalized
+var ErrInvalidURL = errors.New("invalid URL")
+
+// ErrForbiddenURL for case when original URL violates destination URL policy
+var ErrForbiddenURL = errors.New("URL is forbidden by policy")
+
+// ErrMaliciousURL for case when original URL is recognized as malicious by scanners
+var ErrMaliciousURL = errors.New("URL is recognized as malicious")
+
+// ErrURLFlagged for case when short URL is flagged as suspicious, the original URL is still returned
+var ErrURLFlagged = errors.New("URL is flagged as suspicious")
+
+// ErrURLBlocked for case when short URL is blocked as malicious
+var ErrURLBlocked = errors.New("URL is blocked")
+
+// ErrQuotaExceeded for case when user exceeded the quota of links
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ErrShortExists for case when generated short URL is already taken by another original URL
+var ErrShortExists = errors.New("short URL already exists")
+
+// ErrInvalidEventType for case when unknown types of events are requested
+var ErrInvalidEventType = errors.New("invalid event type")
+
+// ErrInvalidWebhook for case when webhook subscription is invalid
+var ErrInvalidWebhook = errors.New("invalid webhook")
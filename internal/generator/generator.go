@@ -1,12 +1,84 @@
 package generator
 
 import (
+	"context"
+	"crypto/rand"
 	"errors"
-	"math/rand"
+	"fmt"
+	"io"
+	"strings"
 )
 
 const urlAlphabet = "useandom-26T198340PX75pxJACKVERYMINDBUSHWOLF_GQZbfghjklqvwyzrict"
-const maxLen = len(urlAlphabet)
+
+// DefaultLength is a length of short IDs used by default.
+const DefaultLength = 10
+
+// unreserved contains characters allowed in URL paths without escaping.
+const unreserved = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~"
+
+// Options configures Generator.
+type Options struct {
+	// Length of IDs, DefaultLength by default.
+	Length int
+	// Alphabet of IDs, URL-safe latin letters, numbers, dash and underscore by default.
+	Alphabet string
+}
+
+// Generator is the random strategy, it returns random IDs of the configured length and alphabet.
+type Generator struct {
+	length   int
+	alphabet string
+	rand     io.Reader
+}
+
+// New returns Generator configured by opts. The alphabet must consist of 2 to 256
+// unique characters allowed in URL paths without escaping.
+func New(opts Options) (*Generator, error) {
+	if opts.Length == 0 {
+		opts.Length = DefaultLength
+	}
+	if opts.Alphabet == "" {
+		opts.Alphabet = urlAlphabet
+	}
+
+	if opts.Length < 1 {
+		return nil, fmt.Errorf("ID length must be positive, got %d", opts.Length)
+	}
+	if err := validateAlphabet(opts.Alphabet); err != nil {
+		return nil, err
+	}
+
+	return &Generator{length: opts.Length, alphabet: opts.Alphabet, rand: rand.Reader}, nil
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 || len(alphabet) > 256 {
+		return fmt.Errorf("ID alphabet must contain from 2 to 256 characters, got %d", len(alphabet))
+	}
+
+	seen := make(map[rune]bool, len(alphabet))
+	for _, c := range alphabet {
+		if !strings.ContainsRune(unreserved, c) {
+			return fmt.Errorf("ID alphabet contains %q, which is not allowed in URLs", c)
+		}
+		if seen[c] {
+			return fmt.Errorf("ID alphabet contains %q twice", c)
+		}
+		seen[c] = true
+	}
+
+	return nil
+}
+
+// Generate returns a new random ID. Nil Generator uses the default options.
+func (g *Generator) Generate(context.Context) (string, error) {
+	if g == nil {
+		return GetRandomStr(DefaultLength)
+	}
+
+	return randomString(g.rand, g.alphabet, g.length)
+}
 
 // GetRandomStr return random string particular size.
 // Contains latin letters, numbers and dash.
@@ -15,11 +87,35 @@ func GetRandomStr(size int) (string, error) {
 		return "", errors.New("size must be positive int")
 	}
 
-	var result string
+	return randomString(rand.Reader, urlAlphabet, size)
+}
+
+// randomString returns a string of size characters picked uniformly from the alphabet.
+// Random bytes are masked to the nearest power of two and rejected when they
+// fall out of the alphabet, so every character is equally likely.
+func randomString(r io.Reader, alphabet string, size int) (string, error) {
+	mask := byte(1)
+	for int(mask) < len(alphabet)-1 {
+		mask = mask<<1 | 1
+	}
+
+	result := make([]byte, 0, size)
+	buf := make([]byte, size*2)
+
+	for len(result) < size {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
 
-	for i := 0; i < size; i++ {
-		result += string(urlAlphabet[rand.Intn(maxLen)])
+		for _, b := range buf {
+			if idx := int(b & mask); idx < len(alphabet) {
+				result = append(result, alphabet[idx])
+				if len(result) == size {
+					break
+				}
+			}
+		}
 	}
 
-	return result, nil
+	return string(result), nil
 }
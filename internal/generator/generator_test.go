@@ -1,7 +1,9 @@
 package generator
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -31,3 +33,76 @@ func TestGetRandomStr(t *testing.T) {
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "Defaults", opts: Options{}},
+		{name: "Custom", opts: Options{Length: 6, Alphabet: "abc123"}},
+		{name: "Negative length", opts: Options{Length: -1}, wantErr: true},
+		{name: "Short alphabet", opts: Options{Alphabet: "a"}, wantErr: true},
+		{name: "Duplicate characters", opts: Options{Alphabet: "abca"}, wantErr: true},
+		{name: "Unsafe characters", opts: Options{Alphabet: "ab/c"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := New(test.opts)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for %+v", test.opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			id, err := g.Generate(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			length, alphabet := test.opts.Length, test.opts.Alphabet
+			if length == 0 {
+				length = DefaultLength
+			}
+			if alphabet == "" {
+				alphabet = urlAlphabet
+			}
+			if len(id) != length || strings.Trim(id, alphabet) != "" {
+				t.Errorf("Expected %d characters of %q, but got: %s", length, alphabet, id)
+			}
+		})
+	}
+}
+
+func TestGenerateDistribution(t *testing.T) {
+	g, err := New(Options{Length: 10000, Alphabet: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := g.Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range "abc" {
+		if n := strings.Count(id, string(c)); n < 3000 || n > 3700 {
+			t.Errorf("Expected about a third of characters to be %q, but got %d of 10000", c, n)
+		}
+	}
+}
+
+func TestGenerateNil(t *testing.T) {
+	var g *Generator
+
+	id, err := g.Generate(context.Background())
+	if err != nil || len(id) != DefaultLength {
+		t.Errorf("Expected ID of default length, but got: %q, %v", id, err)
+	}
+}
@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"context"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"go.uber.org/zap"
+)
+
+// Checker reports whether the ID is free, e.g. by looking it up in the store.
+type Checker func(ctx context.Context, id string) (bool, error)
+
+// Pool is the strategy handing out IDs generated in advance by the source strategy.
+// Run replenishes the pool in the background, so the IDs can be checked
+// against the store before they are requested.
+type Pool struct {
+	ids    chan string
+	source Strategy
+	check  Checker
+}
+
+// NewPool returns Pool holding up to size IDs of the source strategy.
+// Nil check accepts every generated ID.
+func NewPool(source Strategy, size int, check Checker) *Pool {
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &Pool{ids: make(chan string, size), source: source, check: check}
+}
+
+// Generate returns an ID from the pool. When the pool is empty, the ID is taken from the source directly.
+func (p *Pool) Generate(ctx context.Context) (string, error) {
+	select {
+	case id := <-p.ids:
+		return id, nil
+	default:
+		return p.source.Generate(ctx)
+	}
+}
+
+// Len returns the number of IDs in the pool.
+func (p *Pool) Len() int {
+	return len(p.ids)
+}
+
+// Run fills the pool until the context is done. Nil Pool returns immediately.
+func (p *Pool) Run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+
+	for {
+		id, err := p.take(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.FromContext(ctx).Error("ID pool: cannot generate ID", zap.Error(err))
+			if sleep(ctx, time.Second) != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case p.ids <- id:
+		}
+	}
+}
+
+// take returns a new ID of the source, which is free according to the checker.
+func (p *Pool) take(ctx context.Context) (string, error) {
+	for {
+		id, err := p.source.Generate(ctx)
+		if err != nil {
+			return "", err
+		}
+		if p.check == nil {
+			return id, nil
+		}
+
+		free, err := p.check(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		if free {
+			return id, nil
+		}
+	}
+}
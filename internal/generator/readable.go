@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Alphabets selectable by name instead of listing characters.
+const (
+	// ReadableAlphabet contains no characters that are easy to confuse, like 0 and O or 1, l and I.
+	ReadableAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz"
+	// LowerAlphabet is a readable alphabet of a single case, suitable for case-insensitive lookup.
+	LowerAlphabet = "23456789abcdefghijkmnpqrstuvwxyz"
+)
+
+var namedAlphabets = map[string]string{
+	"url":      urlAlphabet,
+	"readable": ReadableAlphabet,
+	"lower":    LowerAlphabet,
+}
+
+// Alphabet returns the alphabet by its name: url, readable or lower.
+// Other values are returned as is, so characters can be listed explicitly.
+func Alphabet(nameOrChars string) string {
+	if alphabet, ok := namedAlphabets[nameOrChars]; ok {
+		return alphabet
+	}
+
+	return nameOrChars
+}
+
+var adjectives = []string{
+	"able", "amber", "bold", "brave", "bright", "calm", "clever", "cosy",
+	"crisp", "curly", "eager", "early", "fair", "fancy", "fast", "fluffy",
+	"fresh", "gentle", "glad", "golden", "grand", "green", "happy", "honest",
+	"jolly", "keen", "kind", "lively", "lucky", "merry", "mighty", "neat",
+	"noble", "polite", "proud", "quick", "quiet", "rapid", "rosy", "royal",
+	"shiny", "silver", "smart", "snowy", "solid", "sunny", "swift", "tidy",
+	"vivid", "warm", "wise", "witty", "young", "zesty",
+}
+
+var nouns = []string{
+	"badger", "bear", "beaver", "bison", "crane", "deer", "dolphin", "eagle",
+	"falcon", "ferret", "finch", "fox", "gecko", "heron", "horse", "koala",
+	"lemur", "lion", "llama", "lynx", "marten", "moose", "newt", "otter",
+	"owl", "panda", "parrot", "pelican", "penguin", "puffin", "rabbit", "raven",
+	"robin", "salmon", "seal", "shark", "sparrow", "squid", "swan", "tiger",
+	"toucan", "trout", "turtle", "walrus", "whale", "wolf", "wombat", "zebra",
+}
+
+// Words is the strategy of codes made of words and a number, like brave-otter-42.
+// Codes are lower-case, so they suit case-insensitive lookup.
+type Words struct {
+	max *big.Int
+}
+
+// NewWords returns Words appending numbers from 0 to max-1, 100 by default.
+// Zero or negative max disables numbers.
+func NewWords(max int) *Words {
+	if max == 0 {
+		max = 100
+	}
+	if max < 0 {
+		return &Words{}
+	}
+
+	return &Words{max: big.NewInt(int64(max))}
+}
+
+// Generate returns a random code.
+func (w *Words) Generate(context.Context) (string, error) {
+	adjective, err := pick(adjectives)
+	if err != nil {
+		return "", err
+	}
+	noun, err := pick(nouns)
+	if err != nil {
+		return "", err
+	}
+
+	code := adjective + "-" + noun
+	if w.max == nil {
+		return code, nil
+	}
+
+	n, err := rand.Int(rand.Reader, w.max)
+	if err != nil {
+		return "", err
+	}
+
+	return code + "-" + strconv.FormatInt(n.Int64(), 10), nil
+}
+
+func pick(words []string) (string, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+	if err != nil {
+		return "", err
+	}
+
+	return words[i.Int64()], nil
+}
+
+// maxFilterAttempts limits the number of IDs rejected by Filter in a row.
+const maxFilterAttempts = 100
+
+// Filter is the strategy rejecting IDs of another strategy that contain blocked words.
+type Filter struct {
+	source  Strategy
+	blocked []string
+}
+
+// NewFilter returns Filter of the source strategy, DefaultBlocklist is used when blocked is empty.
+// Words are matched case-insensitively, digits resembling letters are matched as the letters.
+func NewFilter(source Strategy, blocked []string) *Filter {
+	if len(blocked) == 0 {
+		blocked = DefaultBlocklist
+	}
+
+	words := make([]string, 0, len(blocked))
+	for _, word := range blocked {
+		if word = normalize(strings.TrimSpace(word)); word != "" {
+			words = append(words, word)
+		}
+	}
+
+	return &Filter{source: source, blocked: words}
+}
+
+// Generate returns the first ID of the source that contains no blocked words.
+func (f *Filter) Generate(ctx context.Context) (string, error) {
+	for i := 0; i < maxFilterAttempts; i++ {
+		id, err := f.source.Generate(ctx)
+		if err != nil {
+			return "", err
+		}
+		if !f.Blocked(id) {
+			return id, nil
+		}
+	}
+
+	return "", fmt.Errorf("no acceptable ID in %d attempts", maxFilterAttempts)
+}
+
+// Blocked reports whether the ID contains a blocked word.
+func (f *Filter) Blocked(id string) bool {
+	id = normalize(id)
+	for _, word := range f.blocked {
+		if strings.Contains(id, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookalikes maps characters to letters they are read as, separators are dropped.
+var lookalikes = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b",
+	"-", "", "_", "", ".", "", "~", "",
+)
+
+func normalize(s string) string {
+	return lookalikes.Replace(strings.ToLower(s))
+}
+
+// LoadBlocklist reads blocked words from the file, one per line.
+// Empty lines and lines starting with # are skipped.
+func LoadBlocklist(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+
+	return words, nil
+}
+
+// DefaultBlocklist contains common offensive words filtered when no blocklist is configured.
+var DefaultBlocklist = []string{
+	"anal", "anus", "arse", "bitch", "boob", "butt", "cock", "crap", "cum",
+	"cunt", "damn", "dick", "dildo", "fag", "fuck", "homo", "jizz", "kkk",
+	"nazi", "nigg", "penis", "piss", "porn", "pussy", "rape", "sex", "shit",
+	"slut", "tits", "twat", "vagina", "wank", "whore",
+}
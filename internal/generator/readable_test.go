@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAlphabet(t *testing.T) {
+	if got := Alphabet("readable"); got != ReadableAlphabet {
+		t.Errorf("Expected readable alphabet, but got: %q", got)
+	}
+	if got := Alphabet("abc"); got != "abc" {
+		t.Errorf("Expected characters to be returned as is, but got: %q", got)
+	}
+
+	for _, name := range []string{"url", "readable", "lower"} {
+		if err := validateAlphabet(Alphabet(name)); err != nil {
+			t.Errorf("Alphabet %s: %v", name, err)
+		}
+	}
+	for _, ambiguous := range "01lIO" {
+		if strings.ContainsRune(ReadableAlphabet, ambiguous) || strings.ContainsRune(LowerAlphabet, ambiguous) {
+			t.Errorf("Expected readable alphabets not to contain %q", ambiguous)
+		}
+	}
+	if strings.ToLower(LowerAlphabet) != LowerAlphabet {
+		t.Errorf("Expected lower alphabet to be lower-case")
+	}
+}
+
+func TestWords(t *testing.T) {
+	code := regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]{1,2}$`)
+	w := NewWords(0)
+	for i := 0; i < 100; i++ {
+		id, err := w.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !code.MatchString(id) {
+			t.Fatalf("Expected code like brave-otter-42, but got: %q", id)
+		}
+	}
+
+	id, err := NewWords(-1).Generate(context.Background())
+	if err != nil || strings.Count(id, "-") != 1 {
+		t.Errorf("Expected code without number, but got: %q, %v", id, err)
+	}
+}
+
+type fixedStrategy []string
+
+func (f *fixedStrategy) Generate(context.Context) (string, error) {
+	id := (*f)[0]
+	if len(*f) > 1 {
+		*f = (*f)[1:]
+	}
+
+	return id, nil
+}
+
+func TestFilter(t *testing.T) {
+	f := NewFilter(&fixedStrategy{"xxBadWordxx", "b4d-w0rd", "fine"}, []string{"badword", " "})
+
+	if !f.Blocked("xxBADWORDxx") || !f.Blocked("b4d_w0rd") {
+		t.Errorf("Expected words to be matched case-insensitively with lookalikes")
+	}
+
+	id, err := f.Generate(context.Background())
+	if err != nil || id != "fine" {
+		t.Errorf("Expected blocked IDs to be skipped, but got: %q, %v", id, err)
+	}
+
+	stuck := NewFilter(&fixedStrategy{"badword"}, []string{"badword"})
+	if _, err := stuck.Generate(context.Background()); err == nil {
+		t.Errorf("Expected an error when every ID is blocked")
+	}
+
+	if !NewFilter(&fixedStrategy{"x"}, nil).Blocked("aSh1tb") {
+		t.Errorf("Expected the default blocklist to be used")
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# offensive words\nfoo\n\n  bar \n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	words, err := LoadBlocklist(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(words, ",") != "foo,bar" {
+		t.Errorf("Expected foo and bar, but got: %q", words)
+	}
+
+	if _, err := LoadBlocklist(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Expected an error for missing file")
+	}
+}
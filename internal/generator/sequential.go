@@ -0,0 +1,174 @@
+package generator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Counter returns increasing numbers, e.g. from a database sequence.
+type Counter interface {
+	Next(ctx context.Context) (uint64, error)
+}
+
+// CounterFunc is an adapter allowing to use functions as Counter.
+type CounterFunc func(ctx context.Context) (uint64, error)
+
+// Next calls f.
+func (f CounterFunc) Next(ctx context.Context) (uint64, error) {
+	return f(ctx)
+}
+
+// LocalCounter is a Counter kept in memory.
+type LocalCounter struct {
+	n atomic.Uint64
+}
+
+// NewLocalCounter returns LocalCounter returning numbers after start.
+func NewLocalCounter(start uint64) *LocalCounter {
+	c := &LocalCounter{}
+	c.n.Store(start)
+
+	return c
+}
+
+// Next returns the next number.
+func (c *LocalCounter) Next(context.Context) (uint64, error) {
+	return c.n.Add(1), nil
+}
+
+// Obfuscator reversibly encodes numbers, so consecutive numbers don't look consecutive.
+//
+// The alphabet is shuffled by the salt. The first character of the code selects
+// the rotation of the alphabet used to encode the rest, so neighbouring numbers
+// use different digits. Small numbers produce short codes.
+type Obfuscator struct {
+	alphabet  string
+	minLength int
+}
+
+// NewObfuscator returns Obfuscator using the alphabet shuffled by salt.
+// Codes are padded to minLength characters.
+func NewObfuscator(alphabet, salt string, minLength int) (*Obfuscator, error) {
+	if alphabet == "" {
+		alphabet = urlAlphabet
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+	if len(alphabet) < 3 {
+		return nil, errors.New("obfuscator alphabet must contain at least 3 characters")
+	}
+	if minLength < 0 {
+		return nil, fmt.Errorf("min length must not be negative, got %d", minLength)
+	}
+
+	return &Obfuscator{alphabet: shuffle(alphabet, salt), minLength: minLength}, nil
+}
+
+// Encode returns the code of n.
+func (o *Obfuscator) Encode(n uint64) string {
+	size := uint64(len(o.alphabet))
+	offset := (n ^ n>>7) % size
+	prefix := o.alphabet[offset]
+	digits := o.digits(offset)
+	base := uint64(len(digits))
+
+	var code []byte
+	for {
+		code = append(code, digits[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(code)+1 < o.minLength {
+		code = append(code, digits[0])
+	}
+
+	// digits are collected from the least significant one
+	for i, j := 0, len(code)-1; i < j; i, j = i+1, j-1 {
+		code[i], code[j] = code[j], code[i]
+	}
+
+	return string(prefix) + string(code)
+}
+
+// Decode returns the number encoded by Encode.
+func (o *Obfuscator) Decode(code string) (uint64, error) {
+	if len(code) < 2 {
+		return 0, fmt.Errorf("code %q is too short", code)
+	}
+
+	offset := strings.IndexByte(o.alphabet, code[0])
+	if offset < 0 {
+		return 0, fmt.Errorf("code %q contains unknown character %q", code, code[0])
+	}
+	digits := o.digits(uint64(offset))
+	base := uint64(len(digits))
+
+	var n uint64
+	for i := 1; i < len(code); i++ {
+		d := strings.IndexByte(digits, code[i])
+		if d < 0 {
+			return 0, fmt.Errorf("code %q contains unknown character %q", code, code[i])
+		}
+		next := n*base + uint64(d)
+		if next/base != n {
+			return 0, fmt.Errorf("code %q overflows", code)
+		}
+		n = next
+	}
+
+	return n, nil
+}
+
+// digits returns the alphabet rotated by offset without the prefix character.
+func (o *Obfuscator) digits(offset uint64) string {
+	rotated := o.alphabet[offset:] + o.alphabet[:offset]
+
+	return rotated[1:]
+}
+
+// shuffle permutes the alphabet by the salt with Fisher-Yates shuffle driven by SHA-256 of the salt.
+func shuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	chars := []byte(alphabet)
+	seed := sha256.Sum256([]byte(salt))
+	for i := len(chars) - 1; i > 0; i-- {
+		seed = sha256.Sum256(seed[:])
+		j := binary.BigEndian.Uint64(seed[:8]) % uint64(i+1)
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+
+	return string(chars)
+}
+
+// Sequential is the strategy encoding numbers of the counter with Obfuscator.
+// Its IDs are unique as long as the counter doesn't repeat numbers.
+type Sequential struct {
+	counter    Counter
+	obfuscator *Obfuscator
+}
+
+// NewSequential returns Sequential strategy.
+func NewSequential(counter Counter, obfuscator *Obfuscator) *Sequential {
+	return &Sequential{counter: counter, obfuscator: obfuscator}
+}
+
+// Generate returns the code of the next number.
+func (s *Sequential) Generate(ctx context.Context) (string, error) {
+	n, err := s.counter.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return s.obfuscator.Encode(n), nil
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bit layout of Snowflake IDs: 41 bits of milliseconds since the epoch,
+// 10 bits of the node and 12 bits of the sequence within a millisecond.
+const (
+	nodeBits     = 10
+	sequenceBits = 12
+
+	// MaxNode is the largest node number of Snowflake.
+	MaxNode     = 1<<nodeBits - 1
+	maxSequence = 1<<sequenceBits - 1
+)
+
+// SnowflakeEpoch is the start of Snowflake time, it keeps IDs short for years.
+var SnowflakeEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake is the strategy of time-ordered IDs, which are unique across instances
+// as long as each instance has its own node number.
+type Snowflake struct {
+	mu       sync.Mutex
+	node     uint64
+	last     int64
+	sequence uint64
+	alphabet string
+	now      func() time.Time
+}
+
+// NewSnowflake returns Snowflake of the node, IDs are encoded in the alphabet.
+func NewSnowflake(node int, alphabet string) (*Snowflake, error) {
+	if node < 0 || node > MaxNode {
+		return nil, fmt.Errorf("snowflake node must be from 0 to %d, got %d", MaxNode, node)
+	}
+	if alphabet == "" {
+		alphabet = urlAlphabet
+	}
+	if err := validateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	return &Snowflake{node: uint64(node), alphabet: alphabet, now: time.Now}, nil
+}
+
+// Generate returns the next ID. When the sequence of a millisecond is exhausted,
+// or the clock goes backwards, it waits for the next millisecond.
+func (s *Snowflake) Generate(ctx context.Context) (string, error) {
+	n, err := s.next(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return encode(n, s.alphabet), nil
+}
+
+func (s *Snowflake) next(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		ms := s.now().Sub(SnowflakeEpoch).Milliseconds()
+		if ms < 0 {
+			return 0, fmt.Errorf("clock is before the snowflake epoch %s", SnowflakeEpoch)
+		}
+
+		switch {
+		case ms > s.last:
+			s.last = ms
+			s.sequence = 0
+		case ms == s.last && s.sequence < maxSequence:
+			s.sequence++
+		default:
+			if err := sleep(ctx, time.Millisecond); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		return uint64(ms)<<(nodeBits+sequenceBits) | s.node<<sequenceBits | s.sequence, nil
+	}
+}
+
+// encode returns n in the positional notation with the alphabet digits.
+func encode(n uint64, alphabet string) string {
+	base := uint64(len(alphabet))
+
+	var code []byte
+	for {
+		code = append(code, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+
+	for i, j := 0, len(code)-1; i < j; i, j = i+1, j-1 {
+		code[i], code[j] = code[j], code[i]
+	}
+
+	return string(code)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,17 @@
+package generator
+
+import "context"
+
+// Strategy allocates short IDs.
+type Strategy interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// Names of strategies selectable by config.
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategySnowflake  = "snowflake"
+	StrategyPool       = "pool"
+	StrategyWords      = "words"
+)
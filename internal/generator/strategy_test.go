@@ -0,0 +1,211 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObfuscator(t *testing.T) {
+	o, err := NewObfuscator("", "salt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]uint64)
+	for _, n := range []uint64{0, 1, 2, 3, 63, 64, 65, 1000, 123456789, 1<<64 - 1} {
+		code := o.Encode(n)
+		if other, ok := seen[code]; ok {
+			t.Fatalf("Expected unique codes, but %d and %d are %q", n, other, code)
+		}
+		seen[code] = n
+
+		decoded, err := o.Decode(code)
+		if err != nil || decoded != n {
+			t.Errorf("Expected %q to decode to %d, but got: %d, %v", code, n, decoded, err)
+		}
+	}
+
+	if code := o.Encode(1000); len(code) != 3 {
+		t.Errorf("Expected small numbers to produce short codes, but got: %q", code)
+	}
+	if a, b := o.Encode(1), o.Encode(2); a[1:] == b[1:] || a[0] == b[0] {
+		t.Errorf("Expected consecutive numbers to look different, but got: %q, %q", a, b)
+	}
+}
+
+func TestObfuscatorOptions(t *testing.T) {
+	padded, err := NewObfuscator("", "", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := padded.Encode(5)
+	if len(code) != 6 {
+		t.Errorf("Expected code padded to 6 characters, but got: %q", code)
+	}
+	if n, err := padded.Decode(code); err != nil || n != 5 {
+		t.Errorf("Expected padded code to decode to 5, but got: %d, %v", n, err)
+	}
+
+	a, _ := NewObfuscator("", "one", 0)
+	b, _ := NewObfuscator("", "two", 0)
+	if a.Encode(42) == b.Encode(42) {
+		t.Errorf("Expected different salts to produce different codes")
+	}
+
+	for _, code := range []string{"", "a", "a/b"} {
+		if _, err := a.Decode(code); err == nil {
+			t.Errorf("Expected an error decoding %q", code)
+		}
+	}
+
+	if _, err := NewObfuscator("ab", "", 0); err == nil {
+		t.Errorf("Expected an error for alphabet of 2 characters")
+	}
+	if _, err := NewObfuscator("", "", -1); err == nil {
+		t.Errorf("Expected an error for negative min length")
+	}
+}
+
+func TestSequential(t *testing.T) {
+	o, err := NewObfuscator("", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSequential(NewLocalCounter(10), o)
+
+	for want := uint64(11); want < 14; want++ {
+		id, err := s.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := o.Decode(id); err != nil || n != want {
+			t.Errorf("Expected ID of %d, but got: %q (%d, %v)", want, id, n, err)
+		}
+	}
+
+	failing := NewSequential(CounterFunc(func(context.Context) (uint64, error) {
+		return 0, errors.New("sequence is unavailable")
+	}), o)
+	if _, err := failing.Generate(context.Background()); err == nil {
+		t.Errorf("Expected counter error")
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	s, err := NewSnowflake(7, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := SnowflakeEpoch.Add(time.Hour)
+	s.now = func() time.Time { return now }
+
+	first, err := s.next(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := first >> (nodeBits + sequenceBits); ms != uint64(time.Hour.Milliseconds()) {
+		t.Errorf("Expected timestamp of an hour, but got: %d", ms)
+	}
+	if node := first >> sequenceBits & MaxNode; node != 7 {
+		t.Errorf("Expected node 7, but got: %d", node)
+	}
+
+	second, _ := s.next(context.Background())
+	if second != first+1 {
+		t.Errorf("Expected the sequence to grow within a millisecond, but got: %d, %d", first, second)
+	}
+
+	// the clock going backwards waits until it catches up
+	now = now.Add(-time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.next(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected to wait for the clock, but got: %v", err)
+	}
+
+	if _, err := NewSnowflake(MaxNode+1, ""); err == nil {
+		t.Errorf("Expected an error for node %d", MaxNode+1)
+	}
+}
+
+func TestSnowflakeUnique(t *testing.T) {
+	s, err := NewSnowflake(1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]bool)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				id, err := s.Generate(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[id] {
+					t.Errorf("Duplicate ID %q", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPool(t *testing.T) {
+	source, err := New(Options{Length: 4, Alphabet: "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	free := func(ctx context.Context, id string) (bool, error) {
+		return strings.HasPrefix(id, "a"), nil
+	}
+	p := NewPool(source, 5, free)
+
+	// empty pool falls back to the source
+	if id, err := p.Generate(context.Background()); err != nil || len(id) != 4 {
+		t.Errorf("Expected ID of the source, but got: %q, %v", id, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Len() < 5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if p.Len() != 5 {
+		t.Fatalf("Expected the pool to be filled, but got %d IDs", p.Len())
+	}
+
+	for i := 0; i < 5; i++ {
+		id, err := p.Generate(context.Background())
+		if err != nil || !strings.HasPrefix(id, "a") {
+			t.Errorf("Expected checked ID from the pool, but got: %q, %v", id, err)
+		}
+	}
+
+	cancel()
+	<-done
+
+	var nilPool *Pool
+	nilPool.Run(ctx)
+}
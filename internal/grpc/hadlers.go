@@ -3,16 +3,17 @@ package grpc
 import (
 	"context"
 	"errors"
-	"net/url"
+	"strings"
 
 	"github.com/kupriyanovkk/shortener/internal/failure"
-	"github.com/kupriyanovkk/shortener/internal/generator"
 	pb "github.com/kupriyanovkk/shortener/internal/grpc/proto"
+	"github.com/kupriyanovkk/shortener/internal/links"
+	"github.com/kupriyanovkk/shortener/internal/logging"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
 	"github.com/kupriyanovkk/shortener/internal/userid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // GetShortURL retrieves a short URL for the given original URL and user ID.
@@ -22,26 +23,30 @@ import (
 func (s *ShortenerServer) GetShortURL(ctx context.Context, request *pb.GetShortURLRequest) (*pb.GetShortURLResponse, error) {
 	var response pb.GetShortURLResponse
 
-	baseURL := s.app.Flags.BaseURL
 	userID := userid.Get(ctx)
-	parsedURL, err := url.ParseRequestURI(request.Url)
-	if err != nil {
-		return nil, status.Error(codes.Internal, "Error parsing URL")
-	}
-	id, _ := generator.GetRandomStr(10)
-	short, saveErr := s.app.Store.AddValue(ctx, storeInterface.AddValueOptions{
-		Original: parsedURL.String(),
-		BaseURL:  baseURL,
-		Short:    id,
-		UserID:   userID,
-	})
+	short, saveErr := links.Create(ctx, s.app, request.Url, userID)
+	if saveErr != nil {
+		return nil, createError(saveErr)
+	}
+
+	response.Result = short
+	return &response, nil
+}
 
-	if errors.Is(saveErr, failure.ErrConflict) {
-		return nil, status.Error(codes.AlreadyExists, failure.ErrConflict.Error())
-	} else {
-		response.Result = short
-		return &response, nil
+// createError converts links.Create error to gRPC status error.
+func createError(err error) error {
+	switch {
+	case errors.Is(err, failure.ErrInvalidURL):
+		return status.Error(codes.InvalidArgument, "Error parsing URL")
+	case errors.Is(err, failure.ErrForbiddenURL), errors.Is(err, failure.ErrMaliciousURL):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, failure.ErrConflict):
+		return status.Error(codes.AlreadyExists, failure.ErrConflict.Error())
+	case errors.Is(err, failure.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
 	}
+
+	return status.Error(codes.Internal, err.Error())
 }
 
 // DeleteAPIUserURLs deletes the user's URLs in the ShortenerServer.
@@ -53,13 +58,19 @@ func (s *ShortenerServer) GetOriginalURLByShort(ctx context.Context, request *pb
 
 	origURL, err := s.app.Store.GetOriginalURL(ctx, request.Short)
 	if err != nil {
-		if err.Error() == "URL is deleted" {
+		if errors.Is(err, failure.ErrURLDeleted) {
 			return nil, status.Error(codes.NotFound, err.Error())
+		} else if errors.Is(err, failure.ErrURLBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		} else if errors.Is(err, failure.ErrURLFlagged) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
 		} else {
 			return nil, status.Error(codes.Internal, err.Error())
 		}
 	}
 
+	s.app.Clicks.Add(request.Short)
+	links.Redirected(ctx, s.app, request.Short)
 	response.FullUrl = origURL
 	return &response, nil
 }
@@ -91,20 +102,42 @@ func (s *ShortenerServer) GetAPIUserURLs(ctx context.Context, request *pb.GetAPI
 //
 // Context, request.
 // GetInternalStatsResponse, error.
-func (s *ShortenerServer) GetInternalStats(ctx context.Context, in *emptypb.Empty) (*pb.GetInternalStatsResponse, error) {
-	if s.app.Flags.TrustedSubnet == "" {
+func (s *ShortenerServer) GetInternalStats(ctx context.Context, in *pb.GetInternalStatsRequest) (*pb.GetInternalStatsResponse, error) {
+	if len(s.app.Trusted) == 0 {
 		return nil, status.Error(codes.PermissionDenied, "Trusted subnet is not set")
 	}
+	if ip := s.app.ClientIP.FromContext(ctx); !s.app.Trusted.Contains(ip) {
+		return nil, status.Errorf(codes.PermissionDenied, "Client %s is not in trusted subnet", ip)
+	}
 
-	var response pb.GetInternalStatsResponse
+	opts := storeInterface.StatsOptions{Top: int(in.GetTop()), Days: int(in.GetDays())}
+	if err := opts.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
-	stats, err := s.app.Store.GetInternalStats(ctx)
+	stats, err := s.app.InternalStats(ctx, opts)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	response.Urls = int32(stats.URLs)
-	response.Users = int32(stats.Users)
+	response := pb.GetInternalStatsResponse{
+		Urls:           int32(stats.URLs),
+		Users:          int32(stats.Users),
+		Active:         int32(stats.Active),
+		Deleted:        int32(stats.Deleted),
+		Clicks:         stats.Clicks,
+		StoreSizeBytes: stats.StoreSize,
+		QueueBacklog:   int32(stats.QueueBacklog),
+	}
+	for _, v := range stats.CreatedPerDay {
+		response.CreatedPerDay = append(response.CreatedPerDay, &pb.DailyCount{Day: v.Day, Count: int32(v.Count)})
+	}
+	for _, v := range stats.TopUsers {
+		response.TopUsers = append(response.TopUsers, &pb.UserCount{UserId: v.UserID, Links: int32(v.Links)})
+	}
+	for _, v := range stats.TopDomains {
+		response.TopDomains = append(response.TopDomains, &pb.DomainCount{Domain: v.Domain, Links: int32(v.Links)})
+	}
 
 	return &response, nil
 }
@@ -123,9 +156,55 @@ func (s *ShortenerServer) DeleteAPIUserURLs(ctx context.Context, request *pb.Del
 	}
 
 	s.app.URLChan <- storeInterface.DeletedURLs{
-		UserID: userID,
-		URLs:   request.Urls,
+		UserID:    userID,
+		URLs:      request.Urls,
+		IP:        s.app.ClientIP.FromContext(ctx),
+		RequestID: logging.RequestID(ctx),
 	}
 
 	return &response, nil
 }
+
+// WatchEvents streams events of the user's links until the client cancels the call
+// or the server shuts down. Slow clients receive dropped events with the number of
+// events they missed.
+func (s *ShortenerServer) WatchEvents(request *pb.WatchEventsRequest, stream pb.Shortener_WatchEventsServer) error {
+	if s.app.Events == nil {
+		return status.Error(codes.Unavailable, "events are disabled")
+	}
+
+	ctx := stream.Context()
+	userID := userid.Get(ctx)
+
+	sub, err := links.Subscribe(ctx, s.app, userID, strings.Join(request.Types, ","))
+	if errors.Is(err, failure.ErrInvalidEventType) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+
+			err := stream.Send(&pb.Event{
+				Id:       e.ID,
+				Type:     string(e.Type),
+				Short:    e.Short,
+				Original: e.Original,
+				Dropped:  e.Dropped,
+				Time:     timestamppb.New(e.Time),
+			})
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	pb "github.com/kupriyanovkk/shortener/internal/grpc/proto"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGetInternalStats(t *testing.T) {
+	resolver, err := clientip.New("10.0.0.0/8")
+	require.NoError(t, err)
+	trusted, err := clientip.ParseSubnets("192.168.0.0/16, 2001:db8::/32")
+	require.NoError(t, err)
+
+	newContext := func(addr string, md ...string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 1234}})
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(md...))
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{name: "Trusted", ctx: newContext("192.168.1.1"), want: codes.OK},
+		{name: "Trusted IPv6", ctx: newContext("2001:db8::1"), want: codes.OK},
+		{name: "Untrusted", ctx: newContext("203.0.113.1"), want: codes.PermissionDenied},
+		{name: "Spoofed metadata", ctx: newContext("203.0.113.1", "x-real-ip", "192.168.1.1"), want: codes.PermissionDenied},
+		{name: "Behind trusted proxy", ctx: newContext("10.0.0.1", "x-forwarded-for", "192.168.1.1"), want: codes.OK},
+		{name: "No peer", ctx: context.Background(), want: codes.PermissionDenied},
+	}
+
+	s, err := NewShortenerGRPCServer(&config.App{
+		Store:    inmemory.NewStore(),
+		ClientIP: resolver,
+		Trusted:  trusted,
+	})
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := s.GetInternalStats(test.ctx, nil)
+			assert.Equal(t, test.want, status.Code(err))
+		})
+	}
+
+	_, err = s.GetInternalStats(newContext("192.168.1.1"), &pb.GetInternalStatsRequest{Top: 1000})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	response, err := s.GetInternalStats(newContext("192.168.1.1"), &pb.GetInternalStatsRequest{Days: 3})
+	require.NoError(t, err)
+	assert.Len(t, response.CreatedPerDay, 3)
+
+	s.app.Trusted = nil
+	_, err = s.GetInternalStats(newContext("192.168.1.1"), nil)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "trusted subnet is not set")
+}
+
+func TestWatchEvents(t *testing.T) {
+	app := &config.App{
+		Flags:  &config.ConfigFlags{},
+		Store:  inmemory.NewStore(),
+		Events: events.NewBus(0),
+	}
+	s, err := NewShortenerGRPCServer(app)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterShortenerServer(server, s)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewShortenerClient(conn)
+
+	invalid, err := client.WatchEvents(context.Background(), &pb.WatchEventsRequest{Types: []string{"clicked"}})
+	require.NoError(t, err)
+	_, err = invalid.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	stream, err := client.WatchEvents(context.Background(), &pb.WatchEventsRequest{Types: []string{"created"}})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return app.Events.Subscribers() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Calls without authentication share the user ID of the empty context.
+	_, err = s.GetShortURL(context.Background(), &pb.GetShortURLRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+
+	e, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "created", e.Type)
+	assert.Equal(t, "https://example.com", e.Original)
+	assert.NotEmpty(t, e.Short)
+
+	app.Events.Close()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -11,7 +11,6 @@ import (
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
-	emptypb "google.golang.org/protobuf/types/known/emptypb"
 )
 
 // This is a compile-time assertion to ensure that this generated file
@@ -25,6 +24,7 @@ const (
 	Shortener_GetAPIUserURLs_FullMethodName        = "/store.Shortener/GetAPIUserURLs"
 	Shortener_GetInternalStats_FullMethodName      = "/store.Shortener/GetInternalStats"
 	Shortener_DeleteAPIUserURLs_FullMethodName     = "/store.Shortener/DeleteAPIUserURLs"
+	Shortener_WatchEvents_FullMethodName           = "/store.Shortener/WatchEvents"
 )
 
 // ShortenerClient is the client API for Shortener service.
@@ -34,8 +34,9 @@ type ShortenerClient interface {
 	GetShortURL(ctx context.Context, in *GetShortURLRequest, opts ...grpc.CallOption) (*GetShortURLResponse, error)
 	GetOriginalURLByShort(ctx context.Context, in *GetOriginalURLByShortRequest, opts ...grpc.CallOption) (*GetOriginalURLByShortResponse, error)
 	GetAPIUserURLs(ctx context.Context, in *GetAPIUserURLsRequest, opts ...grpc.CallOption) (*GetAPIUserURLsResponse, error)
-	GetInternalStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetInternalStatsResponse, error)
+	GetInternalStats(ctx context.Context, in *GetInternalStatsRequest, opts ...grpc.CallOption) (*GetInternalStatsResponse, error)
 	DeleteAPIUserURLs(ctx context.Context, in *DeleteAPIUserURLsRequest, opts ...grpc.CallOption) (*DeleteAPIUserURLsResponse, error)
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Shortener_WatchEventsClient, error)
 }
 
 type shortenerClient struct {
@@ -73,7 +74,7 @@ func (c *shortenerClient) GetAPIUserURLs(ctx context.Context, in *GetAPIUserURLs
 	return out, nil
 }
 
-func (c *shortenerClient) GetInternalStats(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*GetInternalStatsResponse, error) {
+func (c *shortenerClient) GetInternalStats(ctx context.Context, in *GetInternalStatsRequest, opts ...grpc.CallOption) (*GetInternalStatsResponse, error) {
 	out := new(GetInternalStatsResponse)
 	err := c.cc.Invoke(ctx, Shortener_GetInternalStats_FullMethodName, in, out, opts...)
 	if err != nil {
@@ -91,6 +92,38 @@ func (c *shortenerClient) DeleteAPIUserURLs(ctx context.Context, in *DeleteAPIUs
 	return out, nil
 }
 
+func (c *shortenerClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (Shortener_WatchEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Shortener_ServiceDesc.Streams[0], Shortener_WatchEvents_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shortenerWatchEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Shortener_WatchEventsClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type shortenerWatchEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *shortenerWatchEventsClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // ShortenerServer is the server API for Shortener service.
 // All implementations must embed UnimplementedShortenerServer
 // for forward compatibility
@@ -98,8 +131,9 @@ type ShortenerServer interface {
 	GetShortURL(context.Context, *GetShortURLRequest) (*GetShortURLResponse, error)
 	GetOriginalURLByShort(context.Context, *GetOriginalURLByShortRequest) (*GetOriginalURLByShortResponse, error)
 	GetAPIUserURLs(context.Context, *GetAPIUserURLsRequest) (*GetAPIUserURLsResponse, error)
-	GetInternalStats(context.Context, *emptypb.Empty) (*GetInternalStatsResponse, error)
+	GetInternalStats(context.Context, *GetInternalStatsRequest) (*GetInternalStatsResponse, error)
 	DeleteAPIUserURLs(context.Context, *DeleteAPIUserURLsRequest) (*DeleteAPIUserURLsResponse, error)
+	WatchEvents(*WatchEventsRequest, Shortener_WatchEventsServer) error
 	mustEmbedUnimplementedShortenerServer()
 }
 
@@ -116,12 +150,15 @@ func (UnimplementedShortenerServer) GetOriginalURLByShort(context.Context, *GetO
 func (UnimplementedShortenerServer) GetAPIUserURLs(context.Context, *GetAPIUserURLsRequest) (*GetAPIUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAPIUserURLs not implemented")
 }
-func (UnimplementedShortenerServer) GetInternalStats(context.Context, *emptypb.Empty) (*GetInternalStatsResponse, error) {
+func (UnimplementedShortenerServer) GetInternalStats(context.Context, *GetInternalStatsRequest) (*GetInternalStatsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetInternalStats not implemented")
 }
 func (UnimplementedShortenerServer) DeleteAPIUserURLs(context.Context, *DeleteAPIUserURLsRequest) (*DeleteAPIUserURLsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteAPIUserURLs not implemented")
 }
+func (UnimplementedShortenerServer) WatchEvents(*WatchEventsRequest, Shortener_WatchEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
 func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
 
 // UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
@@ -190,7 +227,7 @@ func _Shortener_GetAPIUserURLs_Handler(srv interface{}, ctx context.Context, dec
 }
 
 func _Shortener_GetInternalStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(emptypb.Empty)
+	in := new(GetInternalStatsRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
@@ -202,7 +239,7 @@ func _Shortener_GetInternalStats_Handler(srv interface{}, ctx context.Context, d
 		FullMethod: Shortener_GetInternalStats_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ShortenerServer).GetInternalStats(ctx, req.(*emptypb.Empty))
+		return srv.(ShortenerServer).GetInternalStats(ctx, req.(*GetInternalStatsRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -225,6 +262,27 @@ func _Shortener_DeleteAPIUserURLs_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Shortener_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ShortenerServer).WatchEvents(m, &shortenerWatchEventsServer{stream})
+}
+
+type Shortener_WatchEventsServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type shortenerWatchEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *shortenerWatchEventsServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -253,6 +311,12 @@ var Shortener_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _Shortener_DeleteAPIUserURLs_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Shortener_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "internal/grpc/proto/shortener.proto",
 }
@@ -2,13 +2,15 @@ package grpc
 
 import (
 	"context"
-	"log"
 	"net"
 	"sync"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
 	pb "github.com/kupriyanovkk/shortener/internal/grpc/proto"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // ShortenerServer is the server API for Shortener service.
@@ -32,11 +34,24 @@ func NewShortenerGRPCServer(app *config.App) (s *ShortenerServer, err error) {
 func (s *ShortenerServer) Run(ctx context.Context, wg *sync.WaitGroup) {
 	listener, err := net.Listen("tcp", s.app.Flags.GRPCServerAddress)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		s.app.Log().Fatal("failed to listen", zap.Error(err))
 	}
 
-	server := grpc.NewServer()
+	opts := append(s.app.Tracing.ServerOptions(),
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor(s.app.Log()),
+			s.app.Metrics.UnaryServerInterceptor(),
+			s.app.Limiter.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			logging.StreamServerInterceptor(s.app.Log()),
+			s.app.Metrics.StreamServerInterceptor(),
+			s.app.Limiter.StreamServerInterceptor(),
+		),
+	)
+	server := grpc.NewServer(opts...)
 	pb.RegisterShortenerServer(server, s)
+	healthpb.RegisterHealthServer(server, s.app.Health.GRPCServer(pb.Shortener_ServiceDesc.ServiceName))
 
 	wg.Add(1)
 	go func() {
@@ -47,6 +62,6 @@ func (s *ShortenerServer) Run(ctx context.Context, wg *sync.WaitGroup) {
 	}()
 
 	if err := server.Serve(listener); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+		s.app.Log().Fatal("failed to serve", zap.Error(err))
 	}
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/links"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	"github.com/kupriyanovkk/shortener/internal/store/cache"
+)
+
+// HeaderAuditTruncated is set by GetAdminAudit when more entries match than the limit.
+const HeaderAuditTruncated = "X-Audit-Truncated"
+
+// verdictRequest is a body of PutAdminURLVerdict requests.
+type verdictRequest struct {
+	Verdict models.Verdict `json:"verdict"`
+}
+
+// PutAdminURLVerdict processes admin requests for blocking, flagging or clearing the short URL.
+// The verdict is one of "block", "warn" or empty to clear it.
+func PutAdminURLVerdict(w http.ResponseWriter, r *http.Request, app *config.App) {
+	var req verdictRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Verdict {
+	case models.VerdictClean, models.VerdictWarn, models.VerdictBlock:
+	default:
+		http.Error(w, "unknown verdict", http.StatusBadRequest)
+		return
+	}
+
+	short := chi.URLParam(r, "id")
+	err := app.Store.SetVerdict(r.Context(), short, req.Verdict)
+	if errors.Is(err, failure.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	links.Audit(r.Context(), app, audit.Entry{
+		Action:  audit.ActionUpdate,
+		Actor:   audit.ActorAdmin,
+		Shorts:  []string{short},
+		Details: fmt.Sprintf("verdict=%q", req.Verdict),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAdminCache processes admin requests for getting metrics of the redirect cache.
+func GetAdminCache(w http.ResponseWriter, r *http.Request, app *config.App) {
+	cached, ok := app.Store.(*cache.Store)
+	if !ok {
+		http.Error(w, "cache is disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(cached.Stats()); err != nil {
+		return
+	}
+}
+
+// GetAdminUserQuota processes admin requests for getting quotas of the user and their usage.
+func GetAdminUserQuota(w http.ResponseWriter, r *http.Request, app *config.App) {
+	report, err := app.Quota.Report(r.Context(), chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(report); err != nil {
+		return
+	}
+}
+
+// GetAdminAudit processes admin requests for audit trail entries in order they were recorded.
+// Entries are filtered by the from and to times in RFC 3339, to is exclusive, and by the action,
+// actor and short query parameters. The limit parameter caps the number of returned entries,
+// the oldest ones are returned and the X-Audit-Truncated header is set when more entries match.
+func GetAdminAudit(w http.ResponseWriter, r *http.Request, app *config.App) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Action: audit.Action(query.Get("action")),
+		Actor:  query.Get("actor"),
+		Short:  query.Get("short"),
+	}
+
+	var err error
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid %s: %v", name, err), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, truncated, err := app.Audit.Query(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if truncated {
+		w.Header().Set(HeaderAuditTruncated, "true")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(entries); err != nil {
+		return
+	}
+}
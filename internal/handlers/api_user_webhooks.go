@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/links"
+	"github.com/kupriyanovkk/shortener/internal/userid"
+	"github.com/kupriyanovkk/shortener/internal/webhooks"
+)
+
+// GetAPIUserWebhooks processes requests for listing the user's webhook subscriptions
+func GetAPIUserWebhooks(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	writeWebhooksJSON(w, http.StatusOK, app.Webhooks.List(userID))
+}
+
+// PostAPIUserWebhooks processes requests for subscribing a URL to events of the user's links.
+// The response contains the secret signing payloads, it isn't returned anymore.
+func PostAPIUserWebhooks(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	var sub webhooks.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := app.Webhooks.Create(r.Context(), userID, sub)
+	if writeWebhookError(w, err) {
+		return
+	}
+	links.Audit(r.Context(), app, audit.Entry{Action: audit.ActionWebhookCreate, Actor: userID, Details: created.ID + " " + created.URL})
+
+	writeWebhooksJSON(w, http.StatusCreated, created)
+}
+
+// DeleteAPIUserWebhook processes requests for deleting the user's webhook subscription
+func DeleteAPIUserWebhook(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	webhookID := chi.URLParam(r, "webhookID")
+	err := app.Webhooks.Delete(userID, webhookID)
+	if writeWebhookError(w, err) {
+		return
+	}
+	links.Audit(r.Context(), app, audit.Entry{Action: audit.ActionWebhookDelete, Actor: userID, Details: webhookID})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAPIUserWebhookDeliveries processes requests for recent deliveries of the user's webhook subscription
+func GetAPIUserWebhookDeliveries(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.Webhooks.Deliveries(userID, chi.URLParam(r, "webhookID"))
+	if writeWebhookError(w, err) {
+		return
+	}
+
+	writeWebhooksJSON(w, http.StatusOK, deliveries)
+}
+
+// PostAPIUserWebhookTest processes requests for sending the ping event to the user's webhook subscription
+func PostAPIUserWebhookTest(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	delivery, err := app.Webhooks.Test(userID, chi.URLParam(r, "webhookID"))
+	if writeWebhookError(w, err) {
+		return
+	}
+
+	writeWebhooksJSON(w, http.StatusAccepted, delivery)
+}
+
+// PostAPIUserWebhookReplay processes requests for sending the payload of a delivery again
+func PostAPIUserWebhookReplay(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID, ok := webhooksUser(w, r, app)
+	if !ok {
+		return
+	}
+
+	delivery, err := app.Webhooks.Replay(userID, chi.URLParam(r, "webhookID"), chi.URLParam(r, "deliveryID"))
+	if writeWebhookError(w, err) {
+		return
+	}
+
+	writeWebhooksJSON(w, http.StatusAccepted, delivery)
+}
+
+// webhooksUser returns the user ID, or writes the error response if the user is unknown
+// or webhooks are disabled.
+func webhooksUser(w http.ResponseWriter, r *http.Request, app *config.App) (string, bool) {
+	if _, err := r.Cookie("UserID"); err != nil {
+		http.Error(w, errors.New("missing user id").Error(), http.StatusUnauthorized)
+		return "", false
+	}
+
+	if app.Webhooks == nil {
+		http.Error(w, "webhooks are disabled", http.StatusNotFound)
+		return "", false
+	}
+
+	return userid.Get(r.Context()), true
+}
+
+// writeWebhookError writes response for webhooks.Service errors, it returns false for nil errors.
+func writeWebhookError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, failure.ErrInvalidWebhook):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, failure.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	return true
+}
+
+func writeWebhooksJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(v); err != nil {
+		return
+	}
+}
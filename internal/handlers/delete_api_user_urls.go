@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/kupriyanovkk/shortener/internal/audit"
 	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/logging"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/tracing"
 	"github.com/kupriyanovkk/shortener/internal/userid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 // DeleteAPIUserURLs processes requests for deleting user URLs.
@@ -36,8 +42,10 @@ func DeleteAPIUserURLs(w http.ResponseWriter, r *http.Request, app *config.App)
 	}
 
 	app.URLChan <- storeInterface.DeletedURLs{
-		UserID: userID,
-		URLs:   URLs,
+		UserID:    userID,
+		URLs:      URLs,
+		IP:        app.ClientIP.FromContext(r.Context()),
+		RequestID: logging.RequestID(r.Context()),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -45,7 +53,13 @@ func DeleteAPIUserURLs(w http.ResponseWriter, r *http.Request, app *config.App)
 }
 
 // FlushDeletedURLs reading URLChan and processing URLs.
+// When the deletion queue is configured, URLs are passed through it.
 func FlushDeletedURLs(app *config.App, ctx context.Context) {
+	if app.DeleteQueue != nil {
+		flushDeletionQueue(app, ctx)
+		return
+	}
+
 	ticker := time.NewTicker(10 * time.Second)
 
 	var URLs []storeInterface.DeletedURLs
@@ -59,9 +73,9 @@ func FlushDeletedURLs(app *config.App, ctx context.Context) {
 				continue
 			}
 
-			err := app.Store.DeleteURLs(context.TODO(), URLs)
+			err := flush(app, URLs)
 			if err != nil {
-				fmt.Println("cannot save urls", err)
+				app.Log().Error("cannot save urls", zap.Error(err))
 				continue
 			}
 			URLs = nil
@@ -71,3 +85,97 @@ func FlushDeletedURLs(app *config.App, ctx context.Context) {
 		}
 	}
 }
+
+// flushDeletionQueue pushes URLs from URLChan into the deletion queue and applies
+// requests popped from the queue, which may have been pushed by other instances.
+func flushDeletionQueue(app *config.App, ctx context.Context) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for ctx.Err() == nil {
+			requests, err := app.DeleteQueue.Pop(ctx, 100, time.Second)
+			if err != nil {
+				if ctx.Err() == nil {
+					app.Log().Error("cannot read deletion queue", zap.Error(err))
+					time.Sleep(time.Second)
+				}
+				continue
+			}
+			if len(requests) == 0 {
+				continue
+			}
+
+			// Failed requests are pushed back before they are acknowledged,
+			// so they stay in the queue until some instance applies them.
+			err = flush(app, requests)
+			if err != nil {
+				app.Log().Error("cannot save urls", zap.Error(err))
+				time.Sleep(time.Second)
+				if err := app.DeleteQueue.Push(context.TODO(), requests...); err != nil {
+					app.Log().Error("cannot return urls to deletion queue", zap.Error(err))
+					continue
+				}
+			}
+			if err := app.DeleteQueue.Ack(context.TODO(), requests...); err != nil {
+				app.Log().Error("cannot acknowledge deleted urls", zap.Error(err))
+			}
+		}
+	}()
+
+	for {
+		select {
+		case u := <-app.URLChan:
+			if err := app.DeleteQueue.Push(ctx, u); err != nil {
+				app.Log().Error("cannot queue urls", zap.Error(err))
+				deleted, err := app.Store.DeleteURLs(context.TODO(), []storeInterface.DeletedURLs{u})
+				if err != nil {
+					app.Log().Error("cannot save urls", zap.Error(err))
+				}
+				reportDeleted(context.TODO(), app, deleted)
+			}
+		case <-ctx.Done():
+			close(app.URLChan)
+			<-done
+			return
+		}
+	}
+}
+
+// flush applies the deletion requests to the store in a span of its own.
+func flush(app *config.App, requests []storeInterface.DeletedURLs) error {
+	ctx, span := app.Tracing.Start(context.Background(), "deletion.flush",
+		trace.WithAttributes(attribute.Int("requests", len(requests))))
+
+	start := time.Now()
+	deleted, err := app.Store.DeleteURLs(ctx, requests)
+	app.Metrics.ObserveFlush(time.Since(start), err)
+	tracing.End(span, err)
+
+	// URLs deleted before a failure aren't deleted again by the retry, so they are reported now.
+	reportDeleted(ctx, app, deleted)
+
+	return err
+}
+
+// reportDeleted publishes events of URLs deleted by the store and records them in the audit trail
+// on behalf of the requests that deleted them.
+func reportDeleted(ctx context.Context, app *config.App, requests []storeInterface.DeletedURLs) {
+	for _, request := range requests {
+		for _, short := range request.URLs {
+			app.Events.Publish(events.Event{Type: events.TypeDeleted, Short: short, UserID: request.UserID})
+		}
+
+		err := app.Audit.Record(ctx, audit.Entry{
+			Action:    audit.ActionDelete,
+			Actor:     request.UserID,
+			IP:        request.IP,
+			RequestID: request.RequestID,
+			Shorts:    request.URLs,
+		})
+		if err != nil {
+			app.Log().Error("cannot record audit entry", zap.Error(err), zap.String("action", string(audit.ActionDelete)))
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/quota"
+)
+
+// writeCreateError writes response for links.Create errors.
+// It returns false for nil and conflict errors, when the response is still to be written by caller.
+func writeCreateError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil, errors.Is(err, failure.ErrConflict):
+		return false
+	case errors.Is(err, failure.ErrInvalidURL):
+		http.Error(w, "Error parsing URL", http.StatusBadRequest)
+	case errors.Is(err, failure.ErrForbiddenURL), errors.Is(err, failure.ErrMaliciousURL):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, failure.ErrQuotaExceeded):
+		var quotaErr *quota.Error
+		if errors.As(err, &quotaErr) && !quotaErr.Reset.IsZero() {
+			retryAfter := int(math.Ceil(time.Until(quotaErr.Reset).Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+
+	return true
+}
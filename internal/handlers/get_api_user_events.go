@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/links"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/userid"
+	"go.uber.org/zap"
+)
+
+// eventsHeartbeat is a period of comments sent to keep idle event streams open through proxies.
+var eventsHeartbeat = 15 * time.Second
+
+// GetAPIUserEvents streams events of the user's links as Server-Sent Events until the client
+// disconnects or the server shuts down. Types of events may be selected by the comma separated
+// "types" query parameter. Events dropped because the client was too slow are reported by
+// "dropped" events with their number.
+func GetAPIUserEvents(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID := userid.Get(r.Context())
+	if _, err := r.Cookie("UserID"); err != nil {
+		http.Error(w, errors.New("missing user id").Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if app.Events == nil {
+		http.Error(w, "events are disabled", http.StatusNotFound)
+		return
+	}
+
+	sub, err := links.Subscribe(r.Context(), app, userID, r.URL.Query().Get("types"))
+	if errors.Is(err, failure.ErrInvalidEventType) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var err error
+
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+
+			data, _ := json.Marshal(e)
+			if e.ID != 0 {
+				_, err = fmt.Fprintf(w, "id: %d\n", e.ID)
+			}
+			if err == nil {
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			}
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			logging.FromContext(r.Context()).Debug("event stream is closed", zap.Error(err))
+			return
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/userid"
+)
+
+// GetAPIUserQuota processes requests for getting user quotas and their usage
+func GetAPIUserQuota(w http.ResponseWriter, r *http.Request, app *config.App) {
+	userID := userid.Get(r.Context())
+
+	report, err := app.Quota.Report(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(report); err != nil {
+		return
+	}
+}
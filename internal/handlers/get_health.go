@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/health"
+)
+
+// GetHealthz reports liveness of the service.
+func GetHealthz(w http.ResponseWriter, r *http.Request, app *config.App) {
+	health.WriteReport(w, app.Health.Live(r.Context()))
+}
+
+// GetReadyz reports readiness of the service with results of the component checks.
+// It responds with 503 Service Unavailable when any check fails or the service is shutting down.
+func GetReadyz(w http.ResponseWriter, r *http.Request, app *config.App) {
+	health.WriteReport(w, app.Health.Ready(r.Context()))
+}
@@ -1,24 +1,60 @@
 package handlers
 
 import (
+	"errors"
+	"html/template"
 	"net/http"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/links"
+	"github.com/kupriyanovkk/shortener/internal/metrics"
 )
 
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Suspicious link</title>
+</head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The link you followed leads to a site flagged as suspicious. It may try to steal your personal data or install malicious software.</p>
+<p><code>{{.}}</code></p>
+<p><a href="{{.}}" rel="noopener noreferrer nofollow">Continue anyway</a></p>
+</body>
+</html>
+`))
+
 // GetID process requests for getting original URL
 func GetID(w http.ResponseWriter, r *http.Request, app *config.App) {
 	id := r.URL.String()
 	origURL, err := app.Store.GetOriginalURL(r.Context(), id[1:])
 
 	if err != nil {
-		if err.Error() == "URL is deleted" {
+		switch {
+		case errors.Is(err, failure.ErrURLFlagged):
+			app.Metrics.ObserveRedirect(metrics.RedirectFlagged)
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.WriteHeader(http.StatusOK)
+			warningPage.Execute(w, origURL)
+		case errors.Is(err, failure.ErrURLBlocked):
+			app.Metrics.ObserveRedirect(metrics.RedirectBlocked)
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, failure.ErrURLDeleted):
+			app.Metrics.ObserveRedirect(metrics.RedirectGone)
 			http.Error(w, err.Error(), http.StatusGone)
-		} else {
+		default:
+			app.Metrics.ObserveRedirect(metrics.RedirectMiss)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		}
 		return
 	}
 
+	app.Metrics.ObserveRedirect(metrics.RedirectHit)
+	app.Clicks.Add(id[1:])
+	links.Redirected(r.Context(), app, id[1:])
 	http.Redirect(w, r, origURL, http.StatusTemporaryRedirect)
 }
@@ -2,39 +2,49 @@ package handlers
 
 import (
 	"encoding/json"
-	"net"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
 )
 
-// isIPInTrustedSubnet checks if IP is in trusted subnet
-func isIPInTrustedSubnet(ip, subnet string) bool {
-	_, ipNet, err := net.ParseCIDR(subnet)
-	if err != nil {
-		return false
-	}
-	return ipNet.Contains(net.ParseIP(ip))
-}
-
-// GetInternalStats process request for getting internal statistics
+// GetInternalStats process request for getting internal statistics.
+// It is served by the admin listener, which restricts access to trusted clients.
+// The numbers of top users and domains and of days links created per day are
+// counted for may be set by "top" and "days" query parameters.
 func GetInternalStats(w http.ResponseWriter, r *http.Request, app *config.App) {
-	if app.Flags.TrustedSubnet == "" {
-		w.WriteHeader(http.StatusForbidden)
-		return
+	var opts storeInterface.StatsOptions
+	params := []struct {
+		name  string
+		value *int
+	}{
+		{"top", &opts.Top},
+		{"days", &opts.Days},
+	}
+	for _, p := range params {
+		param := r.URL.Query().Get(p.name)
+		if param == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid %s: %q", p.name, param), http.StatusBadRequest)
+			return
+		}
+		*p.value = n
 	}
 
-	xRealIP := r.Header.Get("X-Real-Ip")
-
-	if !isIPInTrustedSubnet(xRealIP, app.Flags.TrustedSubnet) {
-		w.WriteHeader(http.StatusForbidden)
+	if err := opts.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	stats, err := app.Store.GetInternalStats(r.Context())
-
+	stats, err := app.InternalStats(r.Context(), opts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -4,16 +4,35 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/clicks"
+	"github.com/kupriyanovkk/shortener/internal/clientip"
 	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/health"
+	"github.com/kupriyanovkk/shortener/internal/middlewares"
 	"github.com/kupriyanovkk/shortener/internal/models"
+	"github.com/kupriyanovkk/shortener/internal/policy"
+	"github.com/kupriyanovkk/shortener/internal/quota"
+	"github.com/kupriyanovkk/shortener/internal/store/cache"
 	infile "github.com/kupriyanovkk/shortener/internal/store/in_file"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/userid"
+	"github.com/kupriyanovkk/shortener/internal/webhooks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 var defaultURL = "http://localhost:8080/"
@@ -25,10 +44,16 @@ var f = config.ConfigFlags{
 	DatabaseDSN:     dbDSN,
 }
 
+// newTestStore returns file store isolated from other tests,
+// so already shortened URLs don't cause conflicts.
+func newTestStore(t *testing.T) storeInterface.Store {
+	return infile.NewStore(filepath.Join(t.TempDir(), "short-url-db.json"))
+}
+
 func TestPostRoot(t *testing.T) {
 	t.Run("Valid POST Request", func(t *testing.T) {
 		body := []byte("https://example.com")
-		s := infile.NewStore(f.FileStoragePath)
+		s := newTestStore(t)
 		env := &config.App{Flags: &f, Store: s}
 		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 		if err != nil {
@@ -44,9 +69,37 @@ func TestPostRoot(t *testing.T) {
 		assert.Contains(t, rr.Header().Get("Location"), defaultURL)
 	})
 
+	t.Run("Conflict POST Request", func(t *testing.T) {
+		env := &config.App{Flags: &f, Store: newTestStore(t)}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { PostRoot(w, r, env) })
+
+		first := httptest.NewRecorder()
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://example.com")))
+		require.Equal(t, http.StatusCreated, first.Code)
+
+		second := httptest.NewRecorder()
+		handler.ServeHTTP(second, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://example.com")))
+
+		assert.Equal(t, http.StatusConflict, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, first.Body.String(), second.Result().Header.Get("Location"))
+	})
+
+	t.Run("Forbidden POST Request", func(t *testing.T) {
+		engine, err := policy.New(policy.Options{BaseURL: defaultURL})
+		require.NoError(t, err)
+		env := &config.App{Flags: &f, Store: newTestStore(t), Policy: engine}
+
+		rr := httptest.NewRecorder()
+		PostRoot(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("http://localhost:8080/abc")), env)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "shortener itself")
+	})
+
 	t.Run("Invalid POST Request", func(t *testing.T) {
 		body := []byte("invalid-url")
-		s := infile.NewStore(f.FileStoragePath)
+		s := newTestStore(t)
 		env := &config.App{Flags: &f, Store: s}
 		req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBuffer(body))
 		if err != nil {
@@ -66,7 +119,7 @@ func TestPostRoot(t *testing.T) {
 func TestGetID(t *testing.T) {
 	t.Run("Valid GET Request", func(t *testing.T) {
 		id := "abc123"
-		s := infile.NewStore(f.FileStoragePath)
+		s := newTestStore(t)
 		env := &config.App{Flags: &f, Store: s}
 		s.AddValue(context.Background(), storeInterface.AddValueOptions{
 			Short:    id,
@@ -88,8 +141,31 @@ func TestGetID(t *testing.T) {
 		assert.Equal(t, "http://example.com", rr.Header().Get("Location"))
 	})
 
+	t.Run("Flagged and blocked GET Request", func(t *testing.T) {
+		s := newTestStore(t)
+		env := &config.App{Flags: &f, Store: s}
+		s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "warn", Original: "http://suspicious.com/?a=1&b=2"})
+		s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "block", Original: "http://evil.com"})
+		require.NoError(t, s.SetVerdict(context.Background(), "warn", models.VerdictWarn))
+		require.NoError(t, s.SetVerdict(context.Background(), "block", models.VerdictBlock))
+
+		rr := httptest.NewRecorder()
+		GetID(rr, httptest.NewRequest(http.MethodGet, "/warn", nil), env)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("Location"))
+		assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, rr.Body.String(), `href="http://suspicious.com/?a=1&amp;b=2"`)
+
+		rr = httptest.NewRecorder()
+		GetID(rr, httptest.NewRequest(http.MethodGet, "/block", nil), env)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Empty(t, rr.Header().Get("Location"))
+	})
+
 	t.Run("Invalid GET Request (Not Found)", func(t *testing.T) {
-		s := infile.NewStore(f.FileStoragePath)
+		s := newTestStore(t)
 		env := &config.App{Flags: &f, Store: s}
 		req, err := http.NewRequest(http.MethodGet, "/nonexistent", nil)
 		if err != nil {
@@ -107,7 +183,7 @@ func TestGetID(t *testing.T) {
 }
 
 func TestPostApiShorten(t *testing.T) {
-	s := infile.NewStore(f.FileStoragePath)
+	s := newTestStore(t)
 	env := &config.App{Flags: &f, Store: s}
 	body := []byte(`{"url":"http://example.com/"}`)
 	req, err := http.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(body))
@@ -132,8 +208,6 @@ func TestPostApiShorten(t *testing.T) {
 }
 
 func TestPostApiShortenBatch(t *testing.T) {
-	s := infile.NewStore(f.FileStoragePath)
-	env := &config.App{Flags: &f, Store: s}
 
 	testCases := []struct {
 		Name         string
@@ -184,6 +258,7 @@ func TestPostApiShortenBatch(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.Name, func(t *testing.T) {
+			env := &config.App{Flags: &f, Store: newTestStore(t)}
 			reqBody, _ := json.Marshal(tc.Request)
 			req := httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(reqBody))
 			rec := httptest.NewRecorder()
@@ -197,8 +272,118 @@ func TestPostApiShortenBatch(t *testing.T) {
 	}
 }
 
+func TestQuota(t *testing.T) {
+	s := newTestStore(t)
+	env := &config.App{Flags: &f, Store: s, Quota: quota.New(s, quota.Options{
+		Default: quota.Limits{MaxLinks: 1, MaxBatch: 2},
+	})}
+
+	rr := httptest.NewRecorder()
+	PostRoot(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://example.com/1")), env)
+	require.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	PostRoot(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://example.com/2")), env)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, rr.Body.String(), "quota exceeded")
+
+	batch, _ := json.Marshal(make([]models.BatchRequest, 3))
+	rr = httptest.NewRecorder()
+	PostAPIShortenBatch(rr, httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBuffer(batch)), env)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Contains(t, rr.Body.String(), "batch size is limited to 2 links")
+
+	rr = httptest.NewRecorder()
+	GetAPIUserQuota(rr, httptest.NewRequest(http.MethodGet, "/api/user/quota", nil), env)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var report quota.Report
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, 1, report.Links.Limit)
+	assert.Equal(t, 1, report.Links.Used)
+	require.NotNil(t, report.Links.Remaining)
+	assert.Equal(t, 0, *report.Links.Remaining)
+	assert.Nil(t, report.Daily.Remaining)
+	assert.Equal(t, 2, report.MaxBatch)
+}
+
+// chanQueue is a deletion queue kept in a channel.
+type chanQueue chan storeInterface.DeletedURLs
+
+func (q chanQueue) Push(_ context.Context, requests ...storeInterface.DeletedURLs) error {
+	for _, r := range requests {
+		q <- r
+	}
+	return nil
+}
+
+func (q chanQueue) Ack(context.Context, ...storeInterface.DeletedURLs) error {
+	return nil
+}
+
+func (q chanQueue) Pop(ctx context.Context, _ int, wait time.Duration) ([]storeInterface.DeletedURLs, error) {
+	select {
+	case r := <-q:
+		return []storeInterface.DeletedURLs{r}, nil
+	case <-time.After(wait):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestFlushDeletedURLsWithQueue(t *testing.T) {
+	s := newTestStore(t)
+	_, err := s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com", UserID: "user"})
+	require.NoError(t, err)
+
+	_, err = s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "foreign", Original: "https://example.org", UserID: "other"})
+	require.NoError(t, err)
+
+	env := &config.App{
+		Flags:       &f,
+		Store:       s,
+		URLChan:     make(chan storeInterface.DeletedURLs, 1),
+		DeleteQueue: make(chanQueue, 10),
+		Events:      events.NewBus(10),
+	}
+	sub := env.Events.Subscribe(nil)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		FlushDeletedURLs(env, ctx)
+		close(done)
+	}()
+
+	env.URLChan <- storeInterface.DeletedURLs{UserID: "user", URLs: []string{"abc", "foreign", "missing"}}
+
+	assert.Eventually(t, func() bool {
+		_, err := s.GetOriginalURL(context.Background(), "abc")
+		return errors.Is(err, failure.ErrURLDeleted)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	select {
+	case e := <-sub.Events():
+		assert.Equal(t, events.TypeDeleted, e.Type)
+		assert.Equal(t, "abc", e.Short)
+	case <-time.After(2 * time.Second):
+		t.Fatal("deletion isn't published")
+	}
+
+	cancel()
+	<-done
+
+	select {
+	case e := <-sub.Events():
+		t.Errorf("only deleted URLs are published, got %v", e)
+	default:
+	}
+}
+
 func TestGetPing(t *testing.T) {
-	s := infile.NewStore(f.FileStoragePath)
+	s := newTestStore(t)
 
 	req, err := http.NewRequest("GET", "/", nil)
 	if err != nil {
@@ -217,3 +402,352 @@ func TestGetPing(t *testing.T) {
 			status, http.StatusOK)
 	}
 }
+
+func TestPutAdminURLVerdict(t *testing.T) {
+	s := newTestStore(t)
+	app := &config.App{Store: cache.New(s, cache.Options{})}
+	_, err := s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com"})
+	require.NoError(t, err)
+
+	router := chi.NewRouter()
+	router.Put("/api/admin/urls/{id}/verdict", func(w http.ResponseWriter, r *http.Request) {
+		PutAdminURLVerdict(w, r, app)
+	})
+
+	_, err = app.Store.GetOriginalURL(context.Background(), "abc")
+	require.NoError(t, err, "redirect is cached")
+
+	tests := []struct {
+		name string
+		id   string
+		body string
+		want int
+	}{
+		{name: "Block", id: "abc", body: `{"verdict":"block"}`, want: http.StatusNoContent},
+		{name: "Unknown verdict", id: "abc", body: `{"verdict":"maybe"}`, want: http.StatusBadRequest},
+		{name: "Malformed", id: "abc", body: `{`, want: http.StatusBadRequest},
+		{name: "Unknown URL", id: "missing", body: `{"verdict":"warn"}`, want: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/api/admin/urls/"+test.id+"/verdict", bytes.NewBufferString(test.body)))
+			assert.Equal(t, test.want, rr.Code)
+		})
+	}
+
+	_, err = app.Store.GetOriginalURL(context.Background(), "abc")
+	assert.ErrorIs(t, err, failure.ErrURLBlocked, "cached redirect is invalidated")
+}
+
+func TestGetAdminCache(t *testing.T) {
+	rr := httptest.NewRecorder()
+	GetAdminCache(rr, httptest.NewRequest(http.MethodGet, "/api/admin/cache", nil), &config.App{Store: newTestStore(t)})
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	cached := cache.New(newTestStore(t), cache.Options{})
+	_, err := cached.GetOriginalURL(context.Background(), "missing")
+	require.Error(t, err)
+
+	rr = httptest.NewRecorder()
+	GetAdminCache(rr, httptest.NewRequest(http.MethodGet, "/api/admin/cache", nil), &config.App{Store: cached})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"hits":0,"negative_hits":0,"misses":1,"evictions":0,"size":1}`, rr.Body.String())
+}
+
+func TestGetReadyz(t *testing.T) {
+	checker := health.New(0)
+	app := &config.App{Store: newTestStore(t), Health: checker}
+	checker.Add("store", health.Ping(app.Store.Ping))
+
+	rr := httptest.NewRecorder()
+	GetReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil), app)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var report health.Report
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+	assert.Equal(t, health.StatusOK, report.Checks["store"].Status)
+
+	checker.Shutdown()
+
+	rr = httptest.NewRecorder()
+	GetReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil), app)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	rr = httptest.NewRecorder()
+	GetHealthz(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil), app)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestGetInternalStats(t *testing.T) {
+	s := newTestStore(t)
+	app := &config.App{
+		Store:   s,
+		URLChan: make(chan storeInterface.DeletedURLs, 10),
+		Clicks:  clicks.New(s, 0),
+	}
+	app.URLChan <- storeInterface.DeletedURLs{UserID: "user1", URLs: []string{"abc"}}
+
+	_, err := s.AddValue(context.Background(), storeInterface.AddValueOptions{
+		Short:    "abc",
+		Original: "https://example.com/page",
+		UserID:   "user1",
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		GetID(rr, httptest.NewRequest(http.MethodGet, "/abc", nil), app)
+		require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	}
+	require.NoError(t, app.Clicks.Flush(context.Background()))
+
+	rr := httptest.NewRecorder()
+	GetInternalStats(rr, httptest.NewRequest(http.MethodGet, "/api/internal/stats?top=1&days=2", nil), app)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var stats models.InternalStats
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.URLs)
+	assert.Equal(t, 1, stats.Active)
+	assert.Equal(t, int64(2), stats.Clicks)
+	assert.Equal(t, 1, stats.QueueBacklog)
+	assert.Len(t, stats.CreatedPerDay, 2)
+	assert.Equal(t, []models.UserCount{{UserID: "user1", Links: 1}}, stats.TopUsers)
+	assert.Equal(t, []models.DomainCount{{Domain: "example.com", Links: 1}}, stats.TopDomains)
+	assert.Positive(t, stats.StoreSize)
+
+	for _, query := range []string{"top=0", "days=x", "days=1000"} {
+		rr := httptest.NewRecorder()
+		GetInternalStats(rr, httptest.NewRequest(http.MethodGet, "/api/internal/stats?"+query, nil), app)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestGetAPIUserEvents(t *testing.T) {
+	s := newTestStore(t)
+	app := &config.App{Flags: &f, Store: s, Events: events.NewBus(0)}
+	_, err := s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com", UserID: "user1"})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), userid.ContextUserKey, "user1")
+		GetAPIUserEvents(w, r.WithContext(ctx), app)
+	}))
+	defer server.Close()
+
+	request := func(query string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/user/events"+query, nil)
+		require.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: "UserID", Value: "encrypted"})
+
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := request("?types=clicked")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = request("?types=redirect,deleted")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	_, err = s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "other", Original: "https://example.org", UserID: "user2"})
+	require.NoError(t, err)
+	redirect := func(short string) {
+		rr := httptest.NewRecorder()
+		GetID(rr, httptest.NewRequest(http.MethodGet, "/"+short, nil), app)
+		require.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	}
+
+	redirect("other")
+	app.Events.Publish(events.Event{Type: events.TypeCreated, Short: "new", UserID: "user1"})
+	redirect("abc")
+	app.Events.Publish(events.Event{Type: events.TypeDeleted, Short: "abc", UserID: "user1"})
+	app.Events.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	var data []string
+	for _, line := range strings.Split(string(body), "\n") {
+		if value, ok := strings.CutPrefix(line, "data: "); ok {
+			data = append(data, value)
+		}
+	}
+	require.Len(t, data, 2, string(body))
+	assert.Contains(t, string(body), "id: 3\nevent: redirect\n")
+	assert.Contains(t, data[0], `"short":"abc"`)
+	assert.Contains(t, data[1], `"type":"deleted"`)
+	assert.NotContains(t, data[1], "user1")
+}
+
+func TestAPIUserWebhooks(t *testing.T) {
+	s := newTestStore(t)
+	service, err := webhooks.New(s, webhooks.Options{})
+	require.NoError(t, err)
+	app := &config.App{Flags: &f, Store: s, Webhooks: service}
+
+	router := chi.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), userid.ContextUserKey, r.Header.Get("X-Test-User"))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	router.Get("/api/user/webhooks", func(w http.ResponseWriter, r *http.Request) { GetAPIUserWebhooks(w, r, app) })
+	router.Post("/api/user/webhooks", func(w http.ResponseWriter, r *http.Request) { PostAPIUserWebhooks(w, r, app) })
+	router.Delete("/api/user/webhooks/{webhookID}", func(w http.ResponseWriter, r *http.Request) { DeleteAPIUserWebhook(w, r, app) })
+	router.Post("/api/user/webhooks/{webhookID}/test", func(w http.ResponseWriter, r *http.Request) { PostAPIUserWebhookTest(w, r, app) })
+	router.Get("/api/user/webhooks/{webhookID}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		GetAPIUserWebhookDeliveries(w, r, app)
+	})
+	router.Post("/api/user/webhooks/{webhookID}/deliveries/{deliveryID}/replay", func(w http.ResponseWriter, r *http.Request) {
+		PostAPIUserWebhookReplay(w, r, app)
+	})
+
+	request := func(method, target, user, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if user != "" {
+			req.Header.Set("X-Test-User", user)
+			req.AddCookie(&http.Cookie{Name: "UserID", Value: "encrypted"})
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodGet, "/api/user/webhooks", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = request(http.MethodPost, "/api/user/webhooks", "user1", `{"url":"https://example.com/hook","events":["expired"]}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = request(http.MethodPost, "/api/user/webhooks", "user1", `{"url":"https://example.com/hook","events":["created","clicks"],"click_thresholds":[100]}`)
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var sub webhooks.Subscription
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sub))
+	assert.NotEmpty(t, sub.Secret)
+	assert.Equal(t, []int64{100}, sub.ClickThresholds)
+
+	rr = request(http.MethodGet, "/api/user/webhooks", "user1", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), sub.ID)
+	assert.NotContains(t, rr.Body.String(), sub.Secret)
+
+	rr = request(http.MethodPost, "/api/user/webhooks/"+sub.ID+"/test", "user2", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = request(http.MethodPost, "/api/user/webhooks/"+sub.ID+"/test", "user1", "")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	var delivery webhooks.Delivery
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &delivery))
+	assert.Equal(t, webhooks.TypePing, delivery.Event)
+
+	rr = request(http.MethodPost, "/api/user/webhooks/"+sub.ID+"/deliveries/"+delivery.ID+"/replay", "user1", "")
+	require.Equal(t, http.StatusAccepted, rr.Code)
+
+	rr = request(http.MethodGet, "/api/user/webhooks/"+sub.ID+"/deliveries", "user1", "")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var deliveries []webhooks.Delivery
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &deliveries))
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, delivery.ID, deliveries[1].ID)
+	assert.Equal(t, delivery.ID, deliveries[0].ReplayOf)
+
+	rr = request(http.MethodDelete, "/api/user/webhooks/"+sub.ID, "user1", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = request(http.MethodGet, "/api/user/webhooks/"+sub.ID+"/deliveries", "user1", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	app.Webhooks = nil
+	rr = request(http.MethodGet, "/api/user/webhooks", "user1", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestGetAdminAudit(t *testing.T) {
+	s := newTestStore(t)
+	auditLog, err := audit.New(audit.Options{})
+	require.NoError(t, err)
+	resolver, err := clientip.New()
+	require.NoError(t, err)
+	app := &config.App{Flags: &f, Store: s, URLChan: make(chan storeInterface.DeletedURLs, 1), Audit: auditLog, ClientIP: resolver}
+
+	router := chi.NewRouter()
+	router.Use(middlewares.RequestID(zap.NewNop()), resolver.Middleware, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), userid.ContextUserKey, "user1")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) { PostRoot(w, r, app) })
+	router.Delete("/api/user/urls", func(w http.ResponseWriter, r *http.Request) { DeleteAPIUserURLs(w, r, app) })
+	router.Put("/api/admin/urls/{id}/verdict", func(w http.ResponseWriter, r *http.Request) { PutAdminURLVerdict(w, r, app) })
+	router.Get("/api/admin/audit", func(w http.ResponseWriter, r *http.Request) { GetAdminAudit(w, r, app) })
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Request-ID", "req-"+strings.ToLower(method))
+		req.AddCookie(&http.Cookie{Name: "UserID", Value: "encrypted"})
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	start := time.Now().UTC()
+	rr := request(http.MethodPost, "/", "https://example.com/audited")
+	require.Equal(t, http.StatusCreated, rr.Code)
+	short := rr.Body.String()[strings.LastIndex(rr.Body.String(), "/")+1:]
+
+	require.Equal(t, http.StatusAccepted, request(http.MethodDelete, "/api/user/urls", `["`+short+`", "missing"]`).Code)
+	require.NoError(t, flush(app, []storeInterface.DeletedURLs{<-app.URLChan}))
+	require.Equal(t, http.StatusNoContent, request(http.MethodPut, "/api/admin/urls/"+short+"/verdict", `{"verdict":"block"}`).Code)
+	require.Equal(t, http.StatusNotFound, request(http.MethodPut, "/api/admin/urls/missing/verdict", `{"verdict":"block"}`).Code)
+
+	query := func(params string) []audit.Entry {
+		rr := request(http.MethodGet, "/api/admin/audit?"+params, "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var entries []audit.Entry
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+		return entries
+	}
+
+	assert.Empty(t, query("short=missing"), "only deleted links are recorded")
+
+	entries := query("short=" + short)
+	require.Len(t, entries, 3, "failed actions are not recorded")
+	assert.Equal(t, audit.ActionCreate, entries[0].Action)
+	assert.Equal(t, "user1", entries[0].Actor)
+	assert.Equal(t, "192.0.2.1", entries[0].IP)
+	assert.Equal(t, "req-post", entries[0].RequestID)
+	assert.Equal(t, audit.ActionDelete, entries[1].Action)
+	assert.Equal(t, []string{short}, entries[1].Shorts)
+	assert.Equal(t, "192.0.2.1", entries[1].IP)
+	assert.Equal(t, "req-delete", entries[1].RequestID)
+	assert.Equal(t, audit.ActionUpdate, entries[2].Action)
+	assert.Equal(t, audit.ActorAdmin, entries[2].Actor)
+	assert.Equal(t, `verdict="block"`, entries[2].Details)
+
+	assert.Len(t, query("action=link.delete&from="+start.Format(time.RFC3339)), 1)
+	assert.Empty(t, query("to="+start.Add(-time.Minute).Format(time.RFC3339)))
+	assert.Len(t, query("limit=2"), 2)
+
+	rr = request(http.MethodGet, "/api/admin/audit?limit=2", "")
+	assert.Equal(t, "true", rr.Header().Get(HeaderAuditTruncated))
+	rr = request(http.MethodGet, "/api/admin/audit?limit=3", "")
+	assert.Empty(t, rr.Header().Get(HeaderAuditTruncated))
+
+	for _, params := range []string{"from=yesterday", "to=1", "limit=0", "limit=x"} {
+		rr := request(http.MethodGet, "/api/admin/audit?"+params, "")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, params)
+	}
+}
@@ -4,13 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"net/url"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
 	"github.com/kupriyanovkk/shortener/internal/failure"
-	"github.com/kupriyanovkk/shortener/internal/generator"
+	"github.com/kupriyanovkk/shortener/internal/links"
 	"github.com/kupriyanovkk/shortener/internal/models"
-	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
 	"github.com/kupriyanovkk/shortener/internal/userid"
 )
 
@@ -18,7 +16,6 @@ import (
 func PostAPIShorten(w http.ResponseWriter, r *http.Request, app *config.App) {
 	var req models.Request
 	dec := json.NewDecoder(r.Body)
-	baseURL := app.Flags.BaseURL
 	userID := userid.Get(r.Context())
 
 	if err := dec.Decode(&req); err != nil {
@@ -26,24 +23,17 @@ func PostAPIShorten(w http.ResponseWriter, r *http.Request, app *config.App) {
 		return
 	}
 
-	parsedURL, err := url.ParseRequestURI(req.URL)
-	if err != nil {
-		http.Error(w, "Error parsing URL", http.StatusBadRequest)
+	short, saveErr := links.Create(r.Context(), app, req.URL, userID)
+
+	if writeCreateError(w, saveErr) {
 		return
 	}
 
-	id, _ := generator.GetRandomStr(10)
-	short, saveErr := app.Store.AddValue(r.Context(), storeInterface.AddValueOptions{
-		Original: parsedURL.String(),
-		BaseURL:  baseURL,
-		Short:    id,
-		UserID:   userID,
-	})
-
 	resp := models.Response{
 		Result: short,
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", short)
 	if errors.Is(saveErr, failure.ErrConflict) {
 		w.WriteHeader(http.StatusConflict)
 	} else {
@@ -54,6 +44,4 @@ func PostAPIShorten(w http.ResponseWriter, r *http.Request, app *config.App) {
 	if err := enc.Encode(resp); err != nil {
 		return
 	}
-
-	w.Header().Set("Location", short)
 }
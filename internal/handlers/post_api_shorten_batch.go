@@ -4,13 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
-	"net/url"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
 	"github.com/kupriyanovkk/shortener/internal/failure"
-	"github.com/kupriyanovkk/shortener/internal/generator"
+	"github.com/kupriyanovkk/shortener/internal/links"
 	"github.com/kupriyanovkk/shortener/internal/models"
-	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
 	"github.com/kupriyanovkk/shortener/internal/userid"
 )
 
@@ -18,7 +16,6 @@ import (
 func PostAPIShortenBatch(w http.ResponseWriter, r *http.Request, app *config.App) {
 	var req []models.BatchRequest
 	var result []models.BatchResponse
-	baseURL := app.Flags.BaseURL
 	dec := json.NewDecoder(r.Body)
 	userID := userid.Get(r.Context())
 
@@ -32,28 +29,24 @@ func PostAPIShortenBatch(w http.ResponseWriter, r *http.Request, app *config.App
 		return
 	}
 
+	if err := app.Quota.CheckBatch(userID, len(req)); writeCreateError(w, err) {
+		return
+	}
+
 	for _, v := range req {
-		parsedURL, err := url.ParseRequestURI(v.OriginalURL)
-		if err != nil {
-			http.Error(w, "Error parsing URL", http.StatusBadRequest)
+		short, saveErr := links.Create(r.Context(), app, v.OriginalURL, userID)
+		if errors.Is(saveErr, failure.ErrConflict) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if writeCreateError(w, saveErr) {
 			return
 		}
 
-		id, _ := generator.GetRandomStr(10)
-		short, saveErr := app.Store.AddValue(r.Context(), storeInterface.AddValueOptions{
-			Original: parsedURL.String(),
-			BaseURL:  baseURL,
-			Short:    id,
-			UserID:   userID,
-		})
 		result = append(result, models.BatchResponse{
 			CorrelationID: v.CorrelationID,
 			ShortURL:      short,
 		})
-		if errors.Is(saveErr, failure.ErrConflict) {
-			w.WriteHeader(http.StatusConflict)
-			return
-		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
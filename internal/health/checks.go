@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Ping returns the check of a component reachable by ping, e.g. the store.
+func Ping(ping func() error) Check {
+	return func(ctx context.Context) error {
+		return ping()
+	}
+}
+
+// Writable returns the check that the file at path can be opened for writing.
+func Writable(path string) Check {
+	return func(ctx context.Context) error {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return err
+		}
+
+		return f.Close()
+	}
+}
+
+// Backlog returns the check that a queue has no more than max items.
+func Backlog(length func(ctx context.Context) (int, error), max int) Check {
+	return func(ctx context.Context) error {
+		n, err := length(ctx)
+		if err != nil {
+			return err
+		}
+		if n > max {
+			return fmt.Errorf("backlog of %d items exceeds %d", n, max)
+		}
+
+		return nil
+	}
+}
+
+// ErrNoCertificate is returned by certificate loaders when no certificate is issued yet.
+var ErrNoCertificate = errors.New("no certificate")
+
+// Certificate returns the check that the PEM encoded certificate returned by load
+// is valid for at least minValidity more. Certificates not issued yet are not an error,
+// as they are issued on the first TLS handshake.
+func Certificate(load func(ctx context.Context) ([]byte, error), minValidity time.Duration) Check {
+	return func(ctx context.Context) error {
+		data, err := load(ctx)
+		if errors.Is(err, ErrNoCertificate) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				return errors.New("no certificate in PEM data")
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			if now.Before(cert.NotBefore) {
+				return fmt.Errorf("certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339))
+			}
+			if now.Add(minValidity).After(cert.NotAfter) {
+				return fmt.Errorf("certificate expires at %s", cert.NotAfter.Format(time.RFC3339))
+			}
+
+			return nil
+		}
+	}
+}
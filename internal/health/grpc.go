@@ -0,0 +1,96 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer implements the standard grpc.health.v1.Health service by readiness of Checker.
+type GRPCServer struct {
+	healthpb.UnimplementedHealthServer
+
+	checker  *Checker
+	services map[string]bool
+	interval time.Duration
+}
+
+// GRPCServer returns the health service reporting readiness of the server as a whole,
+// the empty service name, and of the services.
+func (c *Checker) GRPCServer(services ...string) *GRPCServer {
+	s := &GRPCServer{
+		checker:  c,
+		services: map[string]bool{"": true},
+		interval: 5 * time.Second,
+	}
+	for _, service := range services {
+		s.services[service] = true
+	}
+
+	return s
+}
+
+// Check returns the serving status of the service.
+func (s *GRPCServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if !s.services[req.GetService()] {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.GetService())
+	}
+
+	return &healthpb.HealthCheckResponse{Status: s.status(ctx)}, nil
+}
+
+// Watch streams the serving status of the service whenever it changes. Readiness is
+// checked every few seconds. The stream ends after reporting NOT_SERVING on shutdown,
+// so it doesn't hold up the graceful stop of the server.
+func (s *GRPCServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	ctx := stream.Context()
+
+	if !s.services[req.GetService()] {
+		err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVICE_UNKNOWN})
+		if err != nil {
+			return err
+		}
+		select {
+		case <-s.checker.done():
+			return nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	last := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		current := s.status(ctx)
+		if current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.checker.done():
+			if last != healthpb.HealthCheckResponse_NOT_SERVING {
+				return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING})
+			}
+			return nil
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+func (s *GRPCServer) status(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if !s.checker.Ready(ctx).OK() {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+
+	return healthpb.HealthCheckResponse_SERVING
+}
@@ -0,0 +1,197 @@
+// Package health reports liveness and readiness of the service.
+//
+// Readiness is made of named component checks, e.g. store reachability, which run
+// concurrently with a timeout on every probe. Readiness fails when any check fails
+// and once the service is shutting down, so load balancers stop sending requests
+// before the listeners are closed.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Statuses of checks and reports.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check returns an error when the component is not healthy.
+type Check func(ctx context.Context) error
+
+// Result is a result of a single check.
+type Result struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is a result of a probe.
+type Report struct {
+	Status       string            `json:"status"`
+	ShuttingDown bool              `json:"shutting_down,omitempty"`
+	Checks       map[string]Result `json:"checks,omitempty"`
+}
+
+// OK reports whether the probe succeeded.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs readiness checks.
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+
+	shuttingDown atomic.Bool
+	stopOnce     sync.Once
+	stopped      chan struct{}
+}
+
+// New returns Checker running checks with timeout, 2 seconds by default.
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	return &Checker{timeout: timeout, stopped: make(chan struct{})}
+}
+
+// Add adds the readiness check of the component.
+func (c *Checker) Add(name string, check Check) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Shutdown makes readiness fail from now on.
+func (c *Checker) Shutdown() {
+	if c == nil {
+		return
+	}
+
+	c.stopOnce.Do(func() {
+		c.shuttingDown.Store(true)
+		close(c.stopped)
+	})
+}
+
+// done returns the channel closed on shutdown.
+func (c *Checker) done() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+
+	return c.stopped
+}
+
+// Live returns the liveness report, which is ok while the process serves requests.
+func (c *Checker) Live(ctx context.Context) Report {
+	return Report{Status: StatusOK}
+}
+
+// Ready runs readiness checks and returns their report.
+func (c *Checker) Ready(ctx context.Context) Report {
+	if c == nil {
+		return Report{Status: StatusOK}
+	}
+
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			results[i] = run(ctx, check)
+		}(i, check.check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	for i, check := range checks {
+		report.Checks[check.name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusFail
+		report.ShuttingDown = true
+	}
+
+	return report
+}
+
+// run runs the check, giving up when ctx is done even if the check doesn't respect it.
+func run(ctx context.Context, check Check) Result {
+	start := time.Now()
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Status:     StatusOK,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// WriteReport writes the report as JSON, with 503 Service Unavailable status when it failed.
+func WriteReport(w http.ResponseWriter, report Report) {
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
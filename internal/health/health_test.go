@@ -0,0 +1,216 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestReady(t *testing.T) {
+	checker := New(50 * time.Millisecond)
+	checker.Add("ok", func(ctx context.Context) error { return nil })
+
+	report := checker.Ready(context.Background())
+	assert.True(t, report.OK())
+	assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+
+	checker.Add("broken", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.Add("hanging", Ping(func() error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	}))
+	checker.Add("panicking", func(ctx context.Context) error { panic("oops") })
+
+	report = checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.Equal(t, Result{Status: StatusFail, Error: "connection refused"}, withoutDuration(report.Checks["broken"]))
+	assert.Equal(t, Result{Status: StatusFail, Error: context.DeadlineExceeded.Error()}, withoutDuration(report.Checks["hanging"]))
+	assert.Equal(t, Result{Status: StatusFail, Error: "check panicked: oops"}, withoutDuration(report.Checks["panicking"]))
+	assert.Equal(t, StatusOK, report.Checks["ok"].Status)
+}
+
+func withoutDuration(r Result) Result {
+	r.DurationMS = 0
+	return r
+}
+
+func TestShutdown(t *testing.T) {
+	checker := New(0)
+	assert.True(t, checker.Ready(context.Background()).OK())
+
+	checker.Shutdown()
+	checker.Shutdown()
+
+	report := checker.Ready(context.Background())
+	assert.False(t, report.OK())
+	assert.True(t, report.ShuttingDown)
+	assert.True(t, checker.Live(context.Background()).OK(), "liveness doesn't depend on shutdown")
+
+	var nilChecker *Checker
+	nilChecker.Add("ok", nil)
+	nilChecker.Shutdown()
+	assert.True(t, nilChecker.Ready(context.Background()).OK())
+}
+
+func TestWriteReport(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteReport(w, Report{Status: StatusFail, Checks: map[string]Result{"store": {Status: StatusFail, Error: "down"}}})
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"fail","checks":{"store":{"status":"fail","error":"down","duration_ms":0}}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	WriteReport(w, Report{Status: StatusOK})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestWritable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.jsonl")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	assert.NoError(t, Writable(path)(context.Background()))
+	assert.Error(t, Writable(filepath.Join(t.TempDir(), "missing"))(context.Background()))
+}
+
+func TestBacklog(t *testing.T) {
+	length := func(n int) func(ctx context.Context) (int, error) {
+		return func(ctx context.Context) (int, error) { return n, nil }
+	}
+
+	assert.NoError(t, Backlog(length(10), 10)(context.Background()))
+	assert.EqualError(t, Backlog(length(11), 10)(context.Background()), "backlog of 11 items exceeds 10")
+}
+
+func selfSigned(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	// Certificates are cached by autocert after the private key.
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+}
+
+func TestCertificate(t *testing.T) {
+	now := time.Now()
+	load := func(data []byte, err error) func(ctx context.Context) ([]byte, error) {
+		return func(ctx context.Context) ([]byte, error) { return data, err }
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		err     error
+		wantErr bool
+	}{
+		{name: "Valid", data: selfSigned(t, now.Add(-time.Hour), now.Add(30*24*time.Hour))},
+		{name: "Expiring", data: selfSigned(t, now.Add(-time.Hour), now.Add(time.Hour)), wantErr: true},
+		{name: "Not valid yet", data: selfSigned(t, now.Add(time.Hour), now.Add(30*24*time.Hour)), wantErr: true},
+		{name: "Not issued", err: ErrNoCertificate},
+		{name: "Unreadable", err: errors.New("permission denied"), wantErr: true},
+		{name: "Malformed", data: []byte("garbage"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Certificate(load(test.data, test.err), 24*time.Hour)(context.Background())
+			assert.Equal(t, test.wantErr, err != nil, "error: %v", err)
+		})
+	}
+}
+
+type watchStream struct {
+	grpc.ServerStream
+
+	ctx  context.Context
+	sent chan healthpb.HealthCheckResponse_ServingStatus
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(resp *healthpb.HealthCheckResponse) error {
+	s.sent <- resp.Status
+	return nil
+}
+
+func TestGRPCServer(t *testing.T) {
+	ctx := context.Background()
+	var down atomic.Bool
+	checker := New(0)
+	checker.Add("store", func(ctx context.Context) error {
+		if down.Load() {
+			return errors.New("down")
+		}
+		return nil
+	})
+	server := checker.GRPCServer("shortener.Shortener")
+	server.interval = 10 * time.Millisecond
+
+	resp, err := server.Check(ctx, &healthpb.HealthCheckRequest{Service: "shortener.Shortener"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	_, err = server.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	unknown := &watchStream{ctx: ctx, sent: make(chan healthpb.HealthCheckResponse_ServingStatus, 10)}
+	unknownDone := make(chan error)
+	go func() {
+		unknownDone <- server.Watch(&healthpb.HealthCheckRequest{Service: "unknown"}, unknown)
+	}()
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, <-unknown.sent)
+
+	stream := &watchStream{ctx: ctx, sent: make(chan healthpb.HealthCheckResponse_ServingStatus, 10)}
+	done := make(chan error)
+	go func() {
+		done <- server.Watch(&healthpb.HealthCheckRequest{}, stream)
+	}()
+
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, <-stream.sent)
+
+	down.Store(true)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, <-stream.sent)
+
+	checker.Shutdown()
+	assert.NoError(t, <-done, "watch ends on shutdown")
+	assert.NoError(t, <-unknownDone, "watch of unknown service ends on shutdown")
+
+	resp, err = server.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
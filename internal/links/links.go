@@ -0,0 +1,108 @@
+// Package links contains logic shared by HTTP and gRPC handlers creating short URLs,
+// streaming their events and recording the audit trail.
+package links
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kupriyanovkk/shortener/internal/audit"
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/generator"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+)
+
+// maxAttempts limits the number of generated IDs tried when they are already taken.
+const maxAttempts = 5
+
+// Create canonicalizes the raw URL, checks it against the policy and saves it
+// into the store under a new short ID unless the store finds that it exceeds the
+// user's quota. New links are passed to the scanner. If the URL was already
+// shortened, the existing short URL is returned along with failure.ErrConflict,
+// even when the quota is exhausted. Taken short IDs are retried with fresh ones.
+func Create(ctx context.Context, app *config.App, raw, userID string) (string, error) {
+	original, err := app.Canonicalizer.Canonicalize(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", failure.ErrInvalidURL, err)
+	}
+
+	if err := app.Policy.Check(ctx, original); err != nil {
+		return "", err
+	}
+
+	verdict, scanned, err := app.Scanner.Before(ctx, original)
+	if err != nil {
+		return "", err
+	}
+
+	strategy := app.Generator
+	if strategy == nil {
+		// nil Generator falls back to random IDs of the default length
+		strategy = (*generator.Generator)(nil)
+	}
+
+	for attempt := 1; ; attempt++ {
+		id, err := strategy.Generate(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		short, err := app.Store.AddValue(ctx, storeInterface.AddValueOptions{
+			Original: original,
+			BaseURL:  app.Flags.BaseURL,
+			Short:    id,
+			UserID:   userID,
+			Quota:    app.Quota.Quota(userID),
+		})
+		if errors.Is(err, failure.ErrShortExists) && attempt < maxAttempts {
+			continue
+		}
+		if err == nil {
+			app.Scanner.After(ctx, id, original, verdict, scanned)
+			app.Events.Publish(events.Event{Type: events.TypeCreated, Short: id, Original: original, UserID: userID})
+			Audit(ctx, app, audit.Entry{Action: audit.ActionCreate, Actor: userID, Shorts: []string{id}})
+		}
+
+		return short, err
+	}
+}
+
+// Audit records the entry with the client IP of the request in the audit trail.
+// Failures are logged, they don't fail the audited action, which is already done.
+func Audit(ctx context.Context, app *config.App, e audit.Entry) {
+	e.IP = app.ClientIP.FromContext(ctx)
+	if err := app.Audit.Record(ctx, e); err != nil {
+		logging.FromContext(ctx).Error("cannot record audit entry", zap.Error(err), zap.String("action", string(e.Action)))
+	}
+}
+
+// Subscribe returns the subscription to events of the user's links of the comma separated
+// types, all types by default. Invalid types are reported as failure.ErrInvalidEventType.
+func Subscribe(ctx context.Context, app *config.App, userID, types string) (*events.Subscription, error) {
+	eventTypes, err := events.ParseTypes(types)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", failure.ErrInvalidEventType, err)
+	}
+
+	return app.Events.Subscribe(events.ForUser(userID), eventTypes...), nil
+}
+
+// Redirected publishes the redirect event of the link along with its owner, which is looked
+// up in the store only if someone receives redirect events.
+func Redirected(ctx context.Context, app *config.App, short string) {
+	if !app.Events.Watched(events.TypeRedirect) {
+		return
+	}
+
+	owners, err := app.Store.GetOwners(ctx, []string{short})
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot get owner of redirected link", zap.Error(err), zap.String("short", short))
+	}
+
+	app.Events.Publish(events.Event{Type: events.TypeRedirect, Short: short, UserID: owners[short]})
+}
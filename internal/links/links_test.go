@@ -0,0 +1,111 @@
+package links
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kupriyanovkk/shortener/internal/canonical"
+	"github.com/kupriyanovkk/shortener/internal/config"
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreate(t *testing.T) {
+	canonicalizer, err := canonical.New(canonical.Options{
+		Steps: append(canonical.DefaultSteps, canonical.StepTracking),
+	})
+	require.NoError(t, err)
+
+	app := &config.App{
+		Flags:         &config.ConfigFlags{BaseURL: "http://localhost:8080"},
+		Store:         inmemory.NewStore(),
+		Canonicalizer: canonicalizer,
+	}
+	ctx := context.Background()
+
+	short, err := Create(ctx, app, "http://example.com/b", "user")
+	require.NoError(t, err)
+
+	duplicate, err := Create(ctx, app, "HTTP://Example.com:80/a/../b?utm_source=x", "user")
+	assert.ErrorIs(t, err, failure.ErrConflict)
+	assert.Equal(t, short, duplicate)
+
+	_, err = Create(ctx, app, "invalid-url", "user")
+	assert.ErrorIs(t, err, failure.ErrInvalidURL)
+}
+
+// clashingStore reports the first clashes AddValue calls as taken short IDs.
+type clashingStore struct {
+	storeInterface.Store
+	clashes int
+	shorts  []string
+}
+
+func (s *clashingStore) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+	s.shorts = append(s.shorts, opts.Short)
+	if len(s.shorts) <= s.clashes {
+		return "", failure.ErrShortExists
+	}
+
+	return s.Store.AddValue(ctx, opts)
+}
+
+func TestCreateRetriesTakenIDs(t *testing.T) {
+	ctx := context.Background()
+
+	store := &clashingStore{Store: inmemory.NewStore(), clashes: 2}
+	app := &config.App{Flags: &config.ConfigFlags{BaseURL: "http://localhost:8080"}, Store: store}
+
+	short, err := Create(ctx, app, "http://example.com/", "user")
+	require.NoError(t, err)
+	require.Len(t, store.shorts, 3)
+	assert.Equal(t, "http://localhost:8080/"+store.shorts[2], short)
+	assert.NotEqual(t, store.shorts[0], store.shorts[1], "every attempt uses a fresh ID")
+
+	store = &clashingStore{Store: inmemory.NewStore(), clashes: maxAttempts}
+	app.Store = store
+
+	_, err = Create(ctx, app, "http://example.com/", "user")
+	assert.ErrorIs(t, err, failure.ErrShortExists)
+	assert.Len(t, store.shorts, maxAttempts)
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx := context.Background()
+	app := &config.App{
+		Flags:  &config.ConfigFlags{BaseURL: "http://localhost:8080"},
+		Store:  inmemory.NewStore(),
+		Events: events.NewBus(0),
+	}
+
+	existing, err := Create(ctx, app, "http://example.com/a", "user")
+	require.NoError(t, err)
+
+	_, err = Subscribe(ctx, app, "user", "created,clicked")
+	assert.ErrorIs(t, err, failure.ErrInvalidEventType)
+
+	sub, err := Subscribe(ctx, app, "user", "redirect")
+	require.NoError(t, err)
+	defer sub.Close()
+
+	short, err := Create(ctx, app, "http://example.com/b", "user")
+	require.NoError(t, err)
+	other, err := Create(ctx, app, "http://example.com/c", "other")
+	require.NoError(t, err)
+
+	for _, u := range []string{existing, other, short} {
+		Redirected(ctx, app, u[len("http://localhost:8080/"):])
+	}
+	Redirected(ctx, app, "unknown")
+
+	for _, u := range []string{existing, short} {
+		e := <-sub.Events()
+		assert.Equal(t, events.TypeRedirect, e.Type)
+		assert.Equal(t, u, "http://localhost:8080/"+e.Short, "redirects by existing and new links are streamed")
+	}
+	assert.Empty(t, sub.Events())
+}
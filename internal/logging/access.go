@@ -0,0 +1,287 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Formats of access log lines, FormatJSON is shared with the application logger.
+// Any other format containing "{{" is a text/template executed with AccessEntry.
+const (
+	FormatCombined = "combined"
+	FormatCommon   = "common"
+)
+
+// clfTime is the time layout of Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// stdout is the access log output when no file is configured.
+var stdout io.Writer = os.Stdout
+
+// AccessEntry describes a served HTTP request.
+type AccessEntry struct {
+	Time       time.Time     `json:"time"`
+	RemoteAddr string        `json:"remote_addr"`
+	Host       string        `json:"host"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"`
+	Proto      string        `json:"proto"`
+	Status     int           `json:"status"`
+	Size       int           `json:"size"`
+	Duration   time.Duration `json:"duration"`
+	Referer    string        `json:"referer,omitempty"`
+	UserAgent  string        `json:"user_agent,omitempty"`
+	RequestID  string        `json:"request_id,omitempty"`
+}
+
+// AccessOptions configures AccessLog.
+type AccessOptions struct {
+	// Format of lines: combined, common, json or a text/template.
+	// When both Format and Output are empty, requests are logged by the request-scoped logger.
+	Format string
+	// Output is a path of the access log file, "-" or empty for stdout.
+	Output string
+	// Sampling is a comma separated list of sampling rates by status, e.g. "3xx=0.01,404=0.1".
+	// Statuses not listed are always logged.
+	Sampling string
+	// Rotate configures rotation of the access log file.
+	Rotate RotateOptions
+}
+
+// AccessLog writes entries of served requests.
+type AccessLog struct {
+	format   func(w *bytes.Buffer, e AccessEntry) error
+	sampling map[string]float64
+	random   func() float64
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+	out io.Writer
+}
+
+// NewAccessLog returns the access log configured by opts.
+func NewAccessLog(opts AccessOptions) (*AccessLog, error) {
+	sampling, err := ParseSampling(opts.Sampling)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &AccessLog{sampling: sampling, random: rand.Float64}
+	if opts.Format == "" && opts.Output == "" {
+		return a, nil
+	}
+
+	if a.format, err = accessFormat(opts.Format); err != nil {
+		return nil, err
+	}
+
+	if opts.Output == "" || opts.Output == "-" {
+		a.out = stdout
+		return a, nil
+	}
+
+	if a.out, err = OpenRotating(opts.Output, opts.Rotate); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Log writes the entry unless it is dropped by sampling.
+func (a *AccessLog) Log(ctx context.Context, e AccessEntry) {
+	if a != nil && !a.sampled(e.Status) {
+		return
+	}
+
+	if a == nil || a.out == nil {
+		FromContext(ctx).Info("request",
+			zap.String("uri", e.URI),
+			zap.String("method", e.Method),
+			zap.Int("status", e.Status),
+			zap.Duration("duration", e.Duration),
+			zap.Int("size", e.Size),
+		)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.buf.Reset()
+	if err := a.format(&a.buf, e); err != nil {
+		FromContext(ctx).Warn("access log: cannot format entry", zap.Error(err))
+		return
+	}
+	if a.buf.Len() == 0 || a.buf.Bytes()[a.buf.Len()-1] != '\n' {
+		a.buf.WriteByte('\n')
+	}
+	if _, err := a.out.Write(a.buf.Bytes()); err != nil {
+		FromContext(ctx).Warn("access log: cannot write entry", zap.Error(err))
+	}
+}
+
+// Close closes the access log file.
+func (a *AccessLog) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	if c, ok := a.out.(io.Closer); ok && a.out != stdout {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// sampled reports whether the entry of the status should be logged.
+func (a *AccessLog) sampled(status int) bool {
+	if len(a.sampling) == 0 {
+		return true
+	}
+
+	code := strconv.Itoa(status)
+	rate, ok := a.sampling[code]
+	if !ok && len(code) == 3 {
+		rate, ok = a.sampling[code[:1]+"xx"]
+	}
+	if !ok || rate >= 1 {
+		return true
+	}
+
+	return a.random() < rate
+}
+
+// ParseSampling parses sampling rates by status code, e.g. 404, or status class, e.g. 3xx.
+// Rates of codes take precedence over rates of classes.
+func ParseSampling(value string) (map[string]float64, error) {
+	sampling := make(map[string]float64)
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		status, rateValue, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sampling %q, expected status=rate", item)
+		}
+
+		status = strings.ToLower(strings.TrimSpace(status))
+		if !validStatus(status) {
+			return nil, fmt.Errorf("invalid sampling status %q, expected e.g. 404 or 3xx", status)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sampling rate %q, expected a number from 0 to 1", rateValue)
+		}
+
+		sampling[status] = rate
+	}
+
+	return sampling, nil
+}
+
+func validStatus(status string) bool {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return false
+	}
+	if status[1:] == "xx" {
+		return true
+	}
+
+	return status[1] >= '0' && status[1] <= '9' && status[2] >= '0' && status[2] <= '9'
+}
+
+// accessFormat returns the function writing entries in the format.
+func accessFormat(format string) (func(w *bytes.Buffer, e AccessEntry) error, error) {
+	switch format {
+	case "", FormatCombined:
+		return writeCombined, nil
+	case FormatCommon:
+		return writeCommon, nil
+	case FormatJSON:
+		return func(w *bytes.Buffer, e AccessEntry) error {
+			return json.NewEncoder(w).Encode(e)
+		}, nil
+	}
+
+	if !strings.Contains(format, "{{") {
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+
+	tmpl, err := template.New("access").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log template: %w", err)
+	}
+
+	return func(w *bytes.Buffer, e AccessEntry) error {
+		return tmpl.Execute(w, e)
+	}, nil
+}
+
+// writeCommon writes the entry in Common Log Format.
+func writeCommon(w *bytes.Buffer, e AccessEntry) error {
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.Itoa(e.Size)
+	}
+
+	_, err := fmt.Fprintf(w, "%s - - [%s] %s %d %s",
+		dash(e.RemoteAddr), e.Time.Format(clfTime), quote(e.Method+" "+e.URI+" "+e.Proto), e.Status, size)
+
+	return err
+}
+
+// writeCombined writes the entry in Combined Log Format, which is Common Log Format
+// followed by the referer and user agent.
+func writeCombined(w *bytes.Buffer, e AccessEntry) error {
+	if err := writeCommon(w, e); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, " %s %s", quote(dash(e.Referer)), quote(dash(e.UserAgent)))
+
+	return err
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+// quote quotes the value like Apache does, escaping quotes, backslashes and control characters.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
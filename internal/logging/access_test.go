@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEntry = AccessEntry{
+	Time:       time.Date(2024, 3, 1, 12, 30, 45, 0, time.FixedZone("", 3*60*60)),
+	RemoteAddr: "192.0.2.1",
+	Host:       "short.example",
+	Method:     "GET",
+	URI:        "/abc",
+	Proto:      "HTTP/1.1",
+	Status:     307,
+	Size:       0,
+	Duration:   1500 * time.Microsecond,
+	UserAgent:  `curl/8.0 "quoted"`,
+	RequestID:  "req-1",
+}
+
+func TestAccessFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatCommon, `192.0.2.1 - - [01/Mar/2024:12:30:45 +0300] "GET /abc HTTP/1.1" 307 -` + "\n"},
+		{FormatCombined, `192.0.2.1 - - [01/Mar/2024:12:30:45 +0300] "GET /abc HTTP/1.1" 307 - "-" "curl/8.0 \"quoted\""` + "\n"},
+		{FormatJSON, `{"time":"2024-03-01T12:30:45+03:00","remote_addr":"192.0.2.1","host":"short.example","method":"GET","uri":"/abc","proto":"HTTP/1.1","status":307,"size":0,"duration":1500000,"user_agent":"curl/8.0 \"quoted\"","request_id":"req-1"}` + "\n"},
+		{`{{.RequestID}} {{.Status}} {{.Duration.Milliseconds}}ms`, "req-1 307 1ms\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var out bytes.Buffer
+			stdout = &out
+			t.Cleanup(func() { stdout = os.Stdout })
+
+			access, err := NewAccessLog(AccessOptions{Format: test.format})
+			require.NoError(t, err)
+			access.Log(context.Background(), testEntry)
+
+			assert.Equal(t, test.want, out.String())
+		})
+	}
+
+	_, err := NewAccessLog(AccessOptions{Format: "apache"})
+	assert.Error(t, err)
+	_, err = NewAccessLog(AccessOptions{Format: "{{.Missing"})
+	assert.Error(t, err)
+}
+
+func TestAccessSampling(t *testing.T) {
+	_, err := ParseSampling("3xx")
+	assert.Error(t, err)
+	_, err = ParseSampling("6xx=0.1")
+	assert.Error(t, err)
+	_, err = ParseSampling("404=2")
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
+
+	access, err := NewAccessLog(AccessOptions{Format: `{{.Status}}`, Sampling: "3xx=0.5, 307=0, 404=1"})
+	require.NoError(t, err)
+	access.random = func() float64 { return 0.3 }
+
+	for _, status := range []int{200, 301, 307, 404} {
+		access.Log(context.Background(), AccessEntry{Status: status})
+	}
+	access.random = func() float64 { return 0.7 }
+	access.Log(context.Background(), AccessEntry{Status: 302})
+
+	assert.Equal(t, "200\n301\n404\n", out.String())
+}
+
+func TestAccessLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+
+	access, err := NewAccessLog(AccessOptions{Output: path})
+	require.NoError(t, err)
+	access.Log(context.Background(), testEntry)
+	require.NoError(t, access.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"GET /abc HTTP/1.1" 307 - "-"`, "combined format is the default")
+}
@@ -0,0 +1,122 @@
+// Package logging builds the application logger and carries request-scoped
+// loggers in contexts, so every line logged while serving a request has its
+// request ID.
+package logging
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/kupriyanovkk/shortener/internal/random"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RequestIDHeader is the HTTP header and, lower-cased, the gRPC metadata key of request IDs.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits request IDs taken from clients.
+const maxRequestIDLength = 128
+
+// Formats of log lines.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Options configures the logger.
+type Options struct {
+	// Format of lines: console (default) or json.
+	Format string
+	// Level is the minimal level of logged lines: debug, info (default), warn or error.
+	Level string
+	// Output is a path of the log file, stderr by default.
+	Output string
+}
+
+// New returns a logger configured by opts.
+func New(opts Options) (*zap.Logger, error) {
+	level := zapcore.InfoLevel
+	if opts.Level != "" {
+		var err error
+		if level, err = zapcore.ParseLevel(opts.Level); err != nil {
+			return nil, err
+		}
+	}
+
+	var cfg zap.Config
+	switch opts.Format {
+	case "", FormatConsole:
+		cfg = zap.NewDevelopmentConfig()
+		cfg.Development = false
+	case FormatJSON:
+		cfg = zap.NewProductionConfig()
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return nil, fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	cfg.Level = zap.NewAtomicLevelAt(level)
+	if opts.Output != "" {
+		cfg.OutputPaths = []string{opts.Output}
+	}
+
+	return cfg.Build()
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b, err := random.Generate(16)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether the request ID received from a client can be used as is:
+// it is not empty, not too long and consists of printable ASCII characters.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WithRequest returns the context carrying the request ID and the logger annotated with it.
+func WithRequest(ctx context.Context, logger *zap.Logger, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+
+	return context.WithValue(ctx, loggerKey, logger.With(zap.String("request_id", requestID)))
+}
+
+// RequestID returns the request ID carried by the context, or empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+
+	return id
+}
+
+// FromContext returns the request-scoped logger carried by the context,
+// or the global logger outside of requests.
+func FromContext(ctx context.Context) *zap.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.Logger); ok {
+		return logger
+	}
+
+	return zap.L()
+}
@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNew(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	logger, err := New(Options{Format: FormatJSON, Level: "warn", Output: path})
+	require.NoError(t, err)
+	logger.Info("hidden")
+	logger.Warn("shown", zap.String("key", "value"))
+	require.NoError(t, logger.Sync())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hidden")
+	assert.Contains(t, string(data), `"msg":"shown","key":"value"`)
+
+	_, err = New(Options{})
+	assert.NoError(t, err)
+	_, err = New(Options{Format: "xml"})
+	assert.Error(t, err)
+	_, err = New(Options{Level: "loud"})
+	assert.Error(t, err)
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID("0f8fad5b-d9cb-469f-a165-70867728950e"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID("with space"))
+	assert.False(t, ValidRequestID("line\nbreak"))
+	assert.False(t, ValidRequestID(strings.Repeat("a", maxRequestIDLength+1)))
+
+	id := NewRequestID()
+	assert.Len(t, id, 32)
+	assert.True(t, ValidRequestID(id))
+}
+
+func TestWithRequest(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	assert.Same(t, zap.L(), FromContext(context.Background()))
+	assert.Empty(t, RequestID(context.Background()))
+
+	ctx := WithRequest(context.Background(), zap.New(core), "req-1")
+	assert.Equal(t, "req-1", RequestID(ctx))
+
+	FromContext(ctx).Info("hello")
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "req-1", logs.All()[0].ContextMap()["request_id"])
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := UnaryServerInterceptor(zap.New(core))
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.Shortener/GetOriginalURLByShort"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-2"))
+	_, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Equal(t, "req-2", RequestID(ctx))
+		FromContext(ctx).Info("handled")
+		return nil, status.Error(codes.NotFound, "deleted")
+	})
+	assert.Error(t, err)
+
+	require.Equal(t, 2, logs.Len())
+	call := logs.All()[1].ContextMap()
+	assert.Equal(t, "req-2", call["request_id"])
+	assert.Equal(t, info.FullMethod, call["method"])
+	assert.Equal(t, "NotFound", call["code"])
+	assert.Equal(t, "req-2", logs.All()[0].ContextMap()["request_id"])
+
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		assert.Len(t, RequestID(ctx), 32, "request ID is generated")
+		return nil, nil
+	})
+	assert.NoError(t, err)
+}
+
+// testStream is a server stream with the context and the header.
+type testStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	interceptor := StreamServerInterceptor(zap.New(core))
+	info := &grpc.StreamServerInfo{FullMethod: "/shortener.Shortener/WatchEvents", IsServerStream: true}
+
+	ss := &testStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "req-3"))}
+	err := interceptor(nil, ss, info, func(srv interface{}, stream grpc.ServerStream) error {
+		assert.Equal(t, "req-3", RequestID(stream.Context()))
+		FromContext(stream.Context()).Info("streaming")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"req-3"}, ss.header.Get("x-request-id"))
+
+	require.Equal(t, 2, logs.Len())
+	call := logs.All()[1].ContextMap()
+	assert.Equal(t, "req-3", call["request_id"])
+	assert.Equal(t, info.FullMethod, call["method"])
+	assert.Equal(t, "OK", call["code"])
+}
@@ -0,0 +1,197 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTime is the time layout of suffixes of rotated files, which sort chronologically.
+const backupTime = "20060102T150405.000"
+
+// RotateOptions configures rotation of a log file.
+type RotateOptions struct {
+	// MaxSize is a size in bytes after which the file is rotated, unlimited by default.
+	MaxSize int64
+	// Interval is a period of time-based rotation, e.g. 24h, disabled by default.
+	// Files are rotated at multiples of Interval since the Unix epoch.
+	Interval time.Duration
+	// MaxBackups is a max number of rotated files kept, all are kept by default.
+	MaxBackups int
+	// MaxAge is a max age of rotated files kept, all are kept by default.
+	MaxAge time.Duration
+}
+
+// RotatingFile is a log file rotated by size and time. Rotated files are renamed
+// to "<path>.<time>" and removed according to the retention options.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+	now  func() time.Time
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	rotate time.Time
+}
+
+// OpenRotating opens the log file at path for appending, creating it if needed.
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	if opts.MaxSize < 0 || opts.Interval < 0 || opts.MaxBackups < 0 || opts.MaxAge < 0 {
+		return nil, fmt.Errorf("invalid rotation options %+v", opts)
+	}
+
+	f := &RotatingFile{path: path, opts: opts, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write writes p to the file, rotating it first if p doesn't fit into MaxSize
+// or the rotation interval has passed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	sizeExceeded := f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize
+	intervalPassed := f.opts.Interval > 0 && !f.now().Before(f.rotate)
+	if sizeExceeded || intervalPassed {
+		if err := f.rotateFile(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	if f.opts.Interval > 0 {
+		f.rotate = f.now().Truncate(f.opts.Interval).Add(f.opts.Interval)
+	}
+
+	return nil
+}
+
+// rotateFile renames the current file, opens a new one and removes expired backups.
+func (f *RotatingFile) rotateFile() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+
+	if f.size > 0 {
+		backup := f.path + "." + f.now().Local().Format(backupTime)
+		if err := os.Rename(f.path, backup); err != nil {
+			return err
+		}
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	return f.removeBackups()
+}
+
+// removeBackups removes rotated files beyond MaxBackups or older than MaxAge.
+func (f *RotatingFile) removeBackups() error {
+	if f.opts.MaxBackups == 0 && f.opts.MaxAge == 0 {
+		return nil
+	}
+
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+
+	// backups are sorted from the newest.
+	for i, backup := range backups {
+		expired := f.opts.MaxAge > 0 && f.now().Sub(backup.created) > f.opts.MaxAge
+		if (f.opts.MaxBackups > 0 && i >= f.opts.MaxBackups) || expired {
+			if err := os.Remove(backup.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type backup struct {
+	path    string
+	created time.Time
+}
+
+// backups returns rotated files of the log file from the newest.
+func (f *RotatingFile) backups() ([]backup, error) {
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(f.path) + "."
+	var backups []backup
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		created, err := time.ParseInLocation(backupTime, suffix, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{
+			path:    filepath.Join(filepath.Dir(f.path), entry.Name()),
+			created: created,
+		})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].created.After(backups[j].created)
+	})
+
+	return backups, nil
+}
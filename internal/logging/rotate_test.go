@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listDir(t *testing.T, dir string) map[string]string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = string(data)
+	}
+
+	return files
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+
+	f, err := OpenRotating(path, RotateOptions{MaxSize: 10, MaxBackups: 2})
+	require.NoError(t, err)
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		now = now.Add(time.Second)
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, map[string]string{
+		"access.log":                     "fourth\n",
+		"access.log.20240301T120004.000": "third\n",
+		"access.log.20240301T120003.000": "second\n",
+	}, listDir(t, dir), "the oldest backup is removed")
+}
+
+func TestRotateByInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+
+	f, err := OpenRotating(path, RotateOptions{Interval: time.Hour, MaxAge: 90 * time.Minute})
+	require.NoError(t, err)
+	defer f.Close()
+	f.now = func() time.Time { return now }
+	f.rotate = now.Add(time.Hour)
+
+	write := func(line string) {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	write("a\n")
+	now = now.Add(30 * time.Minute)
+	write("b\n")
+	now = now.Add(30 * time.Minute)
+	write("c\n")
+	now = now.Add(2 * time.Hour)
+	write("d\n")
+
+	files := listDir(t, dir)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	assert.Len(t, names, 2, "backups older than max age are removed")
+	assert.Equal(t, "d\n", files["access.log"])
+	assert.Equal(t, "c\n", files[names[1]])
+}
+
+func TestOpenRotatingInvalid(t *testing.T) {
+	_, err := OpenRotating(filepath.Join(t.TempDir(), "access.log"), RotateOptions{MaxSize: -1})
+	assert.Error(t, err)
+
+	_, err = OpenRotating(filepath.Join(t.TempDir(), "missing", "access.log"), RotateOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,181 @@
+// Package metrics collects Prometheus metrics of HTTP and gRPC requests,
+// redirects, store operations and URL deletion. Nil *Metrics is valid
+// and collects nothing, so instrumentation can be left in place when
+// metrics are disabled.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version string
+	Date    string
+	Commit  string
+}
+
+// Redirect results.
+const (
+	RedirectHit     = "hit"
+	RedirectMiss    = "miss"
+	RedirectGone    = "gone"
+	RedirectFlagged = "flagged"
+	RedirectBlocked = "blocked"
+)
+
+// Metrics holds collectors registered in its own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests  *prometheus.CounterVec
+	httpDuration  *prometheus.HistogramVec
+	grpcRequests  *prometheus.CounterVec
+	grpcDuration  *prometheus.HistogramVec
+	redirects     *prometheus.CounterVec
+	storeDuration *prometheus.HistogramVec
+	flushDuration *prometheus.HistogramVec
+}
+
+// New returns Metrics with Go runtime, process and build info collectors registered.
+func New(build BuildInfo) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route and status code.",
+		}, []string{"method", "route", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		grpcRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "grpc_requests_total",
+			Help:      "Number of gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		grpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "grpc_request_duration_seconds",
+			Help:      "Duration of gRPC calls by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Number of short URL lookups by result: hit, miss, gone, flagged or blocked.",
+		}, []string{"result"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Duration of store operations by backend, operation and status.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "operation", "status"}),
+		flushDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "delete_flush_duration_seconds",
+			Help:      "Duration of applying batches of deleted URLs to the store.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"status"}),
+	}
+
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "build_info",
+		Help:      "Build information of the running binary, the value is always 1.",
+		ConstLabels: prometheus.Labels{
+			"version": build.Version,
+			"date":    build.Date,
+			"commit":  build.Commit,
+		},
+	})
+	buildInfo.Set(1)
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo,
+		m.httpRequests,
+		m.httpDuration,
+		m.grpcRequests,
+		m.grpcDuration,
+		m.redirects,
+		m.storeDuration,
+		m.flushDuration,
+	)
+
+	return m
+}
+
+// Handler returns the handler serving metrics in the Prometheus exposition format.
+// Nil Metrics responds with 404.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRedirect counts the short URL lookup by its result.
+func (m *Metrics) ObserveRedirect(result string) {
+	if m == nil {
+		return
+	}
+
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveFlush records the duration of applying deleted URLs to the store.
+func (m *Metrics) ObserveFlush(d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	m.flushDuration.WithLabelValues(resultStatus(err)).Observe(d.Seconds())
+}
+
+// RegisterQueue exports the length of the deletion queue, e.g. of the URLChan channel.
+func (m *Metrics) RegisterQueue(length func() int) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "delete_queue_length",
+		Help:      "Number of deletion requests waiting to be applied.",
+	}, func() float64 {
+		return float64(length())
+	}))
+}
+
+// resultStatus returns the status label of the operation result. Lookups of missing,
+// deleted or flagged URLs and conflicts are expected outcomes, not errors.
+func resultStatus(err error) string {
+	switch {
+	case err == nil,
+		errors.Is(err, failure.ErrURLDeleted),
+		errors.Is(err, failure.ErrURLFlagged),
+		errors.Is(err, failure.ErrURLBlocked):
+		return "ok"
+	case errors.Is(err, failure.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, failure.ErrConflict), errors.Is(err, failure.ErrShortExists):
+		return "conflict"
+	}
+
+	return "error"
+}
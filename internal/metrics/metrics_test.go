@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	return w.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	m := New(BuildInfo{Version: "v1.2.3", Date: "2024-01-01", Commit: "abc"})
+	m.RegisterQueue(func() int { return 7 })
+	m.ObserveRedirect(RedirectHit)
+	m.ObserveRedirect(RedirectGone)
+	m.ObserveFlush(time.Millisecond, nil)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `shortener_build_info{commit="abc",date="2024-01-01",version="v1.2.3"} 1`)
+	assert.Contains(t, body, "shortener_delete_queue_length 7")
+	assert.Contains(t, body, `shortener_redirects_total{result="gone"} 1`)
+	assert.Contains(t, body, `shortener_delete_flush_duration_seconds_count{status="ok"} 1`)
+	assert.Contains(t, body, "go_goroutines")
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(BuildInfo{})
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com", http.StatusTemporaryRedirect)
+	})
+
+	for _, path := range []string{"/abc", "/def", "/abc/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "/{id}", "307")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("GET", "unmatched", "404")))
+	assert.Contains(t, scrape(t, m), `shortener_http_request_duration_seconds_count{method="GET",route="/{id}"} 2`)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m := New(BuildInfo{})
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.Shortener/GetOriginalURLByShort"}
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "deleted")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, "NotFound")))
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	m := New(BuildInfo{})
+	info := &grpc.StreamServerInfo{FullMethod: "/shortener.Shortener/WatchEvents", IsServerStream: true}
+
+	err := m.StreamServerInterceptor()(nil, nil, info, func(srv interface{}, ss grpc.ServerStream) error {
+		return status.Error(codes.Canceled, "client gone")
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.grpcRequests.WithLabelValues(info.FullMethod, "Canceled")))
+
+	var nilMetrics *Metrics
+	assert.NoError(t, nilMetrics.StreamServerInterceptor()(nil, nil, info, func(interface{}, grpc.ServerStream) error { return nil }))
+}
+
+func TestWrapStore(t *testing.T) {
+	m := New(BuildInfo{})
+	backend := inmemory.NewStore()
+	store := m.WrapStore(backend, "memory")
+
+	_, err := store.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com"})
+	require.NoError(t, err)
+	_, err = store.GetOriginalURL(context.Background(), "missing")
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `shortener_store_operation_duration_seconds_count{backend="memory",operation="add_value",status="ok"} 1`)
+	assert.Contains(t, body, `shortener_store_operation_duration_seconds_count{backend="memory",operation="get_original_url",status="not_found"} 1`)
+
+	assert.Same(t, backend, store.(*Store).Unwrap())
+}
+
+func TestNil(t *testing.T) {
+	var m *Metrics
+
+	m.ObserveRedirect(RedirectHit)
+	m.ObserveFlush(time.Second, errors.New("failed"))
+	m.RegisterQueue(func() int { return 0 })
+
+	backend := inmemory.NewStore()
+	assert.Same(t, backend, m.WrapStore(backend, "memory"))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	assert.NotNil(t, m.Middleware(next))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.False(t, strings.Contains(w.Body.String(), "shortener_"))
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/models"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+)
+
+// Store measures durations of operations of the wrapped store.
+type Store struct {
+	store   storeInterface.Store
+	backend string
+	m       *Metrics
+}
+
+// WrapStore returns the store measuring its operations labeled by the backend name.
+// Nil Metrics returns the store as is.
+func (m *Metrics) WrapStore(store storeInterface.Store, backend string) storeInterface.Store {
+	if m == nil {
+		return store
+	}
+
+	return &Store{store: store, backend: backend, m: m}
+}
+
+// Unwrap returns the measured store.
+func (s *Store) Unwrap() storeInterface.Store {
+	return s.store
+}
+
+func (s *Store) observe(operation string, start time.Time, err error) {
+	s.m.storeDuration.WithLabelValues(s.backend, operation, resultStatus(err)).Observe(time.Since(start).Seconds())
+}
+
+// GetOriginalURL measures GetOriginalURL of the store.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	start := time.Now()
+	original, err := s.store.GetOriginalURL(ctx, short)
+	s.observe("get_original_url", start, err)
+
+	return original, err
+}
+
+// AddValue measures AddValue of the store.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+	start := time.Now()
+	short, err := s.store.AddValue(ctx, opts)
+	s.observe("add_value", start, err)
+
+	return short, err
+}
+
+// GetUserURLs measures GetUserURLs of the store.
+func (s *Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+	start := time.Now()
+	urls, err := s.store.GetUserURLs(ctx, opts)
+	s.observe("get_user_urls", start, err)
+
+	return urls, err
+}
+
+// GetOwners measures GetOwners of the store.
+func (s *Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	start := time.Now()
+	owners, err := s.store.GetOwners(ctx, shorts)
+	s.observe("get_owners", start, err)
+
+	return owners, err
+}
+
+// Ping measures Ping of the store.
+func (s *Store) Ping() error {
+	start := time.Now()
+	err := s.store.Ping()
+	s.observe("ping", start, err)
+
+	return err
+}
+
+// DeleteURLs measures DeleteURLs of the store.
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	start := time.Now()
+	deleted, err := s.store.DeleteURLs(ctx, opts)
+	s.observe("delete_urls", start, err)
+
+	return deleted, err
+}
+
+// GetInternalStats measures GetInternalStats of the store.
+func (s *Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	start := time.Now()
+	stats, err := s.store.GetInternalStats(ctx, opts)
+	s.observe("get_internal_stats", start, err)
+
+	return stats, err
+}
+
+// SetVerdict measures SetVerdict of the store.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	start := time.Now()
+	err := s.store.SetVerdict(ctx, short, verdict)
+	s.observe("set_verdict", start, err)
+
+	return err
+}
+
+// GetUserUsage measures GetUserUsage of the store.
+func (s *Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	start := time.Now()
+	usage, err := s.store.GetUserUsage(ctx, userID, since)
+	s.observe("get_user_usage", start, err)
+
+	return usage, err
+}
+
+// AddClicks measures AddClicks of the store.
+func (s *Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	start := time.Now()
+	totals, err := s.store.AddClicks(ctx, clicks)
+	s.observe("add_clicks", start, err)
+
+	return totals, err
+}
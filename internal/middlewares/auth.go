@@ -3,12 +3,13 @@ package middlewares
 import (
 	"context"
 	"encoding/hex"
-	"fmt"
 	"net/http"
 
 	"github.com/kupriyanovkk/shortener/internal/encrypt"
+	"github.com/kupriyanovkk/shortener/internal/logging"
 	"github.com/kupriyanovkk/shortener/internal/random"
 	"github.com/kupriyanovkk/shortener/internal/userid"
+	"go.uber.org/zap"
 )
 
 // Auth is middleware for checking user authorization.
@@ -17,9 +18,10 @@ func Auth(h http.Handler) http.Handler {
 		userID, _ := random.Generate(10)
 		cookie, cookieErr := r.Cookie("UserID")
 		encrypt, err := encrypt.Get()
+		verified := false
 
 		if err != nil {
-			fmt.Printf("encrypt.Get() error: %v\n", err)
+			logging.FromContext(r.Context()).Error("cannot get cipher", zap.Error(err))
 		} else {
 			if cookieErr != nil {
 				encrypted := encrypt.AEAD.Seal(nil, encrypt.Nonce, userID, nil)
@@ -33,13 +35,15 @@ func Auth(h http.Handler) http.Handler {
 				decode, _ := hex.DecodeString(cookie.Value)
 				decrypted, err := encrypt.AEAD.Open(nil, encrypt.Nonce, decode, nil)
 				if err != nil {
-					fmt.Printf("encrypt.AEAD.Open error: %v\n", err)
+					logging.FromContext(r.Context()).Warn("cannot decrypt user ID cookie", zap.Error(err))
 				}
 				userID = decrypted
+				verified = err == nil
 			}
 		}
 
 		ctx := context.WithValue(r.Context(), userid.ContextUserKey, hex.EncodeToString(userID))
+		ctx = context.WithValue(ctx, userid.ContextVerifiedKey, verified)
 		h.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/kupriyanovkk/shortener/internal/userid"
 )
 
 func TestAuthMiddleware(t *testing.T) {
@@ -28,4 +30,33 @@ func TestAuthMiddleware(t *testing.T) {
 			}
 		}
 	})
+	t.Run("Test Auth middleware verifies UserID cookie", func(t *testing.T) {
+		var verified bool
+		var userID string
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			verified = userid.Verified(r.Context())
+			userID = userid.Get(r.Context())
+		})
+
+		rr := httptest.NewRecorder()
+		Auth(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/api/user/urls", nil))
+		if verified {
+			t.Error("Expected minted user ID not to be verified")
+		}
+		minted := userID
+
+		req := httptest.NewRequest("GET", "/api/user/urls", nil)
+		req.AddCookie(rr.Result().Cookies()[0])
+		Auth(handler).ServeHTTP(httptest.NewRecorder(), req)
+		if !verified || userID != minted {
+			t.Errorf("Expected verified user ID %s, got %s (verified: %v)", minted, userID, verified)
+		}
+
+		req = httptest.NewRequest("GET", "/api/user/urls", nil)
+		req.AddCookie(&http.Cookie{Name: "UserID", Value: "forged"})
+		Auth(handler).ServeHTTP(httptest.NewRecorder(), req)
+		if verified {
+			t.Error("Expected forged user ID not to be verified")
+		}
+	})
 }
@@ -40,6 +40,14 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 	c.w.WriteHeader(statusCode)
 }
 
+// FlushError method flushes compressed data to the client, it is used by http.ResponseController
+func (c *compressWriter) FlushError() error {
+	if err := c.zw.Flush(); err != nil {
+		return err
+	}
+	return http.NewResponseController(c.w).Flush()
+}
+
 // Close method call zw.Close
 func (c *compressWriter) Close() error {
 	return c.zw.Close()
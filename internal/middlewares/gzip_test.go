@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/kupriyanovkk/shortener/internal/config"
@@ -18,13 +19,11 @@ import (
 
 func TestGzip(t *testing.T) {
 	defaultURL := "http://localhost:8080/"
-	storageFile := "/tmp/short-url-db.json"
 	dbDSN := ""
 
 	f := config.ConfigFlags{
-		BaseURL:         defaultURL,
-		FileStoragePath: storageFile,
-		DatabaseDSN:     dbDSN,
+		BaseURL:     defaultURL,
+		DatabaseDSN: dbDSN,
 	}
 
 	// Helper function to create a compressed request body
@@ -51,7 +50,7 @@ func TestGzip(t *testing.T) {
 	}
 
 	t.Run("sends gzip", func(t *testing.T) {
-		s := infile.NewStore(f.FileStoragePath)
+		s := infile.NewStore(filepath.Join(t.TempDir(), "short-url-db.json"))
 		env := &config.App{Flags: &f, Store: s}
 		handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			handlers.PostAPIShorten(w, r, env)
@@ -73,7 +72,7 @@ func TestGzip(t *testing.T) {
 	})
 
 	t.Run("accepts gzip", func(t *testing.T) {
-		s := infile.NewStore(f.FileStoragePath)
+		s := infile.NewStore(filepath.Join(t.TempDir(), "short-url-db.json"))
 		env := &config.App{Flags: &f, Store: s}
 		handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			handlers.PostAPIShorten(w, r, env)
@@ -99,7 +98,7 @@ func TestGzip(t *testing.T) {
 	})
 
 	t.Run("no gzip", func(t *testing.T) {
-		s := infile.NewStore(f.FileStoragePath)
+		s := infile.NewStore(filepath.Join(t.TempDir(), "short-url-db.json"))
 		env := &config.App{Flags: &f, Store: s}
 		handler := Gzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			handlers.PostAPIShorten(w, r, env)
@@ -1,9 +1,11 @@
 package middlewares
 
 import (
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/kupriyanovkk/shortener/internal/logging"
 	"go.uber.org/zap"
 )
 
@@ -32,36 +34,74 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
-// Logger is middleware for logging requests data.
-func Logger(h http.Handler) http.Handler {
-	logger, err := zap.NewDevelopment()
-	if err != nil {
-		panic("cannot initialize zap")
+// Unwrap returns the original ResponseWriter for http.ResponseController
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RequestID is middleware taking the request ID from the X-Request-ID header or generating one.
+// The ID is returned in the response header, and the logger annotated with it is put into
+// the request context for Logger and handlers.
+func RequestID(logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(logging.RequestIDHeader)
+			if !logging.ValidRequestID(requestID) {
+				requestID = logging.NewRequestID()
+			}
+
+			w.Header().Set(logging.RequestIDHeader, requestID)
+			h.ServeHTTP(w, r.WithContext(logging.WithRequest(r.Context(), logger, requestID)))
+		})
 	}
-	defer logger.Sync()
+}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+// Logger is middleware for logging requests data by the request-scoped logger.
+func Logger(h http.Handler) http.Handler {
+	return AccessLog(nil)(h)
+}
+
+// AccessLog is middleware writing served requests to the access log.
+// Requests are logged by the request-scoped logger when access is nil.
+func AccessLog(access *logging.AccessLog) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
 
-		responseData := &responseData{
-			status: 0,
-			size:   0,
-		}
-		lw := loggingResponseWriter{
-			ResponseWriter: w,
-			responseData:   responseData,
-		}
-		h.ServeHTTP(&lw, r)
+			responseData := &responseData{
+				status: 0,
+				size:   0,
+			}
+			lw := loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   responseData,
+			}
+			h.ServeHTTP(&lw, r)
 
-		duration := time.Since(start)
-		sugar := logger.Sugar()
+			status := responseData.status
+			if status == 0 {
+				status = http.StatusOK
+			}
 
-		sugar.Infoln(
-			"uri", r.RequestURI,
-			"method", r.Method,
-			"status", responseData.status,
-			"duration", duration,
-			"size", responseData.size,
-		)
-	})
+			remoteAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				remoteAddr = r.RemoteAddr
+			}
+
+			access.Log(r.Context(), logging.AccessEntry{
+				Time:       start,
+				RemoteAddr: remoteAddr,
+				Host:       r.Host,
+				Method:     r.Method,
+				URI:        r.RequestURI,
+				Proto:      r.Proto,
+				Status:     status,
+				Size:       responseData.size,
+				Duration:   time.Since(start),
+				Referer:    r.Referer(),
+				UserAgent:  r.UserAgent(),
+				RequestID:  logging.RequestID(r.Context()),
+			})
+		})
+	}
 }
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	handler := RequestID(zap.New(core))(Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("handler")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	r.Header.Set(logging.RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, "req-1", w.Header().Get(logging.RequestIDHeader))
+	require.Equal(t, 2, logs.Len())
+	assert.Equal(t, "req-1", logs.All()[0].ContextMap()["request_id"])
+
+	access := logs.All()[1].ContextMap()
+	assert.Equal(t, "req-1", access["request_id"])
+	assert.Equal(t, "/api/shorten", access["uri"])
+	assert.Equal(t, int64(http.StatusCreated), access["status"])
+	assert.Equal(t, int64(len("created")), access["size"])
+
+	r = httptest.NewRequest(http.MethodGet, "/abc", nil)
+	r.Header.Set(logging.RequestIDHeader, "bad id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	generated := w.Header().Get(logging.RequestIDHeader)
+	assert.Len(t, generated, 32)
+	assert.Equal(t, generated, logs.All()[3].ContextMap()["request_id"])
+}
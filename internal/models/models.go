@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Request struct
 type Request struct {
 	URL string `json:"url"`
@@ -10,13 +12,28 @@ type Response struct {
 	Result string `json:"result"`
 }
 
+// Verdict is a result of malicious URL scanning
+type Verdict string
+
+const (
+	// VerdictClean means that nothing suspicious was found
+	VerdictClean Verdict = ""
+	// VerdictWarn means that user should be warned before redirect
+	VerdictWarn Verdict = "warn"
+	// VerdictBlock means that redirect is forbidden
+	VerdictBlock Verdict = "block"
+)
+
 // URL is a structure contains all URL data
 type URL struct {
-	UUID        int    `json:"uuid"`
-	Short       string `json:"short_url"`
-	Original    string `json:"original_url"`
-	UserID      string `json:"user_id"`
-	DeletedFlag bool   `json:"is_deleted"`
+	UUID        int       `json:"uuid"`
+	Short       string    `json:"short_url"`
+	Original    string    `json:"original_url"`
+	UserID      string    `json:"user_id"`
+	DeletedFlag bool      `json:"is_deleted"`
+	Verdict     Verdict   `json:"verdict,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Clicks      int64     `json:"clicks,omitempty"`
 }
 
 // BatchRequest is a structure for URL batching
@@ -39,6 +56,51 @@ type UserURL struct {
 
 // InternalStats is a structure for internal statistics
 type InternalStats struct {
-	URLs  int `json:"urls"`
+	// URLs is a number of all links, including deleted ones
+	URLs int `json:"urls"`
+	// Users is a number of users who have created links
 	Users int `json:"users"`
+	// Active is a number of links, which are not deleted
+	Active int `json:"active"`
+	// Deleted is a number of deleted links
+	Deleted int `json:"deleted"`
+	// Clicks is a number of redirects by all links
+	Clicks int64 `json:"clicks"`
+	// CreatedPerDay is a number of links created per day (UTC), from the oldest day
+	CreatedPerDay []DailyCount `json:"created_per_day"`
+	// TopUsers are users with the most active links
+	TopUsers []UserCount `json:"top_users"`
+	// TopDomains are domains of original URLs with the most active links
+	TopDomains []DomainCount `json:"top_domains"`
+	// StoreSize is a size of the stored data in bytes, if the store reports it
+	StoreSize int64 `json:"store_size_bytes,omitempty"`
+	// QueueBacklog is a number of deletion requests waiting to be applied
+	QueueBacklog int `json:"queue_backlog"`
+}
+
+// DailyCount is a number of links created on the day
+type DailyCount struct {
+	// Day is formatted as 2006-01-02
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// UserCount is a number of user's active links
+type UserCount struct {
+	UserID string `json:"user_id"`
+	Links  int    `json:"links"`
+}
+
+// DomainCount is a number of active links to the domain
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Links  int    `json:"links"`
+}
+
+// Usage is a structure for user's links usage
+type Usage struct {
+	// Links is a number of user's links, which are not deleted
+	Links int `json:"links"`
+	// Created is a number of user's links created since the requested time, including deleted ones
+	Created int `json:"created"`
 }
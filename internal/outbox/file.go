@@ -0,0 +1,62 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+)
+
+type fileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openFile(u *url.URL) (Sink, error) {
+	path := u.Path
+	if path == "" {
+		path = u.Opaque
+	}
+	if path == "" {
+		return nil, fmt.Errorf("outbox: file sink URI needs a path, e.g. file:///tmp/outbox.jsonl")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: opening file sink: %w", err)
+	}
+
+	return &fileSink{file: file}, nil
+}
+
+// Publish appends messages as JSON lines and syncs the file.
+func (s *fileSink) Publish(ctx context.Context, messages []storeInterface.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w := bufio.NewWriter(s.file)
+	enc := json.NewEncoder(w)
+	for _, m := range messages {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
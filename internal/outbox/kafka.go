@@ -0,0 +1,58 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/segmentio/kafka-go"
+)
+
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func openKafka(u *url.URL) (Sink, error) {
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" {
+		return nil, fmt.Errorf("outbox: kafka sink URI needs brokers and topic, e.g. kafka://localhost:9092/shortener")
+	}
+
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(u.Host, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+		},
+	}, nil
+}
+
+// Publish writes messages keyed by the short ID, so events of a link keep their order.
+func (s *kafkaSink) Publish(ctx context.Context, messages []storeInterface.OutboxMessage) error {
+	records := make([]kafka.Message, 0, len(messages))
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		records = append(records, kafka.Message{
+			Key:   []byte(m.Short),
+			Value: data,
+			Headers: []kafka.Header{
+				{Key: "id", Value: []byte(m.ID)},
+				{Key: "type", Value: []byte(m.Type)},
+			},
+		})
+	}
+
+	return s.writer.WriteMessages(ctx, records...)
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,67 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubject is the subject prefix of NATS messages.
+const DefaultSubject = "shortener"
+
+type natsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func openNATS(u *url.URL) (Sink, error) {
+	subject := u.Query().Get("subject")
+	if subject == "" {
+		subject = DefaultSubject
+	}
+
+	server := url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}
+	conn, err := nats.Connect(server.String(), nats.Name("shortener-outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("outbox: connecting to NATS: %w", err)
+	}
+
+	return &natsSink{conn: conn, subject: strings.TrimSuffix(subject, ".")}, nil
+}
+
+// Publish sends messages to <subject>.<type>, the message ID is passed in the
+// Nats-Msg-Id header, which JetStream streams use for deduplication.
+func (s *natsSink) Publish(ctx context.Context, messages []storeInterface.OutboxMessage) error {
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		msg := nats.NewMsg(s.subject + "." + m.Type)
+		msg.Header.Set(nats.MsgIdHdr, m.ID)
+		msg.Data = data
+		if err := s.conn.PublishMsg(msg); err != nil {
+			return err
+		}
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+
+	// Flush waits until the server has received the messages.
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *natsSink) Close() error {
+	return s.conn.Drain()
+}
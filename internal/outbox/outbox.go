@@ -0,0 +1,159 @@
+// Package outbox publishes events recorded in the store outbox to message brokers.
+//
+// Stores implementing storeInterface.Outbox record events of link mutations
+// atomically with the mutations. Relay periodically passes them to a Sink and
+// removes them from the outbox once the sink acknowledges them. Delivery is at
+// least once: messages published before a crash or a failed removal are
+// published again, consumers should skip duplicates by the message ID.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+)
+
+// Default relay settings.
+const (
+	DefaultInterval   = time.Second
+	DefaultBatchSize  = 100
+	DefaultMaxBackoff = time.Minute
+)
+
+// Sink publishes outbox messages. Publish returns nil only when all messages
+// are accepted by the broker.
+type Sink interface {
+	Publish(ctx context.Context, messages []storeInterface.OutboxMessage) error
+	Close() error
+}
+
+// Open creates the sink by the URI:
+//
+//	nats://host:4222?subject=shortener        messages go to <subject>.<type>
+//	kafka://broker1:9092,broker2:9092/topic   messages are keyed by the short ID
+//	file:///var/log/shortener/outbox.jsonl    messages are appended as JSON lines
+func Open(uri string) (Sink, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: invalid sink URI: %w", err)
+	}
+
+	switch u.Scheme {
+	case "nats":
+		return openNATS(u)
+	case "kafka":
+		return openKafka(u)
+	case "file":
+		return openFile(u)
+	case "":
+		return nil, fmt.Errorf("outbox: sink URI %q has no scheme", uri)
+	}
+
+	return nil, fmt.Errorf("outbox: unknown sink %q", u.Scheme)
+}
+
+// Options are settings of Relay.
+type Options struct {
+	// Interval is the period of polling the outbox, DefaultInterval by default.
+	Interval time.Duration
+	// BatchSize limits the number of messages published at once, DefaultBatchSize by default.
+	BatchSize int
+	// MaxBackoff limits the delay after failures, which doubles from Interval, DefaultMaxBackoff by default.
+	MaxBackoff time.Duration
+	// Logger logs failed relays, the global logger is used by default.
+	Logger *zap.Logger
+}
+
+// Relay moves messages from the store outbox to the sink. Nil Relay relays nothing.
+type Relay struct {
+	source storeInterface.Outbox
+	sink   Sink
+	opts   Options
+}
+
+// NewRelay returns Relay publishing messages of the source to the sink.
+func NewRelay(source storeInterface.Outbox, sink Sink, opts Options) *Relay {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.MaxBackoff < opts.Interval {
+		opts.MaxBackoff = opts.Interval
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.L()
+	}
+
+	return &Relay{
+		source: source,
+		sink:   sink,
+		opts:   opts,
+	}
+}
+
+// Flush publishes messages until the outbox is empty and returns the number of published messages.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	if r == nil {
+		return 0, nil
+	}
+
+	total := 0
+	for {
+		n, err := r.source.RelayOutbox(ctx, r.opts.BatchSize, r.sink.Publish)
+		total += n
+		if err != nil || n < r.opts.BatchSize {
+			return total, err
+		}
+	}
+}
+
+// Run relays messages until the context is done, then closes the sink.
+// Failed batches are retried with exponential backoff.
+func (r *Relay) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+
+	defer func() {
+		if err := r.sink.Close(); err != nil {
+			r.opts.Logger.Error("outbox: closing sink failed", zap.Error(err))
+		}
+	}()
+
+	delay := r.opts.Interval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if _, err := r.Flush(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			delay *= 2
+			if delay > r.opts.MaxBackoff {
+				delay = r.opts.MaxBackoff
+			}
+			r.opts.Logger.Error("outbox: relaying messages failed", zap.Error(err), zap.Duration("retry_in", delay))
+		} else {
+			delay = r.opts.Interval
+		}
+
+		timer.Reset(delay)
+	}
+}
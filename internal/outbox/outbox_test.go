@@ -0,0 +1,203 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(t *testing.T) storeInterface.Store {
+	store, err := registry.Open("memory://", storeInterface.Options{Outbox: true})
+	require.NoError(t, err)
+
+	return store
+}
+
+func addLinks(t *testing.T, store storeInterface.Store, shorts ...string) {
+	for _, short := range shorts {
+		_, err := store.AddValue(context.Background(), storeInterface.AddValueOptions{
+			Original: "https://example.com/" + short,
+			Short:    short,
+			UserID:   "user",
+		})
+		require.NoError(t, err)
+	}
+}
+
+func runNATS(t *testing.T) *server.Server {
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoLog: true, NoSigs: true})
+	require.NoError(t, err)
+
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server isn't ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	return srv
+}
+
+func TestOpen(t *testing.T) {
+	for _, uri := range []string{"", "outbox.jsonl", "amqp://localhost", "kafka://localhost:9092", "file://"} {
+		_, err := Open(uri)
+		assert.Error(t, err, uri)
+	}
+
+	sink, err := Open("kafka://localhost:9092,localhost:9093/shortener")
+	require.NoError(t, err)
+	assert.NoError(t, sink.Close())
+}
+
+func TestNATSSink(t *testing.T) {
+	srv := runNATS(t)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sub, err := conn.SubscribeSync("links.>")
+	require.NoError(t, err)
+	require.NoError(t, conn.Flush())
+
+	sink, err := Open(srv.ClientURL() + "?subject=links")
+	require.NoError(t, err)
+
+	store := newStore(t)
+	addLinks(t, store, "first", "second")
+	_, err = store.DeleteURLs(context.Background(), []storeInterface.DeletedURLs{{UserID: "user", URLs: []string{"first"}}})
+	require.NoError(t, err)
+
+	relay := NewRelay(store.(storeInterface.Outbox), sink, Options{BatchSize: 2})
+	n, err := relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	expected := []struct{ subject, short string }{
+		{"links." + storeInterface.OutboxCreated, "first"},
+		{"links." + storeInterface.OutboxCreated, "second"},
+		{"links." + storeInterface.OutboxDeleted, "first"},
+	}
+	ids := make(map[string]bool)
+	for _, e := range expected {
+		msg, err := sub.NextMsg(5 * time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, e.subject, msg.Subject)
+
+		var m storeInterface.OutboxMessage
+		require.NoError(t, json.Unmarshal(msg.Data, &m))
+		assert.Equal(t, e.short, m.Short)
+		assert.Equal(t, m.ID, msg.Header.Get(nats.MsgIdHdr))
+		ids[m.ID] = true
+	}
+	assert.Len(t, ids, 3)
+
+	n, err = relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, n, "published messages are removed from the outbox")
+
+	require.NoError(t, sink.Close())
+}
+
+func TestRelayRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	sink, err := Open("file://" + path)
+	require.NoError(t, err)
+
+	store := newStore(t)
+	addLinks(t, store, "first")
+	_, err = store.AddClicks(context.Background(), map[string]int64{"first": 2})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewRelay(store.(storeInterface.Outbox), sink, Options{Interval: 10 * time.Millisecond}).Run(ctx)
+		close(done)
+	}()
+
+	var messages []storeInterface.OutboxMessage
+	require.Eventually(t, func() bool {
+		messages = readLines(t, path)
+		return len(messages) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, storeInterface.OutboxCreated, messages[0].Type)
+	assert.Equal(t, "https://example.com/first", messages[0].Original)
+	assert.Equal(t, storeInterface.OutboxClicked, messages[1].Type)
+	assert.Equal(t, int64(2), messages[1].Clicks)
+	assert.Error(t, sink.Publish(context.Background(), messages), "sink is closed by Run")
+}
+
+type failingSink struct {
+	failures  int
+	published []storeInterface.OutboxMessage
+}
+
+func (s *failingSink) Publish(ctx context.Context, messages []storeInterface.OutboxMessage) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("broker is unavailable")
+	}
+
+	s.published = append(s.published, messages...)
+	return nil
+}
+
+func (s *failingSink) Close() error {
+	return nil
+}
+
+func TestRelayRetries(t *testing.T) {
+	store := newStore(t)
+	addLinks(t, store, "first", "second")
+
+	sink := &failingSink{failures: 1}
+	relay := NewRelay(store.(storeInterface.Outbox), sink, Options{})
+
+	_, err := relay.Flush(context.Background())
+	require.Error(t, err)
+	assert.Empty(t, sink.published)
+
+	n, err := relay.Flush(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "messages are kept until they are published")
+	assert.Len(t, sink.published, 2)
+
+	var nilRelay *Relay
+	n, err = nilRelay.Flush(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	nilRelay.Run(context.Background())
+}
+
+func readLines(t *testing.T, path string) []storeInterface.OutboxMessage {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var result []storeInterface.OutboxMessage
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var m storeInterface.OutboxMessage
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		result = append(result, m)
+	}
+
+	return result
+}
@@ -0,0 +1,299 @@
+// Package policy decides which destination URLs may be shortened.
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"go.uber.org/zap"
+)
+
+// DefaultSchemes are allowed when no schemes are configured.
+var DefaultSchemes = []string{"http", "https"}
+
+// Error describes why the URL is rejected. It matches failure.ErrForbiddenURL by errors.Is.
+type Error struct {
+	URL    string
+	Reason string
+}
+
+// Error returns text of the policy error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", failure.ErrForbiddenURL, e.Reason)
+}
+
+// Unwrap returns failure.ErrForbiddenURL.
+func (e *Error) Unwrap() error {
+	return failure.ErrForbiddenURL
+}
+
+// Options configures Engine.
+type Options struct {
+	// Schemes lists allowed URL schemes, DefaultSchemes if empty.
+	Schemes []string
+	// ListFile is a path to the file with domain rules, one per line:
+	//
+	//	# comment
+	//	deny phishing.example
+	//	allow example.com
+	//
+	// Rules match the domain and all its subdomains. When at least one allow rule
+	// exists, only allowed domains can be shortened.
+	ListFile string
+	// ReloadInterval is how often ListFile is checked for changes by Watch.
+	ReloadInterval time.Duration
+	// AllowPrivate disables rejection of localhost and private network addresses.
+	AllowPrivate bool
+	// Resolve enables resolving host names to check the addresses they point to.
+	Resolve bool
+	// BaseURL is the address of the service, links pointing to it are rejected.
+	BaseURL string
+}
+
+type lists struct {
+	allow   []string
+	deny    []string
+	modTime time.Time
+}
+
+// Engine checks URLs against the configured policy.
+type Engine struct {
+	opts     Options
+	schemes  map[string]bool
+	selfHost string
+	resolver *net.Resolver
+
+	mu    sync.RWMutex
+	lists lists
+}
+
+// New returns Engine configured by opts. Domain lists are loaded immediately.
+func New(opts Options) (*Engine, error) {
+	schemes := opts.Schemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	e := &Engine{
+		opts:     opts,
+		schemes:  make(map[string]bool, len(schemes)),
+		resolver: net.DefaultResolver,
+	}
+	for _, scheme := range schemes {
+		e.schemes[strings.ToLower(strings.TrimSpace(scheme))] = true
+	}
+
+	if opts.BaseURL != "" {
+		base, err := url.Parse(opts.BaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL: %w", err)
+		}
+		e.selfHost = normalizeHost(base)
+	}
+
+	if opts.ListFile != "" {
+		if err := e.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// Check returns *Error if the URL violates the policy. Nil Engine allows everything.
+func (e *Engine) Check(ctx context.Context, raw string) error {
+	if e == nil {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return &Error{URL: raw, Reason: err.Error()}
+	}
+
+	if !e.schemes[strings.ToLower(u.Scheme)] {
+		return &Error{URL: raw, Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return &Error{URL: raw, Reason: "host is empty"}
+	}
+
+	if e.selfHost != "" && normalizeHost(u) == e.selfHost {
+		return &Error{URL: raw, Reason: "link points to the shortener itself"}
+	}
+
+	e.mu.RLock()
+	l := e.lists
+	e.mu.RUnlock()
+
+	if matchDomain(l.deny, host) {
+		return &Error{URL: raw, Reason: fmt.Sprintf("domain %s is blocked", host)}
+	}
+	if len(l.allow) > 0 && !matchDomain(l.allow, host) {
+		return &Error{URL: raw, Reason: fmt.Sprintf("domain %s is not in the allow list", host)}
+	}
+
+	if !e.opts.AllowPrivate {
+		if err := e.checkPrivate(ctx, host); err != nil {
+			return &Error{URL: raw, Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// Watch reloads the domain lists when ListFile changes until ctx is done.
+func (e *Engine) Watch(ctx context.Context) {
+	if e == nil || e.opts.ListFile == "" {
+		return
+	}
+
+	interval := e.opts.ReloadInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.reload(); err != nil {
+				logging.FromContext(ctx).Error("policy: cannot reload domain list", zap.String("path", e.opts.ListFile), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload reads ListFile if it was modified since the last load.
+func (e *Engine) reload() error {
+	info, err := os.Stat(e.opts.ListFile)
+	if err != nil {
+		return err
+	}
+
+	e.mu.RLock()
+	unchanged := info.ModTime().Equal(e.lists.modTime)
+	e.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(e.opts.ListFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	l, err := parseLists(file)
+	if err != nil {
+		return err
+	}
+	l.modTime = info.ModTime()
+
+	e.mu.Lock()
+	e.lists = l
+	e.mu.Unlock()
+
+	return nil
+}
+
+func parseLists(r io.Reader) (lists, error) {
+	var l lists
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return lists{}, fmt.Errorf("line %d: expected \"allow|deny domain\"", line)
+		}
+
+		domain := strings.TrimSuffix(strings.ToLower(fields[1]), ".")
+		switch fields[0] {
+		case "allow":
+			l.allow = append(l.allow, domain)
+		case "deny":
+			l.deny = append(l.deny, domain)
+		default:
+			return lists{}, fmt.Errorf("line %d: unknown rule %q", line, fields[0])
+		}
+	}
+
+	return l, scanner.Err()
+}
+
+func (e *Engine) checkPrivate(ctx context.Context, host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("host %s is local", host)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if IsPrivate(ip) {
+			return fmt.Errorf("address %s is private", ip)
+		}
+		return nil
+	}
+
+	if !e.opts.Resolve {
+		return nil
+	}
+
+	addrs, err := e.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve host %s", host)
+	}
+	for _, addr := range addrs {
+		if IsPrivate(addr.IP) {
+			return fmt.Errorf("host %s resolves to private address %s", host, addr.IP)
+		}
+	}
+
+	return nil
+}
+
+// IsPrivate reports whether the address is loopback, private, link-local or unspecified.
+func IsPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsInterfaceLocalMulticast()
+}
+
+func matchDomain(domains []string, host string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeHost returns lower-cased host with the default port removed.
+func normalizeHost(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == "" || (port == "80" && u.Scheme == "http") || (port == "443" && u.Scheme == "https") {
+		return host
+	}
+
+	return net.JoinHostPort(host, port)
+}
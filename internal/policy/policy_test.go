@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(listFile, []byte("# rules\ndeny phishing.example\n"), 0644))
+
+	engine, err := New(Options{
+		ListFile: listFile,
+		BaseURL:  "https://short.ly",
+	})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		url     string
+		allowed bool
+	}{
+		{url: "https://example.com/path", allowed: true},
+		{url: "http://example.com:8080/", allowed: true},
+		{url: "javascript:alert(1)", allowed: false},
+		{url: "file:///etc/passwd", allowed: false},
+		{url: "ftp://example.com/file", allowed: false},
+		{url: "https://short.ly/abc", allowed: false},
+		{url: "http://SHORT.ly:443/abc", allowed: true},
+		{url: "http://short.ly/abc", allowed: false},
+		{url: "http://localhost:8080/", allowed: false},
+		{url: "http://api.localhost/", allowed: false},
+		{url: "http://127.0.0.1/", allowed: false},
+		{url: "http://10.0.0.1/", allowed: false},
+		{url: "http://192.168.1.1/", allowed: false},
+		{url: "http://169.254.169.254/latest/meta-data", allowed: false},
+		{url: "http://[::1]/", allowed: false},
+		{url: "http://[fd00::1]/", allowed: false},
+		{url: "http://8.8.8.8/", allowed: true},
+		{url: "http://phishing.example/login", allowed: false},
+		{url: "http://login.phishing.example/", allowed: false},
+		{url: "http://notphishing.example/", allowed: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			err := engine.Check(context.Background(), tc.url)
+			if tc.allowed {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, failure.ErrForbiddenURL)
+			var policyErr *Error
+			require.True(t, errors.As(err, &policyErr))
+			assert.NotEmpty(t, policyErr.Reason)
+		})
+	}
+}
+
+func TestAllowList(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(listFile, []byte("allow example.com\n"), 0644))
+
+	engine, err := New(Options{ListFile: listFile, AllowPrivate: true})
+	require.NoError(t, err)
+
+	assert.NoError(t, engine.Check(context.Background(), "https://docs.example.com/"))
+	assert.NoError(t, engine.Check(context.Background(), "https://example.com:8443/"))
+	assert.Error(t, engine.Check(context.Background(), "http://localhost/"))
+	assert.Error(t, engine.Check(context.Background(), "https://example.org/"))
+}
+
+func TestWatch(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(listFile, []byte(""), 0644))
+
+	engine, err := New(Options{ListFile: listFile, ReloadInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, engine.Check(context.Background(), "https://example.com/"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go engine.Watch(ctx)
+
+	require.NoError(t, os.WriteFile(listFile, []byte("deny example.com\n"), 0644))
+	require.NoError(t, os.Chtimes(listFile, time.Now(), time.Now().Add(time.Minute)))
+
+	assert.Eventually(t, func() bool {
+		return engine.Check(context.Background(), "https://example.com/") != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestParseListsErrors(t *testing.T) {
+	listFile := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(listFile, []byte("block example.com\n"), 0644))
+
+	_, err := New(Options{ListFile: listFile})
+	assert.Error(t, err)
+}
+
+func TestNilEngine(t *testing.T) {
+	var engine *Engine
+	assert.NoError(t, engine.Check(context.Background(), "javascript:alert(1)"))
+}
@@ -0,0 +1,149 @@
+// Package quota limits the number of links users can create.
+package quota
+
+import (
+	"context"
+	"time"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+)
+
+// Limits of the user, zero values mean no limit.
+type Limits struct {
+	// MaxLinks limits the number of user's links, deleted links are not counted.
+	MaxLinks int `json:"max_links"`
+	// MaxBatch limits the number of links in one batch request.
+	MaxBatch int `json:"max_batch"`
+	// MaxPerDay limits the number of links created during a day (UTC), deleted links are counted.
+	MaxPerDay int `json:"max_per_day"`
+}
+
+// Limit names used in Error.
+const (
+	LimitLinks  = storeInterface.QuotaLinks
+	LimitBatch  = storeInterface.QuotaBatch
+	LimitPerDay = storeInterface.QuotaPerDay
+)
+
+// Error is returned when creating links would exceed the quota.
+type Error = storeInterface.QuotaError
+
+// Options configures Manager.
+type Options struct {
+	// Default limits are applied to users without overrides.
+	Default Limits
+	// Users overrides limits of particular users.
+	Users map[string]Limits
+}
+
+// Counter reports usage of the limit.
+type Counter struct {
+	Limit     int  `json:"limit"`
+	Used      int  `json:"used"`
+	Remaining *int `json:"remaining,omitempty"`
+}
+
+// Report describes user's quotas and their usage. Zero limit means no limit.
+type Report struct {
+	Links    Counter   `json:"links"`
+	Daily    Counter   `json:"daily"`
+	MaxBatch int       `json:"max_batch"`
+	Reset    time.Time `json:"reset"`
+}
+
+// Manager provides users' quotas and reports their usage kept in the store.
+type Manager struct {
+	store storeInterface.Store
+	opts  Options
+	now   func() time.Time
+}
+
+// New returns Manager reporting quotas usage in store.
+func New(store storeInterface.Store, opts Options) *Manager {
+	return &Manager{store: store, opts: opts, now: time.Now}
+}
+
+// Limits returns limits of the user.
+func (m *Manager) Limits(userID string) Limits {
+	if limits, ok := m.opts.Users[userID]; ok {
+		return limits
+	}
+
+	return m.opts.Default
+}
+
+// CheckBatch returns *Error when the user cannot create n links by one request.
+// Nil Manager allows everything.
+func (m *Manager) CheckBatch(userID string, n int) error {
+	if m == nil {
+		return nil
+	}
+
+	limits := m.Limits(userID)
+	if limits.MaxBatch > 0 && n > limits.MaxBatch {
+		return &Error{Limit: LimitBatch, Max: limits.MaxBatch, Used: n}
+	}
+
+	return nil
+}
+
+// Quota returns the limits of the user's links the store checks when they are added,
+// so the limits hold for concurrent requests. It returns nil when links are unlimited.
+func (m *Manager) Quota(userID string) *storeInterface.Quota {
+	if m == nil {
+		return nil
+	}
+
+	limits := m.Limits(userID)
+	if limits.MaxLinks <= 0 && limits.MaxPerDay <= 0 {
+		return nil
+	}
+
+	dayStart, dayEnd := m.day()
+
+	return &storeInterface.Quota{
+		MaxLinks:  limits.MaxLinks,
+		MaxPerDay: limits.MaxPerDay,
+		Since:     dayStart,
+		Reset:     dayEnd,
+	}
+}
+
+// Report returns quotas of the user and their usage.
+func (m *Manager) Report(ctx context.Context, userID string) (Report, error) {
+	limits := m.Limits(userID)
+	dayStart, dayEnd := m.day()
+
+	usage, err := m.store.GetUserUsage(ctx, userID, dayStart)
+	if err != nil {
+		return Report{}, err
+	}
+
+	return Report{
+		Links:    counter(limits.MaxLinks, usage.Links),
+		Daily:    counter(limits.MaxPerDay, usage.Created),
+		MaxBatch: limits.MaxBatch,
+		Reset:    dayEnd,
+	}, nil
+}
+
+// day returns the bounds of the current UTC day.
+func (m *Manager) day() (time.Time, time.Time) {
+	now := m.now().UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	return start, start.AddDate(0, 0, 1)
+}
+
+func counter(limit, used int) Counter {
+	c := Counter{Limit: limit, Used: used}
+	if limit > 0 {
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Remaining = &remaining
+	}
+
+	return c
+}
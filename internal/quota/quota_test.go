@@ -0,0 +1,107 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewStore()
+	m := New(store, Options{
+		Default: Limits{MaxLinks: 3, MaxBatch: 2, MaxPerDay: 4},
+		Users: map[string]Limits{
+			"vip": {},
+		},
+	})
+
+	add := func(short, userID string) error {
+		_, err := store.AddValue(ctx, storeInterface.AddValueOptions{
+			Short:    short,
+			Original: "https://example.com/" + short,
+			UserID:   userID,
+			Quota:    m.Quota(userID),
+		})
+		return err
+	}
+
+	var quotaErr *Error
+
+	err := m.CheckBatch("user", 3)
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, LimitBatch, quotaErr.Limit)
+	assert.ErrorIs(t, err, failure.ErrQuotaExceeded)
+	assert.NoError(t, m.CheckBatch("user", 2))
+
+	require.NoError(t, add("a", "user"))
+	require.NoError(t, add("b", "user"))
+	require.NoError(t, add("c", "user"))
+	err = add("d", "user")
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, &Error{Limit: LimitLinks, Max: 3, Used: 3}, quotaErr)
+
+	_, err = store.AddValue(ctx, storeInterface.AddValueOptions{
+		Short:    "e",
+		Original: "https://example.com/a",
+		UserID:   "user",
+		Quota:    m.Quota("user"),
+	})
+	assert.ErrorIs(t, err, failure.ErrConflict, "already shortened URLs are returned at the limit")
+
+	_, err = store.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: "user", URLs: []string{"a", "b"}}})
+	require.NoError(t, err)
+	require.NoError(t, add("d", "user"), "deleted links free the links quota")
+
+	err = add("e", "user")
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, LimitPerDay, quotaErr.Limit)
+	assert.Equal(t, 4, quotaErr.Used)
+	assert.True(t, quotaErr.Reset.After(time.Now()))
+
+	m.now = func() time.Time { return time.Now().AddDate(0, 0, 1) }
+	assert.Equal(t, time.Now().UTC().AddDate(0, 0, 1).Truncate(24*time.Hour), m.Quota("user").Since, "daily quota is reset next day")
+
+	assert.Nil(t, m.Quota("vip"), "user overrides replace default limits")
+	assert.NoError(t, m.CheckBatch("vip", 100))
+
+	var nilManager *Manager
+	assert.NoError(t, nilManager.CheckBatch("user", 100))
+	assert.Nil(t, nilManager.Quota("user"))
+}
+
+func TestReport(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewStore()
+	m := New(store, Options{Default: Limits{MaxLinks: 1, MaxBatch: 10}})
+	m.now = func() time.Time { return time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC) }
+
+	_, err := store.AddValue(ctx, storeInterface.AddValueOptions{Short: "a", Original: "https://example.com/", UserID: "user"})
+	require.NoError(t, err)
+	_, err = store.AddValue(ctx, storeInterface.AddValueOptions{Short: "b", Original: "https://example.org/", UserID: "user"})
+	require.NoError(t, err)
+
+	report, err := m.Report(ctx, "user")
+	require.NoError(t, err)
+
+	zero := 0
+	assert.Equal(t, Report{
+		Links:    Counter{Limit: 1, Used: 2, Remaining: &zero},
+		Daily:    Counter{Limit: 0, Used: 2},
+		MaxBatch: 10,
+		Reset:    time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, report)
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &Error{Limit: LimitLinks, Max: 3, Used: 3}
+	assert.Equal(t, "quota exceeded: links limit is 3 links, 3 used", err.Error())
+	assert.True(t, errors.Is(err, failure.ErrQuotaExceeded))
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/kupriyanovkk/shortener/internal/userid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor rejects calls exceeding the limit with codes.ResourceExhausted.
+// Rate limit values are sent in the response header metadata. Nil Limiter doesn't limit calls.
+func (l *Limiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if l == nil {
+			return handler(ctx, req)
+		}
+
+		md, err := l.allowCall(ctx, info.FullMethod)
+		if md != nil {
+			grpc.SetHeader(ctx, md)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls,
+// a token is taken when the stream is opened.
+func (l *Limiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if l == nil {
+			return handler(srv, ss)
+		}
+
+		md, err := l.allowCall(ss.Context(), info.FullMethod)
+		if md != nil {
+			ss.SetHeader(md)
+		}
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// allowCall takes a token for the call and returns the rate limit header metadata,
+// which is nil for calls without a limit, and the error rejecting the call.
+func (l *Limiter) allowCall(ctx context.Context, method string) (metadata.MD, error) {
+	result := l.Allow("", method, l.grpcClient(ctx))
+	if result.Limit == 0 {
+		return nil, nil
+	}
+
+	md := metadata.Pairs(
+		"ratelimit-limit", strconv.Itoa(result.Limit),
+		"ratelimit-remaining", strconv.Itoa(result.Remaining),
+		"ratelimit-reset", seconds(result.Reset),
+	)
+
+	if !result.Allowed {
+		md.Set("retry-after", seconds(result.RetryAfter))
+		return md, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %s seconds", seconds(result.RetryAfter))
+	}
+
+	return md, nil
+}
+
+func (l *Limiter) grpcClient(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	switch l.key {
+	case KeyUser:
+		if userid.Verified(ctx) {
+			return "user:" + userid.Get(ctx)
+		}
+	case KeyAPIKey:
+		if key := first("x-api-key"); l.apiKeys[key] {
+			return "key:" + key
+		}
+	}
+
+	return "ip:" + l.resolver.FromContext(ctx)
+}
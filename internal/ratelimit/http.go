@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/userid"
+)
+
+// APIKeyHeader is a header with the API key of the client.
+const APIKeyHeader = "X-API-Key"
+
+// Middleware rejects requests exceeding the limit with 429 status code.
+// It must be used after the middleware authenticating users. Nil Limiter doesn't limit requests.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := l.Allow(r.Method, r.URL.Path, l.httpClient(r))
+		if result.Limit == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", seconds(result.RetryAfter))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) httpClient(r *http.Request) string {
+	switch l.key {
+	case KeyUser:
+		if userid.Verified(r.Context()) {
+			return "user:" + userid.Get(r.Context())
+		}
+	case KeyAPIKey:
+		if key := r.Header.Get(APIKeyHeader); l.apiKeys[key] {
+			return "key:" + key
+		}
+	}
+
+	return "ip:" + l.resolver.FromRequest(r)
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
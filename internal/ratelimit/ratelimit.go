@@ -0,0 +1,319 @@
+// Package ratelimit limits request rates with token buckets keyed by user ID,
+// client IP or API key.
+//
+// Limits are configured per route. HTTP routes are written as chi patterns with an
+// optional method, e.g. "POST /api/shorten/batch" or "GET /{id}", gRPC routes as
+// full method names, e.g. "/shortener.Shortener/GetShortURL". Requests not matching
+// any route get the default limit.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+	"golang.org/x/time/rate"
+)
+
+// Key selects what requests share a bucket.
+type Key string
+
+const (
+	// KeyIP shares a bucket between requests from the same client IP.
+	KeyIP Key = "ip"
+	// KeyUser shares a bucket between requests of the same user, requests
+	// without a valid signed user cookie are limited by client IP.
+	KeyUser Key = "user"
+	// KeyAPIKey shares a bucket between requests with the same API key,
+	// requests without a configured key are limited by client IP.
+	KeyAPIKey Key = "apikey"
+)
+
+// ParseKey returns Key by its name, empty name means KeyIP.
+func ParseKey(name string) (Key, error) {
+	switch Key(name) {
+	case "", KeyIP:
+		return KeyIP, nil
+	case KeyUser, KeyAPIKey:
+		return Key(name), nil
+	}
+
+	return "", fmt.Errorf("unknown rate limit key %q", name)
+}
+
+// Limit is a bucket refill rate and its capacity.
+type Limit struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// ParseLimit parses limits like "10/s", "600/m:50" or "1000/h". The burst after
+// the colon defaults to the number of requests per period.
+func ParseLimit(spec string) (Limit, error) {
+	count, rest, ok := strings.Cut(spec, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<s|m|h>[:<burst>]", spec)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid number of requests in rate limit %q", spec)
+	}
+
+	period, burstSpec, hasBurst := strings.Cut(rest, ":")
+
+	var per time.Duration
+	switch period {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Limit{}, fmt.Errorf("invalid period in rate limit %q", spec)
+	}
+
+	burst := n
+	if hasBurst {
+		burst, err = strconv.Atoi(burstSpec)
+		if err != nil || burst <= 0 {
+			return Limit{}, fmt.Errorf("invalid burst in rate limit %q", spec)
+		}
+	}
+
+	return Limit{Rate: rate.Every(per / time.Duration(n)), Burst: burst}, nil
+}
+
+// Options configures Limiter.
+type Options struct {
+	// Key selects bucket keys, KeyIP by default.
+	Key Key
+	// Default limits requests not matching any route, requests aren't limited when it is zero.
+	Default string
+	// Routes maps routes to their limits.
+	Routes map[string]string
+	// APIKeys are keys of clients for KeyAPIKey, unknown keys are ignored so clients
+	// can't get fresh buckets by sending random keys.
+	APIKeys []string
+	// Resolver resolves client IPs for KeyIP, it is shared with the rest of the app, so
+	// limits apply to the same IPs that are logged. Nil Resolver trusts no proxies.
+	Resolver *clientip.Resolver
+	// IdleTimeout is a time after which unused buckets are removed, 10 minutes by default.
+	IdleTimeout time.Duration
+}
+
+type route struct {
+	method   string
+	segments []string
+	limit    Limit
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter keeps token buckets of clients.
+type Limiter struct {
+	key         Key
+	def         *Limit
+	routes      []route
+	apiKeys     map[string]bool
+	resolver    *clientip.Resolver
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Result describes the state of the bucket after the request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is a time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is a time until the next request is allowed, it is set for rejected requests only.
+	RetryAfter time.Duration
+}
+
+// New returns Limiter configured by opts.
+func New(opts Options) (*Limiter, error) {
+	l := &Limiter{
+		key:         opts.Key,
+		apiKeys:     make(map[string]bool, len(opts.APIKeys)),
+		resolver:    opts.Resolver,
+		idleTimeout: opts.IdleTimeout,
+		buckets:     make(map[string]*bucket),
+		now:         time.Now,
+	}
+	if l.key == "" {
+		l.key = KeyIP
+	}
+	if l.idleTimeout <= 0 {
+		l.idleTimeout = 10 * time.Minute
+	}
+	for _, key := range opts.APIKeys {
+		if key != "" {
+			l.apiKeys[key] = true
+		}
+	}
+
+	if opts.Default != "" {
+		limit, err := ParseLimit(opts.Default)
+		if err != nil {
+			return nil, err
+		}
+		l.def = &limit
+	}
+
+	for pattern, spec := range opts.Routes {
+		limit, err := ParseLimit(spec)
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", pattern, err)
+		}
+
+		r := route{limit: limit}
+		path := pattern
+		if method, p, ok := strings.Cut(pattern, " "); ok {
+			r.method = strings.ToUpper(method)
+			path = strings.TrimSpace(p)
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route %q: path must start with /", pattern)
+		}
+		r.segments = splitPath(path)
+
+		l.routes = append(l.routes, r)
+	}
+
+	return l, nil
+}
+
+// Allow takes a token from the bucket of the client for the route.
+// The route is identified by the request method and path, the method is empty for gRPC.
+// Requests without a limit are always allowed with zero Result.Limit.
+func (l *Limiter) Allow(method, path, client string) Result {
+	pattern, limit, ok := l.match(method, path)
+	if !ok {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	lim := l.bucket(pattern+"\x00"+client, limit, now)
+
+	result := Result{Limit: limit.Burst}
+	reservation := lim.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		result.RetryAfter = delay
+	} else {
+		result.Allowed = true
+	}
+
+	tokens := lim.TokensAt(now)
+	result.Remaining = int(math.Max(0, math.Floor(tokens)))
+	if missing := float64(limit.Burst) - tokens; missing > 0 && limit.Rate > 0 {
+		result.Reset = time.Duration(missing / float64(limit.Rate) * float64(time.Second))
+	}
+
+	return result
+}
+
+func (l *Limiter) bucket(key string, limit Limit, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > l.idleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.idleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(limit.Rate, limit.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	return b.limiter
+}
+
+// match returns the most specific route for the request, or the default limit.
+func (l *Limiter) match(method, path string) (string, Limit, bool) {
+	segments := splitPath(path)
+
+	best := -1
+	bestScore := -1
+	for i, r := range l.routes {
+		if r.method != "" && r.method != method {
+			continue
+		}
+
+		score, ok := matchSegments(r.segments, segments)
+		if !ok {
+			continue
+		}
+		if r.method != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	if best >= 0 {
+		r := l.routes[best]
+		return r.method + " /" + strings.Join(r.segments, "/"), r.limit, true
+	}
+
+	if l.def != nil {
+		return "", *l.def, true
+	}
+
+	return "", Limit{}, false
+}
+
+// matchSegments matches path segments against the pattern. Segments like {id}
+// match any single segment, * matches the rest of the path. The score counts
+// literal segments, so more specific patterns win.
+func matchSegments(pattern, path []string) (int, bool) {
+	score := 0
+	for i, p := range pattern {
+		if p == "*" {
+			return score, true
+		}
+		if i >= len(path) {
+			return 0, false
+		}
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			continue
+		}
+		if p != path[i] {
+			return 0, false
+		}
+		score += 2
+	}
+
+	return score, len(pattern) == len(path)
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
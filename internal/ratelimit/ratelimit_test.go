@@ -0,0 +1,264 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/clientip"
+	"github.com/kupriyanovkk/shortener/internal/userid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func newTestLimiter(t *testing.T, opts Options) (*Limiter, *time.Time) {
+	l, err := New(opts)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	return l, &now
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Limit
+		wantErr bool
+	}{
+		{spec: "10/s", want: Limit{Rate: 10, Burst: 10}},
+		{spec: "60/m:5", want: Limit{Rate: 1, Burst: 5}},
+		{spec: "3600/h", want: Limit{Rate: 1, Burst: 3600}},
+		{spec: "10", wantErr: true},
+		{spec: "0/s", wantErr: true},
+		{spec: "10/d", wantErr: true},
+		{spec: "10/s:x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseLimit(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.InDelta(t, float64(tt.want.Rate), float64(got.Rate), 1e-9)
+			assert.Equal(t, tt.want.Burst, got.Burst)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	l, _ := newTestLimiter(t, Options{
+		Default: "100/s",
+		Routes: map[string]string{
+			"POST /api/shorten/batch":             "1/s",
+			"GET /{id}":                           "2/s",
+			"/api/user/*":                         "3/s",
+			"/shortener.Shortener/GetShortURL":    "4/s",
+			"DELETE /api/user/urls":               "5/s",
+			"/shortener.Shortener/GetAPIUserURLs": "6/s",
+		},
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		burst  int
+	}{
+		{http.MethodPost, "/api/shorten/batch", 1},
+		{http.MethodGet, "/api/shorten/batch", 100},
+		{http.MethodGet, "/abc123", 2},
+		{http.MethodPost, "/abc123", 100},
+		{http.MethodGet, "/api/user/urls", 3},
+		{http.MethodDelete, "/api/user/urls", 5},
+		{"", "/shortener.Shortener/GetShortURL", 4},
+		{"", "/shortener.Shortener/GetAPIUserURLs", 6},
+		{"", "/shortener.Shortener/DeleteAPIUserURLs", 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			_, limit, ok := l.match(tt.method, tt.path)
+			require.True(t, ok)
+			assert.Equal(t, tt.burst, limit.Burst)
+		})
+	}
+
+	l, _ = newTestLimiter(t, Options{Routes: map[string]string{"GET /{id}": "2/s"}})
+	_, _, ok := l.match(http.MethodPost, "/")
+	assert.False(t, ok)
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(Options{Default: "fast"})
+	assert.Error(t, err)
+
+	_, err = New(Options{Routes: map[string]string{"GET api": "1/s"}})
+	assert.Error(t, err)
+
+	_, err = ParseKey("cookie")
+	assert.Error(t, err)
+}
+
+func TestAllow(t *testing.T) {
+	l, now := newTestLimiter(t, Options{Default: "1/s:2"})
+
+	result := l.Allow(http.MethodGet, "/", "a")
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Second}, result)
+
+	result = l.Allow(http.MethodGet, "/", "a")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result = l.Allow(http.MethodGet, "/", "a")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	assert.True(t, l.Allow(http.MethodGet, "/", "b").Allowed, "clients have separate buckets")
+
+	*now = now.Add(time.Second)
+	assert.True(t, l.Allow(http.MethodGet, "/", "a").Allowed)
+
+	*now = now.Add(time.Hour)
+	l.Allow(http.MethodGet, "/", "c")
+	assert.Len(t, l.buckets, 1, "idle buckets are removed")
+}
+
+func TestMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		var l *Limiter
+		rr := httptest.NewRecorder()
+		l.Middleware(next).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Limited", func(t *testing.T) {
+		l, _ := newTestLimiter(t, Options{Key: KeyAPIKey, APIKeys: []string{"first", "second"}, Routes: map[string]string{"POST /api/shorten/batch": "1/m"}})
+		handler := l.Middleware(next)
+
+		request := func(key string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", nil)
+			req.Header.Set(APIKeyHeader, key)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := request("first")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "60", rr.Header().Get("RateLimit-Reset"))
+
+		rr = request("first")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+		assert.Equal(t, http.StatusOK, request("second").Code)
+		assert.Equal(t, http.StatusOK, request("random1").Code, "unknown keys are limited by client IP")
+		assert.Equal(t, http.StatusTooManyRequests, request("random2").Code)
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("User", func(t *testing.T) {
+		l, _ := newTestLimiter(t, Options{Key: KeyUser, Default: "1/m"})
+		handler := l.Middleware(next)
+
+		request := func(userID string, verified bool) int {
+			ctx := context.WithValue(context.Background(), userid.ContextUserKey, userID)
+			ctx = context.WithValue(ctx, userid.ContextVerifiedKey, verified)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc", nil).WithContext(ctx))
+			return rr.Code
+		}
+
+		assert.Equal(t, http.StatusOK, request("user1", true))
+		assert.Equal(t, http.StatusTooManyRequests, request("user1", true))
+		assert.Equal(t, http.StatusOK, request("user2", true))
+		assert.Equal(t, http.StatusOK, request("minted1", false))
+		assert.Equal(t, http.StatusTooManyRequests, request("minted2", false), "users without cookies are limited by client IP")
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	resolver, err := clientip.New("203.0.113.0/24")
+	require.NoError(t, err)
+	l, _ := newTestLimiter(t, Options{Default: "1/s", Resolver: resolver})
+	interceptor := l.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shortener.Shortener/GetShortURL"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 1234}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "198.51.100.1"))
+
+	resp, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	other := metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "198.51.100.2"))
+	_, err = interceptor(other, nil, info, handler)
+	assert.NoError(t, err, "clients behind the trusted proxy have own buckets")
+
+	var nilLimiter *Limiter
+	_, err = nilLimiter.UnaryServerInterceptor()(ctx, nil, info, handler)
+	assert.NoError(t, err)
+}
+
+// testStream is a server stream with the context and the header.
+type testStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	header metadata.MD
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	l, _ := newTestLimiter(t, Options{Routes: map[string]string{"/shortener.Shortener/WatchEvents": "1/m"}})
+	interceptor := l.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/shortener.Shortener/WatchEvents", IsServerStream: true}
+	handler := func(interface{}, grpc.ServerStream) error { return nil }
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.1"), Port: 1234}})
+	ss := &testStream{ctx: ctx}
+	require.NoError(t, interceptor(nil, ss, info, handler))
+	assert.Equal(t, []string{"0"}, ss.header.Get("ratelimit-remaining"))
+
+	ss = &testStream{ctx: ctx}
+	err := interceptor(nil, ss, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, []string{"60"}, ss.header.Get("retry-after"))
+
+	var nilLimiter *Limiter
+	assert.NoError(t, nilLimiter.StreamServerInterceptor()(nil, ss, info, handler))
+}
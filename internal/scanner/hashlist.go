@@ -0,0 +1,246 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// minPrefixLen is the shortest hash prefix in hex characters accepted in the list.
+const minPrefixLen = 8
+
+type hashEntry struct {
+	prefix  string
+	verdict models.Verdict
+}
+
+// HashList matches URLs against the file of SHA-256 hashes of URL expressions.
+//
+// Every line of the file contains hex encoded full hash or hash prefix (at least 8 characters)
+// and an optional verdict, block by default:
+//
+//	# phishing kit
+//	5a2b1c3d block
+//	0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0 warn
+//
+// Hashed expressions are built like in Safe Browsing: host suffixes combined with path
+// prefixes, e.g. "evil.example.com/login" or "example.com/".
+type HashList struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	entries []hashEntry
+	modTime time.Time
+}
+
+// NewHashList loads the hash list from path. The file is reloaded by Watch
+// every interval (30 seconds by default) when its modification time changes.
+func NewHashList(path string, interval time.Duration) (*HashList, error) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	l := &HashList{path: path, interval: interval}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Scan returns the most severe verdict of the list entries matching URL expressions.
+func (l *HashList) Scan(_ context.Context, rawURL string) (models.Verdict, error) {
+	exprs, err := Expressions(rawURL)
+	if err != nil {
+		return models.VerdictClean, err
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	result := models.VerdictClean
+	for _, expr := range exprs {
+		sum := sha256.Sum256([]byte(expr))
+		hash := hex.EncodeToString(sum[:])
+
+		for _, e := range l.entries {
+			if strings.HasPrefix(hash, e.prefix) {
+				result = Worst(result, e.verdict)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Watch reloads the list file until ctx is done.
+func (l *HashList) Watch(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.reload(); err != nil {
+				logging.FromContext(ctx).Error("scanner: cannot reload hash list", zap.String("path", l.path), zap.Error(err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *HashList) reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.RLock()
+	unchanged := info.ModTime().Equal(l.modTime)
+	l.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := parseHashList(file)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.modTime = info.ModTime()
+	l.mu.Unlock()
+
+	return nil
+}
+
+func parseHashList(r io.Reader) ([]hashEntry, error) {
+	var entries []hashEntry
+	scanner := bufio.NewScanner(r)
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: unexpected %q", n, line)
+		}
+
+		prefix := strings.ToLower(fields[0])
+		if _, err := hex.DecodeString(prefix); err != nil || len(prefix) < minPrefixLen || len(prefix) > sha256.Size*2 {
+			return nil, fmt.Errorf("line %d: invalid hash %q", n, fields[0])
+		}
+
+		verdict := models.VerdictBlock
+		if len(fields) == 2 {
+			v, err := ParseVerdict(fields[1])
+			if err != nil || v == models.VerdictClean {
+				return nil, fmt.Errorf("line %d: invalid verdict %q", n, fields[1])
+			}
+			verdict = v
+		}
+
+		entries = append(entries, hashEntry{prefix: prefix, verdict: verdict})
+	}
+
+	return entries, scanner.Err()
+}
+
+// Expressions returns host suffix and path prefix combinations of the URL,
+// which are hashed to match the list. Hosts are limited to the exact host and
+// up to 4 suffixes built from the last 5 components, paths to the exact path
+// with and without query and up to 4 prefixes.
+func Expressions(rawURL string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil, fmt.Errorf("URL %q has no host", rawURL)
+	}
+
+	hosts := []string{host}
+	if labels := strings.Split(host, "."); len(labels) > 2 && !isIP(host) {
+		if len(labels) > 5 {
+			labels = labels[len(labels)-5:]
+		}
+		for i := 0; i < len(labels)-1; i++ {
+			suffix := strings.Join(labels[i:], ".")
+			if suffix != host {
+				hosts = append(hosts, suffix)
+			}
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	prefix := "/"
+	for i := 0; i < len(segments) && i < 4; i++ {
+		if prefix != path {
+			paths = appendUnique(paths, prefix)
+		}
+		if segments[i] == "" {
+			break
+		}
+		prefix += segments[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+
+	return exprs, nil
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+func isIP(host string) bool {
+	return strings.Trim(host, "0123456789.") == "" || strings.Contains(host, ":")
+}
@@ -0,0 +1,237 @@
+// Package scanner checks shortened URLs for phishing and malware.
+//
+// Scanners are invoked asynchronously after a link is created and, optionally,
+// synchronously before creation. Links recognized as suspicious are flagged
+// in the store, so redirects show a warning page or are blocked.
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+)
+
+// Scanner returns verdict for the URL.
+type Scanner interface {
+	Scan(ctx context.Context, rawURL string) (models.Verdict, error)
+}
+
+// Watcher is implemented by scanners reloading their data in background.
+type Watcher interface {
+	Watch(ctx context.Context)
+}
+
+// Chain runs scanners in order and returns the most severe verdict.
+type Chain []Scanner
+
+// Scan runs all scanners, an error of one scanner doesn't stop the others.
+func (c Chain) Scan(ctx context.Context, rawURL string) (models.Verdict, error) {
+	result := models.VerdictClean
+	var firstErr error
+
+	for _, s := range c {
+		verdict, err := s.Scan(ctx, rawURL)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		result = Worst(result, verdict)
+		if result == models.VerdictBlock {
+			break
+		}
+	}
+
+	return result, firstErr
+}
+
+// Worst returns the most severe of two verdicts.
+func Worst(a, b models.Verdict) models.Verdict {
+	if severity(b) > severity(a) {
+		return b
+	}
+
+	return a
+}
+
+func severity(v models.Verdict) int {
+	switch v {
+	case models.VerdictWarn:
+		return 1
+	case models.VerdictBlock:
+		return 2
+	}
+
+	return 0
+}
+
+// ParseVerdict returns Verdict by its name, "clean" and empty string mean VerdictClean.
+func ParseVerdict(name string) (models.Verdict, error) {
+	switch name {
+	case "", "clean":
+		return models.VerdictClean, nil
+	case string(models.VerdictWarn):
+		return models.VerdictWarn, nil
+	case string(models.VerdictBlock):
+		return models.VerdictBlock, nil
+	}
+
+	return models.VerdictClean, fmt.Errorf("unknown verdict %q", name)
+}
+
+type job struct {
+	short    string
+	original string
+}
+
+// Options configures Service.
+type Options struct {
+	// Sync enables scanning before the link is created.
+	Sync bool
+	// Workers is a number of goroutines scanning created links, 1 by default.
+	Workers int
+	// QueueSize is a capacity of the queue of links waiting for scanning, 100 by default.
+	QueueSize int
+}
+
+// Service runs scanners for created links and stores their verdicts.
+type Service struct {
+	scanner Scanner
+	store   storeInterface.Store
+	opts    Options
+	jobs    chan job
+}
+
+// NewService returns Service scanning links by scanner and saving verdicts into store.
+func NewService(scanner Scanner, store storeInterface.Store, opts Options) *Service {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 100
+	}
+
+	return &Service{
+		scanner: scanner,
+		store:   store,
+		opts:    opts,
+		jobs:    make(chan job, opts.QueueSize),
+	}
+}
+
+// Before scans the URL before creation in synchronous mode. It returns failure.ErrMaliciousURL
+// for blocked URLs and the verdict to be saved after creation otherwise.
+// Scanner errors don't prevent creation, the link is scanned again asynchronously then.
+func (s *Service) Before(ctx context.Context, original string) (models.Verdict, bool, error) {
+	if s == nil || !s.opts.Sync {
+		return models.VerdictClean, false, nil
+	}
+
+	verdict, err := s.scanner.Scan(ctx, original)
+	if err != nil {
+		logging.FromContext(ctx).Warn("scanner: cannot scan URL", zap.String("url", original), zap.Error(err))
+		return models.VerdictClean, false, nil
+	}
+
+	if verdict == models.VerdictBlock {
+		return verdict, true, failure.ErrMaliciousURL
+	}
+
+	return verdict, true, nil
+}
+
+// After saves the verdict of synchronous scanning or queues the link for asynchronous scanning.
+func (s *Service) After(ctx context.Context, short, original string, verdict models.Verdict, scanned bool) {
+	if s == nil {
+		return
+	}
+
+	if scanned {
+		if verdict != models.VerdictClean {
+			if err := s.store.SetVerdict(ctx, short, verdict); err != nil {
+				logging.FromContext(ctx).Error("scanner: cannot save verdict", zap.String("short", short), zap.Error(err))
+			}
+		}
+		return
+	}
+
+	select {
+	case s.jobs <- job{short: short, original: original}:
+	default:
+		logging.FromContext(ctx).Warn("scanner: queue is full, link is not scanned", zap.String("short", short))
+	}
+}
+
+// Run scans queued links and reloads scanners data until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	watchers := 0
+	done := make(chan struct{})
+	for _, w := range s.watchers() {
+		watchers++
+		go func(w Watcher) {
+			defer func() { done <- struct{}{} }()
+			w.Watch(ctx)
+		}(w)
+	}
+
+	for i := 0; i < s.opts.Workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+
+			for {
+				select {
+				case j := <-s.jobs:
+					s.scan(ctx, j)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < s.opts.Workers+watchers; i++ {
+		<-done
+	}
+}
+
+func (s *Service) watchers() []Watcher {
+	scanners := []Scanner{s.scanner}
+	if chain, ok := s.scanner.(Chain); ok {
+		scanners = chain
+	}
+
+	var result []Watcher
+	for _, sc := range scanners {
+		if w, ok := sc.(Watcher); ok {
+			result = append(result, w)
+		}
+	}
+
+	return result
+}
+
+func (s *Service) scan(ctx context.Context, j job) {
+	verdict, err := s.scanner.Scan(ctx, j.original)
+	if err != nil {
+		logging.FromContext(ctx).Warn("scanner: cannot scan URL", zap.String("url", j.original), zap.Error(err))
+	}
+
+	if verdict == models.VerdictClean {
+		return
+	}
+
+	if err := s.store.SetVerdict(ctx, j.short, verdict); err != nil {
+		logging.FromContext(ctx).Error("scanner: cannot save verdict", zap.String("short", j.short), zap.Error(err))
+	}
+}
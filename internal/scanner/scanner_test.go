@@ -0,0 +1,230 @@
+package scanner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticScanner struct {
+	verdict models.Verdict
+	err     error
+}
+
+func (s staticScanner) Scan(context.Context, string) (models.Verdict, error) {
+	return s.verdict, s.err
+}
+
+func hash(expr string) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExpressions(t *testing.T) {
+	exprs, err := Expressions("http://a.b.example.com/1/2.html?param=1")
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{
+		"a.b.example.com/1/2.html?param=1",
+		"a.b.example.com/1/2.html",
+		"a.b.example.com/",
+		"a.b.example.com/1/",
+		"b.example.com/1/2.html?param=1",
+		"b.example.com/1/2.html",
+		"b.example.com/",
+		"b.example.com/1/",
+		"example.com/1/2.html?param=1",
+		"example.com/1/2.html",
+		"example.com/",
+		"example.com/1/",
+	}, exprs)
+
+	exprs, err = Expressions("http://192.168.0.1/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.168.0.1/"}, exprs)
+
+	_, err = Expressions("/path")
+	assert.Error(t, err)
+}
+
+func TestHashList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+	content := "# test list\n" +
+		hash("evil.com/")[:8] + "\n" +
+		hash("example.com/phishing/") + " warn\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	list, err := NewHashList(path, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		verdict models.Verdict
+	}{
+		{"https://evil.com/", models.VerdictBlock},
+		{"https://login.evil.com/account?id=1", models.VerdictBlock},
+		{"https://example.com/phishing/page.html", models.VerdictWarn},
+		{"https://example.com/", models.VerdictClean},
+		{"https://notevil.com/", models.VerdictClean},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			verdict, err := list.Scan(context.Background(), tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.verdict, verdict)
+		})
+	}
+
+	t.Run("Reload", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte(hash("example.com/")+" block\n"), 0o600))
+		require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+		require.NoError(t, list.reload())
+
+		verdict, err := list.Scan(context.Background(), "https://evil.com/")
+		require.NoError(t, err)
+		assert.Equal(t, models.VerdictClean, verdict)
+
+		verdict, err = list.Scan(context.Background(), "https://example.com/")
+		require.NoError(t, err)
+		assert.Equal(t, models.VerdictBlock, verdict)
+	})
+}
+
+func TestParseHashListErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.txt")
+
+	for _, content := range []string{"abc\n", "zzzzzzzz\n", "abcdef01 maybe\n", "abcdef01 clean\n", "abcdef01 warn extra\n"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := NewHashList(path, 0)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req webhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		verdict := "clean"
+		if req.URL == "https://evil.com/" {
+			verdict = "block"
+		}
+		json.NewEncoder(w).Encode(webhookResponse{Verdict: verdict})
+	}))
+	defer server.Close()
+
+	wh := NewWebhook(server.URL, "secret", time.Second)
+
+	verdict, err := wh.Scan(context.Background(), "https://evil.com/")
+	require.NoError(t, err)
+	assert.Equal(t, models.VerdictBlock, verdict)
+
+	verdict, err = wh.Scan(context.Background(), "https://example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, models.VerdictClean, verdict)
+
+	_, err = NewWebhook(server.URL, "wrong", time.Second).Scan(context.Background(), "https://example.com/")
+	assert.Error(t, err)
+}
+
+func TestChain(t *testing.T) {
+	scanErr := errors.New("unavailable")
+	chain := Chain{
+		staticScanner{err: scanErr},
+		staticScanner{verdict: models.VerdictWarn},
+		staticScanner{verdict: models.VerdictClean},
+	}
+
+	verdict, err := chain.Scan(context.Background(), "https://example.com/")
+	assert.Equal(t, models.VerdictWarn, verdict)
+	assert.ErrorIs(t, err, scanErr)
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	add := func(store storeInterface.Store, short, original string) {
+		_, err := store.AddValue(ctx, storeInterface.AddValueOptions{Short: short, Original: original})
+		require.NoError(t, err)
+	}
+
+	t.Run("Nil", func(t *testing.T) {
+		var s *Service
+		_, scanned, err := s.Before(ctx, "https://example.com/")
+		assert.NoError(t, err)
+		assert.False(t, scanned)
+		s.After(ctx, "short", "https://example.com/", models.VerdictClean, false)
+		s.Run(ctx)
+	})
+
+	t.Run("Sync", func(t *testing.T) {
+		store := inmemory.NewStore()
+		s := NewService(staticScanner{verdict: models.VerdictBlock}, store, Options{Sync: true})
+
+		_, _, err := s.Before(ctx, "https://evil.com/")
+		assert.ErrorIs(t, err, failure.ErrMaliciousURL)
+
+		s = NewService(staticScanner{verdict: models.VerdictWarn}, store, Options{Sync: true})
+		verdict, scanned, err := s.Before(ctx, "https://suspicious.com/")
+		require.NoError(t, err)
+		require.True(t, scanned)
+
+		add(store, "warn", "https://suspicious.com/")
+		s.After(ctx, "warn", "https://suspicious.com/", verdict, scanned)
+
+		original, err := store.GetOriginalURL(ctx, "warn")
+		assert.ErrorIs(t, err, failure.ErrURLFlagged)
+		assert.Equal(t, "https://suspicious.com/", original)
+	})
+
+	t.Run("Async", func(t *testing.T) {
+		store := inmemory.NewStore()
+		s := NewService(staticScanner{verdict: models.VerdictBlock}, store, Options{Workers: 2})
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx)
+			close(done)
+		}()
+
+		_, scanned, err := s.Before(ctx, "https://evil.com/")
+		require.NoError(t, err)
+		require.False(t, scanned)
+
+		add(store, "evil", "https://evil.com/")
+		s.After(ctx, "evil", "https://evil.com/", models.VerdictClean, scanned)
+
+		assert.Eventually(t, func() bool {
+			_, err := store.GetOriginalURL(ctx, "evil")
+			return errors.Is(err, failure.ErrURLBlocked)
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		<-done
+	})
+}
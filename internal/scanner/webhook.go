@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/models"
+)
+
+// Webhook asks the external HTTP service for the verdict.
+//
+// The service receives POST request with {"url": "..."} body and responds
+// with {"verdict": "clean|warn|block"}.
+type Webhook struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+type webhookResponse struct {
+	Verdict string `json:"verdict"`
+}
+
+// NewWebhook returns Webhook calling endpoint. The token, when it isn't empty,
+// is sent as a bearer token. Requests are limited by timeout, 5 seconds by default.
+func NewWebhook(endpoint, token string, timeout time.Duration) *Webhook {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	return &Webhook{
+		endpoint: endpoint,
+		token:    token,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Scan sends URL to the verdict service.
+func (wh *Webhook) Scan(ctx context.Context, rawURL string) (models.Verdict, error) {
+	body, err := json.Marshal(webhookRequest{URL: rawURL})
+	if err != nil {
+		return models.VerdictClean, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return models.VerdictClean, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wh.token != "" {
+		req.Header.Set("Authorization", "Bearer "+wh.token)
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return models.VerdictClean, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return models.VerdictClean, fmt.Errorf("verdict service responded with status %d", resp.StatusCode)
+	}
+
+	var result webhookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return models.VerdictClean, err
+	}
+
+	return ParseVerdict(result.Verdict)
+}
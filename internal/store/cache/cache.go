@@ -0,0 +1,440 @@
+// Package cache implements a read-through cache of redirects in front of any store.
+//
+// Results of GetOriginalURL are kept in a bounded LRU with TTL. Unknown short IDs
+// are cached too, with a shorter TTL, and concurrent misses of the same ID are
+// collapsed into a single backend call. Entries are invalidated by AddValue,
+// DeleteURLs and SetVerdict going through the cache; changes made by other
+// instances sharing the backend become visible after TTL.
+//
+// An optional shared tier, e.g. Redis, is consulted on local misses before the
+// backend, so instances reuse each other's lookups.
+//
+// When the wrapped store looks up short IDs case-insensitively, entries are still
+// cached by the IDs clients use, since a mixed-case ID may be a link of its own.
+// Invalidation drops entries of all case variants of the ID, and only lower-case
+// IDs go to the shared tier, so its entries can be invalidated by their IDs.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Options configures Store.
+type Options struct {
+	// Size is a max number of cached short IDs, 10000 by default.
+	Size int
+	// TTL is a time to live of cached redirects, 5 minutes by default.
+	TTL time.Duration
+	// NegativeTTL is a time to live of cached unknown short IDs, 30 seconds by default.
+	NegativeTTL time.Duration
+	// Shared is an optional second tier shared between instances.
+	Shared Shared
+	// LoadTimeout limits a load of a missed redirect, 5 seconds by default. The load is
+	// shared by concurrent callers, so it doesn't depend on their contexts.
+	LoadTimeout time.Duration
+	// CaseInsensitive must be set when the wrapped store looks up short IDs case-insensitively.
+	CaseInsensitive bool
+}
+
+// Shared is a cache shared between instances. Values are opaque strings,
+// missing keys are reported by false.
+type Shared interface {
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Stats contains cache metrics.
+type Stats struct {
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Size         int    `json:"size"`
+}
+
+type entry struct {
+	short    string
+	original string
+	err      error
+	expires  time.Time
+}
+
+type result struct {
+	original string
+	err      error
+}
+
+// Store caches redirects of the wrapped store, other methods are passed through.
+type Store struct {
+	storeInterface.Store
+
+	opts Options
+	now  func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	// variants are cached IDs by their lower-case forms, they are kept with CaseInsensitive only.
+	variants map[string]map[string]bool
+	// generation is incremented on every invalidation, so values loaded
+	// before the invalidation aren't put into the cache.
+	generation uint64
+
+	group singleflight.Group
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+	evictions    atomic.Uint64
+}
+
+// New returns Store caching redirects of store.
+func New(store storeInterface.Store, opts Options) *Store {
+	if opts.Size <= 0 {
+		opts.Size = 10000
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	if opts.NegativeTTL <= 0 {
+		opts.NegativeTTL = 30 * time.Second
+	}
+	if opts.LoadTimeout <= 0 {
+		opts.LoadTimeout = 5 * time.Second
+	}
+
+	return &Store{
+		Store:    store,
+		opts:     opts,
+		now:      time.Now,
+		items:    make(map[string]*list.Element, opts.Size),
+		lru:      list.New(),
+		variants: make(map[string]map[string]bool),
+	}
+}
+
+// GetOriginalURL returns the cached redirect or loads it from the wrapped store.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	if e, ok := s.get(short); ok {
+		if errors.Is(e.err, failure.ErrNotFound) || errors.Is(e.err, failure.ErrURLDeleted) {
+			s.negativeHits.Add(1)
+		} else {
+			s.hits.Add(1)
+		}
+		return e.original, e.err
+	}
+
+	s.misses.Add(1)
+
+	ch := s.group.DoChan(short, func() (interface{}, error) {
+		// Callers joining the load would fail if the first one goes away,
+		// so the load keeps values of its context only.
+		ctx, cancel := context.WithTimeout(detached{ctx}, s.opts.LoadTimeout)
+		defer cancel()
+
+		s.mu.Lock()
+		generation := s.generation
+		s.mu.Unlock()
+
+		if r, ok := s.getShared(ctx, short); ok {
+			s.set(short, r.original, r.err, generation)
+			return r, nil
+		}
+
+		original, err := s.Store.GetOriginalURL(ctx, short)
+		if cacheable(err) {
+			s.set(short, original, err, generation)
+			s.setShared(ctx, short, original, err)
+		}
+
+		return result{original: original, err: err}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		r := res.Val.(result)
+		return r.original, r.err
+	}
+}
+
+// detached is a context with values of the parent, which is never canceled.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+// AddValue adds URL to the wrapped store and invalidates a cached miss of its short ID.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+	short, err := s.Store.AddValue(ctx, opts)
+	s.invalidate(opts.Short)
+
+	return short, err
+}
+
+// DeleteURLs deletes URLs in the wrapped store and invalidates their cached redirects.
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	deleted, err := s.Store.DeleteURLs(ctx, opts)
+
+	var shorts []string
+	for _, o := range opts {
+		shorts = append(shorts, o.URLs...)
+	}
+	s.invalidate(shorts...)
+
+	return deleted, err
+}
+
+// SetVerdict sets verdict in the wrapped store and invalidates the cached redirect.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	err := s.Store.SetVerdict(ctx, short, verdict)
+	s.invalidate(short)
+
+	return err
+}
+
+// Unwrap returns the cached store.
+func (s *Store) Unwrap() storeInterface.Store {
+	return s.Store
+}
+
+// Stats returns cache metrics.
+func (s *Store) Stats() Stats {
+	s.mu.Lock()
+	size := s.lru.Len()
+	s.mu.Unlock()
+
+	return Stats{
+		Hits:         s.hits.Load(),
+		NegativeHits: s.negativeHits.Load(),
+		Misses:       s.misses.Load(),
+		Evictions:    s.evictions.Load(),
+		Size:         size,
+	}
+}
+
+func (s *Store) get(short string) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[short]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if s.now().After(e.expires) {
+		s.remove(el)
+		return nil, false
+	}
+
+	s.lru.MoveToFront(el)
+
+	return e, true
+}
+
+func (s *Store) set(short, original string, err error, generation uint64) {
+	ttl := s.opts.TTL
+	if errors.Is(err, failure.ErrNotFound) {
+		ttl = s.opts.NegativeTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+
+	e := &entry{short: short, original: original, err: err, expires: s.now().Add(ttl)}
+	if el, ok := s.items[short]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return
+	}
+
+	s.items[short] = s.lru.PushFront(e)
+	if s.opts.CaseInsensitive {
+		folded := strings.ToLower(short)
+		if s.variants[folded] == nil {
+			s.variants[folded] = make(map[string]bool)
+		}
+		s.variants[folded][short] = true
+	}
+
+	for s.lru.Len() > s.opts.Size {
+		s.remove(s.lru.Back())
+		s.evictions.Add(1)
+	}
+}
+
+// remove drops the cached entry. It is called with the lock held.
+func (s *Store) remove(el *list.Element) {
+	short := el.Value.(*entry).short
+	s.lru.Remove(el)
+	delete(s.items, short)
+
+	if s.opts.CaseInsensitive {
+		folded := strings.ToLower(short)
+		delete(s.variants[folded], short)
+		if len(s.variants[folded]) == 0 {
+			delete(s.variants, folded)
+		}
+	}
+}
+
+func (s *Store) invalidate(shorts ...string) {
+	if s.opts.CaseInsensitive {
+		folded := make([]string, 0, len(shorts))
+		for _, short := range shorts {
+			folded = append(folded, strings.ToLower(short))
+		}
+		shorts = folded
+	}
+
+	s.mu.Lock()
+	s.generation++
+	for _, short := range shorts {
+		keys := []string{short}
+		if s.opts.CaseInsensitive {
+			for variant := range s.variants[short] {
+				keys = append(keys, variant)
+			}
+		}
+
+		for _, key := range keys {
+			if el, ok := s.items[key]; ok {
+				s.remove(el)
+			}
+			s.group.Forget(key)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.opts.Shared != nil && len(shorts) > 0 {
+		if err := s.opts.Shared.Delete(context.Background(), shorts...); err != nil {
+			zap.L().Warn("cache: cannot invalidate shared cache", zap.Error(err))
+		}
+	}
+}
+
+// shared reports whether the entry of the short ID goes to the shared tier.
+func (s *Store) shared(short string) bool {
+	return s.opts.Shared != nil && (!s.opts.CaseInsensitive || short == strings.ToLower(short))
+}
+
+func (s *Store) getShared(ctx context.Context, short string) (result, bool) {
+	if !s.shared(short) {
+		return result{}, false
+	}
+
+	value, ok, err := s.opts.Shared.Get(ctx, short)
+	if err != nil {
+		logging.FromContext(ctx).Warn("cache: cannot read shared cache", zap.Error(err))
+		return result{}, false
+	}
+	if !ok {
+		return result{}, false
+	}
+
+	return decode(short, value)
+}
+
+func (s *Store) setShared(ctx context.Context, short, original string, err error) {
+	if !s.shared(short) {
+		return
+	}
+
+	ttl := s.opts.TTL
+	if errors.Is(err, failure.ErrNotFound) {
+		ttl = s.opts.NegativeTTL
+	}
+
+	if err := s.opts.Shared.Set(ctx, short, encode(original, err), ttl); err != nil {
+		logging.FromContext(ctx).Warn("cache: cannot write shared cache", zap.Error(err))
+	}
+}
+
+// Results are encoded for the shared cache as "<kind>:<original>".
+const (
+	kindOK       = "ok"
+	kindNotFound = "notfound"
+	kindDeleted  = "deleted"
+	kindFlagged  = "flagged"
+	kindBlocked  = "blocked"
+)
+
+func encode(original string, err error) string {
+	kind := kindOK
+	switch {
+	case errors.Is(err, failure.ErrNotFound):
+		kind = kindNotFound
+	case errors.Is(err, failure.ErrURLDeleted):
+		kind = kindDeleted
+	case errors.Is(err, failure.ErrURLFlagged):
+		kind = kindFlagged
+	case errors.Is(err, failure.ErrURLBlocked):
+		kind = kindBlocked
+	}
+
+	return kind + ":" + original
+}
+
+func decode(short, value string) (result, bool) {
+	kind, original, ok := strings.Cut(value, ":")
+	if !ok {
+		return result{}, false
+	}
+
+	switch kind {
+	case kindOK:
+		return result{original: original}, true
+	case kindNotFound:
+		return result{err: fmt.Errorf("%w by key %s", failure.ErrNotFound, short)}, true
+	case kindDeleted:
+		return result{err: failure.ErrURLDeleted}, true
+	case kindFlagged:
+		return result{original: original, err: failure.ErrURLFlagged}, true
+	case kindBlocked:
+		return result{err: failure.ErrURLBlocked}, true
+	}
+
+	return result{}, false
+}
+
+// cacheable reports whether the result of GetOriginalURL may be cached.
+// Backend failures are never cached.
+func cacheable(err error) bool {
+	return err == nil ||
+		errors.Is(err, failure.ErrNotFound) ||
+		errors.Is(err, failure.ErrURLDeleted) ||
+		errors.Is(err, failure.ErrURLFlagged) ||
+		errors.Is(err, failure.ErrURLBlocked)
+}
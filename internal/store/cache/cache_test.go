@@ -0,0 +1,343 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+	"github.com/kupriyanovkk/shortener/internal/store/storetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts GetOriginalURL calls and optionally slows them down.
+type countingStore struct {
+	storeInterface.Store
+	calls   atomic.Int64
+	delay   time.Duration
+	failErr error
+}
+
+func (s *countingStore) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	s.calls.Add(1)
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if s.failErr != nil {
+		return "", s.failErr
+	}
+
+	return s.Store.GetOriginalURL(ctx, short)
+}
+
+func newTestStore(t testing.TB, opts Options) (*Store, *countingStore) {
+	backend := &countingStore{Store: inmemory.NewStore()}
+	return New(backend, opts), backend
+}
+
+func add(t testing.TB, s storeInterface.Store, short, original string) {
+	_, err := s.AddValue(context.Background(), storeInterface.AddValueOptions{Short: short, Original: original, UserID: "user"})
+	require.NoError(t, err)
+}
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, opts storeInterface.Options) storeInterface.Store {
+		store, err := registry.Open("memory://", opts)
+		require.NoError(t, err)
+
+		return New(store, Options{CaseInsensitive: opts.CaseInsensitive})
+	})
+}
+
+func TestGetOriginalURL(t *testing.T) {
+	ctx := context.Background()
+	s, backend := newTestStore(t, Options{})
+	add(t, s, "abc", "https://example.com")
+
+	for i := 0; i < 3; i++ {
+		original, err := s.GetOriginalURL(ctx, "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", original)
+	}
+	assert.Equal(t, int64(1), backend.calls.Load())
+
+	for i := 0; i < 3; i++ {
+		_, err := s.GetOriginalURL(ctx, "missing")
+		assert.ErrorIs(t, err, failure.ErrNotFound)
+	}
+	assert.Equal(t, int64(2), backend.calls.Load(), "unknown IDs are cached")
+
+	assert.Equal(t, Stats{Hits: 2, NegativeHits: 2, Misses: 2, Size: 2}, s.Stats())
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	s, backend := newTestStore(t, Options{TTL: time.Minute, NegativeTTL: time.Second})
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	add(t, s, "abc", "https://example.com")
+
+	s.GetOriginalURL(ctx, "abc")
+	s.GetOriginalURL(ctx, "missing")
+
+	now = now.Add(2 * time.Second)
+	s.GetOriginalURL(ctx, "abc")
+	s.GetOriginalURL(ctx, "missing")
+	assert.Equal(t, int64(3), backend.calls.Load(), "only negative entry expired")
+
+	now = now.Add(2 * time.Minute)
+	s.GetOriginalURL(ctx, "abc")
+	assert.Equal(t, int64(4), backend.calls.Load())
+}
+
+func TestInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStore(t, Options{})
+
+	_, err := s.GetOriginalURL(ctx, "abc")
+	require.ErrorIs(t, err, failure.ErrNotFound)
+
+	add(t, s, "abc", "https://example.com")
+	original, err := s.GetOriginalURL(ctx, "abc")
+	require.NoError(t, err, "AddValue invalidates cached miss")
+	assert.Equal(t, "https://example.com", original)
+
+	require.NoError(t, s.SetVerdict(ctx, "abc", models.VerdictBlock))
+	_, err = s.GetOriginalURL(ctx, "abc")
+	assert.ErrorIs(t, err, failure.ErrURLBlocked)
+
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: "user", URLs: []string{"abc"}}})
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(ctx, "abc")
+	assert.ErrorIs(t, err, failure.ErrURLDeleted)
+}
+
+func TestStaleLoad(t *testing.T) {
+	s, _ := newTestStore(t, Options{})
+
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+
+	s.invalidate("abc")
+	s.set("abc", "https://stale.com", nil, generation)
+
+	_, ok := s.get("abc")
+	assert.False(t, ok, "value loaded before invalidation isn't cached")
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	s, backend := newTestStore(t, Options{Size: 2})
+	add(t, s, "a", "https://example.com/a")
+	add(t, s, "b", "https://example.com/b")
+	add(t, s, "c", "https://example.com/c")
+
+	s.GetOriginalURL(ctx, "a")
+	s.GetOriginalURL(ctx, "b")
+	s.GetOriginalURL(ctx, "a")
+	s.GetOriginalURL(ctx, "c")
+
+	stats := s.Stats()
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Size)
+
+	calls := backend.calls.Load()
+	s.GetOriginalURL(ctx, "a")
+	assert.Equal(t, calls, backend.calls.Load(), "recently used entry is kept")
+	s.GetOriginalURL(ctx, "b")
+	assert.Equal(t, calls+1, backend.calls.Load(), "least recently used entry is evicted")
+}
+
+func TestBackendErrorsAreNotCached(t *testing.T) {
+	s, backend := newTestStore(t, Options{})
+	backend.failErr = errors.New("connection refused")
+
+	for i := 0; i < 2; i++ {
+		_, err := s.GetOriginalURL(context.Background(), "abc")
+		assert.EqualError(t, err, "connection refused")
+	}
+	assert.Equal(t, int64(2), backend.calls.Load())
+}
+
+func TestSingleflight(t *testing.T) {
+	s, backend := newTestStore(t, Options{})
+	backend.delay = 50 * time.Millisecond
+	add(t, s, "abc", "https://example.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			original, err := s.GetOriginalURL(context.Background(), "abc")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://example.com", original)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), backend.calls.Load())
+}
+
+func TestSingleflightCanceled(t *testing.T) {
+	s, backend := newTestStore(t, Options{})
+	backend.delay = 100 * time.Millisecond
+	add(t, s, "abc", "https://example.com")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := s.GetOriginalURL(ctx, "abc")
+		first <- err
+	}()
+
+	require.Eventually(t, func() bool { return backend.calls.Load() == 1 }, time.Second, time.Millisecond)
+	second := make(chan string)
+	go func() {
+		original, err := s.GetOriginalURL(context.Background(), "abc")
+		assert.NoError(t, err)
+		second <- original
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	assert.Equal(t, "https://example.com", <-second, "the shared load isn't canceled by the first caller")
+	assert.Equal(t, int64(1), backend.calls.Load())
+
+	s, backend = newTestStore(t, Options{LoadTimeout: 10 * time.Millisecond})
+	backend.delay = time.Second
+	_, err := s.GetOriginalURL(context.Background(), "abc")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+type mapShared struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (m *mapShared) Get(_ context.Context, key string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.values[key]
+	return value, ok, nil
+}
+
+func (m *mapShared) Set(_ context.Context, key, value string, _ time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[key] = value
+	return nil
+}
+
+func (m *mapShared) Delete(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func TestShared(t *testing.T) {
+	ctx := context.Background()
+	shared := &mapShared{values: make(map[string]string)}
+	backend := &countingStore{Store: inmemory.NewStore()}
+	first := New(backend, Options{Shared: shared})
+	second := New(backend, Options{Shared: shared})
+
+	add(t, first, "abc", "https://example.com")
+	require.NoError(t, first.SetVerdict(ctx, "abc", models.VerdictWarn))
+
+	original, err := first.GetOriginalURL(ctx, "abc")
+	assert.ErrorIs(t, err, failure.ErrURLFlagged)
+	assert.Equal(t, "https://example.com", original)
+
+	original, err = second.GetOriginalURL(ctx, "abc")
+	assert.ErrorIs(t, err, failure.ErrURLFlagged)
+	assert.Equal(t, "https://example.com", original)
+
+	_, err = second.GetOriginalURL(ctx, "missing")
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+	_, err = first.GetOriginalURL(ctx, "missing")
+	assert.EqualError(t, err, "value doesn't exist by key missing")
+
+	assert.Equal(t, int64(2), backend.calls.Load(), "second instance reuses lookups of the first one")
+
+	_, err = second.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: "user", URLs: []string{"abc"}}})
+	require.NoError(t, err)
+	_, ok, _ := shared.Get(ctx, "abc")
+	assert.False(t, ok, "shared entry is invalidated")
+}
+
+func TestSharedCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	shared := &mapShared{values: make(map[string]string)}
+	backend, err := registry.Open("memory://", storeInterface.Options{CaseInsensitive: true})
+	require.NoError(t, err)
+	first := New(backend, Options{Shared: shared, CaseInsensitive: true})
+	second := New(backend, Options{Shared: shared, CaseInsensitive: true})
+
+	add(t, first, "abc", "https://example.com")
+	for _, s := range []*Store{first, second} {
+		for _, short := range []string{"abc", "ABC"} {
+			_, err := s.GetOriginalURL(ctx, short)
+			require.NoError(t, err)
+		}
+	}
+	assert.Len(t, shared.values, 1, "aliases aren't shared")
+
+	_, err = second.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: "user", URLs: []string{"abc"}}})
+	require.NoError(t, err)
+	assert.Empty(t, shared.values)
+	assert.Empty(t, second.variants, "variants of invalidated entries are dropped")
+	_, err = second.GetOriginalURL(ctx, "ABC")
+	assert.ErrorIs(t, err, failure.ErrURLDeleted)
+}
+
+// backendLatency simulates a round trip to the database.
+const backendLatency = 100 * time.Microsecond
+
+func benchmarkRedirects(b *testing.B, newStore func(storeInterface.Store) storeInterface.Store) {
+	backend := &countingStore{Store: inmemory.NewStore(), delay: backendLatency}
+	s := newStore(backend)
+
+	const links = 1000
+	for i := 0; i < links; i++ {
+		add(b, s, fmt.Sprintf("short%d", i), fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.GetOriginalURL(ctx, fmt.Sprintf("short%d", i%links)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRedirectUncached(b *testing.B) {
+	benchmarkRedirects(b, func(s storeInterface.Store) storeInterface.Store { return s })
+}
+
+func BenchmarkRedirectCached(b *testing.B) {
+	benchmarkRedirects(b, func(s storeInterface.Store) storeInterface.Store { return New(s, Options{}) })
+}
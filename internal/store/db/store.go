@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/kupriyanovkk/shortener/internal/failure"
@@ -15,11 +17,14 @@ import (
 
 // Store structure
 type Store struct {
-	db storeInterface.DatabaseConnection
+	db       storeInterface.DatabaseConnection
+	dedup    storeInterface.DedupMode
+	foldCase bool
+	outbox   bool
 }
 
 // Bootstrap function create table shortener and
-// set unique index for 'original' field.
+// set unique index for 'original' field according to the dedup mode.
 func (s Store) Bootstrap(ctx context.Context) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -28,17 +33,60 @@ func (s Store) Bootstrap(ctx context.Context) error {
 
 	defer tx.Rollback()
 
-	tx.ExecContext(ctx, `
-		CREATE TABLE shortener(
+	queries := []string{`
+		CREATE TABLE IF NOT EXISTS shortener(
 			id serial PRIMARY KEY,
 			short varchar(128),
 			original TEXT,
 			user_id varchar(128) NOT NULL,
 			is_deleted BOOLEAN NOT NULL
 		)
-	`)
+	`,
+		// url_id was created by previous versions and counted deleted URLs as duplicates.
+		"DROP INDEX IF EXISTS url_id",
+		"ALTER TABLE shortener ADD COLUMN IF NOT EXISTS verdict varchar(16) NOT NULL DEFAULT ''",
+		"ALTER TABLE shortener ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now()",
+		"CREATE INDEX IF NOT EXISTS url_user_created ON shortener (user_id, created_at)",
+		"ALTER TABLE shortener ADD COLUMN IF NOT EXISTS clicks bigint NOT NULL DEFAULT 0",
+		"CREATE INDEX IF NOT EXISTS url_created ON shortener (created_at)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS url_short ON shortener (short)",
+		"CREATE SEQUENCE IF NOT EXISTS shortener_short_seq",
+		`
+		CREATE TABLE IF NOT EXISTS shortener_outbox(
+			id bigserial PRIMARY KEY,
+			type varchar(32) NOT NULL,
+			short varchar(128) NOT NULL,
+			original TEXT NOT NULL DEFAULT '',
+			user_id varchar(128) NOT NULL DEFAULT '',
+			clicks bigint NOT NULL DEFAULT 0,
+			created_at timestamptz NOT NULL DEFAULT now()
+		)
+	`,
+	}
 
-	tx.ExecContext(ctx, "CREATE UNIQUE INDEX url_id ON shortener (original)")
+	switch s.dedup {
+	case storeInterface.DedupGlobal:
+		queries = append(queries,
+			"DROP INDEX IF EXISTS url_user_original",
+			"CREATE UNIQUE INDEX IF NOT EXISTS url_original ON shortener (original) WHERE NOT is_deleted",
+		)
+	case storeInterface.DedupUser:
+		queries = append(queries,
+			"DROP INDEX IF EXISTS url_original",
+			"CREATE UNIQUE INDEX IF NOT EXISTS url_user_original ON shortener (user_id, original) WHERE NOT is_deleted",
+		)
+	default:
+		queries = append(queries,
+			"DROP INDEX IF EXISTS url_original",
+			"DROP INDEX IF EXISTS url_user_original",
+		)
+	}
+
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
 
 	return tx.Commit()
 }
@@ -48,35 +96,61 @@ func (s Store) FindOriginalURL(ctx context.Context, short string) (models.URL, e
 	var (
 		original  string
 		isDeleted bool
+		verdict   string
 	)
-	row := s.db.QueryRowContext(ctx, `SELECT original, is_deleted FROM shortener WHERE short = $1`, short)
-	err := row.Scan(&original, &isDeleted)
+	row := s.db.QueryRowContext(ctx, `SELECT original, is_deleted, verdict FROM shortener WHERE short = $1`, short)
+	err := row.Scan(&original, &isDeleted, &verdict)
 
 	return models.URL{
 		Original:    original,
 		DeletedFlag: isDeleted,
+		Verdict:     models.Verdict(verdict),
 	}, err
 }
 
 // FindShortURL using for search short URL by original.
-func (s Store) FindShortURL(ctx context.Context, original string) (shortURL string, err error) {
-	row := s.db.QueryRowContext(ctx, `SELECT short FROM shortener WHERE original = $1`, original)
+// In DedupUser mode only URLs of the user are taken into account.
+func (s Store) FindShortURL(ctx context.Context, original, userID string) (shortURL string, err error) {
+	return s.findShortURL(ctx, s.db, original, userID)
+}
+
+func (s Store) findShortURL(ctx context.Context, db executor, original, userID string) (shortURL string, err error) {
+	var row *sql.Row
+	if s.dedup == storeInterface.DedupUser {
+		row = db.QueryRowContext(ctx, `SELECT short FROM shortener WHERE original = $1 AND user_id = $2 AND NOT is_deleted`, original, userID)
+	} else {
+		row = db.QueryRowContext(ctx, `SELECT short FROM shortener WHERE original = $1 AND NOT is_deleted`, original)
+	}
 	err = row.Scan(&shortURL)
 	return
 }
 
 // InsertURL inserts new URL into a table.
 func (s Store) InsertURL(ctx context.Context, short, original, userID string) error {
-	_, err := s.db.ExecContext(ctx, `
+	return s.insertURL(ctx, s.db, short, original, userID)
+}
+
+// executor runs statements on the database or in a transaction.
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s Store) insertURL(ctx context.Context, db executor, short, original, userID string) error {
+	query := s.withOutbox(`
 			INSERT INTO shortener
 			(short, original, user_id, is_deleted)
 			VALUES
-			($1, $2, $3, $4);
-	`, short, original, userID, false)
+			($1, $2, $3, $4)
+	`, storeInterface.OutboxCreated, "short, original, user_id, 0, created_at")
+	_, err := db.ExecContext(ctx, query, short, original, userID, false)
 
 	if err != nil {
 		var pgErr *pq.Error
 		if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
+			if pgErr.Constraint == "url_short" {
+				return fmt.Errorf("%w: %s", failure.ErrShortExists, short)
+			}
 			err = failure.ErrConflict
 		}
 	}
@@ -84,32 +158,109 @@ func (s Store) InsertURL(ctx context.Context, short, original, userID string) er
 	return err
 }
 
+// insertWithQuota inserts new URL if the user's quota allows it. Inserts of the user
+// are serialized by an advisory lock, so concurrent requests can't exceed the quota.
+// URLs already shortened are reported as failure.ErrConflict even at the limit.
+func (s Store) insertWithQuota(ctx context.Context, opts storeInterface.AddValueOptions) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('shortener_quota'), hashtext($1))`, opts.UserID)
+	if err != nil {
+		return err
+	}
+
+	usage, err := s.getUserUsage(ctx, tx, opts.UserID, opts.Quota.Since)
+	if err != nil {
+		return err
+	}
+
+	if err := opts.Quota.Check(usage); err != nil {
+		if s.dedup != storeInterface.DedupOff {
+			if _, findErr := s.findShortURL(ctx, tx, opts.Original, opts.UserID); findErr == nil {
+				return failure.ErrConflict
+			}
+		}
+		return err
+	}
+
+	if err := s.insertURL(ctx, tx, opts.Short, opts.Original, opts.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // GetOriginalURL using for search original URL by short.
+// For flagged URLs the original URL is returned along with failure.ErrURLFlagged.
 func (s Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	return storeInterface.LookupFolded(ctx, short, s.foldCase, s.getOriginalURL)
+}
+
+func (s Store) getOriginalURL(ctx context.Context, short string) (string, error) {
 	URL, err := s.FindOriginalURL(ctx, short)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	if err != nil {
+		return "", err
+	}
 
 	if URL.DeletedFlag {
-		return "", errors.New("URL is deleted")
+		return "", failure.ErrURLDeleted
 	}
 
-	return URL.Original, err
+	return storeInterface.CheckVerdict(URL.Original, URL.Verdict)
+}
+
+// SetVerdict sets verdict of malicious URL scanning.
+func (s Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	result, err := s.db.ExecContext(ctx, `UPDATE shortener SET verdict = $1 WHERE short = $2`, string(verdict), short)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	return nil
 }
 
 // AddValue adding new URL into database.
+// If the short ID is already taken, failure.ErrShortExists is returned.
 func (s Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
 	if opts.Original == "" {
 		return "", failure.ErrEmptyOrigURL
 	}
 
-	err := s.InsertURL(ctx, opts.Short, opts.Original, opts.UserID)
+	var err error
+	if opts.Quota == nil {
+		err = s.InsertURL(ctx, opts.Short, opts.Original, opts.UserID)
+	} else {
+		err = s.insertWithQuota(ctx, opts)
+	}
 
 	if err != nil && errors.Is(err, failure.ErrConflict) {
-		short, _ := s.FindShortURL(ctx, opts.Original)
+		short, _ := s.FindShortURL(ctx, opts.Original, opts.UserID)
 		result := fmt.Sprintf("%s/%s", opts.BaseURL, short)
 
 		return result, err
 	}
 
+	if err != nil {
+		return "", err
+	}
+
 	return fmt.Sprintf("%s/%s", opts.BaseURL, opts.Short), nil
 }
 
@@ -146,30 +297,84 @@ func (s Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsO
 	return result, nil
 }
 
-// DeleteURLs marked URLs as deleted.
-func (s Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) error {
+// GetOwners returns owners of the links by their short IDs.
+func (s Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	return storeInterface.OwnersFolded(ctx, shorts, s.foldCase, s.getOwners)
+}
+
+func (s Store) getOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	owners := make(map[string]string, len(shorts))
+	if len(shorts) == 0 {
+		return owners, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT short, user_id FROM shortener WHERE short = ANY($1::varchar[])`, pq.Array(shorts))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var short, owner string
+		if err := rows.Scan(&short, &owner); err != nil {
+			return nil, err
+		}
+		owners[short] = owner
+	}
+
+	return owners, rows.Err()
+}
+
+// DeleteURLs marked URLs as deleted in a single transaction, so nothing is deleted on failure.
+func (s Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer tx.Rollback()
 
-	for _, o := range opts {
-		for _, u := range o.URLs {
-			_, err := tx.ExecContext(ctx, `
+	// Outbox messages are recorded for deleted URLs only, so they list the deleted short IDs as well.
+	query := s.withOutbox(`
 			UPDATE shortener SET is_deleted = TRUE
-				WHERE short = $1 AND user_id = $2
-		`, u, o.UserID)
+				WHERE short = ANY($1::varchar[]) AND user_id = $2 AND NOT is_deleted
+		`, storeInterface.OutboxDeleted, "short, '', user_id, 0, now()") + " RETURNING short"
 
-			if err != nil {
-				tx.Rollback()
-				return err
-			}
+	var deleted []storeInterface.DeletedURLs
+	for _, o := range opts {
+		shorts, err := s.deleteUserURLs(ctx, tx, query, o)
+		if err != nil {
+			return nil, err
 		}
+		deleted = storeInterface.AppendDeleted(deleted, o, shorts)
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// deleteUserURLs runs the deleting query for URLs of the request and returns the deleted short IDs.
+func (s Store) deleteUserURLs(ctx context.Context, tx *sql.Tx, query string, o storeInterface.DeletedURLs) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, pq.Array(o.URLs), o.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var shorts []string
+	for rows.Next() {
+		var short string
+		if err := rows.Scan(&short); err != nil {
+			return nil, err
+		}
+		shorts = append(shorts, short)
+	}
+
+	return shorts, rows.Err()
 }
 
 // Ping checks database connection.
@@ -178,25 +383,263 @@ func (s Store) Ping() error {
 	return err
 }
 
-// GetInternalStats returning internal statistics
-func (s Store) GetInternalStats(ctx context.Context) (models.InternalStats, error) {
-	var (
-		urlCount  int
-		userCount int
-	)
-	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM shortener`).Scan(&urlCount)
+// NextID returns the next number of the sequence used by the sequential ID strategy.
+func (s Store) NextID(ctx context.Context) (uint64, error) {
+	var id uint64
+	err := s.db.QueryRowContext(ctx, `SELECT nextval('shortener_short_seq')`).Scan(&id)
+
+	return id, err
+}
+
+// GetUserUsage returns the number of user's links and links created since the time.
+func (s Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	return s.getUserUsage(ctx, s.db, userID, since)
+}
+
+func (s Store) getUserUsage(ctx context.Context, db executor, userID string, since time.Time) (models.Usage, error) {
+	var usage models.Usage
+
+	row := db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE NOT is_deleted),
+			COUNT(*) FILTER (WHERE created_at >= $2)
+		FROM shortener
+		WHERE user_id = $1
+	`, userID, since)
+	err := row.Scan(&usage.Links, &usage.Created)
+
+	return usage, err
+}
+
+// GetInternalStats returning internal statistics.
+// All queries run in a read-only transaction, so they see the same snapshot.
+func (s Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	opts = opts.WithDefaults()
+	now := time.Now()
+	since := opts.Since(now)
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return models.InternalStats{}, err
+	}
+
+	defer tx.Rollback()
+
+	var stats models.InternalStats
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE NOT is_deleted),
+			COUNT(DISTINCT user_id),
+			COALESCE(SUM(clicks), 0),
+			pg_total_relation_size('shortener')
+		FROM shortener
+	`).Scan(&stats.URLs, &stats.Active, &stats.Users, &stats.Clicks, &stats.StoreSize)
 	if err != nil {
 		return models.InternalStats{}, err
 	}
-	err = s.db.QueryRowContext(ctx, `SELECT user_id, COUNT(user_id) FROM shortener GROUP BY user_id`).Scan(&userCount)
+	stats.Deleted = stats.URLs - stats.Active
+
+	days, err := queryCounts(ctx, tx, `
+		SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD'), COUNT(*)
+		FROM shortener
+		WHERE created_at >= $1
+		GROUP BY 1
+	`, since)
 	if err != nil {
 		return models.InternalStats{}, err
 	}
+	stats.CreatedPerDay = storeInterface.DailyCounts(days, since, now)
+
+	users, err := queryCounts(ctx, tx, `
+		SELECT user_id, COUNT(*)
+		FROM shortener
+		WHERE NOT is_deleted
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT $1
+	`, opts.Top)
+	if err != nil {
+		return models.InternalStats{}, err
+	}
+	stats.TopUsers = storeInterface.TopUsers(users, opts.Top)
+
+	// The host is taken as Go's url.URL.Hostname does: without user info, port and IPv6 brackets.
+	domains, err := queryCounts(ctx, tx, `
+		SELECT domain, COUNT(*)
+		FROM (
+			SELECT btrim(lower(substring(original from '^[^:/?#]+://(?:[^/?#@]*@)?(\[[^]/?#]*\]|[^/?#:]+)')), '[]') AS domain
+			FROM shortener
+			WHERE NOT is_deleted
+		) AS hosts
+		WHERE domain <> ''
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT $1
+	`, opts.Top)
+	if err != nil {
+		return models.InternalStats{}, err
+	}
+	stats.TopDomains = storeInterface.TopDomains(domains, opts.Top)
+
+	return stats, tx.Commit()
+}
+
+// queryCounts returns counts by keys selected by the query as (key, count) rows.
+func queryCounts(ctx context.Context, tx *sql.Tx, query string, args ...any) (map[string]int, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			key   string
+			count int
+		)
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// AddClicks adds the numbers of redirects to the URLs by a single statement and returns
+// their totals, unknown short IDs are skipped.
+func (s Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	totals := make(map[string]int64, len(clicks))
+	if len(clicks) == 0 {
+		return totals, nil
+	}
+
+	shorts := make([]string, 0, len(clicks))
+	counts := make([]int64, 0, len(clicks))
+	for short, n := range clicks {
+		shorts = append(shorts, short)
+		counts = append(counts, n)
+	}
+
+	mutation := `
+		UPDATE shortener AS s SET clicks = s.clicks + c.clicks
+		FROM unnest($1::varchar[], $2::bigint[]) AS c(short, clicks)
+		WHERE s.short = c.short
+	`
+	query := mutation + " RETURNING s.short, s.clicks"
+	if s.outbox {
+		// The outbox messages carry added clicks, so the totals are selected from the mutation itself.
+		query = fmt.Sprintf(`
+			WITH changed AS (%s RETURNING s.short, s.clicks AS total, c.clicks AS added),
+			recorded AS (
+				INSERT INTO shortener_outbox (type, short, original, user_id, clicks, created_at)
+				SELECT '%s', short, '', '', added, now() FROM changed
+			)
+			SELECT short, total FROM changed
+		`, mutation, storeInterface.OutboxClicked)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(shorts), pq.Array(counts))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			short string
+			total int64
+		)
+		if err := rows.Scan(&short, &total); err != nil {
+			return nil, err
+		}
+		totals[short] = total
+	}
+
+	return totals, rows.Err()
+}
+
+// withOutbox returns the statement recording rows changed by the mutation in the outbox
+// as messages of the type, or the mutation itself if the outbox is disabled. A single
+// statement is atomic, so messages are recorded if and only if the mutation succeeds.
+// The returning list selects short, original, user_id, clicks and created_at of messages.
+func (s Store) withOutbox(mutation, messageType, returning string) string {
+	if !s.outbox {
+		return mutation
+	}
+
+	return fmt.Sprintf(`
+		WITH changed AS (%s RETURNING '%s'::varchar, %s)
+		INSERT INTO shortener_outbox (type, short, original, user_id, clicks, created_at)
+		SELECT * FROM changed
+	`, mutation, messageType, returning)
+}
+
+// RelayOutbox passes up to limit oldest outbox messages to publish and deletes them if it
+// succeeds. Relays of all instances are serialized by an advisory lock, the relay returns
+// nothing while another one holds it. Messages are relayed in order of their IDs.
+func (s Store) RelayOutbox(ctx context.Context, limit int, publish storeInterface.Publish) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	var locked bool
+	err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock(hashtext('shortener_outbox'))`).Scan(&locked)
+	if err != nil || !locked {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, type, short, original, user_id, clicks, created_at
+		FROM shortener_outbox ORDER BY id LIMIT $1
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rows.Close()
+
+	var (
+		ids      []int64
+		messages []storeInterface.OutboxMessage
+	)
+	for rows.Next() {
+		var (
+			id int64
+			m  storeInterface.OutboxMessage
+		)
+		if err := rows.Scan(&id, &m.Type, &m.Short, &m.Original, &m.UserID, &m.Clicks, &m.Time); err != nil {
+			return 0, err
+		}
+		m.ID = strconv.FormatInt(id, 10)
+		m.Time = m.Time.UTC()
+
+		ids = append(ids, id)
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	if err := publish(ctx, messages); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM shortener_outbox WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
 
-	return models.InternalStats{
-		URLs:  urlCount,
-		Users: userCount,
-	}, nil
+	return len(messages), tx.Commit()
 }
 
 // NewStore return Store for working with DB
@@ -2,13 +2,19 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgerrcode"
 	"github.com/kupriyanovkk/shortener/internal/failure"
 	"github.com/kupriyanovkk/shortener/internal/models"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/lib/pq"
 )
 
 func TestAddValue(t *testing.T) {
@@ -57,22 +63,29 @@ func TestAddValue(t *testing.T) {
 			expectedErr: failure.ErrConflict,
 		},
 		{
-			name:          "AddValue with FileWriterStorage",
-			short:         "example",
-			original:      "https://example.com",
-			user:          "123",
-			dbExpectation: func(short, original, user string) {},
-			expectedURL:   "https://example.com/example",
-			expectedErr:   nil,
+			name:     "AddValue insert error",
+			short:    "example",
+			original: "https://example.com",
+			user:     "123",
+			dbExpectation: func(short, original, user string) {
+				mock.ExpectExec("INSERT INTO shortener").WithArgs(short, original, user, false).WillReturnError(errors.New("connection refused"))
+			},
+			expectedURL: "",
+			expectedErr: errors.New("connection refused"),
 		},
 		{
-			name:          "AddValue with MemoryStorage",
-			short:         "example",
-			original:      "https://example.com",
-			user:          "123",
-			dbExpectation: func(short, original, user string) {},
-			expectedURL:   "https://example.com/example",
-			expectedErr:   nil,
+			name:     "AddValue short already exists",
+			short:    "example",
+			original: "https://example.com",
+			user:     "123",
+			dbExpectation: func(short, original, user string) {
+				mock.ExpectExec("INSERT INTO shortener").WithArgs(short, original, user, false).WillReturnError(&pq.Error{
+					Code:       pgerrcode.UniqueViolation,
+					Constraint: "url_short",
+				})
+			},
+			expectedURL: "",
+			expectedErr: fmt.Errorf("%w: example", failure.ErrShortExists),
 		},
 		{
 			name:     "AddValue conflict - Short URL already exists",
@@ -243,6 +256,35 @@ func TestGetUserURLs(t *testing.T) {
 	}
 }
 
+func TestGetOwners(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error occurred while creating mock database: %s", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db, foldCase: true}
+
+	mock.ExpectQuery("SELECT short, user_id FROM shortener WHERE short = ANY").
+		WithArgs(pq.Array([]string{"short1", "Short2"})).
+		WillReturnRows(sqlmock.NewRows([]string{"short", "user_id"}).AddRow("short1", "user1"))
+	mock.ExpectQuery("SELECT short, user_id FROM shortener WHERE short = ANY").
+		WithArgs(pq.Array([]string{"short2"})).
+		WillReturnRows(sqlmock.NewRows([]string{"short", "user_id"}).AddRow("short2", "user2"))
+
+	owners, err := s.GetOwners(context.Background(), []string{"short1", "Short2"})
+	if err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+	if !reflect.DeepEqual(owners, map[string]string{"short1": "user1", "Short2": "user2"}) {
+		t.Errorf("Unexpected owners: %v", owners)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestFindOriginalURL(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -268,9 +310,9 @@ func TestFindOriginalURL(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		mock.ExpectQuery("SELECT original, is_deleted FROM shortener WHERE short = ?").
+		mock.ExpectQuery("SELECT original, is_deleted, verdict FROM shortener WHERE short = ?").
 			WithArgs(c.short).
-			WillReturnRows(sqlmock.NewRows([]string{"original", "is_deleted"}).AddRow(c.expectedURL.Original, c.expectedURL.DeletedFlag))
+			WillReturnRows(sqlmock.NewRows([]string{"original", "is_deleted", "verdict"}).AddRow(c.expectedURL.Original, c.expectedURL.DeletedFlag, c.expectedURL.Verdict))
 
 		url, err := s.FindOriginalURL(context.Background(), c.short)
 		if err != c.expectedErr {
@@ -301,13 +343,17 @@ func TestDeleteURLs(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE shortener SET is_deleted = TRUE").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("UPDATE shortener SET is_deleted = TRUE .* RETURNING short").
+			WillReturnRows(sqlmock.NewRows([]string{"short"}).AddRow("example1.com"))
 		mock.ExpectCommit()
 
-		err := s.DeleteURLs(context.Background(), opts)
+		deleted, err := s.DeleteURLs(context.Background(), opts)
 		if err != nil {
 			t.Errorf("Failed to delete single URL: %v", err)
 		}
+		if !reflect.DeepEqual(deleted, opts) {
+			t.Errorf("Expected %v deleted, got: %v", opts, deleted)
+		}
 	})
 
 	// Test case for deleting multiple URLs
@@ -324,14 +370,18 @@ func TestDeleteURLs(t *testing.T) {
 		}
 
 		mock.ExpectBegin()
-		mock.ExpectExec("UPDATE shortener").WithArgs("example2.com", "user2").WillReturnResult(sqlmock.NewResult(0, 1))
-		mock.ExpectExec("UPDATE shortener").WithArgs("example3.com", "user2").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("UPDATE shortener").WithArgs(pq.Array([]string{"example2.com", "example3.com"}), "user2").
+			WillReturnRows(sqlmock.NewRows([]string{"short"}).AddRow("example3.com"))
 		mock.ExpectCommit()
 
-		err := s.DeleteURLs(context.Background(), opts)
+		deleted, err := s.DeleteURLs(context.Background(), opts)
 		if err != nil {
 			t.Errorf("Failed to delete multiple URLs: %v", err)
 		}
+		expected := []storeInterface.DeletedURLs{{URLs: []string{"example3.com"}, UserID: "user2"}}
+		if !reflect.DeepEqual(deleted, expected) {
+			t.Errorf("Expected only URLs not deleted yet, got: %v", deleted)
+		}
 	})
 }
 
@@ -345,16 +395,276 @@ func TestGetInternalStats(t *testing.T) {
 
 	store := Store{db: db}
 
-	mock.ExpectQuery("SELECT COUNT(*) FROM shortener").WillReturnError(errors.New("database error"))
-	_, err = store.GetInternalStats(ctx)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT(.+)FROM shortener").WillReturnError(errors.New("database error"))
+	mock.ExpectRollback()
+	_, err = store.GetInternalStats(ctx, storeInterface.StatsOptions{})
 	if err == nil {
 		t.Errorf("Expected an error, but got nil")
 	}
 
-	mock.ExpectQuery("SELECT COUNT(*) FROM shortener").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
-	mock.ExpectQuery("SELECT user_id, COUNT(user_id) FROM shortener GROUP BY user_id").WillReturnError(errors.New("database error"))
-	_, err = store.GetInternalStats(ctx)
-	if err == nil {
-		t.Errorf("Expected an error, but got nil")
+	today := storeInterface.Day(time.Now())
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT(.+)pg_total_relation_size").
+		WillReturnRows(sqlmock.NewRows([]string{"urls", "active", "users", "clicks", "size"}).AddRow(10, 7, 3, 42, 8192))
+	mock.ExpectQuery("SELECT to_char").
+		WillReturnRows(sqlmock.NewRows([]string{"day", "count"}).AddRow(today, 4))
+	mock.ExpectQuery("SELECT user_id, COUNT").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "count"}).AddRow("user1", 5).AddRow("user2", 2))
+	mock.ExpectQuery("SELECT domain, COUNT").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"domain", "count"}).AddRow("example.com", 6))
+	mock.ExpectCommit()
+
+	stats, err := store.GetInternalStats(ctx, storeInterface.StatsOptions{Top: 2, Days: 3})
+	if err != nil {
+		t.Fatalf("Error was not expected, got: %v", err)
+	}
+
+	if stats.URLs != 10 || stats.Active != 7 || stats.Deleted != 3 || stats.Users != 3 || stats.Clicks != 42 || stats.StoreSize != 8192 {
+		t.Errorf("Unexpected counts %+v", stats)
+	}
+	if len(stats.CreatedPerDay) != 3 || stats.CreatedPerDay[2] != (models.DailyCount{Day: today, Count: 4}) {
+		t.Errorf("Unexpected links created per day %v", stats.CreatedPerDay)
+	}
+	if len(stats.TopUsers) != 2 || stats.TopUsers[0] != (models.UserCount{UserID: "user1", Links: 5}) {
+		t.Errorf("Unexpected top users %v", stats.TopUsers)
+	}
+	if len(stats.TopDomains) != 1 || stats.TopDomains[0] != (models.DomainCount{Domain: "example.com", Links: 6}) {
+		t.Errorf("Unexpected top domains %v", stats.TopDomains)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddClicks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db}
+
+	if _, err := s.AddClicks(context.Background(), nil); err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+
+	mock.ExpectQuery("UPDATE shortener AS s SET clicks .* RETURNING s.short, s.clicks").
+		WithArgs(pq.Array([]string{"short1"}), pq.Array([]int64{3})).
+		WillReturnRows(sqlmock.NewRows([]string{"short", "clicks"}).AddRow("short1", 10))
+	totals, err := s.AddClicks(context.Background(), map[string]int64{"short1": 3})
+	if err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+	if !reflect.DeepEqual(totals, map[string]int64{"short1": 10}) {
+		t.Errorf("Expected the total of 10 clicks, got: %v", totals)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestSetVerdict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db}
+
+	mock.ExpectExec("UPDATE shortener SET verdict").WithArgs("block", "short1").WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := s.SetVerdict(context.Background(), "short1", models.VerdictBlock); err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+
+	mock.ExpectExec("UPDATE shortener SET verdict").WithArgs("warn", "missing").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := s.SetVerdict(context.Background(), "missing", models.VerdictWarn); !errors.Is(err, failure.ErrNotFound) {
+		t.Errorf("Expected error %v, got: %v", failure.ErrNotFound, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestNextID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db}
+
+	mock.ExpectQuery("SELECT nextval").WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(42))
+
+	id, err := s.NextID(context.Background())
+	if err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+	if id != 42 {
+		t.Errorf("Expected 42, got: %d", id)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetUserUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db}
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT (.+) FROM shortener WHERE user_id = ?").
+		WithArgs("user1", since).
+		WillReturnRows(sqlmock.NewRows([]string{"links", "created"}).AddRow(5, 2))
+
+	usage, err := s.GetUserUsage(context.Background(), "user1", since)
+	if err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+	if usage != (models.Usage{Links: 5, Created: 2}) {
+		t.Errorf("Expected usage %+v, got: %+v", models.Usage{Links: 5, Created: 2}, usage)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db, outbox: true}
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	mock.ExpectQuery("WITH changed AS \\(\\s*UPDATE shortener AS s SET clicks.*INSERT INTO shortener_outbox.*SELECT short, total FROM changed").
+		WithArgs(pq.Array([]string{"short1"}), pq.Array([]int64{3})).
+		WillReturnRows(sqlmock.NewRows([]string{"short", "total"}).AddRow("short1", 3))
+	if _, err := s.AddClicks(context.Background(), map[string]int64{"short1": 3}); err != nil {
+		t.Errorf("Error was not expected, got: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT id, type, short, original, user_id, clicks, created_at FROM shortener_outbox").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "short", "original", "user_id", "clicks", "created_at"}).
+			AddRow(7, storeInterface.OutboxClicked, "short1", "", "", 3, created))
+	mock.ExpectExec("DELETE FROM shortener_outbox").WithArgs(pq.Array([]int64{7})).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	var relayed []storeInterface.OutboxMessage
+	n, err := s.RelayOutbox(context.Background(), 10, func(_ context.Context, messages []storeInterface.OutboxMessage) error {
+		relayed = append(relayed, messages...)
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("Expected 1 relayed message, got: %d, %v", n, err)
+	}
+	expected := storeInterface.OutboxMessage{ID: "7", Type: storeInterface.OutboxClicked, Short: "short1", Clicks: 3, Time: created}
+	if len(relayed) != 1 || relayed[0] != expected {
+		t.Errorf("Expected %v, got: %v", expected, relayed)
+	}
+
+	publishErr := errors.New("publish failed")
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectQuery("SELECT id, type, short, original, user_id, clicks, created_at FROM shortener_outbox").
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "type", "short", "original", "user_id", "clicks", "created_at"}).
+			AddRow(8, storeInterface.OutboxDeleted, "short1", "", "user", 0, created))
+	mock.ExpectRollback()
+
+	_, err = s.RelayOutbox(context.Background(), 10, func(context.Context, []storeInterface.OutboxMessage) error {
+		return publishErr
+	})
+	if !errors.Is(err, publishErr) {
+		t.Errorf("Expected error %v, got: %v", publishErr, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT pg_try_advisory_xact_lock").WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	mock.ExpectRollback()
+
+	n, err = s.RelayOutbox(context.Background(), 10, func(context.Context, []storeInterface.OutboxMessage) error {
+		t.Error("Messages locked by another relay were published")
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Errorf("Expected nothing relayed, got: %d, %v", n, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestAddValueQuota(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	s := Store{db: db}
+	since := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	quota := &storeInterface.Quota{MaxLinks: 2, Since: since}
+	opts := storeInterface.AddValueOptions{Original: "https://example.com", BaseURL: "http://localhost", Short: "short", UserID: "user", Quota: quota}
+	usage := func(links, created int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"links", "created"}).AddRow(links, created)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs("user").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT").WithArgs("user", since).WillReturnRows(usage(1, 1))
+	mock.ExpectExec("INSERT INTO shortener").WithArgs("short", "https://example.com", "user", false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	result, err := s.AddValue(context.Background(), opts)
+	if err != nil || result != "http://localhost/short" {
+		t.Errorf("Expected http://localhost/short, got: %s, %v", result, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs("user").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT").WithArgs("user", since).WillReturnRows(usage(2, 2))
+	mock.ExpectQuery("SELECT short FROM shortener").WithArgs("https://example.com").WillReturnRows(sqlmock.NewRows([]string{"short"}).AddRow("existing"))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT short FROM shortener").WithArgs("https://example.com").WillReturnRows(sqlmock.NewRows([]string{"short"}).AddRow("existing"))
+
+	result, err = s.AddValue(context.Background(), opts)
+	if !errors.Is(err, failure.ErrConflict) || result != "http://localhost/existing" {
+		t.Errorf("Expected the existing URL with conflict at the limit, got: %s, %v", result, err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs("user").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT COUNT").WithArgs("user", since).WillReturnRows(usage(2, 2))
+	mock.ExpectQuery("SELECT short FROM shortener").WithArgs("https://example.com").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err = s.AddValue(context.Background(), opts)
+	var quotaErr *storeInterface.QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Limit != storeInterface.QuotaLinks {
+		t.Errorf("Expected links quota error, got: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("There were unfulfilled expectations: %s", err)
 	}
 }
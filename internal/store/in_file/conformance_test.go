@@ -0,0 +1,32 @@
+package infile
+
+import (
+	"path/filepath"
+	"testing"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.RunPersistent(t, func(t *testing.T, opts storeInterface.Options) storeInterface.Store {
+		store, err := newStore(filepath.Join(t.TempDir(), "short-url-db.json"), 0666, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return store
+	}, func(t *testing.T, s storeInterface.Store) storeInterface.Store {
+		old := s.(*Store)
+		if err := old.file.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := newStore(old.file.Name(), 0666, storeInterface.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
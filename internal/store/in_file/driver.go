@@ -0,0 +1,48 @@
+package infile
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+)
+
+func init() {
+	registry.Register("file", open)
+}
+
+// open creates Store from the storage URI like file:///var/lib/short.jsonl?perm=0600.
+//
+// Supported options:
+//   - perm: octal permission bits used when the file is created, 0666 by default.
+func open(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error) {
+	filename := filePath(uri)
+	if filename == "" {
+		return nil, errors.New("file storage path is empty")
+	}
+
+	perm := os.FileMode(0666)
+	if value := uri.Query().Get("perm"); value != "" {
+		parsed, err := strconv.ParseUint(value, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("option perm: %w", err)
+		}
+		perm = os.FileMode(parsed)
+	}
+
+	return newStore(filename, perm, opts)
+}
+
+// filePath extracts file path from the URI. Both file:///abs/path and
+// file://./relative/path forms are accepted.
+func filePath(uri *url.URL) string {
+	if uri.Opaque != "" {
+		return uri.Opaque
+	}
+
+	return uri.Host + uri.Path
+}
@@ -0,0 +1,85 @@
+package infile
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePath(t *testing.T) {
+	testCases := []struct {
+		uri      string
+		expected string
+	}{
+		{uri: "file:///var/lib/short.jsonl", expected: "/var/lib/short.jsonl"},
+		{uri: "file://./short.jsonl", expected: "./short.jsonl"},
+		{uri: "file:short.jsonl", expected: "short.jsonl"},
+		{uri: "file://", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.uri, func(t *testing.T) {
+			uri, err := url.Parse(tc.uri)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, filePath(uri))
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "short.jsonl")
+
+	uri, _ := url.Parse("file://" + fileName + "?perm=0600")
+	_, err := open(uri, storeInterface.Options{})
+	require.NoError(t, err)
+
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	uri, _ = url.Parse("file://" + fileName + "?perm=abc")
+	_, err = open(uri, storeInterface.Options{})
+	assert.Error(t, err)
+}
+
+func TestOutboxReload(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "short-url-db.json")
+	opts := storeInterface.Options{Outbox: true}
+
+	store, err := newStore(path, 0666, opts)
+	require.NoError(t, err)
+	for _, short := range []string{"first", "second", "third"} {
+		_, err = store.AddValue(ctx, storeInterface.AddValueOptions{Original: "https://example.com/" + short, Short: short})
+		require.NoError(t, err)
+	}
+	n, err := store.RelayOutbox(ctx, 2, func(context.Context, []storeInterface.OutboxMessage) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	reloaded, err := newStore(path, 0666, opts)
+	require.NoError(t, err)
+
+	var relayed []storeInterface.OutboxMessage
+	n, err = reloaded.RelayOutbox(ctx, 10, func(_ context.Context, messages []storeInterface.OutboxMessage) error {
+		relayed = append(relayed, messages...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, n, "acknowledged messages aren't relayed again")
+	assert.Equal(t, "third", relayed[0].Short)
+
+	_, err = reloaded.AddValue(ctx, storeInterface.AddValueOptions{Original: "https://example.com/fourth", Short: "fourth"})
+	require.NoError(t, err)
+	_, err = reloaded.RelayOutbox(ctx, 10, func(_ context.Context, messages []storeInterface.OutboxMessage) error {
+		assert.NotEqual(t, relayed[0].ID, messages[0].ID, "IDs continue after reload")
+		return nil
+	})
+	require.NoError(t, err)
+}
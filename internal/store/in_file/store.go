@@ -2,110 +2,245 @@ package infile
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/kupriyanovkk/shortener/internal/failure"
 	"github.com/kupriyanovkk/shortener/internal/models"
 	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
 )
 
-var uuid = 0
+// line is a line of the storage file. Besides URLs, the file keeps outbox messages
+// and acknowledgements of relayed messages, which are told apart by their fields.
+type line struct {
+	models.URL
+	Outbox    *storeInterface.OutboxMessage `json:"outbox,omitempty"`
+	OutboxAck string                        `json:"outbox_ack,omitempty"`
+}
+
+type outboxLine struct {
+	Outbox *storeInterface.OutboxMessage `json:"outbox"`
+}
+
+type ackLine struct {
+	OutboxAck string `json:"outbox_ack"`
+}
 
 // ReadValuesFromFile return value from storage file
 func ReadValuesFromFile(scanner *bufio.Scanner) (map[string]models.URL, error) {
-	if !scanner.Scan() {
-		return nil, scanner.Err()
-	}
+	values, _, _, err := readFile(scanner)
+
+	return values, err
+}
 
+// readFile returns values, outbox messages not acknowledged yet and the last outbox message ID.
+func readFile(scanner *bufio.Scanner) (map[string]models.URL, []storeInterface.OutboxMessage, uint64, error) {
+	var (
+		pending []storeInterface.OutboxMessage
+		seq     uint64
+	)
 	values := make(map[string]models.URL, 100)
 	for scanner.Scan() {
-		value := models.URL{}
-		err := json.Unmarshal(scanner.Bytes(), &value)
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var l line
+		err := json.Unmarshal(scanner.Bytes(), &l)
 		if err != nil {
-			return nil, err
+			return nil, nil, 0, err
+		}
+
+		switch {
+		case l.Outbox != nil:
+			id, _ := strconv.ParseUint(l.Outbox.ID, 10, 64)
+			if id > seq {
+				seq = id
+			}
+			pending = append(pending, *l.Outbox)
+		case l.OutboxAck != "":
+			ack, _ := strconv.ParseUint(l.OutboxAck, 10, 64)
+			if ack > seq {
+				seq = ack
+			}
+			for len(pending) > 0 {
+				if id, _ := strconv.ParseUint(pending[0].ID, 10, 64); id > ack {
+					break
+				}
+				pending = pending[1:]
+			}
+		default:
+			values[l.Short] = l.URL
 		}
-		uuid = value.UUID
-		values[value.Short] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, 0, err
 	}
 
-	return values, nil
+	return values, pending, seq, nil
 }
 
 // Store structure
 type Store struct {
-	values map[string]models.URL
-	file   *os.File
-	writer *bufio.Writer
+	mu        sync.RWMutex
+	uuid      int
+	dedup     storeInterface.DedupMode
+	foldCase  bool
+	values    map[string]models.URL
+	originals map[string]string
+	file      *os.File
+	writer    *bufio.Writer
+
+	outbox    bool
+	outboxSeq uint64
+	pending   []storeInterface.OutboxMessage
+	// relayMu serializes relays, so messages are published once and in order.
+	relayMu sync.Mutex
 }
 
 // GetOriginalURL using for search original URL by short.
-func (s Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+// For flagged URLs the original URL is returned along with failure.ErrURLFlagged.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	return storeInterface.LookupFolded(ctx, short, s.foldCase, s.getOriginalURL)
+}
+
+func (s *Store) getOriginalURL(ctx context.Context, short string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if value, ok := s.values[short]; ok {
 		if value.DeletedFlag {
-			return "", errors.New("URL is deleted")
+			return "", failure.ErrURLDeleted
 		}
 
-		return value.Original, nil
+		return storeInterface.CheckVerdict(value.Original, value.Verdict)
 	}
 
-	return "", fmt.Errorf("value doesn't exist by key %s", short)
+	return "", fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
 }
 
 // AddValue adding new URL into database.
-func (s Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+// If the short ID is already taken, failure.ErrShortExists is returned.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
 	if opts.Original == "" {
 		return "", failure.ErrEmptyOrigURL
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.dedup.Key(opts.UserID, opts.Original)
+	if short, ok := s.originals[key]; ok {
+		return fmt.Sprintf("%s/%s", opts.BaseURL, short), failure.ErrConflict
+	}
+
+	if opts.Quota != nil {
+		if err := opts.Quota.Check(s.usage(opts.UserID, opts.Quota.Since)); err != nil {
+			return "", err
+		}
+	}
+
+	if _, ok := s.values[opts.Short]; ok {
+		return "", fmt.Errorf("%w: %s", failure.ErrShortExists, opts.Short)
+	}
+
 	result := fmt.Sprintf("%s/%s", opts.BaseURL, opts.Short)
-	uuid += 1
+	s.uuid += 1
 
 	v := models.URL{
-		UUID:        uuid,
+		UUID:        s.uuid,
 		Short:       opts.Short,
 		Original:    opts.Original,
 		UserID:      opts.UserID,
 		DeletedFlag: false,
+		CreatedAt:   time.Now().UTC(),
 	}
 	s.values[opts.Short] = v
+	if key != "" {
+		s.originals[key] = opts.Short
+	}
 
-	if err := s.WriteValue(&v); err != nil {
+	err := s.writeValue(&v, storeInterface.OutboxMessage{
+		Type:     storeInterface.OutboxCreated,
+		Short:    v.Short,
+		Original: v.Original,
+		UserID:   v.UserID,
+		Time:     v.CreatedAt,
+	})
+	if err != nil {
 		return result, err
 	}
 
-	return fmt.Sprintf("%s/%s", opts.BaseURL, opts.Short), nil
+	return result, nil
 }
 
 // WriteValue writing value to storage file.
 func (s *Store) WriteValue(value *models.URL) error {
-	data, err := json.Marshal(&value)
+	return s.writeLines(value)
+}
 
-	if err != nil {
-		return err
+// writeValue writes the value along with the outbox message of its mutation, if the outbox
+// is enabled. Both lines are written by a single flush. It is called with the lock held.
+func (s *Store) writeValue(value *models.URL, m storeInterface.OutboxMessage) error {
+	if !s.outbox {
+		return s.writeLines(value)
 	}
 
-	if _, err := s.writer.Write(data); err != nil {
+	m.ID = strconv.FormatUint(s.outboxSeq+1, 10)
+	if m.Time.IsZero() {
+		m.Time = time.Now().UTC()
+	}
+	if err := s.writeLines(value, outboxLine{Outbox: &m}); err != nil {
 		return err
 	}
 
-	if err := s.writer.WriteByte('\n'); err != nil {
-		return err
+	s.outboxSeq++
+	s.pending = append(s.pending, m)
+
+	return nil
+}
+
+// writeLines writes values to storage file as JSON lines and flushes them.
+func (s *Store) writeLines(values ...any) error {
+	for _, value := range values {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.writer.Write(data); err != nil {
+			return err
+		}
+
+		if err := s.writer.WriteByte('\n'); err != nil {
+			return err
+		}
 	}
 
 	return s.writer.Flush()
 }
 
 // Ping checks database connection.
-func (s Store) Ping() error {
+func (s *Store) Ping() error {
 	return nil
 }
 
+// Path returns the path of the storage file.
+func (s *Store) Path() string {
+	return s.file.Name()
+}
+
 // GetUserURLs returning all URLs by particular user.
-func (s Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+func (s *Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	result := make([]models.UserURL, 0, 100)
 	for _, value := range s.values {
 		if value.UserID == opts.UserID {
@@ -119,74 +254,226 @@ func (s Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsO
 	return result, nil
 }
 
+// GetOwners returns owners of the links by their short IDs.
+func (s *Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	return storeInterface.OwnersFolded(ctx, shorts, s.foldCase, s.getOwners)
+}
+
+func (s *Store) getOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	owners := make(map[string]string, len(shorts))
+	for _, short := range shorts {
+		if value, ok := s.values[short]; ok {
+			owners[short] = value.UserID
+		}
+	}
+
+	return owners, nil
+}
+
 // DeleteURLs marked URLs as deleted.
-func (s Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) error {
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []storeInterface.DeletedURLs
 	for _, o := range opts {
-		for _, value := range s.values {
-			if value.UserID == o.UserID {
-				for _, u := range o.URLs {
-					if u == value.Short {
-						s.values[value.Short] = models.URL{
-							Short:       value.Short,
-							Original:    value.Original,
-							UserID:      value.UserID,
-							DeletedFlag: true,
-						}
-					}
+		var shorts []string
+		for _, u := range o.URLs {
+			value, ok := s.values[u]
+			if ok && value.UserID == o.UserID && !value.DeletedFlag {
+				value.DeletedFlag = true
+				s.values[u] = value
+
+				key := s.dedup.Key(value.UserID, value.Original)
+				if s.originals[key] == value.Short {
+					delete(s.originals, key)
 				}
+
+				m := storeInterface.OutboxMessage{Type: storeInterface.OutboxDeleted, Short: u, UserID: o.UserID}
+				if err := s.writeValue(&value, m); err != nil {
+					return storeInterface.AppendDeleted(deleted, o, shorts), err
+				}
+				shorts = append(shorts, u)
 			}
 		}
+		deleted = storeInterface.AppendDeleted(deleted, o, shorts)
+	}
+
+	return deleted, nil
+}
+
+// SetVerdict sets verdict of malicious URL scanning.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[short]
+	if !ok {
+		return fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	if value.Verdict != verdict {
+		value.Verdict = verdict
+		s.values[short] = value
+
+		if err := s.WriteValue(&value); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// GetUserUsage returns the number of user's links and links created since the time.
+func (s *Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.usage(userID, since), nil
+}
+
+// usage counts links of the user, the caller must hold the lock.
+func (s *Store) usage(userID string, since time.Time) models.Usage {
+	var usage models.Usage
+	for _, value := range s.values {
+		if value.UserID != userID {
+			continue
+		}
+		if !value.DeletedFlag {
+			usage.Links++
+		}
+		if !value.CreatedAt.Before(since) {
+			usage.Created++
+		}
+	}
+
+	return usage
+}
+
 // GetInternalStats returning internal statistics
-func (s Store) GetInternalStats(ctx context.Context) (models.InternalStats, error) {
-	uniqueUserIDs := make([]string, 0)
+func (s *Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	collector := storeInterface.NewStatsCollector(opts)
 	for _, value := range s.values {
-		if !contains(uniqueUserIDs, value.UserID) {
-			uniqueUserIDs = append(uniqueUserIDs, value.UserID)
+		collector.Add(value)
+	}
+
+	stats := collector.Stats()
+	if info, err := s.file.Stat(); err == nil {
+		stats.StoreSize = info.Size()
+	}
+
+	return stats, nil
+}
+
+// AddClicks adds the numbers of redirects to the URLs and returns their totals, unknown short IDs are skipped.
+func (s *Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := make(map[string]int64, len(clicks))
+	for short, n := range clicks {
+		if value, ok := s.values[short]; ok && n > 0 {
+			value.Clicks += n
+			s.values[short] = value
+			m := storeInterface.OutboxMessage{Type: storeInterface.OutboxClicked, Short: short, Clicks: n}
+			if err := s.writeValue(&value, m); err != nil {
+				return nil, err
+			}
+			totals[short] = value.Clicks
 		}
 	}
 
-	return models.InternalStats{
-		URLs:  len(s.values),
-		Users: len(uniqueUserIDs),
-	}, nil
+	return totals, nil
+}
+
+// RelayOutbox passes up to limit oldest outbox messages to publish. Published messages
+// are acknowledged in the file, so they are not relayed again after restart.
+func (s *Store) RelayOutbox(ctx context.Context, limit int, publish storeInterface.Publish) (int, error) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+
+	s.mu.RLock()
+	if limit > len(s.pending) {
+		limit = len(s.pending)
+	}
+	batch := append([]storeInterface.OutboxMessage(nil), s.pending[:limit]...)
+	s.mu.RUnlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := publish(ctx, batch); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writeLines(ackLine{OutboxAck: batch[len(batch)-1].ID}); err != nil {
+		return 0, err
+	}
+	// Only relays remove messages, so the published ones are still at the head.
+	s.pending = append([]storeInterface.OutboxMessage(nil), s.pending[len(batch):]...)
+
+	return len(batch), nil
 }
 
 // NewStore return Store for working with file.
 func NewStore(filename string) storeInterface.Store {
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	store, err := newStore(filename, 0666, storeInterface.Options{})
 	if err != nil {
 		panic(err)
 	}
 
+	return store
+}
+
+func newStore(filename string, perm os.FileMode, opts storeInterface.Options) (*Store, error) {
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, perm)
+	if err != nil {
+		return nil, err
+	}
+
 	scanner := bufio.NewScanner(file)
-	values, readErr := ReadValuesFromFile(scanner)
-	if readErr != nil {
-		panic(readErr)
+	values, pending, seq, err := readFile(scanner)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
 
 	if len(values) == 0 {
 		values = make(map[string]models.URL)
 	}
 
-	return Store{
-		values: values,
-		file:   file,
-		writer: bufio.NewWriter(file),
-	}
-}
+	uuid := 0
+	originals := make(map[string]string, len(values))
+	for _, value := range values {
+		if value.UUID > uuid {
+			uuid = value.UUID
+		}
 
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
+		key := opts.Dedup.Key(value.UserID, value.Original)
+		if key != "" && !value.DeletedFlag {
+			originals[key] = value.Short
 		}
 	}
 
-	return false
+	return &Store{
+		uuid:      uuid,
+		dedup:     opts.Dedup,
+		foldCase:  opts.CaseInsensitive,
+		values:    values,
+		originals: originals,
+		file:      file,
+		writer:    bufio.NewWriter(file),
+		outbox:    opts.Outbox,
+		outboxSeq: seq,
+		pending:   pending,
+	}, nil
 }
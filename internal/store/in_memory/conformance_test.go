@@ -0,0 +1,14 @@
+package inmemory
+
+import (
+	"testing"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, opts storeInterface.Options) storeInterface.Store {
+		return newStore(100, opts)
+	})
+}
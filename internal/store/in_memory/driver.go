@@ -0,0 +1,25 @@
+package inmemory
+
+import (
+	"net/url"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+)
+
+func init() {
+	registry.Register("memory", open)
+}
+
+// open creates Store from the storage URI like memory://?capacity=1000.
+//
+// Supported options:
+//   - capacity: number of preallocated entries, 100 by default.
+func open(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error) {
+	capacity, err := registry.IntOption(uri, "capacity", 100)
+	if err != nil {
+		return nil, err
+	}
+
+	return newStore(capacity, opts), nil
+}
@@ -2,8 +2,10 @@ package inmemory
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/kupriyanovkk/shortener/internal/failure"
 	"github.com/kupriyanovkk/shortener/internal/models"
@@ -12,45 +14,97 @@ import (
 
 // Store structure
 type Store struct {
-	values map[string]models.URL
+	mu        sync.RWMutex
+	dedup     storeInterface.DedupMode
+	foldCase  bool
+	values    map[string]models.URL
+	originals map[string]string
+
+	outbox    bool
+	outboxSeq uint64
+	pending   []storeInterface.OutboxMessage
+	// relayMu serializes relays, so messages are published once and in order.
+	relayMu sync.Mutex
 }
 
 // GetOriginalURL using for search original URL by short.
-func (s Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+// For flagged URLs the original URL is returned along with failure.ErrURLFlagged.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	return storeInterface.LookupFolded(ctx, short, s.foldCase, s.getOriginalURL)
+}
+
+func (s *Store) getOriginalURL(ctx context.Context, short string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if value, ok := s.values[short]; ok {
 		if value.DeletedFlag {
-			return "", errors.New("URL is deleted")
+			return "", failure.ErrURLDeleted
 		}
 
-		return value.Original, nil
+		return storeInterface.CheckVerdict(value.Original, value.Verdict)
 	}
 
-	return "", fmt.Errorf("value doesn't exist by key %s", short)
+	return "", fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
 }
 
 // AddValue adding new URL into database.
-func (s Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+// If the short ID is already taken, failure.ErrShortExists is returned.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
 	if opts.Original == "" {
 		return "", failure.ErrEmptyOrigURL
 	}
 
-	s.values[opts.Short] = models.URL{
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.dedup.Key(opts.UserID, opts.Original)
+	if short, ok := s.originals[key]; ok {
+		return fmt.Sprintf("%s/%s", opts.BaseURL, short), failure.ErrConflict
+	}
+
+	if opts.Quota != nil {
+		if err := opts.Quota.Check(s.usage(opts.UserID, opts.Quota.Since)); err != nil {
+			return "", err
+		}
+	}
+
+	if _, ok := s.values[opts.Short]; ok {
+		return "", fmt.Errorf("%w: %s", failure.ErrShortExists, opts.Short)
+	}
+
+	value := models.URL{
 		Short:       opts.Short,
 		Original:    opts.Original,
 		UserID:      opts.UserID,
 		DeletedFlag: false,
+		CreatedAt:   time.Now().UTC(),
+	}
+	s.values[opts.Short] = value
+	if key != "" {
+		s.originals[key] = opts.Short
 	}
+	s.record(storeInterface.OutboxMessage{
+		Type:     storeInterface.OutboxCreated,
+		Short:    value.Short,
+		Original: value.Original,
+		UserID:   value.UserID,
+		Time:     value.CreatedAt,
+	})
 
 	return fmt.Sprintf("%s/%s", opts.BaseURL, opts.Short), nil
 }
 
 // Ping checks database connection.
-func (s Store) Ping() error {
+func (s *Store) Ping() error {
 	return nil
 }
 
 // GetUserURLs returning all URLs by particular user.
-func (s Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+func (s *Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	result := make([]models.UserURL, 0, 100)
 	for _, value := range s.values {
 		if value.UserID == opts.UserID {
@@ -64,57 +118,181 @@ func (s Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsO
 	return result, nil
 }
 
+// GetOwners returns owners of the links by their short IDs.
+func (s *Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	return storeInterface.OwnersFolded(ctx, shorts, s.foldCase, s.getOwners)
+}
+
+func (s *Store) getOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	owners := make(map[string]string, len(shorts))
+	for _, short := range shorts {
+		if value, ok := s.values[short]; ok {
+			owners[short] = value.UserID
+		}
+	}
+
+	return owners, nil
+}
+
 // DeleteURLs marked URLs as deleted.
-func (s Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) error {
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted []storeInterface.DeletedURLs
 	for _, o := range opts {
-		for _, value := range s.values {
-			if value.UserID == o.UserID {
-				for _, u := range o.URLs {
-					if u == value.Short {
-						s.values[value.Short] = models.URL{
-							Short:       value.Short,
-							Original:    value.Original,
-							UserID:      value.UserID,
-							DeletedFlag: true,
-						}
-					}
+		var shorts []string
+		for _, u := range o.URLs {
+			value, ok := s.values[u]
+			if ok && value.UserID == o.UserID && !value.DeletedFlag {
+				s.record(storeInterface.OutboxMessage{Type: storeInterface.OutboxDeleted, Short: u, UserID: o.UserID})
+
+				value.DeletedFlag = true
+				s.values[u] = value
+				shorts = append(shorts, u)
+
+				key := s.dedup.Key(value.UserID, value.Original)
+				if s.originals[key] == value.Short {
+					delete(s.originals, key)
 				}
 			}
 		}
+		deleted = storeInterface.AppendDeleted(deleted, o, shorts)
+	}
+
+	return deleted, nil
+}
+
+// SetVerdict sets verdict of malicious URL scanning.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.values[short]
+	if !ok {
+		return fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	if value.Verdict != verdict {
+		value.Verdict = verdict
+		s.values[short] = value
 	}
 
 	return nil
 }
 
-// GetInternalStats returning internal statistics
-func (s Store) GetInternalStats(ctx context.Context) (models.InternalStats, error) {
-	uniqueUserIDs := make([]string, 0)
+// GetUserUsage returns the number of user's links and links created since the time.
+func (s *Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	return s.usage(userID, since), nil
+}
+
+// usage counts links of the user, the caller must hold the lock.
+func (s *Store) usage(userID string, since time.Time) models.Usage {
+	var usage models.Usage
 	for _, value := range s.values {
-		if !contains(uniqueUserIDs, value.UserID) {
-			uniqueUserIDs = append(uniqueUserIDs, value.UserID)
+		if value.UserID != userID {
+			continue
+		}
+		if !value.DeletedFlag {
+			usage.Links++
+		}
+		if !value.CreatedAt.Before(since) {
+			usage.Created++
 		}
 	}
 
-	return models.InternalStats{
-		URLs:  len(s.values),
-		Users: len(uniqueUserIDs),
-	}, nil
+	return usage
 }
 
-// NewStore return Store for working with memory
-func NewStore() storeInterface.Store {
-	return Store{
-		values: make(map[string]models.URL, 100),
+// GetInternalStats returning internal statistics
+func (s *Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collector := storeInterface.NewStatsCollector(opts)
+	for _, value := range s.values {
+		collector.Add(value)
 	}
+
+	return collector.Stats(), nil
 }
 
-func contains(s []string, str string) bool {
-	for _, v := range s {
-		if v == str {
-			return true
+// AddClicks adds the numbers of redirects to the URLs and returns their totals, unknown short IDs are skipped.
+func (s *Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	totals := make(map[string]int64, len(clicks))
+	for short, n := range clicks {
+		if value, ok := s.values[short]; ok && n > 0 {
+			value.Clicks += n
+			s.values[short] = value
+			totals[short] = value.Clicks
+			s.record(storeInterface.OutboxMessage{Type: storeInterface.OutboxClicked, Short: short, Clicks: n})
 		}
 	}
 
-	return false
+	return totals, nil
+}
+
+// record adds the message to the outbox if it is enabled. It is called with the lock held.
+func (s *Store) record(m storeInterface.OutboxMessage) {
+	if !s.outbox {
+		return
+	}
+
+	s.outboxSeq++
+	m.ID = strconv.FormatUint(s.outboxSeq, 10)
+	if m.Time.IsZero() {
+		m.Time = time.Now().UTC()
+	}
+	s.pending = append(s.pending, m)
+}
+
+// RelayOutbox passes up to limit oldest outbox messages to publish and removes them if it succeeds.
+func (s *Store) RelayOutbox(ctx context.Context, limit int, publish storeInterface.Publish) (int, error) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+
+	s.mu.RLock()
+	if limit > len(s.pending) {
+		limit = len(s.pending)
+	}
+	batch := append([]storeInterface.OutboxMessage(nil), s.pending[:limit]...)
+	s.mu.RUnlock()
+
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := publish(ctx, batch); err != nil {
+		return 0, err
+	}
+
+	// Only relays remove messages, so the published ones are still at the head.
+	s.mu.Lock()
+	s.pending = append([]storeInterface.OutboxMessage(nil), s.pending[len(batch):]...)
+	s.mu.Unlock()
+
+	return len(batch), nil
+}
+
+// NewStore return Store for working with memory
+func NewStore() storeInterface.Store {
+	return newStore(100, storeInterface.Options{})
+}
+
+func newStore(capacity int, opts storeInterface.Options) *Store {
+	return &Store{
+		dedup:     opts.Dedup,
+		foldCase:  opts.CaseInsensitive,
+		values:    make(map[string]models.URL, capacity),
+		originals: make(map[string]string, capacity),
+		outbox:    opts.Outbox,
+	}
 }
@@ -171,37 +171,63 @@ func TestStore_GetInternalStats(t *testing.T) {
 	}
 
 	expectedStatsNonEmpty := models.InternalStats{
-		URLs:  3,
-		Users: 2,
+		URLs:   3,
+		Users:  2,
+		Active: 3,
 	}
 
 	t.Run("EmptyValues", func(t *testing.T) {
-		stats, _ := store.GetInternalStats(context.Background())
-		if stats != expectedStatsEmpty {
+		stats, _ := store.GetInternalStats(context.Background(), storeInterface.StatsOptions{})
+		if !reflect.DeepEqual(counts(stats), expectedStatsEmpty) {
 			t.Errorf("Expected %v, but got %v", expectedStatsEmpty, stats)
 		}
 	})
 
 	t.Run("NonEmptyValues", func(t *testing.T) {
 		store.AddValue(ctx, storeInterface.AddValueOptions{
-			Original: "original1",
+			Original: "https://example.com/1",
 			Short:    "short1",
 			UserID:   "user1",
 		})
 		store.AddValue(ctx, storeInterface.AddValueOptions{
-			Original: "original2",
+			Original: "https://Example.com/2",
 			Short:    "short2",
 			UserID:   "user2",
 		})
 		store.AddValue(ctx, storeInterface.AddValueOptions{
-			Original: "original3",
+			Original: "https://user@test.org:8080/3",
 			Short:    "short3",
 			UserID:   "user2",
 		})
 
-		stats, _ := store.GetInternalStats(context.Background())
-		if stats != expectedStatsNonEmpty {
+		stats, _ := store.GetInternalStats(context.Background(), storeInterface.StatsOptions{Top: 1, Days: 2})
+		if !reflect.DeepEqual(counts(stats), expectedStatsNonEmpty) {
 			t.Errorf("Expected %v, but got %v", expectedStatsNonEmpty, stats)
 		}
+
+		expectedTopUsers := []models.UserCount{{UserID: "user2", Links: 2}}
+		if !reflect.DeepEqual(stats.TopUsers, expectedTopUsers) {
+			t.Errorf("Expected top users %v, but got %v", expectedTopUsers, stats.TopUsers)
+		}
+
+		expectedTopDomains := []models.DomainCount{{Domain: "example.com", Links: 2}}
+		if !reflect.DeepEqual(stats.TopDomains, expectedTopDomains) {
+			t.Errorf("Expected top domains %v, but got %v", expectedTopDomains, stats.TopDomains)
+		}
+
+		if len(stats.CreatedPerDay) != 2 || stats.CreatedPerDay[0].Count != 0 || stats.CreatedPerDay[1].Count != 3 {
+			t.Errorf("Expected 3 links created today, but got %v", stats.CreatedPerDay)
+		}
 	})
 }
+
+// counts returns stats without the lists and the store size.
+func counts(stats models.InternalStats) models.InternalStats {
+	return models.InternalStats{
+		URLs:    stats.URLs,
+		Users:   stats.Users,
+		Active:  stats.Active,
+		Deleted: stats.Deleted,
+		Clicks:  stats.Clicks,
+	}
+}
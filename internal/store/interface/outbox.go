@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Types of outbox messages.
+const (
+	OutboxCreated = "link.created"
+	OutboxDeleted = "link.deleted"
+	// OutboxClicked carries the number of redirects added to the link by a single AddClicks call.
+	OutboxClicked = "link.clicked"
+)
+
+// OutboxMessage is an event of a store mutation recorded along with the mutation.
+type OutboxMessage struct {
+	// ID is unique within the store, consumers may use it to skip duplicates.
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Short    string    `json:"short"`
+	Original string    `json:"original,omitempty"`
+	UserID   string    `json:"user_id,omitempty"`
+	Clicks   int64     `json:"clicks,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Publish publishes outbox messages, e.g. to a message broker.
+type Publish func(ctx context.Context, messages []OutboxMessage) error
+
+// Outbox is implemented by stores recording events of their mutations in the outbox
+// atomically with the mutations when Options.Outbox is set, so events are not lost
+// or published for mutations which failed.
+type Outbox interface {
+	// RelayOutbox passes up to limit oldest messages to publish and removes them from
+	// the outbox if it succeeds. Concurrent relays don't receive the same messages.
+	// It returns the number of relayed messages.
+	RelayOutbox(ctx context.Context, limit int, publish Publish) (int, error)
+}
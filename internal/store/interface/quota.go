@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+)
+
+// Quota limit names used in QuotaError.
+const (
+	QuotaLinks  = "links"
+	QuotaBatch  = "batch"
+	QuotaPerDay = "daily"
+)
+
+// Quota limits links of the user. AddValue checks it atomically with adding the link,
+// so concurrent requests can't exceed it. Zero limits mean no limit.
+type Quota struct {
+	// MaxLinks limits the number of user's links, deleted links are not counted.
+	MaxLinks int
+	// MaxPerDay limits the number of links created since Since, deleted links are counted.
+	MaxPerDay int
+	Since     time.Time
+	// Reset is the time when the daily quota is reset.
+	Reset time.Time
+}
+
+// Check returns *QuotaError if the user with the usage can't add one more link.
+// Nil Quota allows everything.
+func (q *Quota) Check(usage models.Usage) error {
+	if q == nil {
+		return nil
+	}
+
+	if q.MaxLinks > 0 && usage.Links >= q.MaxLinks {
+		return &QuotaError{Limit: QuotaLinks, Max: q.MaxLinks, Used: usage.Links}
+	}
+	if q.MaxPerDay > 0 && usage.Created >= q.MaxPerDay {
+		return &QuotaError{Limit: QuotaPerDay, Max: q.MaxPerDay, Used: usage.Created, Reset: q.Reset}
+	}
+
+	return nil
+}
+
+// QuotaError is returned when creating links would exceed the quota.
+type QuotaError struct {
+	Limit string
+	Max   int
+	Used  int
+	// Reset is a time when the daily quota is reset, it is set for QuotaPerDay only.
+	Reset time.Time
+}
+
+func (e *QuotaError) Error() string {
+	if e.Limit == QuotaBatch {
+		return fmt.Sprintf("%v: batch size is limited to %d links", failure.ErrQuotaExceeded, e.Max)
+	}
+
+	return fmt.Sprintf("%v: %s limit is %d links, %d used", failure.ErrQuotaExceeded, e.Limit, e.Max, e.Used)
+}
+
+// Unwrap returns failure.ErrQuotaExceeded.
+func (e *QuotaError) Unwrap() error {
+	return failure.ErrQuotaExceeded
+}
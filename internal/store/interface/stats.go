@@ -0,0 +1,200 @@
+package store
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/models"
+)
+
+// Defaults and limits of StatsOptions.
+const (
+	DefaultStatsTop  = 10
+	DefaultStatsDays = 30
+	MaxStatsTop      = 100
+	MaxStatsDays     = 366
+)
+
+// dayLayout is the format of days of models.DailyCount.
+const dayLayout = "2006-01-02"
+
+// StatsOptions is a structure for GetInternalStats method params
+type StatsOptions struct {
+	// Top is a max number of top users and domains, DefaultStatsTop by default.
+	Top int
+	// Days is a number of days, including today, links created per day are counted for,
+	// DefaultStatsDays by default.
+	Days int
+}
+
+// WithDefaults returns the options with defaults in place of zero values.
+func (o StatsOptions) WithDefaults() StatsOptions {
+	if o.Top <= 0 {
+		o.Top = DefaultStatsTop
+	}
+	if o.Days <= 0 {
+		o.Days = DefaultStatsDays
+	}
+
+	return o
+}
+
+// Validate returns an error if the options are out of limits, zero values are valid.
+func (o StatsOptions) Validate() error {
+	if o.Top < 0 || o.Top > MaxStatsTop {
+		return fmt.Errorf("top must be between 1 and %d", MaxStatsTop)
+	}
+	if o.Days < 0 || o.Days > MaxStatsDays {
+		return fmt.Errorf("days must be between 1 and %d", MaxStatsDays)
+	}
+
+	return nil
+}
+
+// Since returns the beginning of the first day links created per day are counted for.
+func (o StatsOptions) Since(now time.Time) time.Time {
+	o = o.WithDefaults()
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	return today.AddDate(0, 0, 1-o.Days)
+}
+
+// Day returns the day of the time as it is reported in models.DailyCount.
+func Day(t time.Time) string {
+	return t.UTC().Format(dayLayout)
+}
+
+// Domain returns the lower-cased host of the original URL, or an empty string
+// if it can't be parsed.
+func Domain(original string) string {
+	u, err := url.Parse(original)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// DailyCounts returns counts by days, see Day, for every day since the time until today,
+// days without links are reported with zero counts.
+func DailyCounts(counts map[string]int, since, now time.Time) []models.DailyCount {
+	result := make([]models.DailyCount, 0, 31)
+	for day := since.UTC(); !day.After(now); day = day.AddDate(0, 0, 1) {
+		result = append(result, models.DailyCount{Day: Day(day), Count: counts[Day(day)]})
+	}
+
+	return result
+}
+
+type keyCount struct {
+	key   string
+	count int
+}
+
+// top returns up to n keys with the biggest positive counts, ties are ordered by keys.
+func top(counts map[string]int, n int) []keyCount {
+	result := make([]keyCount, 0, len(counts))
+	for key, count := range counts {
+		if count > 0 {
+			result = append(result, keyCount{key: key, count: count})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].key < result[j].key
+	})
+
+	if len(result) > n {
+		result = result[:n]
+	}
+
+	return result
+}
+
+// TopUsers returns up to n users with the most links.
+func TopUsers(links map[string]int, n int) []models.UserCount {
+	result := make([]models.UserCount, 0, n)
+	for _, c := range top(links, n) {
+		result = append(result, models.UserCount{UserID: c.key, Links: c.count})
+	}
+
+	return result
+}
+
+// TopDomains returns up to n domains with the most links.
+func TopDomains(links map[string]int, n int) []models.DomainCount {
+	result := make([]models.DomainCount, 0, n)
+	for _, c := range top(links, n) {
+		result = append(result, models.DomainCount{Domain: c.key, Links: c.count})
+	}
+
+	return result
+}
+
+// StatsCollector computes statistics of stores iterating over all their URLs.
+type StatsCollector struct {
+	opts  StatsOptions
+	now   time.Time
+	since time.Time
+
+	stats   models.InternalStats
+	users   map[string]struct{}
+	links   map[string]int
+	domains map[string]int
+	days    map[string]int
+}
+
+// NewStatsCollector returns StatsCollector for the options.
+func NewStatsCollector(opts StatsOptions) *StatsCollector {
+	opts = opts.WithDefaults()
+	now := time.Now()
+
+	return &StatsCollector{
+		opts:    opts,
+		now:     now,
+		since:   opts.Since(now),
+		users:   make(map[string]struct{}),
+		links:   make(map[string]int),
+		domains: make(map[string]int),
+		days:    make(map[string]int),
+	}
+}
+
+// Add counts the URL.
+func (c *StatsCollector) Add(value models.URL) {
+	c.stats.URLs++
+	c.stats.Clicks += value.Clicks
+	c.users[value.UserID] = struct{}{}
+
+	if !value.CreatedAt.Before(c.since) {
+		c.days[Day(value.CreatedAt)]++
+	}
+
+	if value.DeletedFlag {
+		c.stats.Deleted++
+		return
+	}
+
+	c.stats.Active++
+	c.links[value.UserID]++
+	if domain := Domain(value.Original); domain != "" {
+		c.domains[domain]++
+	}
+}
+
+// Stats returns statistics of the counted URLs.
+func (c *StatsCollector) Stats() models.InternalStats {
+	stats := c.stats
+	stats.Users = len(c.users)
+	stats.CreatedPerDay = DailyCounts(c.days, c.since, c.now)
+	stats.TopUsers = TopUsers(c.links, c.opts.Top)
+	stats.TopDomains = TopDomains(c.domains, c.opts.Top)
+
+	return stats
+}
@@ -3,7 +3,12 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/kupriyanovkk/shortener/internal/failure"
 	"github.com/kupriyanovkk/shortener/internal/models"
 )
 
@@ -12,9 +17,25 @@ type Store interface {
 	GetOriginalURL(ctx context.Context, short string) (string, error)
 	AddValue(ctx context.Context, opts AddValueOptions) (string, error)
 	GetUserURLs(ctx context.Context, opts GetUserURLsOptions) ([]models.UserURL, error)
+	// GetOwners returns IDs of users owning the links by their short IDs, deleted links
+	// included, unknown short IDs are omitted.
+	GetOwners(ctx context.Context, shorts []string) (map[string]string, error)
 	Ping() error
-	DeleteURLs(ctx context.Context, opts []DeletedURLs) error
-	GetInternalStats(ctx context.Context) (models.InternalStats, error)
+	// DeleteURLs marks URLs as deleted by their owners and returns the requests
+	// narrowed to URLs deleted by the call, requests deleting nothing are omitted.
+	// On failure URLs deleted before it are returned along with the error.
+	DeleteURLs(ctx context.Context, opts []DeletedURLs) ([]DeletedURLs, error)
+	GetInternalStats(ctx context.Context, opts StatsOptions) (models.InternalStats, error)
+	SetVerdict(ctx context.Context, short string, verdict models.Verdict) error
+	GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error)
+	// AddClicks adds the numbers of redirects to the URLs and returns their updated totals,
+	// unknown short IDs are skipped.
+	AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error)
+}
+
+// Sequence is implemented by stores able to hand out numbers unique across instances sharing the store.
+type Sequence interface {
+	NextID(ctx context.Context) (uint64, error)
 }
 
 // AddValueOptions is a structure for AddValue method params
@@ -23,6 +44,8 @@ type AddValueOptions struct {
 	BaseURL  string
 	Short    string
 	UserID   string
+	// Quota of the user checked after deduplication, so already shortened URLs are returned.
+	Quota *Quota
 }
 
 // GetUserURLsOptions is a structure for getting user URLs
@@ -35,6 +58,168 @@ type GetUserURLsOptions struct {
 type DeletedURLs struct {
 	UserID string
 	URLs   []string
+	// IP and RequestID identify the request for the audit trail, which records deletions once they are applied.
+	IP        string `json:",omitempty"`
+	RequestID string `json:",omitempty"`
+}
+
+// AppendDeleted appends the request narrowed to the deleted shorts unless they are empty.
+func AppendDeleted(deleted []DeletedURLs, request DeletedURLs, shorts []string) []DeletedURLs {
+	if len(shorts) == 0 {
+		return deleted
+	}
+
+	request.URLs = shorts
+	return append(deleted, request)
+}
+
+// DeletionQueue keeps deletion requests until they are applied to the store.
+// Popped requests are kept by the queue until they are acknowledged by Ack,
+// so the queue can deliver them again if the consumer fails to apply them.
+type DeletionQueue interface {
+	Push(ctx context.Context, requests ...DeletedURLs) error
+	Pop(ctx context.Context, max int, wait time.Duration) ([]DeletedURLs, error)
+	Ack(ctx context.Context, requests ...DeletedURLs) error
+}
+
+// DedupMode defines how already shortened original URLs are detected.
+type DedupMode int
+
+const (
+	// DedupGlobal returns the existing short URL for the same original URL added by any user.
+	DedupGlobal DedupMode = iota
+	// DedupUser returns the existing short URL only if it was added by the same user.
+	DedupUser
+	// DedupOff disables deduplication, every AddValue call creates a new short URL.
+	DedupOff
+)
+
+var dedupModes = map[string]DedupMode{
+	"global": DedupGlobal,
+	"user":   DedupUser,
+	"off":    DedupOff,
+}
+
+// ParseDedupMode returns DedupMode by its name, empty name means DedupGlobal.
+func ParseDedupMode(name string) (DedupMode, error) {
+	if name == "" {
+		return DedupGlobal, nil
+	}
+
+	mode, ok := dedupModes[name]
+	if !ok {
+		return DedupGlobal, fmt.Errorf("unknown dedup mode %q", name)
+	}
+
+	return mode, nil
+}
+
+// String returns the name of DedupMode.
+func (m DedupMode) String() string {
+	for name, mode := range dedupModes {
+		if mode == m {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("DedupMode(%d)", int(m))
+}
+
+// Key returns the key by which duplicates of the original URL are detected.
+// Empty key means that deduplication is disabled.
+func (m DedupMode) Key(userID, original string) string {
+	switch m {
+	case DedupGlobal:
+		return original
+	case DedupUser:
+		return userID + "\x00" + original
+	}
+
+	return ""
+}
+
+// CheckVerdict returns the original URL and the error matching the scanning verdict.
+// Blocked URLs are not returned, flagged URLs are returned along with failure.ErrURLFlagged.
+func CheckVerdict(original string, verdict models.Verdict) (string, error) {
+	switch verdict {
+	case models.VerdictBlock:
+		return "", failure.ErrURLBlocked
+	case models.VerdictWarn:
+		return original, failure.ErrURLFlagged
+	}
+
+	return original, nil
+}
+
+// Options is a structure with settings common for all stores
+type Options struct {
+	Dedup DedupMode
+	// CaseInsensitive makes GetOriginalURL fall back to the lower-cased short ID.
+	CaseInsensitive bool
+	// Outbox enables recording of mutations in the outbox of stores implementing Outbox.
+	Outbox bool
+}
+
+// Lookup returns the original URL by the short ID.
+type Lookup func(ctx context.Context, short string) (string, error)
+
+// LookupFolded calls lookup with the short ID and, if it is not found and
+// caseInsensitive is set, with the lower-cased short ID. IDs generated for
+// case-insensitive lookup are lower-case, while exact matches keep working
+// for mixed-case IDs created before.
+func LookupFolded(ctx context.Context, short string, caseInsensitive bool, lookup Lookup) (string, error) {
+	original, err := lookup(ctx, short)
+	if !caseInsensitive || !errors.Is(err, failure.ErrNotFound) {
+		return original, err
+	}
+
+	folded := strings.ToLower(short)
+	if folded == short {
+		return original, err
+	}
+
+	return lookup(ctx, folded)
+}
+
+// OwnersLookup returns owners of links by their short IDs.
+type OwnersLookup func(ctx context.Context, shorts []string) (map[string]string, error)
+
+// OwnersFolded calls lookup with the short IDs and, if caseInsensitive is set, with the
+// lower-cased IDs of the ones not found, like LookupFolded. Owners are returned by the
+// short IDs as given.
+func OwnersFolded(ctx context.Context, shorts []string, caseInsensitive bool, lookup OwnersLookup) (map[string]string, error) {
+	owners, err := lookup(ctx, shorts)
+	if err != nil || !caseInsensitive {
+		return owners, err
+	}
+
+	aliases := make(map[string][]string)
+	var folded []string
+	for _, short := range shorts {
+		lower := strings.ToLower(short)
+		if _, ok := owners[short]; ok || lower == short {
+			continue
+		}
+		if len(aliases[lower]) == 0 {
+			folded = append(folded, lower)
+		}
+		aliases[lower] = append(aliases[lower], short)
+	}
+	if len(folded) == 0 {
+		return owners, nil
+	}
+
+	found, err := lookup(ctx, folded)
+	if err != nil {
+		return nil, err
+	}
+	for lower, owner := range found {
+		for _, short := range aliases[lower] {
+			owners[short] = owner
+		}
+	}
+
+	return owners, nil
 }
 
 // Database interface
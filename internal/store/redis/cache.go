@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// Cache is a redirect cache shared between instances, see cache.Shared.
+type Cache struct {
+	client goredis.UniversalClient
+	prefix string
+}
+
+// NewCache returns Cache keeping values under keys starting with prefix.
+func NewCache(client goredis.UniversalClient, prefix string) *Cache {
+	return &Cache{client: client, prefix: keyPrefix(client, prefix) + "cache:"}
+}
+
+// Get returns the cached value, false is returned for missing keys.
+func (c *Cache) Get(ctx context.Context, key string) (string, bool, error) {
+	value, err := c.client.Get(ctx, c.prefix+key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// Set caches the value for ttl.
+func (c *Cache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+}
+
+// Delete removes the keys from the cache.
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = c.prefix + key
+	}
+
+	return c.client.Del(ctx, prefixed...).Err()
+}
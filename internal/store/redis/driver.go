@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"net/url"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+func init() {
+	registry.Register("redis", open)
+	registry.Register("rediss", open)
+}
+
+// open creates Store from the storage URI like redis://:password@localhost:6379/0?prefix=short:.
+func open(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error) {
+	client, prefix, err := NewClient(uri.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStore(client, prefix, opts), nil
+}
+
+// NewClient returns a client connected to the Redis URI and the prefix of keys.
+//
+// Supported options (the rest of the query is passed to the client as is):
+//   - prefix: prefix of all keys, "shortener:" by default.
+func NewClient(uri string) (*goredis.Client, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", err
+	}
+
+	query := u.Query()
+	prefix := DefaultPrefix
+	if query.Has("prefix") {
+		prefix = query.Get("prefix")
+		query.Del("prefix")
+		u.RawQuery = query.Encode()
+	}
+
+	options, err := goredis.ParseURL(u.String())
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := goredis.NewClient(options)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, "", err
+	}
+
+	return client, prefix, nil
+}
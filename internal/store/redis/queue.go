@@ -0,0 +1,199 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/logging"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	goredis "github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// consumerTTL is the time a consumer is considered alive after its last Pop or Ack.
+// Requests popped by consumers that are gone for longer are returned to the queue.
+const consumerTTL = time.Minute
+
+// recoverScript returns requests of a consumer to the head of the queue
+// unless the consumer is alive, and forgets the consumer.
+// It returns the number of returned requests.
+var recoverScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[3]) == 1 then
+	return 0
+end
+local n = 0
+while redis.call("LMOVE", KEYS[2], KEYS[1], "RIGHT", "LEFT") do
+	n = n + 1
+end
+redis.call("SREM", KEYS[4], ARGV[1])
+return n
+`)
+
+// Queue is a deletion queue shared between instances, see storeInterface.DeletionQueue.
+// Requests are kept in a Redis list, so any instance can apply them.
+//
+// Popped requests are moved to the list of the consumer and removed by Ack,
+// so they survive a crash of the instance before they are applied. Each
+// consumer renews the key "<prefix>deletions:alive:<id>" on Pop and Ack;
+// once it expires, other consumers return its requests to the queue.
+type Queue struct {
+	client    goredis.UniversalClient
+	key       string
+	consumers string
+	id        string
+
+	mu        sync.Mutex
+	recovered time.Time
+}
+
+// NewQueue returns Queue keeping requests in the list "<prefix>deletions".
+func NewQueue(client goredis.UniversalClient, prefix string) *Queue {
+	key := keyPrefix(client, prefix) + "deletions"
+
+	return &Queue{
+		client:    client,
+		key:       key,
+		consumers: key + ":consumers",
+		id:        strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+func (q *Queue) processingKey(id string) string {
+	return q.key + ":processing:" + id
+}
+
+func (q *Queue) aliveKey(id string) string {
+	return q.key + ":alive:" + id
+}
+
+// Push adds requests to the queue.
+func (q *Queue) Push(ctx context.Context, requests ...storeInterface.DeletedURLs) error {
+	values := make([]interface{}, len(requests))
+	for i, r := range requests {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		values[i] = data
+	}
+
+	return q.client.RPush(ctx, q.key, values...).Err()
+}
+
+// Len returns the number of requests in the queue.
+func (q *Queue) Len(ctx context.Context) (int, error) {
+	n, err := q.client.LLen(ctx, q.key).Result()
+
+	return int(n), err
+}
+
+// Pop moves up to max requests from the queue to the list of the consumer.
+// It waits up to wait when the queue is empty and returns nothing if no
+// requests came. Requests stay in the list of the consumer until Ack.
+func (q *Queue) Pop(ctx context.Context, max int, wait time.Duration) ([]storeInterface.DeletedURLs, error) {
+	if err := q.heartbeat(ctx); err != nil {
+		return nil, err
+	}
+	if err := q.recover(ctx); err != nil {
+		return nil, err
+	}
+
+	processing := q.processingKey(q.id)
+	first, err := q.client.BLMove(ctx, q.key, processing, "LEFT", "RIGHT", wait).Result()
+	if errors.Is(err, goredis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := []string{first}
+	if max > 1 {
+		pipe := q.client.Pipeline()
+		cmds := make([]*goredis.StringCmd, max-1)
+		for i := range cmds {
+			cmds[i] = pipe.LMove(ctx, q.key, processing, "LEFT", "RIGHT")
+		}
+		// Moved requests are taken from the commands, the error is the one of the first failed command.
+		_, _ = pipe.Exec(ctx)
+		for _, cmd := range cmds {
+			if cmd.Err() == nil {
+				values = append(values, cmd.Val())
+			}
+		}
+	}
+
+	requests := make([]storeInterface.DeletedURLs, 0, len(values))
+	for _, value := range values {
+		var r storeInterface.DeletedURLs
+		if err := json.Unmarshal([]byte(value), &r); err != nil {
+			logging.FromContext(ctx).Warn("redis: skipping malformed deletion request", zap.String("value", value), zap.Error(err))
+			q.client.LRem(ctx, processing, 1, value)
+			continue
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, nil
+}
+
+// Ack removes applied requests from the list of the consumer.
+func (q *Queue) Ack(ctx context.Context, requests ...storeInterface.DeletedURLs) error {
+	pipe := q.client.Pipeline()
+	for _, r := range requests {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		pipe.LRem(ctx, q.processingKey(q.id), 1, data)
+	}
+	pipe.Set(ctx, q.aliveKey(q.id), 1, consumerTTL)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// heartbeat marks the consumer alive.
+func (q *Queue) heartbeat(ctx context.Context) error {
+	pipe := q.client.Pipeline()
+	pipe.SAdd(ctx, q.consumers, q.id)
+	pipe.Set(ctx, q.aliveKey(q.id), 1, consumerTTL)
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+// recover returns requests of gone consumers to the queue, at most once per consumerTTL.
+func (q *Queue) recover(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if time.Since(q.recovered) < consumerTTL {
+		return nil
+	}
+
+	ids, err := q.client.SMembers(ctx, q.consumers).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == q.id {
+			continue
+		}
+		keys := []string{q.key, q.processingKey(id), q.aliveKey(id), q.consumers}
+		n, err := recoverScript.Run(ctx, q.client, keys, id).Int()
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			logging.FromContext(ctx).Info("redis: returned deletion requests of a gone consumer", zap.String("consumer", id), zap.Int("requests", n))
+		}
+	}
+	q.recovered = time.Now()
+
+	return nil
+}
@@ -0,0 +1,588 @@
+// Package redis implements storeInterface.Store, a shared redirect cache and
+// a deletion queue on top of Redis.
+//
+// Every short URL is kept in a hash "<prefix>url:<short>". Sets and sorted sets
+// indexed by user ID back GetUserURLs, GetUserUsage and GetInternalStats, and
+// "<prefix>dedup:<key>" keys map original URLs to their short IDs. The counter
+// "<prefix>seq" numbers sequential short IDs. Multi-key updates are done by Lua
+// scripts, so they are atomic.
+//
+// Aggregates under "<prefix>stats:" are updated along with links, so statistics
+// are read without scanning all links: links created per day, active links per
+// user and per domain, and the numbers of deleted links and clicks. They count
+// links created and deleted since they were introduced.
+//
+// When the outbox is enabled, scripts append messages of their mutations to the
+// stream "<prefix>outbox" within the same script.
+//
+// On Redis Cluster the prefix is wrapped in braces, "{<prefix>}", so all keys
+// hash to one slot and the scripts, which touch several keys, can run there.
+// Single-node keys keep the plain prefix.
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// DefaultPrefix is a prefix of all keys used by default.
+const DefaultPrefix = "shortener:"
+
+// keyPrefix returns the prefix of keys for the client. Cluster clients get it
+// wrapped in a hash tag unless it already has one, so multi-key commands and
+// scripts find all keys in one slot.
+func keyPrefix(client goredis.UniversalClient, prefix string) string {
+	if _, ok := client.(*goredis.ClusterClient); !ok || strings.Contains(prefix, "{") {
+		return prefix
+	}
+
+	return "{" + prefix + "}"
+}
+
+// addScript saves the URL unless its original is already shortened or its short ID is taken.
+// It returns {0, existing short} on conflict, {2, short} when the short ID is taken,
+// {3, links, created} when the user's quota is exceeded and {1, short} otherwise.
+var addScript = goredis.NewScript(`
+local url, dedup, user, active, created, urls, users = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6], KEYS[7]
+local daily, topUsers, topDomains, outbox = KEYS[8], KEYS[9], KEYS[10], KEYS[11]
+local short, original, userID, createdAt, dedupOn, day, domain = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5], ARGV[6], ARGV[7]
+local outboxType = ARGV[8]
+local maxLinks, maxPerDay, since = tonumber(ARGV[9]), tonumber(ARGV[10]), ARGV[11]
+
+if dedupOn == "1" then
+	local existing = redis.call("GET", dedup)
+	if existing then
+		return {0, existing}
+	end
+end
+
+if maxLinks > 0 or maxPerDay > 0 then
+	local links = redis.call("SCARD", active)
+	local count = redis.call("ZCOUNT", created, since, "+inf")
+	if (maxLinks > 0 and links >= maxLinks) or (maxPerDay > 0 and count >= maxPerDay) then
+		return {3, links, count}
+	end
+end
+
+if redis.call("EXISTS", url) == 1 then
+	return {2, short}
+end
+
+redis.call("HSET", url, "original", original, "user_id", userID, "is_deleted", "0", "verdict", "", "created_at", createdAt)
+if dedupOn == "1" then
+	redis.call("SET", dedup, short)
+end
+redis.call("SADD", user, short)
+redis.call("SADD", active, short)
+redis.call("ZADD", created, createdAt, short)
+redis.call("SADD", urls, short)
+redis.call("SADD", users, userID)
+redis.call("HINCRBY", daily, day, 1)
+redis.call("ZINCRBY", topUsers, 1, userID)
+if domain ~= "" then
+	redis.call("ZINCRBY", topDomains, 1, domain)
+end
+if outboxType ~= "" then
+	redis.call("XADD", outbox, "*", "type", outboxType, "short", short, "original", original, "user_id", userID, "time", createdAt)
+end
+
+return {1, short}
+`)
+
+// deleteScript marks the URL of the user as deleted and frees its original for deduplication.
+// It returns 1 if the URL is deleted and 0 if it belongs to another user or is already deleted.
+var deleteScript = goredis.NewScript(`
+local url, active, dedup, topUsers, topDomains, deleted, outbox = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], KEYS[6], KEYS[7]
+local short, userID, domain, outboxType, now = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5]
+
+local values = redis.call("HMGET", url, "user_id", "is_deleted")
+if values[1] ~= userID then
+	return 0
+end
+if values[2] == "1" then
+	return 0
+end
+
+redis.call("HSET", url, "is_deleted", "1")
+redis.call("SREM", active, short)
+if redis.call("GET", dedup) == short then
+	redis.call("DEL", dedup)
+end
+
+redis.call("INCR", deleted)
+redis.call("ZINCRBY", topUsers, -1, userID)
+redis.call("ZREMRANGEBYSCORE", topUsers, "-inf", 0)
+if domain ~= "" then
+	redis.call("ZINCRBY", topDomains, -1, domain)
+	redis.call("ZREMRANGEBYSCORE", topDomains, "-inf", 0)
+end
+if outboxType ~= "" then
+	redis.call("XADD", outbox, "*", "type", outboxType, "short", short, "user_id", userID, "time", now)
+end
+
+return 1
+`)
+
+// verdictScript sets the verdict of the existing URL.
+var verdictScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+
+redis.call("HSET", KEYS[1], "verdict", ARGV[1])
+return 1
+`)
+
+// clicksScript adds the number of redirects to the existing URL and the total.
+// It returns the number of redirects to the URL or 0 if it doesn't exist.
+var clicksScript = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+
+local clicks = redis.call("HINCRBY", KEYS[1], "clicks", ARGV[1])
+redis.call("INCRBY", KEYS[2], ARGV[1])
+if ARGV[2] ~= "" then
+	redis.call("XADD", KEYS[3], "*", "type", ARGV[2], "short", ARGV[3], "clicks", ARGV[1], "time", ARGV[4])
+end
+return clicks
+`)
+
+// unlockScript releases the lock if it is still held by the token.
+var unlockScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// outboxLockTTL limits the time a relay holds the lock if it can't release it.
+const outboxLockTTL = time.Minute
+
+// Store structure
+type Store struct {
+	client   goredis.UniversalClient
+	prefix   string
+	dedup    storeInterface.DedupMode
+	foldCase bool
+	outbox   bool
+}
+
+// NewStore returns Store keeping data in Redis under keys starting with prefix.
+func NewStore(client goredis.UniversalClient, prefix string, opts storeInterface.Options) *Store {
+	return &Store{
+		client:   client,
+		prefix:   keyPrefix(client, prefix),
+		dedup:    opts.Dedup,
+		foldCase: opts.CaseInsensitive,
+		outbox:   opts.Outbox,
+	}
+}
+
+// outboxType returns the type of outbox messages passed to scripts, empty if the outbox is disabled.
+func (s *Store) outboxType(messageType string) string {
+	if !s.outbox {
+		return ""
+	}
+
+	return messageType
+}
+
+func (s *Store) urlKey(short string) string {
+	return s.prefix + "url:" + short
+}
+
+func (s *Store) dedupKey(userID, original string) string {
+	key := s.dedup.Key(userID, original)
+	if key == "" {
+		return ""
+	}
+
+	return s.prefix + "dedup:" + key
+}
+
+func (s *Store) userKey(kind, userID string) string {
+	return s.prefix + kind + ":" + userID
+}
+
+func (s *Store) statsKey(kind string) string {
+	return s.prefix + "stats:" + kind
+}
+
+// GetOriginalURL using for search original URL by short.
+// For flagged URLs the original URL is returned along with failure.ErrURLFlagged.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	return storeInterface.LookupFolded(ctx, short, s.foldCase, s.getOriginalURL)
+}
+
+func (s *Store) getOriginalURL(ctx context.Context, short string) (string, error) {
+	values, err := s.client.HMGet(ctx, s.urlKey(short), "original", "is_deleted", "verdict").Result()
+	if err != nil {
+		return "", err
+	}
+
+	original, ok := values[0].(string)
+	if !ok {
+		return "", fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	if values[1] == "1" {
+		return "", failure.ErrURLDeleted
+	}
+
+	verdict, _ := values[2].(string)
+
+	return storeInterface.CheckVerdict(original, models.Verdict(verdict))
+}
+
+// AddValue adding new URL into Redis.
+// If the short ID is already taken, failure.ErrShortExists is returned.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+	if opts.Original == "" {
+		return "", failure.ErrEmptyOrigURL
+	}
+
+	dedupKey := s.dedupKey(opts.UserID, opts.Original)
+	dedupOn := "0"
+	if dedupKey != "" {
+		dedupOn = "1"
+	} else {
+		// Scripts must declare all keys they access, the unused one is never touched.
+		dedupKey = s.prefix + "dedup:"
+	}
+
+	keys := []string{
+		s.urlKey(opts.Short),
+		dedupKey,
+		s.userKey("user", opts.UserID),
+		s.userKey("active", opts.UserID),
+		s.userKey("created", opts.UserID),
+		s.prefix + "urls",
+		s.prefix + "users",
+		s.statsKey("daily"),
+		s.statsKey("users"),
+		s.statsKey("domains"),
+		s.prefix + "outbox",
+	}
+	now := time.Now()
+	createdAt := strconv.FormatInt(now.UnixMilli(), 10)
+	day := storeInterface.Day(now)
+	domain := storeInterface.Domain(opts.Original)
+	outboxType := s.outboxType(storeInterface.OutboxCreated)
+	var maxLinks, maxPerDay, since int64
+	if opts.Quota != nil {
+		maxLinks, maxPerDay, since = int64(opts.Quota.MaxLinks), int64(opts.Quota.MaxPerDay), opts.Quota.Since.UnixMilli()
+	}
+
+	res, err := addScript.Run(ctx, s.client, keys, opts.Short, opts.Original, opts.UserID, createdAt, dedupOn, day, domain, outboxType,
+		maxLinks, maxPerDay, since).Slice()
+	if err != nil {
+		return "", err
+	}
+
+	if res[0] == int64(3) {
+		links, _ := res[1].(int64)
+		created, _ := res[2].(int64)
+		return "", opts.Quota.Check(models.Usage{Links: int(links), Created: int(created)})
+	}
+
+	short, _ := res[1].(string)
+	switch res[0] {
+	case int64(0):
+		return fmt.Sprintf("%s/%s", opts.BaseURL, short), failure.ErrConflict
+	case int64(2):
+		return "", fmt.Errorf("%w: %s", failure.ErrShortExists, short)
+	}
+
+	return fmt.Sprintf("%s/%s", opts.BaseURL, short), nil
+}
+
+// Ping checks Redis connection.
+func (s *Store) Ping() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+// GetUserURLs returning all URLs by particular user.
+func (s *Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+	shorts, err := s.client.SMembers(ctx, s.userKey("user", opts.UserID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*goredis.StringCmd, len(shorts))
+	for i, short := range shorts {
+		cmds[i] = pipe.HGet(ctx, s.urlKey(short), "original")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	result := make([]models.UserURL, 0, len(shorts))
+	for i, short := range shorts {
+		original, err := cmds[i].Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, models.UserURL{
+			Short:    fmt.Sprintf("%s/%s", opts.BaseURL, short),
+			Original: original,
+		})
+	}
+
+	return result, nil
+}
+
+// GetOwners returns owners of the links by their short IDs.
+func (s *Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	return storeInterface.OwnersFolded(ctx, shorts, s.foldCase, s.getOwners)
+}
+
+func (s *Store) getOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*goredis.StringCmd, len(shorts))
+	for i, short := range shorts {
+		cmds[i] = pipe.HGet(ctx, s.urlKey(short), "user_id")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return nil, err
+	}
+
+	owners := make(map[string]string, len(shorts))
+	for i, short := range shorts {
+		owner, err := cmds[i].Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		owners[short] = owner
+	}
+
+	return owners, nil
+}
+
+// DeleteURLs marked URLs as deleted.
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	var deleted []storeInterface.DeletedURLs
+	for _, o := range opts {
+		var shorts []string
+		for _, short := range o.URLs {
+			original, err := s.client.HGet(ctx, s.urlKey(short), "original").Result()
+			if errors.Is(err, goredis.Nil) {
+				continue
+			}
+			if err != nil {
+				return storeInterface.AppendDeleted(deleted, o, shorts), err
+			}
+
+			keys := []string{
+				s.urlKey(short),
+				s.userKey("active", o.UserID),
+				s.dedupKey(o.UserID, original),
+				s.statsKey("users"),
+				s.statsKey("domains"),
+				s.statsKey("deleted"),
+				s.prefix + "outbox",
+			}
+			if keys[2] == "" {
+				keys[2] = s.prefix + "dedup:"
+			}
+			domain := storeInterface.Domain(original)
+			outboxType := s.outboxType(storeInterface.OutboxDeleted)
+			now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+			n, err := deleteScript.Run(ctx, s.client, keys, short, o.UserID, domain, outboxType, now).Int()
+			if err != nil {
+				return storeInterface.AppendDeleted(deleted, o, shorts), err
+			}
+			if n == 1 {
+				shorts = append(shorts, short)
+			}
+		}
+		deleted = storeInterface.AppendDeleted(deleted, o, shorts)
+	}
+
+	return deleted, nil
+}
+
+// SetVerdict sets verdict of malicious URL scanning.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	updated, err := verdictScript.Run(ctx, s.client, []string{s.urlKey(short)}, string(verdict)).Int()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w by key %s", failure.ErrNotFound, short)
+	}
+
+	return nil
+}
+
+// NextID returns the next number of the counter used by the sequential ID strategy.
+func (s *Store) NextID(ctx context.Context) (uint64, error) {
+	id, err := s.client.Incr(ctx, s.prefix+"seq").Result()
+
+	return uint64(id), err
+}
+
+// GetUserUsage returns the number of user's links and links created since the time.
+func (s *Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	pipe := s.client.Pipeline()
+	links := pipe.SCard(ctx, s.userKey("active", userID))
+	created := pipe.ZCount(ctx, s.userKey("created", userID), strconv.FormatInt(since.UnixMilli(), 10), "+inf")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return models.Usage{}, err
+	}
+
+	return models.Usage{
+		Links:   int(links.Val()),
+		Created: int(created.Val()),
+	}, nil
+}
+
+// GetInternalStats returning internal statistics
+func (s *Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	opts = opts.WithDefaults()
+	now := time.Now()
+	since := opts.Since(now)
+
+	days := make([]string, 0, opts.Days)
+	for day := since; !day.After(now); day = day.AddDate(0, 0, 1) {
+		days = append(days, storeInterface.Day(day))
+	}
+
+	pipe := s.client.Pipeline()
+	urls := pipe.SCard(ctx, s.prefix+"urls")
+	users := pipe.SCard(ctx, s.prefix+"users")
+	deleted := pipe.Get(ctx, s.statsKey("deleted"))
+	clicks := pipe.Get(ctx, s.statsKey("clicks"))
+	daily := pipe.HMGet(ctx, s.statsKey("daily"), days...)
+	topUsers := pipe.ZRevRangeWithScores(ctx, s.statsKey("users"), 0, int64(opts.Top-1))
+	topDomains := pipe.ZRevRangeWithScores(ctx, s.statsKey("domains"), 0, int64(opts.Top-1))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, goredis.Nil) {
+		return models.InternalStats{}, err
+	}
+
+	stats := models.InternalStats{
+		URLs:  int(urls.Val()),
+		Users: int(users.Val()),
+	}
+	stats.Deleted, _ = strconv.Atoi(deleted.Val())
+	stats.Active = stats.URLs - stats.Deleted
+	stats.Clicks, _ = strconv.ParseInt(clicks.Val(), 10, 64)
+
+	counts := make(map[string]int, len(days))
+	for i, value := range daily.Val() {
+		if value, ok := value.(string); ok {
+			counts[days[i]], _ = strconv.Atoi(value)
+		}
+	}
+	stats.CreatedPerDay = storeInterface.DailyCounts(counts, since, now)
+
+	stats.TopUsers = storeInterface.TopUsers(zCounts(topUsers.Val()), opts.Top)
+	stats.TopDomains = storeInterface.TopDomains(zCounts(topDomains.Val()), opts.Top)
+
+	return stats, nil
+}
+
+// zCounts returns scores of sorted set members as counts.
+func zCounts(members []goredis.Z) map[string]int {
+	counts := make(map[string]int, len(members))
+	for _, member := range members {
+		key, _ := member.Member.(string)
+		counts[key] = int(member.Score)
+	}
+
+	return counts
+}
+
+// AddClicks adds the numbers of redirects to the URLs and returns their totals, unknown short IDs are skipped.
+func (s *Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	outboxType := s.outboxType(storeInterface.OutboxClicked)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	pipe := s.client.Pipeline()
+	cmds := make(map[string]*goredis.Cmd, len(clicks))
+	for short, n := range clicks {
+		if n > 0 {
+			keys := []string{s.urlKey(short), s.statsKey("clicks"), s.prefix + "outbox"}
+			cmds[short] = clicksScript.Eval(ctx, pipe, keys, n, outboxType, short, now)
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]int64, len(cmds))
+	for short, cmd := range cmds {
+		if total, _ := cmd.Int64(); total > 0 {
+			totals[short] = total
+		}
+	}
+
+	return totals, nil
+}
+
+// RelayOutbox passes up to limit oldest messages of the outbox stream to publish and deletes
+// them if it succeeds. Relays of all instances are serialized by a lock, the relay returns
+// nothing while another one holds it.
+func (s *Store) RelayOutbox(ctx context.Context, limit int, publish storeInterface.Publish) (int, error) {
+	lockKey := s.prefix + "outbox:lock"
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	locked, err := s.client.SetNX(ctx, lockKey, token, outboxLockTTL).Result()
+	if err != nil || !locked {
+		return 0, err
+	}
+	defer unlockScript.Run(context.Background(), s.client, []string{lockKey}, token)
+
+	entries, err := s.client.XRangeN(ctx, s.prefix+"outbox", "-", "+", int64(limit)).Result()
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(entries))
+	messages := make([]storeInterface.OutboxMessage, 0, len(entries))
+	for _, entry := range entries {
+		m := storeInterface.OutboxMessage{ID: entry.ID}
+		m.Type, _ = entry.Values["type"].(string)
+		m.Short, _ = entry.Values["short"].(string)
+		m.Original, _ = entry.Values["original"].(string)
+		m.UserID, _ = entry.Values["user_id"].(string)
+		if clicks, ok := entry.Values["clicks"].(string); ok {
+			m.Clicks, _ = strconv.ParseInt(clicks, 10, 64)
+		}
+		if ms, ok := entry.Values["time"].(string); ok {
+			millis, _ := strconv.ParseInt(ms, 10, 64)
+			m.Time = time.UnixMilli(millis).UTC()
+		}
+
+		ids = append(ids, entry.ID)
+		messages = append(messages, m)
+	}
+
+	if err := publish(ctx, messages); err != nil {
+		return 0, err
+	}
+
+	if err := s.client.XDel(ctx, s.prefix+"outbox", ids...).Err(); err != nil {
+		return 0, err
+	}
+
+	return len(messages), nil
+}
@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/kupriyanovkk/shortener/internal/store/registry"
+	"github.com/kupriyanovkk/shortener/internal/store/storetest"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*goredis.Client, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+func TestConformance(t *testing.T) {
+	storetest.RunPersistent(t, func(t *testing.T, opts storeInterface.Options) storeInterface.Store {
+		client, _ := newTestClient(t)
+		return NewStore(client, DefaultPrefix, opts)
+	}, func(t *testing.T, s storeInterface.Store) storeInterface.Store {
+		old := s.(*Store).client.(*goredis.Client)
+		client := goredis.NewClient(&goredis.Options{Addr: old.Options().Addr})
+		t.Cleanup(func() { client.Close() })
+		require.NoError(t, old.Close())
+
+		return NewStore(client, DefaultPrefix, storeInterface.Options{})
+	})
+}
+
+func TestOpen(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	store, err := registry.Open("redis://"+server.Addr()+"/0?prefix=test:", storeInterface.Options{})
+	require.NoError(t, err)
+	require.NoError(t, store.Ping())
+
+	_, err = store.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com"})
+	require.NoError(t, err)
+	assert.True(t, server.Exists("test:url:abc"))
+
+	_, err = registry.Open("redis://"+server.Addr()+"/0?unknown=1", storeInterface.Options{})
+	assert.Error(t, err)
+}
+
+func TestNextID(t *testing.T) {
+	client, _ := newTestClient(t)
+	store := NewStore(client, DefaultPrefix, storeInterface.Options{})
+	other := NewStore(client, DefaultPrefix, storeInterface.Options{})
+
+	first, err := store.NextID(context.Background())
+	require.NoError(t, err)
+	second, err := other.NextID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2}, []uint64{first, second})
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+	cache := NewCache(client, DefaultPrefix)
+
+	_, ok, err := cache.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "abc", "ok:https://example.com", time.Minute))
+	value, ok, err := cache.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ok:https://example.com", value)
+	assert.Equal(t, time.Minute, server.TTL(DefaultPrefix+"cache:abc"))
+
+	require.NoError(t, cache.Delete(ctx, "abc"))
+	_, ok, err = cache.Get(ctx, "abc")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+	queue := NewQueue(client, DefaultPrefix)
+
+	requests, err := queue.Pop(ctx, 10, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, requests)
+
+	require.NoError(t, queue.Push(ctx,
+		storeInterface.DeletedURLs{UserID: "user1", URLs: []string{"a", "b"}},
+		storeInterface.DeletedURLs{UserID: "user2", URLs: []string{"c"}},
+	))
+	server.RPush(DefaultPrefix+"deletions", "malformed")
+	require.NoError(t, queue.Push(ctx, storeInterface.DeletedURLs{UserID: "user3", URLs: []string{"d"}}))
+
+	n, err := queue.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	requests, err = queue.Pop(ctx, 3, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []storeInterface.DeletedURLs{
+		{UserID: "user1", URLs: []string{"a", "b"}},
+		{UserID: "user2", URLs: []string{"c"}},
+	}, requests, "malformed requests are skipped")
+
+	require.NoError(t, queue.Ack(ctx, requests...))
+
+	requests, err = queue.Pop(ctx, 3, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []storeInterface.DeletedURLs{{UserID: "user3", URLs: []string{"d"}}}, requests)
+
+	processing, err := server.List(queue.processingKey(queue.id))
+	require.NoError(t, err)
+	assert.Len(t, processing, 1, "requests are kept until acknowledged")
+
+	require.NoError(t, queue.Ack(ctx, requests...))
+	assert.False(t, server.Exists(queue.processingKey(queue.id)))
+}
+
+func TestQueueRecover(t *testing.T) {
+	ctx := context.Background()
+	client, server := newTestClient(t)
+
+	crashed := NewQueue(client, DefaultPrefix)
+	require.NoError(t, crashed.Push(ctx,
+		storeInterface.DeletedURLs{UserID: "user1", URLs: []string{"a"}},
+		storeInterface.DeletedURLs{UserID: "user2", URLs: []string{"b"}},
+	))
+	requests, err := crashed.Pop(ctx, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+
+	queue := NewQueue(client, DefaultPrefix)
+	queue.id = crashed.id + "-other"
+	requests, err = queue.Pop(ctx, 10, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Empty(t, requests, "requests of alive consumers are not taken")
+
+	server.FastForward(consumerTTL + time.Second)
+
+	queue = NewQueue(client, DefaultPrefix)
+	queue.id = crashed.id + "-next"
+	requests, err = queue.Pop(ctx, 10, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []storeInterface.DeletedURLs{
+		{UserID: "user1", URLs: []string{"a"}},
+		{UserID: "user2", URLs: []string{"b"}},
+	}, requests, "requests of gone consumers are returned to the queue")
+	assert.False(t, server.Exists(crashed.processingKey(crashed.id)))
+}
+
+func TestKeyPrefix(t *testing.T) {
+	client, _ := newTestClient(t)
+	assert.Equal(t, DefaultPrefix, keyPrefix(client, DefaultPrefix))
+
+	cluster := goredis.NewClusterClient(&goredis.ClusterOptions{Addrs: []string{"localhost:0"}})
+	t.Cleanup(func() { cluster.Close() })
+	assert.Equal(t, "{"+DefaultPrefix+"}", keyPrefix(cluster, DefaultPrefix))
+	assert.Equal(t, "{app}:", keyPrefix(cluster, "{app}:"), "hash tags are kept")
+}
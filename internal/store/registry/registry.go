@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+)
+
+// Factory creates a store from the parsed storage URI and common store options.
+type Factory func(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error)
+
+var (
+	mu      sync.RWMutex
+	drivers = make(map[string]Factory)
+)
+
+// Register makes a storage driver available by the provided URI scheme.
+// It panics if Register is called twice with the same scheme or if factory is nil.
+func Register(scheme string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if factory == nil {
+		panic("registry: Register factory is nil")
+	}
+	if _, dup := drivers[scheme]; dup {
+		panic("registry: Register called twice for driver " + scheme)
+	}
+	drivers[scheme] = factory
+}
+
+// Drivers returns a sorted list of the registered URI schemes.
+func Drivers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]string, 0, len(drivers))
+	for scheme := range drivers {
+		list = append(list, scheme)
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// Open parses the storage URI and creates a store by the driver registered for its scheme.
+func Open(uri string, opts storeInterface.Options) (storeInterface.Store, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("registry: invalid storage URI: %w", err)
+	}
+
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("registry: storage URI %q has no scheme", uri)
+	}
+
+	mu.RLock()
+	factory, ok := drivers[u.Scheme]
+	mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("registry: unknown driver %q (forgotten import?)", u.Scheme)
+	}
+
+	return factory(u, opts)
+}
+
+// IntOption returns integer option from the URI query or def if the option is not set.
+func IntOption(uri *url.URL, name string, def int) (int, error) {
+	value := uri.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("registry: option %s: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// BoolOption returns boolean option from the URI query or def if the option is not set.
+func BoolOption(uri *url.URL, name string, def bool) (bool, error) {
+	value := uri.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("registry: option %s: %w", name, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package registry
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	storeInterface.Store
+}
+
+func TestOpen(t *testing.T) {
+	var got *url.URL
+	Register("fake", func(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error) {
+		got = uri
+		if uri.Query().Get("fail") != "" {
+			return nil, errors.New("fail")
+		}
+		return fakeStore{}, nil
+	})
+
+	t.Run("registered driver", func(t *testing.T) {
+		store, err := Open("fake://host/path?size=10", storeInterface.Options{})
+		require.NoError(t, err)
+		assert.NotNil(t, store)
+		assert.Equal(t, "host", got.Host)
+		assert.Equal(t, "/path", got.Path)
+		assert.Equal(t, "10", got.Query().Get("size"))
+	})
+
+	t.Run("driver error", func(t *testing.T) {
+		_, err := Open("fake://?fail=1", storeInterface.Options{})
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown driver", func(t *testing.T) {
+		_, err := Open("unknown://", storeInterface.Options{})
+		assert.ErrorContains(t, err, "unknown driver")
+	})
+
+	t.Run("missing scheme", func(t *testing.T) {
+		_, err := Open("/tmp/short.json", storeInterface.Options{})
+		assert.ErrorContains(t, err, "no scheme")
+	})
+
+	assert.Contains(t, Drivers(), "fake")
+	assert.Panics(t, func() {
+		Register("fake", func(uri *url.URL, opts storeInterface.Options) (storeInterface.Store, error) { return nil, nil })
+	})
+}
+
+func TestOptions(t *testing.T) {
+	uri, _ := url.Parse("fake://?size=10&sync=true&bad=x")
+
+	size, err := IntOption(uri, "size", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 10, size)
+
+	missing, err := IntOption(uri, "missing", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, missing)
+
+	sync, err := BoolOption(uri, "sync", false)
+	require.NoError(t, err)
+	assert.True(t, sync)
+
+	_, err = IntOption(uri, "bad", 0)
+	assert.Error(t, err)
+	_, err = BoolOption(uri, "bad", false)
+	assert.Error(t, err)
+}
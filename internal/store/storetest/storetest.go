@@ -0,0 +1,733 @@
+// Package storetest implements a conformance test suite for storeInterface.Store
+// implementations. Every backend is expected to pass it:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T, opts storeInterface.Options) storeInterface.Store {
+//			return newStore(100, opts)
+//		})
+//	}
+//
+// The suite only relies on data it creates itself, so it can be run against
+// shared backends like a database that already contains records.
+//
+// Backends keeping data between runs pass RunPersistent a function reopening
+// the store, so the suite also checks that written data is read back.
+package storetest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	"github.com/kupriyanovkk/shortener/internal/random"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseURL = "http://short.test"
+
+// Factory returns a store configured with opts ready to be used by a single test.
+type Factory func(t *testing.T, opts storeInterface.Options) storeInterface.Store
+
+// Run runs the conformance suite against stores created by newStore.
+func Run(t *testing.T, newStore Factory) {
+	defaults := func(t *testing.T) storeInterface.Store {
+		return newStore(t, storeInterface.Options{})
+	}
+
+	t.Run("AddAndGet", func(t *testing.T) { testAddAndGet(t, defaults(t)) })
+	t.Run("EmptyOriginal", func(t *testing.T) { testEmptyOriginal(t, defaults(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, defaults(t)) })
+	t.Run("ShortExists", func(t *testing.T) { testShortExists(t, defaults(t)) })
+	t.Run("CaseSensitive", func(t *testing.T) { testCaseSensitive(t, defaults(t)) })
+	t.Run("CaseInsensitive", func(t *testing.T) {
+		testCaseInsensitive(t, newStore(t, storeInterface.Options{CaseInsensitive: true}))
+	})
+	t.Run("DedupGlobal", func(t *testing.T) {
+		testDedupGlobal(t, newStore(t, storeInterface.Options{Dedup: storeInterface.DedupGlobal}))
+	})
+	t.Run("DedupUser", func(t *testing.T) {
+		testDedupUser(t, newStore(t, storeInterface.Options{Dedup: storeInterface.DedupUser}))
+	})
+	t.Run("DedupOff", func(t *testing.T) {
+		testDedupOff(t, newStore(t, storeInterface.Options{Dedup: storeInterface.DedupOff}))
+	})
+	t.Run("Delete", func(t *testing.T) { testDelete(t, defaults(t)) })
+	t.Run("UserURLs", func(t *testing.T) { testUserURLs(t, defaults(t)) })
+	t.Run("Owners", func(t *testing.T) { testOwners(t, defaults(t)) })
+	t.Run("Verdict", func(t *testing.T) { testVerdict(t, defaults(t)) })
+	t.Run("Usage", func(t *testing.T) { testUsage(t, defaults(t)) })
+	t.Run("Quota", func(t *testing.T) { testQuota(t, defaults(t)) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, defaults(t)) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, defaults(t)) })
+	t.Run("Outbox", func(t *testing.T) {
+		testOutbox(t, newStore(t, storeInterface.Options{Outbox: true}))
+	})
+}
+
+// Reopen closes the store and returns a new one reading the same data.
+type Reopen func(t *testing.T, s storeInterface.Store) storeInterface.Store
+
+// RunPersistent runs the conformance suite and checks that data is kept when the store is reopened.
+func RunPersistent(t *testing.T, newStore Factory, reopen Reopen) {
+	Run(t, newStore)
+
+	t.Run("Reopen", func(t *testing.T) {
+		testReopen(t, newStore(t, storeInterface.Options{}), reopen)
+	})
+}
+
+// unique returns a random string, so tests don't interfere with existing data.
+func unique(t *testing.T, prefix string) string {
+	b, err := random.Generate(8)
+	require.NoError(t, err)
+
+	return prefix + hex.EncodeToString(b)
+}
+
+func add(t *testing.T, s storeInterface.Store, short, original, userID string) (string, error) {
+	return s.AddValue(context.Background(), storeInterface.AddValueOptions{
+		Original: original,
+		BaseURL:  baseURL,
+		Short:    short,
+		UserID:   userID,
+	})
+}
+
+func testAddAndGet(t *testing.T, s storeInterface.Store) {
+	short := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+
+	result, err := add(t, s, short, original, unique(t, "u"))
+	require.NoError(t, err)
+	assert.Equal(t, baseURL+"/"+short, result)
+
+	got, err := s.GetOriginalURL(context.Background(), short)
+	require.NoError(t, err)
+	assert.Equal(t, original, got)
+}
+
+func testEmptyOriginal(t *testing.T, s storeInterface.Store) {
+	result, err := add(t, s, unique(t, "s"), "", unique(t, "u"))
+	assert.ErrorIs(t, err, failure.ErrEmptyOrigURL)
+	assert.Empty(t, result)
+}
+
+func testNotFound(t *testing.T, s storeInterface.Store) {
+	got, err := s.GetOriginalURL(context.Background(), unique(t, "missing"))
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+	assert.Empty(t, got)
+}
+
+func testShortExists(t *testing.T, s storeInterface.Store) {
+	short := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+
+	_, err := add(t, s, short, original, unique(t, "u"))
+	require.NoError(t, err)
+
+	got, err := add(t, s, short, "https://example.com/"+unique(t, "p"), unique(t, "u"))
+	assert.ErrorIs(t, err, failure.ErrShortExists)
+	assert.NotErrorIs(t, err, failure.ErrConflict)
+	assert.Empty(t, got)
+
+	got, err = s.GetOriginalURL(context.Background(), short)
+	require.NoError(t, err)
+	assert.Equal(t, original, got, "existing URL isn't overwritten")
+}
+
+func testCaseSensitive(t *testing.T, s storeInterface.Store) {
+	short := unique(t, "s")
+
+	_, err := add(t, s, short, "https://example.com/"+unique(t, "p"), unique(t, "u"))
+	require.NoError(t, err)
+
+	_, err = s.GetOriginalURL(context.Background(), strings.ToUpper(short))
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+}
+
+func testCaseInsensitive(t *testing.T, s storeInterface.Store) {
+	lower := unique(t, "s")
+	lowerOriginal := "https://example.com/" + unique(t, "p")
+	mixed := unique(t, "M")
+	mixedOriginal := "https://example.com/" + unique(t, "p")
+
+	_, err := add(t, s, lower, lowerOriginal, unique(t, "u"))
+	require.NoError(t, err)
+	_, err = add(t, s, mixed, mixedOriginal, unique(t, "u"))
+	require.NoError(t, err)
+
+	got, err := s.GetOriginalURL(context.Background(), strings.ToUpper(lower))
+	require.NoError(t, err)
+	assert.Equal(t, lowerOriginal, got)
+
+	got, err = s.GetOriginalURL(context.Background(), mixed)
+	require.NoError(t, err)
+	assert.Equal(t, mixedOriginal, got, "exact match of mixed-case ID")
+
+	_, err = s.GetOriginalURL(context.Background(), strings.ToUpper(unique(t, "missing")))
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+
+	owners, err := s.GetOwners(context.Background(), []string{strings.ToUpper(lower), mixed, strings.ToUpper(unique(t, "missing"))})
+	require.NoError(t, err)
+	assert.Len(t, owners, 2, "owners are returned by short IDs as given")
+	assert.Contains(t, owners, strings.ToUpper(lower))
+	assert.Contains(t, owners, mixed)
+
+	// Changes of links are visible through their aliases, even if they were looked up before.
+	userID := unique(t, "u")
+	short := unique(t, "s")
+	alias := strings.ToUpper(short[:1]) + short[1:]
+	_, err = add(t, s, short, "https://example.com/"+unique(t, "p"), userID)
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(context.Background(), alias)
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetVerdict(context.Background(), short, models.VerdictBlock))
+	_, err = s.GetOriginalURL(context.Background(), alias)
+	assert.ErrorIs(t, err, failure.ErrURLBlocked)
+
+	_, err = s.DeleteURLs(context.Background(), []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{short}}})
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(context.Background(), alias)
+	assert.ErrorIs(t, err, failure.ErrURLDeleted)
+}
+
+func testOwners(t *testing.T, s storeInterface.Store) {
+	userID := unique(t, "u")
+	other := unique(t, "u")
+	own := unique(t, "s")
+	deleted := unique(t, "s")
+	foreign := unique(t, "s")
+
+	for short, owner := range map[string]string{own: userID, deleted: userID, foreign: other} {
+		_, err := add(t, s, short, "https://example.com/"+unique(t, "p"), owner)
+		require.NoError(t, err)
+	}
+	_, err := s.DeleteURLs(context.Background(), []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{deleted}}})
+	require.NoError(t, err)
+	cleanup(t, s, userID, own)
+	cleanup(t, s, other, foreign)
+
+	owners, err := s.GetOwners(context.Background(), []string{own, deleted, foreign, unique(t, "missing")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{own: userID, deleted: userID, foreign: other}, owners)
+
+	owners, err = s.GetOwners(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, owners)
+}
+
+// cleanup deletes URLs created by the test, so the data left doesn't break
+// unique indexes of shared stores configured with another dedup mode.
+func cleanup(t *testing.T, s storeInterface.Store, userID string, shorts ...string) {
+	t.Cleanup(func() {
+		_, err := s.DeleteURLs(context.Background(), []storeInterface.DeletedURLs{{UserID: userID, URLs: shorts}})
+		assert.NoError(t, err)
+	})
+}
+
+func testDedupGlobal(t *testing.T, s storeInterface.Store) {
+	short := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+	owner := unique(t, "u")
+
+	_, err := add(t, s, short, original, owner)
+	require.NoError(t, err)
+
+	result, err := add(t, s, unique(t, "s"), original, owner)
+	assert.ErrorIs(t, err, failure.ErrConflict)
+	assert.Equal(t, baseURL+"/"+short, result, "existing short URL is returned on conflict")
+
+	result, err = add(t, s, unique(t, "s"), original, unique(t, "u"))
+	assert.ErrorIs(t, err, failure.ErrConflict, "URLs of other users are taken into account")
+	assert.Equal(t, baseURL+"/"+short, result)
+
+	_, err = s.DeleteURLs(context.Background(), []storeInterface.DeletedURLs{{UserID: owner, URLs: []string{short}}})
+	require.NoError(t, err)
+
+	again := unique(t, "s")
+	result, err = add(t, s, again, original, owner)
+	require.NoError(t, err, "deleted URLs are not duplicates")
+	assert.Equal(t, baseURL+"/"+again, result)
+	cleanup(t, s, owner, again)
+}
+
+func testDedupUser(t *testing.T, s storeInterface.Store) {
+	short := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+	owner := unique(t, "u")
+
+	_, err := add(t, s, short, original, owner)
+	require.NoError(t, err)
+	cleanup(t, s, owner, short)
+
+	result, err := add(t, s, unique(t, "s"), original, owner)
+	assert.ErrorIs(t, err, failure.ErrConflict)
+	assert.Equal(t, baseURL+"/"+short, result)
+
+	other := unique(t, "u")
+	otherShort := unique(t, "s")
+	result, err = add(t, s, otherShort, original, other)
+	require.NoError(t, err, "URLs of other users are not duplicates")
+	assert.Equal(t, baseURL+"/"+otherShort, result)
+	cleanup(t, s, other, otherShort)
+}
+
+func testDedupOff(t *testing.T, s storeInterface.Store) {
+	original := "https://example.com/" + unique(t, "p")
+	owner := unique(t, "u")
+	shorts := []string{unique(t, "s"), unique(t, "s")}
+
+	for _, short := range shorts {
+		result, err := add(t, s, short, original, owner)
+		require.NoError(t, err)
+		assert.Equal(t, baseURL+"/"+short, result)
+
+		got, err := s.GetOriginalURL(context.Background(), short)
+		require.NoError(t, err)
+		assert.Equal(t, original, got)
+	}
+	cleanup(t, s, owner, shorts...)
+}
+
+func testDelete(t *testing.T, s storeInterface.Store) {
+	ctx := context.Background()
+	owner := unique(t, "u")
+	own := unique(t, "s")
+	foreign := unique(t, "s")
+
+	_, err := add(t, s, own, "https://example.com/"+unique(t, "p"), owner)
+	require.NoError(t, err)
+	foreignOriginal := "https://example.com/" + unique(t, "p")
+	_, err = add(t, s, foreign, foreignOriginal, unique(t, "u"))
+	require.NoError(t, err)
+
+	other := unique(t, "u")
+	requests := []storeInterface.DeletedURLs{
+		{UserID: owner, URLs: []string{own, foreign, unique(t, "missing")}},
+		{UserID: other, URLs: []string{own}},
+	}
+	deleted, err := s.DeleteURLs(ctx, requests)
+	require.NoError(t, err)
+	assert.Equal(t, []storeInterface.DeletedURLs{{UserID: owner, URLs: []string{own}}}, deleted, "only deleted URLs are returned")
+
+	deleted, err = s.DeleteURLs(ctx, requests)
+	require.NoError(t, err)
+	assert.Empty(t, deleted, "URLs are deleted once")
+
+	_, err = s.GetOriginalURL(ctx, own)
+	assert.ErrorIs(t, err, failure.ErrURLDeleted)
+
+	got, err := s.GetOriginalURL(ctx, foreign)
+	require.NoError(t, err, "only owner can delete URL")
+	assert.Equal(t, foreignOriginal, got)
+}
+
+func testUserURLs(t *testing.T, s storeInterface.Store) {
+	userID := unique(t, "u")
+	expected := make([]models.UserURL, 0, 3)
+
+	for i := 0; i < 3; i++ {
+		short := unique(t, "s")
+		original := fmt.Sprintf("https://example.com/%d/%s", i, unique(t, "p"))
+		_, err := add(t, s, short, original, userID)
+		require.NoError(t, err)
+
+		expected = append(expected, models.UserURL{Short: baseURL + "/" + short, Original: original})
+	}
+	_, err := add(t, s, unique(t, "s"), "https://example.com/"+unique(t, "p"), unique(t, "u"))
+	require.NoError(t, err)
+
+	got, err := s.GetUserURLs(context.Background(), storeInterface.GetUserURLsOptions{
+		UserID:  userID,
+		BaseURL: baseURL,
+	})
+	require.NoError(t, err)
+
+	sortURLs(expected)
+	sortURLs(got)
+	assert.Equal(t, expected, got)
+
+	empty, err := s.GetUserURLs(context.Background(), storeInterface.GetUserURLsOptions{
+		UserID:  unique(t, "u"),
+		BaseURL: baseURL,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func testVerdict(t *testing.T, s storeInterface.Store) {
+	ctx := context.Background()
+	short := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+
+	_, err := add(t, s, short, original, unique(t, "u"))
+	require.NoError(t, err)
+
+	require.NoError(t, s.SetVerdict(ctx, short, models.VerdictWarn))
+	got, err := s.GetOriginalURL(ctx, short)
+	assert.ErrorIs(t, err, failure.ErrURLFlagged)
+	assert.Equal(t, original, got, "flagged URL is returned for the warning page")
+
+	require.NoError(t, s.SetVerdict(ctx, short, models.VerdictBlock))
+	got, err = s.GetOriginalURL(ctx, short)
+	assert.ErrorIs(t, err, failure.ErrURLBlocked)
+	assert.Empty(t, got)
+
+	require.NoError(t, s.SetVerdict(ctx, short, models.VerdictClean))
+	got, err = s.GetOriginalURL(ctx, short)
+	require.NoError(t, err)
+	assert.Equal(t, original, got)
+
+	err = s.SetVerdict(ctx, unique(t, "missing"), models.VerdictBlock)
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+}
+
+func testUsage(t *testing.T, s storeInterface.Store) {
+	ctx := context.Background()
+	userID := unique(t, "u")
+	before := time.Now().Add(-time.Minute)
+
+	shorts := make([]string, 3)
+	for i := range shorts {
+		shorts[i] = unique(t, "s")
+		_, err := add(t, s, shorts[i], "https://example.com/"+unique(t, "p"), userID)
+		require.NoError(t, err)
+	}
+	_, err := add(t, s, unique(t, "s"), "https://example.com/"+unique(t, "p"), unique(t, "u"))
+	require.NoError(t, err)
+
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: userID, URLs: shorts[:1]}})
+	require.NoError(t, err)
+
+	usage, err := s.GetUserUsage(ctx, userID, before)
+	require.NoError(t, err)
+	assert.Equal(t, models.Usage{Links: 2, Created: 3}, usage, "deleted links are counted as created")
+
+	usage, err = s.GetUserUsage(ctx, userID, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, models.Usage{Links: 2, Created: 0}, usage)
+
+	usage, err = s.GetUserUsage(ctx, unique(t, "u"), before)
+	require.NoError(t, err)
+	assert.Equal(t, models.Usage{}, usage)
+}
+
+func testQuota(t *testing.T, s storeInterface.Store) {
+	ctx := context.Background()
+	userID := unique(t, "u")
+	quota := &storeInterface.Quota{MaxLinks: 3, MaxPerDay: 4, Since: time.Now().Add(-time.Minute)}
+	addLimited := func(short, original string) (string, error) {
+		return s.AddValue(ctx, storeInterface.AddValueOptions{
+			Original: original,
+			BaseURL:  baseURL,
+			Short:    short,
+			UserID:   userID,
+			Quota:    quota,
+		})
+	}
+
+	const workers = 10
+	shorts := make(chan string, workers)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			short := unique(t, "s")
+			if _, err := addLimited(short, "https://example.com/"+short); err != nil {
+				errs <- err
+				return
+			}
+			shorts <- short
+		}()
+	}
+	wg.Wait()
+	close(shorts)
+	close(errs)
+
+	assert.Len(t, shorts, quota.MaxLinks, "concurrent requests can't exceed the quota")
+	for err := range errs {
+		var quotaErr *storeInterface.QuotaError
+		require.ErrorAs(t, err, &quotaErr)
+		assert.Equal(t, storeInterface.QuotaLinks, quotaErr.Limit)
+		assert.Equal(t, quota.MaxLinks, quotaErr.Used)
+	}
+
+	existing := <-shorts
+	result, err := addLimited(unique(t, "s"), "https://example.com/"+existing)
+	assert.ErrorIs(t, err, failure.ErrConflict, "already shortened URLs are found at the limit")
+	assert.Equal(t, baseURL+"/"+existing, result)
+
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{existing}}})
+	require.NoError(t, err)
+	_, err = addLimited(unique(t, "s"), "https://example.com/"+unique(t, "p"))
+	require.NoError(t, err, "deleted links free the links quota")
+
+	_, err = addLimited(unique(t, "s"), "https://example.com/"+unique(t, "p"))
+	var quotaErr *storeInterface.QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+	assert.ErrorIs(t, err, failure.ErrQuotaExceeded)
+
+	quota.MaxLinks = 0
+	_, err = addLimited(unique(t, "s"), "https://example.com/"+unique(t, "p"))
+	require.ErrorAs(t, err, &quotaErr)
+	assert.Equal(t, storeInterface.QuotaPerDay, quotaErr.Limit, "deleted links are counted as created")
+
+	_, err = add(t, s, unique(t, "s"), "https://example.com/"+unique(t, "p"), userID)
+	assert.NoError(t, err, "links are unlimited without quota")
+}
+
+func testStats(t *testing.T, s storeInterface.Store) {
+	ctx := context.Background()
+	opts := storeInterface.StatsOptions{Days: 7}
+	before, err := s.GetInternalStats(ctx, opts)
+	require.NoError(t, err)
+
+	users := []string{unique(t, "u"), unique(t, "u")}
+	shorts := make([]string, 3)
+	for i := range shorts {
+		shorts[i] = unique(t, "s")
+		_, err := add(t, s, shorts[i], "https://example.com/"+unique(t, "p"), users[i%2])
+		require.NoError(t, err)
+	}
+
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: users[0], URLs: shorts[:1]}})
+	require.NoError(t, err)
+	totals, err := s.AddClicks(ctx, map[string]int64{shorts[1]: 2, unique(t, "s"): 5})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{shorts[1]: 2}, totals, "totals of unknown links are skipped")
+	totals, err = s.AddClicks(ctx, map[string]int64{shorts[1]: 3})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{shorts[1]: 5}, totals, "totals are returned")
+
+	after, err := s.GetInternalStats(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, before.URLs+3, after.URLs)
+	assert.Equal(t, before.Users+2, after.Users)
+	assert.Equal(t, before.Active+2, after.Active)
+	assert.Equal(t, before.Deleted+1, after.Deleted)
+	assert.Equal(t, before.Clicks+5, after.Clicks, "clicks of unknown links are skipped")
+
+	require.Len(t, after.CreatedPerDay, 7)
+	today := after.CreatedPerDay[6]
+	assert.Equal(t, storeInterface.Day(time.Now()), today.Day)
+	assert.Equal(t, before.CreatedPerDay[6].Count+3, today.Count, "deleted links are counted as created")
+
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: users[0], URLs: shorts[:1]}})
+	require.NoError(t, err)
+	again, err := s.GetInternalStats(ctx, opts)
+	require.NoError(t, err)
+	assert.Equal(t, after.Deleted, again.Deleted, "links are deleted once")
+}
+
+func testConcurrency(t *testing.T, s storeInterface.Store) {
+	const workers = 4
+	const perWorker = 20
+
+	ctx := context.Background()
+	userID := unique(t, "u")
+	prefix := unique(t, "s")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < perWorker; i++ {
+				short := fmt.Sprintf("%s-%d-%d", prefix, w, i)
+				original := fmt.Sprintf("https://example.com/%s/%d/%d", prefix, w, i)
+				if _, err := add(t, s, short, original, userID); err != nil {
+					errs <- err
+					continue
+				}
+
+				got, err := s.GetOriginalURL(ctx, short)
+				if err != nil {
+					errs <- err
+				} else if got != original {
+					errs <- fmt.Errorf("got %s for %s, want %s", got, short, original)
+				}
+
+				if i%5 == 0 {
+					_, err := s.GetUserURLs(ctx, storeInterface.GetUserURLsOptions{UserID: userID, BaseURL: baseURL})
+					if err != nil {
+						errs <- err
+					}
+					if _, err := s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{short}}}); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	urls, err := s.GetUserURLs(ctx, storeInterface.GetUserURLsOptions{UserID: userID, BaseURL: baseURL})
+	require.NoError(t, err)
+	assert.Len(t, urls, workers*perWorker)
+
+	deleted := 0
+	for w := 0; w < workers; w++ {
+		for i := 0; i < perWorker; i += 5 {
+			_, err := s.GetOriginalURL(ctx, fmt.Sprintf("%s-%d-%d", prefix, w, i))
+			if errors.Is(err, failure.ErrURLDeleted) {
+				deleted++
+			}
+		}
+	}
+	assert.Equal(t, workers*perWorker/5, deleted)
+}
+
+func sortURLs(urls []models.UserURL) {
+	sort.Slice(urls, func(i, j int) bool {
+		return urls[i].Short < urls[j].Short
+	})
+}
+
+// relayAll relays all outbox messages and returns the ones of the short IDs.
+func relayAll(t *testing.T, outbox storeInterface.Outbox, shorts ...string) []storeInterface.OutboxMessage {
+	var result []storeInterface.OutboxMessage
+	for {
+		n, err := outbox.RelayOutbox(context.Background(), 2, func(ctx context.Context, messages []storeInterface.OutboxMessage) error {
+			for _, m := range messages {
+				for _, short := range shorts {
+					if m.Short == short {
+						result = append(result, m)
+					}
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		if n == 0 {
+			return result
+		}
+	}
+}
+
+func testOutbox(t *testing.T, s storeInterface.Store) {
+	outbox, ok := s.(storeInterface.Outbox)
+	if !ok {
+		t.Skip("store doesn't implement Outbox")
+	}
+
+	ctx := context.Background()
+	userID := unique(t, "u")
+	first := unique(t, "s")
+	second := unique(t, "s")
+	original := "https://example.com/" + unique(t, "p")
+
+	_, err := add(t, s, first, original, userID)
+	require.NoError(t, err)
+	_, err = add(t, s, second, "https://example.com/"+unique(t, "p"), userID)
+	require.NoError(t, err)
+	_, err = add(t, s, first, "https://example.com/"+unique(t, "p"), userID)
+	require.ErrorIs(t, err, failure.ErrShortExists)
+
+	deleted := []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{first}}}
+	_, err = s.DeleteURLs(ctx, deleted)
+	require.NoError(t, err)
+	_, err = s.DeleteURLs(ctx, deleted)
+	require.NoError(t, err)
+	_, err = s.AddClicks(ctx, map[string]int64{second: 3, unique(t, "missing"): 1})
+	require.NoError(t, err)
+
+	messages := relayAll(t, outbox, first, second)
+	require.Len(t, messages, 4, "failed and repeated mutations are not recorded")
+
+	ids := make(map[string]bool)
+	for _, m := range messages {
+		assert.NotEmpty(t, m.ID)
+		assert.False(t, m.Time.IsZero())
+		ids[m.ID] = true
+	}
+	assert.Len(t, ids, 4)
+
+	assert.Equal(t, storeInterface.OutboxCreated, messages[0].Type)
+	assert.Equal(t, first, messages[0].Short)
+	assert.Equal(t, original, messages[0].Original)
+	assert.Equal(t, userID, messages[0].UserID)
+	assert.Equal(t, storeInterface.OutboxCreated, messages[1].Type)
+	assert.Equal(t, storeInterface.OutboxDeleted, messages[2].Type)
+	assert.Equal(t, first, messages[2].Short)
+	assert.Equal(t, userID, messages[2].UserID)
+	assert.Equal(t, storeInterface.OutboxClicked, messages[3].Type)
+	assert.Equal(t, second, messages[3].Short)
+	assert.Equal(t, int64(3), messages[3].Clicks)
+
+	assert.Empty(t, relayAll(t, outbox, first, second), "relayed messages are removed")
+
+	third := unique(t, "s")
+	_, err = add(t, s, third, "https://example.com/"+unique(t, "p"), userID)
+	require.NoError(t, err)
+
+	publishErr := errors.New("broker is unavailable")
+	_, err = outbox.RelayOutbox(ctx, 100, func(context.Context, []storeInterface.OutboxMessage) error {
+		return publishErr
+	})
+	require.ErrorIs(t, err, publishErr)
+
+	messages = relayAll(t, outbox, third)
+	require.Len(t, messages, 1, "messages are kept if publishing fails")
+	assert.Equal(t, storeInterface.OutboxCreated, messages[0].Type)
+}
+
+func testReopen(t *testing.T, s storeInterface.Store, reopen Reopen) {
+	ctx := context.Background()
+	userID := unique(t, "u")
+	originals := make(map[string]string, 5)
+	expected := make([]models.UserURL, 0, 5)
+
+	for i := 0; i < 5; i++ {
+		short := unique(t, "s")
+		original := fmt.Sprintf("https://example.com/%d/%s", i, unique(t, "p"))
+		_, err := add(t, s, short, original, userID)
+		require.NoError(t, err)
+
+		originals[short] = original
+		expected = append(expected, models.UserURL{Short: baseURL + "/" + short, Original: original})
+	}
+
+	deleted := unique(t, "s")
+	_, err := add(t, s, deleted, "https://example.com/"+unique(t, "p"), userID)
+	require.NoError(t, err)
+	_, err = s.DeleteURLs(ctx, []storeInterface.DeletedURLs{{UserID: userID, URLs: []string{deleted}}})
+	require.NoError(t, err)
+
+	s = reopen(t, s)
+
+	for short, original := range originals {
+		got, err := s.GetOriginalURL(ctx, short)
+		require.NoError(t, err, short)
+		assert.Equal(t, original, got, short)
+	}
+
+	_, err = s.GetOriginalURL(ctx, deleted)
+	assert.ErrorIs(t, err, failure.ErrURLDeleted)
+
+	got, err := s.GetUserURLs(ctx, storeInterface.GetUserURLsOptions{UserID: userID, BaseURL: baseURL})
+	require.NoError(t, err)
+	assert.Subset(t, got, expected)
+}
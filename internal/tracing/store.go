@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/models"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store starts a span of every operation of the wrapped store.
+type Store struct {
+	store   storeInterface.Store
+	backend string
+	tracer  trace.Tracer
+}
+
+// WrapStore returns the store tracing its operations, spans are labeled by the backend name.
+// Nil Tracing returns the store as is.
+func (t *Tracing) WrapStore(store storeInterface.Store, backend string) storeInterface.Store {
+	if t == nil {
+		return store
+	}
+
+	return &Store{store: store, backend: backend, tracer: t.tracer}
+}
+
+// Unwrap returns the traced store.
+func (s *Store) Unwrap() storeInterface.Store {
+	return s.store
+}
+
+func (s *Store) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		semconv.DBSystemKey.String(s.backend),
+		semconv.DBOperation(operation),
+	)
+
+	return s.tracer.Start(ctx, "store."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// End records the error on the span and ends it. Missing, deleted or flagged URLs and
+// conflicts are expected outcomes, they are recorded as events only.
+func End(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, failure.ErrNotFound),
+		errors.Is(err, failure.ErrURLDeleted),
+		errors.Is(err, failure.ErrURLFlagged),
+		errors.Is(err, failure.ErrURLBlocked),
+		errors.Is(err, failure.ErrConflict),
+		errors.Is(err, failure.ErrShortExists):
+		span.AddEvent(err.Error())
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// GetOriginalURL traces GetOriginalURL of the store.
+func (s *Store) GetOriginalURL(ctx context.Context, short string) (string, error) {
+	ctx, span := s.start(ctx, "GetOriginalURL", attribute.String("short", short))
+	original, err := s.store.GetOriginalURL(ctx, short)
+	End(span, err)
+
+	return original, err
+}
+
+// AddValue traces AddValue of the store.
+func (s *Store) AddValue(ctx context.Context, opts storeInterface.AddValueOptions) (string, error) {
+	ctx, span := s.start(ctx, "AddValue", attribute.String("short", opts.Short))
+	short, err := s.store.AddValue(ctx, opts)
+	End(span, err)
+
+	return short, err
+}
+
+// GetUserURLs traces GetUserURLs of the store.
+func (s *Store) GetUserURLs(ctx context.Context, opts storeInterface.GetUserURLsOptions) ([]models.UserURL, error) {
+	ctx, span := s.start(ctx, "GetUserURLs")
+	urls, err := s.store.GetUserURLs(ctx, opts)
+	span.SetAttributes(attribute.Int("urls", len(urls)))
+	End(span, err)
+
+	return urls, err
+}
+
+// GetOwners traces GetOwners of the store.
+func (s *Store) GetOwners(ctx context.Context, shorts []string) (map[string]string, error) {
+	ctx, span := s.start(ctx, "GetOwners", attribute.Int("shorts", len(shorts)))
+	owners, err := s.store.GetOwners(ctx, shorts)
+	End(span, err)
+
+	return owners, err
+}
+
+// Ping traces Ping of the store.
+func (s *Store) Ping() error {
+	_, span := s.start(context.Background(), "Ping")
+	err := s.store.Ping()
+	End(span, err)
+
+	return err
+}
+
+// DeleteURLs traces DeleteURLs of the store.
+func (s *Store) DeleteURLs(ctx context.Context, opts []storeInterface.DeletedURLs) ([]storeInterface.DeletedURLs, error) {
+	ctx, span := s.start(ctx, "DeleteURLs", attribute.Int("requests", len(opts)))
+	deleted, err := s.store.DeleteURLs(ctx, opts)
+	End(span, err)
+
+	return deleted, err
+}
+
+// GetInternalStats traces GetInternalStats of the store.
+func (s *Store) GetInternalStats(ctx context.Context, opts storeInterface.StatsOptions) (models.InternalStats, error) {
+	ctx, span := s.start(ctx, "GetInternalStats", attribute.Int("top", opts.Top), attribute.Int("days", opts.Days))
+	stats, err := s.store.GetInternalStats(ctx, opts)
+	End(span, err)
+
+	return stats, err
+}
+
+// SetVerdict traces SetVerdict of the store.
+func (s *Store) SetVerdict(ctx context.Context, short string, verdict models.Verdict) error {
+	ctx, span := s.start(ctx, "SetVerdict", attribute.String("short", short), attribute.String("verdict", string(verdict)))
+	err := s.store.SetVerdict(ctx, short, verdict)
+	End(span, err)
+
+	return err
+}
+
+// GetUserUsage traces GetUserUsage of the store.
+func (s *Store) GetUserUsage(ctx context.Context, userID string, since time.Time) (models.Usage, error) {
+	ctx, span := s.start(ctx, "GetUserUsage")
+	usage, err := s.store.GetUserUsage(ctx, userID, since)
+	End(span, err)
+
+	return usage, err
+}
+
+// AddClicks traces AddClicks of the store.
+func (s *Store) AddClicks(ctx context.Context, clicks map[string]int64) (map[string]int64, error) {
+	ctx, span := s.start(ctx, "AddClicks", attribute.Int("urls", len(clicks)))
+	totals, err := s.store.AddClicks(ctx, clicks)
+	End(span, err)
+
+	return totals, err
+}
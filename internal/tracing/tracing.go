@@ -0,0 +1,136 @@
+// Package tracing sets up OpenTelemetry tracing of HTTP requests, gRPC calls,
+// store operations and background jobs. Trace context is propagated in the
+// W3C traceparent and baggage headers. Nil *Tracing is valid and traces
+// nothing, so instrumentation can be left in place when tracing is disabled.
+//
+// Sampling follows the standard OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG
+// environment variables, all spans are sampled by default.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/kupriyanovkk/shortener"
+
+// Exporters of spans.
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Options configures Tracing.
+type Options struct {
+	// Exporter of spans: otlp or stdout. Empty exporter disables tracing.
+	Exporter string
+	// Endpoint of the OTLP gRPC collector, e.g. localhost:4317. OTEL_EXPORTER_OTLP_ENDPOINT
+	// and other standard variables are used when it is empty.
+	Endpoint string
+	// Insecure disables TLS of the connection to the collector.
+	Insecure bool
+	// ServiceVersion is reported as the service.version resource attribute.
+	ServiceVersion string
+	// Output of the stdout exporter, os.Stdout by default.
+	Output io.Writer
+}
+
+// Tracing holds the tracer provider exporting spans.
+type Tracing struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New returns Tracing exporting spans by the configured exporter and registers it
+// as the global tracer provider and propagator. Nil Tracing is returned when
+// no exporter is configured.
+func New(ctx context.Context, opts Options) (*Tracing, error) {
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch opts.Exporter {
+	case "":
+		return nil, nil
+	case ExporterStdout:
+		output := opts.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	case ExporterOTLP:
+		var clientOpts []otlptracegrpc.Option
+		if opts.Endpoint != "" {
+			clientOpts = append(clientOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+		if opts.Insecure {
+			clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, clientOpts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("shortener"),
+		semconv.ServiceVersion(opts.ServiceVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	propagator := propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagator,
+	}, nil
+}
+
+// Start starts a span of a background job, e.g. flushing of deleted URLs.
+// Nil Tracing returns the context as is and a no-op span.
+func (t *Tracing) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	return t.tracer.Start(ctx, name, opts...)
+}
+
+// Shutdown exports the remaining spans and stops the provider.
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	return t.provider.Shutdown(ctx)
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracing() (*Tracing, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	return &Tracing{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+	}, recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	tr, recorder := newTestTracing()
+	router := chi.NewRouter()
+	router.Use(tr.Middleware)
+	router.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com", http.StatusTemporaryRedirect)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /{id}", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String(), "trace of the caller is continued")
+}
+
+func TestWrapStore(t *testing.T) {
+	tr, recorder := newTestTracing()
+	backend := inmemory.NewStore()
+	store := tr.WrapStore(backend, "memory")
+
+	ctx, parent := tr.Start(context.Background(), "request")
+	_, err := store.AddValue(ctx, storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com"})
+	require.NoError(t, err)
+	_, err = store.GetOriginalURL(ctx, "missing")
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "store.AddValue", spans[0].Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	assert.Equal(t, "store.GetOriginalURL", spans[1].Name())
+	assert.Equal(t, codes.Unset, spans[1].Status().Code, "missing URL isn't an error")
+
+	assert.Same(t, backend, store.(*Store).Unwrap())
+}
+
+func TestEnd(t *testing.T) {
+	tr, recorder := newTestTracing()
+
+	_, span := tr.Start(context.Background(), "deletion.flush")
+	End(span, errors.New("connection refused"))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, "connection refused", spans[0].Status().Description)
+}
+
+func TestNew(t *testing.T) {
+	tr, err := New(context.Background(), Options{})
+	require.NoError(t, err)
+	assert.Nil(t, tr)
+
+	_, err = New(context.Background(), Options{Exporter: "zipkin"})
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	tr, err = New(context.Background(), Options{Exporter: ExporterStdout, Output: &out, ServiceVersion: "v1.0.0"})
+	require.NoError(t, err)
+
+	_, span := tr.Start(context.Background(), "job")
+	span.End()
+	require.NoError(t, tr.Shutdown(context.Background()))
+
+	assert.Contains(t, out.String(), `"Name":"job"`)
+	assert.Contains(t, out.String(), "v1.0.0")
+
+	carrier := propagation.MapCarrier{}
+	ctx, span := tr.Start(context.Background(), "propagated")
+	defer span.End()
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	assert.NotEmpty(t, carrier.Get("traceparent"))
+}
+
+func TestNil(t *testing.T) {
+	var tr *Tracing
+
+	ctx, span := tr.Start(context.Background(), "job")
+	End(span, nil)
+	assert.Equal(t, context.Background(), ctx)
+	assert.Nil(t, tr.ServerOptions())
+	assert.NoError(t, tr.Shutdown(context.Background()))
+
+	backend := inmemory.NewStore()
+	assert.Same(t, backend, tr.WrapStore(backend, "memory"))
+}
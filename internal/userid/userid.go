@@ -11,6 +11,9 @@ type ContextKey string
 // ContextUserKey constant UserID
 const ContextUserKey ContextKey = "UserID"
 
+// ContextVerifiedKey marks contexts of requests carrying a valid signed user ID cookie.
+const ContextVerifiedKey ContextKey = "UserIDVerified"
+
 // Get returns the string representation of the value associated with the ContextUserKey in the given context.
 //
 // ctx: context.Context
@@ -18,3 +21,10 @@ const ContextUserKey ContextKey = "UserID"
 func Get(ctx context.Context) string {
 	return fmt.Sprint(ctx.Value(ContextUserKey))
 }
+
+// Verified reports whether the user ID in the context was taken from a valid signed cookie
+// rather than minted for the request.
+func Verified(ctx context.Context) bool {
+	verified, _ := ctx.Value(ContextVerifiedKey).(bool)
+	return verified
+}
@@ -0,0 +1,335 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/policy"
+	"go.uber.org/zap"
+)
+
+// Headers of webhook requests.
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the body of webhook requests.
+type Payload struct {
+	Type     Type      `json:"type"`
+	Time     time.Time `json:"time"`
+	Short    string    `json:"short,omitempty"`
+	ShortURL string    `json:"short_url,omitempty"`
+	Original string    `json:"original,omitempty"`
+	// Clicks is the crossed threshold of the number of redirects to the link, for TypeClicks events.
+	Clicks int64 `json:"clicks,omitempty"`
+}
+
+// Status is a status of deliveries.
+type Status string
+
+// Statuses of deliveries.
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	StatusFailed    Status = "failed"
+)
+
+// Attempt is an attempt to deliver a payload.
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Delivery is a payload sent to a subscription with its attempts.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"webhook_id"`
+	Event          Type            `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         Status          `json:"status"`
+	Attempts       []Attempt       `json:"attempts"`
+	NextAttempt    *time.Time      `json:"next_attempt,omitempty"`
+	// ReplayOf is the ID of the replayed delivery.
+	ReplayOf  string    `json:"replay_of,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// copy returns the copy of the delivery safe to use without the lock.
+func (d *Delivery) copy() Delivery {
+	result := *d
+	result.Attempts = append([]Attempt(nil), d.Attempts...)
+	if d.NextAttempt != nil {
+		next := *d.NextAttempt
+		result.NextAttempt = &next
+	}
+
+	return result
+}
+
+// Sign returns the signature of the payload sent at the Unix timestamp:
+// "sha256=" followed by hex encoded HMAC-SHA256 of "<timestamp>.<body>" with the secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliveries returns recent deliveries of the user's subscription, the latest first.
+func (s *Service) Deliveries(userID, id string) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.get(userID, id); err != nil {
+		return nil, err
+	}
+
+	history := s.history[id]
+	result := make([]Delivery, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		result = append(result, history[i].copy())
+	}
+
+	return result, nil
+}
+
+// Test queues the ping event to the user's subscription.
+func (s *Service) Test(userID, id string) (Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, err := s.get(userID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	d, err := s.enqueue(sub, Payload{Type: TypePing, Time: time.Now().UTC()}, "")
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return d.copy(), nil
+}
+
+// Replay queues the payload of the delivery to the user's subscription again.
+func (s *Service) Replay(userID, id, deliveryID string) (Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, err := s.get(userID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	original, ok := s.deliveries[deliveryID]
+	if !ok || original.SubscriptionID != id {
+		return Delivery{}, fmt.Errorf("%w: delivery %s", failure.ErrNotFound, deliveryID)
+	}
+
+	d, err := s.add(sub, original.Event, original.Payload, original.ID)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return d.copy(), nil
+}
+
+// enqueue creates the delivery of the payload. It is called with the lock held.
+func (s *Service) enqueue(sub *Subscription, payload Payload, replayOf string) (*Delivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.add(sub, payload.Type, body, replayOf)
+}
+
+// add records the delivery and queues its first attempt. It is called with the lock held.
+func (s *Service) add(sub *Subscription, event Type, body []byte, replayOf string) (*Delivery, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Delivery{
+		ID:             id,
+		SubscriptionID: sub.ID,
+		Event:          event,
+		Payload:        body,
+		Status:         StatusPending,
+		ReplayOf:       replayOf,
+		CreatedAt:      time.Now().UTC(),
+	}
+	s.deliveries[d.ID] = d
+
+	history := append(s.history[sub.ID], d)
+	if len(history) > s.opts.History {
+		for _, old := range history[:len(history)-s.opts.History] {
+			delete(s.deliveries, old.ID)
+		}
+		history = append([]*Delivery(nil), history[len(history)-s.opts.History:]...)
+	}
+	s.history[sub.ID] = history
+
+	select {
+	case s.queue <- d.ID:
+	default:
+		d.Status = StatusFailed
+		d.Attempts = append(d.Attempts, Attempt{Time: d.CreatedAt, Error: "delivery queue is full"})
+		s.opts.Logger.Warn("webhooks: queue is full, delivery is dropped", zap.String("webhook", sub.ID))
+	}
+
+	return d, nil
+}
+
+// attempt sends the delivery and schedules the next attempt if it fails.
+func (s *Service) attempt(ctx context.Context, id string) {
+	s.mu.Lock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	sub, ok := s.subs[d.SubscriptionID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	url, secret, event, body := sub.URL, sub.Secret, d.Event, d.Payload
+	d.NextAttempt = nil
+	s.mu.Unlock()
+
+	start := time.Now()
+	code, err := s.send(ctx, url, secret, id, event, body)
+	attempt := Attempt{Time: start.UTC(), StatusCode: code, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.Attempts = append(d.Attempts, attempt)
+	switch {
+	case err == nil:
+		d.Status = StatusDelivered
+		return
+	case len(d.Attempts) >= s.opts.MaxAttempts || ctx.Err() != nil:
+		d.Status = StatusFailed
+		s.opts.Logger.Warn("webhooks: delivery failed", zap.String("webhook", d.SubscriptionID),
+			zap.String("delivery", d.ID), zap.Int("attempts", len(d.Attempts)), zap.Error(err))
+		return
+	}
+
+	delay := s.backoff(len(d.Attempts))
+	next := time.Now().Add(delay).UTC()
+	d.NextAttempt = &next
+
+	time.AfterFunc(delay, func() {
+		select {
+		case s.queue <- id:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// backoff returns the delay after the attempt: Backoff doubled with every attempt,
+// limited by MaxBackoff, with up to 10% jitter.
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.opts.Backoff
+	for i := 1; i < attempts && delay < s.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.MaxBackoff {
+		delay = s.opts.MaxBackoff
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay)/10+1))
+}
+
+// send posts the signed payload, any response but 2xx is an error.
+func (s *Service) send(ctx context.Context, url, secret, id string, event Type, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shortener-webhooks")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderEvent, string(event))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// errPrivateAddress is returned for connections to private addresses.
+var errPrivateAddress = errors.New("webhook address is private")
+
+// newClient returns the client not following redirects. Unless allowPrivate, it refuses
+// to connect to private addresses, which are checked after resolving, so DNS can't point
+// webhooks to internal services.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || policy.IsPrivate(ip) {
+				return fmt.Errorf("%w: %s", errPrivateAddress, host)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,550 @@
+// Package webhooks notifies external systems about events of users' links.
+//
+// Users subscribe URLs to types of events. Payloads are JSON documents signed by
+// HMAC-SHA256 with the secret of the subscription. They are delivered by background
+// workers and retried with exponential backoff. Recent deliveries and their attempts
+// are kept in memory, so they can be inspected and replayed.
+package webhooks
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	"github.com/kupriyanovkk/shortener/internal/random"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"go.uber.org/zap"
+)
+
+// Type is a type of webhook events.
+type Type string
+
+// Types of webhook events.
+const (
+	TypeCreated Type = "created"
+	TypeDeleted Type = "deleted"
+	// TypeClicks is sent when the stored number of redirects to a link reaches a threshold of the subscription.
+	TypeClicks Type = "clicks"
+	// TypePing is sent by Test only.
+	TypePing Type = "ping"
+)
+
+// Limits of subscriptions.
+const (
+	MaxThresholds = 10
+	MaxSecretLen  = 256
+)
+
+// Subscription is a URL subscribed to events of the user's links.
+type Subscription struct {
+	ID     string `json:"id"`
+	UserID string `json:"-"`
+	URL    string `json:"url"`
+	// Secret signs payloads. It is generated when empty and returned on creation only.
+	Secret string `json:"secret,omitempty"`
+	Events []Type `json:"events"`
+	// ClickThresholds are numbers of redirects to a link TypeClicks events are sent at.
+	ClickThresholds []int64   `json:"click_thresholds,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// has reports whether the subscription receives events of the type.
+func (s *Subscription) has(t Type) bool {
+	for _, e := range s.Events {
+		if e == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate checks the subscription and normalizes its events and thresholds.
+func (s *Subscription) validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", failure.ErrInvalidWebhook, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", failure.ErrInvalidWebhook, u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%w: host is empty", failure.ErrInvalidWebhook)
+	}
+	if len(s.Secret) > MaxSecretLen {
+		return fmt.Errorf("%w: secret is longer than %d bytes", failure.ErrInvalidWebhook, MaxSecretLen)
+	}
+
+	if len(s.Events) == 0 {
+		return fmt.Errorf("%w: no events", failure.ErrInvalidWebhook)
+	}
+	seen := make(map[Type]bool, len(s.Events))
+	types := s.Events[:0]
+	for _, t := range s.Events {
+		switch t {
+		case TypeCreated, TypeDeleted, TypeClicks:
+		default:
+			return fmt.Errorf("%w: unknown event type %q", failure.ErrInvalidWebhook, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	s.Events = types
+
+	if seen[TypeClicks] != (len(s.ClickThresholds) > 0) {
+		return fmt.Errorf("%w: click thresholds are required for and only for clicks events", failure.ErrInvalidWebhook)
+	}
+	if len(s.ClickThresholds) > MaxThresholds {
+		return fmt.Errorf("%w: at most %d click thresholds", failure.ErrInvalidWebhook, MaxThresholds)
+	}
+	sort.Slice(s.ClickThresholds, func(i, j int) bool { return s.ClickThresholds[i] < s.ClickThresholds[j] })
+	for i, n := range s.ClickThresholds {
+		if n <= 0 {
+			return fmt.Errorf("%w: click thresholds must be positive", failure.ErrInvalidWebhook)
+		}
+		if i > 0 && n == s.ClickThresholds[i-1] {
+			return fmt.Errorf("%w: duplicate click threshold %d", failure.ErrInvalidWebhook, n)
+		}
+	}
+
+	return nil
+}
+
+// Options configures Service.
+type Options struct {
+	// BaseURL is the address of the service, short URLs in payloads are built of it.
+	BaseURL string
+	// File is a path to the JSON file subscriptions are saved to, they are kept in memory only if empty.
+	File string
+	// Workers is a number of goroutines delivering payloads, 4 by default.
+	Workers int
+	// QueueSize is a capacity of the queue of deliveries, 1000 by default.
+	QueueSize int
+	// MaxAttempts is a number of attempts to deliver a payload, 5 by default.
+	MaxAttempts int
+	// Backoff is a delay before the second attempt, 1 second by default. It doubles with every attempt.
+	Backoff time.Duration
+	// MaxBackoff limits the delay between attempts, 10 minutes by default.
+	MaxBackoff time.Duration
+	// Timeout limits a single attempt, 10 seconds by default.
+	Timeout time.Duration
+	// History is a number of recent deliveries kept per subscription, 100 by default.
+	History int
+	// MaxPerUser is a number of subscriptions a user may have, 10 by default.
+	MaxPerUser int
+	// AllowPrivate allows delivering to localhost and private network addresses.
+	AllowPrivate bool
+	// Client sends payloads, the client refusing private addresses unless AllowPrivate is used by default.
+	Client *http.Client
+	// Logger logs failed deliveries, the global logger is used by default.
+	Logger *zap.Logger
+}
+
+// Service keeps webhook subscriptions and delivers events to them.
+type Service struct {
+	store  storeInterface.Store
+	opts   Options
+	client *http.Client
+	queue  chan string
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+	// users are subscribed users and their subscriptions in order of creation.
+	users      map[string][]*Subscription
+	deliveries map[string]*Delivery
+	history    map[string][]*Delivery
+}
+
+// New returns Service looking up owners of links in store. Subscriptions are loaded from
+// opts.File if it exists.
+func New(store storeInterface.Store, opts Options) (*Service, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 10 * time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.History <= 0 {
+		opts.History = 100
+	}
+	if opts.MaxPerUser <= 0 {
+		opts.MaxPerUser = 10
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.L()
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = newClient(opts.Timeout, opts.AllowPrivate)
+	}
+
+	s := &Service{
+		store:      store,
+		opts:       opts,
+		client:     client,
+		queue:      make(chan string, opts.QueueSize),
+		subs:       make(map[string]*Subscription),
+		users:      make(map[string][]*Subscription),
+		deliveries: make(map[string]*Delivery),
+		history:    make(map[string][]*Delivery),
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Create adds the subscription of the user. Invalid subscriptions are reported
+// as failure.ErrInvalidWebhook. The created subscription is returned along with its secret.
+func (s *Service) Create(ctx context.Context, userID string, sub Subscription) (Subscription, error) {
+	if err := sub.validate(); err != nil {
+		return Subscription{}, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Subscription{}, err
+	}
+	if sub.Secret == "" {
+		if sub.Secret, err = newSecret(); err != nil {
+			return Subscription{}, err
+		}
+	}
+	sub.ID = id
+	sub.UserID = userID
+	sub.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.users[userID]) >= s.opts.MaxPerUser {
+		return Subscription{}, fmt.Errorf("%w: at most %d webhooks per user", failure.ErrInvalidWebhook, s.opts.MaxPerUser)
+	}
+
+	s.subs[sub.ID] = &sub
+	s.users[userID] = append(s.users[userID], &sub)
+	if err := s.save(); err != nil {
+		s.remove(&sub)
+		return Subscription{}, err
+	}
+
+	return sub, nil
+}
+
+// List returns subscriptions of the user without their secrets.
+func (s *Service) List(userID string) []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]Subscription, 0, len(s.users[userID]))
+	for _, sub := range s.users[userID] {
+		result = append(result, public(sub))
+	}
+
+	return result
+}
+
+// Delete removes the subscription of the user along with its deliveries.
+func (s *Service) Delete(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, err := s.get(userID, id)
+	if err != nil {
+		return err
+	}
+
+	s.remove(sub)
+	if err := s.save(); err != nil {
+		s.subs[sub.ID] = sub
+		s.users[userID] = append(s.users[userID], sub)
+		return err
+	}
+
+	return nil
+}
+
+// Run delivers events of the bus to subscriptions until ctx is done.
+func (s *Service) Run(ctx context.Context, bus *events.Bus) {
+	if s == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(s.opts.Workers)
+	for i := 0; i < s.opts.Workers; i++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case id := <-s.queue:
+					s.attempt(ctx, id)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	sub := bus.Subscribe(s.filter, events.TypeCreated, events.TypeDeleted)
+	defer sub.Close()
+
+	for received := sub.Events(); received != nil; {
+		select {
+		case e, ok := <-received:
+			if !ok {
+				// The bus is closed on shutdown, queued deliveries are still attempted.
+				received = nil
+				break
+			}
+			s.handle(ctx, e)
+		case <-ctx.Done():
+			received = nil
+		}
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+}
+
+// filter passes events of links of subscribed users. It must not block.
+func (s *Service) filter(e events.Event) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.users[e.UserID]) > 0
+}
+
+// handle queues deliveries of the event to subscriptions of the link owner.
+func (s *Service) handle(ctx context.Context, e events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload := Payload{Type: Type(e.Type), Time: e.Time, Short: e.Short, Original: e.Original}
+	if e.Short != "" {
+		payload.ShortURL = fmt.Sprintf("%s/%s", s.opts.BaseURL, e.Short)
+	}
+
+	if e.Type == events.TypeDropped {
+		s.opts.Logger.Warn("webhooks: events are dropped", zap.Uint64("dropped", e.Dropped))
+		return
+	}
+
+	for _, sub := range s.users[e.UserID] {
+		if !sub.has(payload.Type) {
+			continue
+		}
+
+		if _, err := s.enqueue(sub, payload, ""); err != nil {
+			s.opts.Logger.Error("webhooks: cannot queue delivery", zap.String("webhook", sub.ID), zap.Error(err))
+		}
+	}
+}
+
+// Clicked queues TypeClicks deliveries for thresholds crossed by flushed clicks. Added are
+// numbers of clicks flushed to the store, and totals are the numbers kept by the store after
+// that, so every threshold is crossed by a single flush across restarts and instances.
+// Owners of the links are looked up in the store. It is a clicks.Listener.
+func (s *Service) Clicked(ctx context.Context, added, totals map[string]int64) {
+	if s == nil || s.store == nil || len(totals) == 0 || !s.watchesClicks() {
+		return
+	}
+
+	shorts := make([]string, 0, len(totals))
+	for short := range totals {
+		shorts = append(shorts, short)
+	}
+	owners, err := s.store.GetOwners(ctx, shorts)
+	if err != nil {
+		s.opts.Logger.Error("webhooks: cannot get owners of clicked links", zap.Error(err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for short, total := range totals {
+		userID, ok := owners[short]
+		if !ok {
+			continue
+		}
+
+		for _, sub := range s.users[userID] {
+			if !sub.has(TypeClicks) {
+				continue
+			}
+
+			for _, n := range crossed(sub.ClickThresholds, total-added[short], total) {
+				payload := Payload{
+					Type:     TypeClicks,
+					Time:     now,
+					Short:    short,
+					ShortURL: fmt.Sprintf("%s/%s", s.opts.BaseURL, short),
+					Clicks:   n,
+				}
+				if _, err := s.enqueue(sub, payload, ""); err != nil {
+					s.opts.Logger.Error("webhooks: cannot queue delivery", zap.String("webhook", sub.ID), zap.Error(err))
+				}
+			}
+		}
+	}
+}
+
+// crossed returns the sorted thresholds in the range (from, to].
+func crossed(thresholds []int64, from, to int64) []int64 {
+	i := sort.Search(len(thresholds), func(i int) bool { return thresholds[i] > from })
+	j := sort.Search(len(thresholds), func(i int) bool { return thresholds[i] > to })
+
+	return thresholds[i:j]
+}
+
+// watchesClicks reports whether any subscription receives TypeClicks events.
+func (s *Service) watchesClicks() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.has(TypeClicks) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// get returns the subscription of the user. It is called with the lock held.
+func (s *Service) get(userID, id string) (*Subscription, error) {
+	sub, ok := s.subs[id]
+	if !ok || sub.UserID != userID {
+		return nil, fmt.Errorf("%w: webhook %s", failure.ErrNotFound, id)
+	}
+
+	return sub, nil
+}
+
+// remove forgets the subscription and its deliveries. It is called with the lock held.
+func (s *Service) remove(sub *Subscription) {
+	delete(s.subs, sub.ID)
+
+	subs := s.users[sub.UserID]
+	for i, v := range subs {
+		if v == sub {
+			s.users[sub.UserID] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(s.users[sub.UserID]) == 0 {
+		delete(s.users, sub.UserID)
+	}
+
+	for _, d := range s.history[sub.ID] {
+		delete(s.deliveries, d.ID)
+	}
+	delete(s.history, sub.ID)
+}
+
+// load reads subscriptions from the file, which keeps them by user IDs.
+func (s *Service) load() error {
+	if s.opts.File == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.opts.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var users map[string][]*Subscription
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("cannot parse webhooks file %s: %w", s.opts.File, err)
+	}
+
+	for userID, subs := range users {
+		for _, sub := range subs {
+			sub.UserID = userID
+			s.subs[sub.ID] = sub
+		}
+		s.users[userID] = subs
+	}
+
+	return nil
+}
+
+// save writes subscriptions to the file atomically. It is called with the lock held.
+func (s *Service) save() error {
+	if s.opts.File == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.opts.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.opts.File)
+}
+
+// public returns the copy of the subscription without its secret.
+func public(sub *Subscription) Subscription {
+	result := *sub
+	result.Secret = ""
+	result.Events = append([]Type(nil), sub.Events...)
+	result.ClickThresholds = append([]int64(nil), sub.ClickThresholds...)
+
+	return result
+}
+
+func newID() (string, error) {
+	b, err := random.Generate(8)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func newSecret() (string, error) {
+	b, err := random.Generate(32)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,361 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kupriyanovkk/shortener/internal/events"
+	"github.com/kupriyanovkk/shortener/internal/failure"
+	inmemory "github.com/kupriyanovkk/shortener/internal/store/in_memory"
+	storeInterface "github.com/kupriyanovkk/shortener/internal/store/interface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a webhook endpoint responding with the statuses in order, then with 200.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []request
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		rcv.requests = append(rcv.requests, request{header: r.Header.Clone(), body: body})
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+
+	return rcv
+}
+
+func (rcv *receiver) received() []request {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	return append([]request(nil), rcv.requests...)
+}
+
+func newTestService(t *testing.T, rcv *receiver, opts Options) *Service {
+	opts.BaseURL = "http://short.test"
+	opts.Backoff = time.Millisecond
+	if rcv != nil {
+		opts.Client = rcv.Client()
+	}
+
+	s, err := New(inmemory.NewStore(), opts)
+	require.NoError(t, err)
+
+	return s
+}
+
+func run(t *testing.T, s *Service, bus *events.Bus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, bus)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Run subscribes to the bus asynchronously.
+	require.Eventually(t, func() bool { return bus.Subscribers() == 1 }, time.Second, time.Millisecond)
+}
+
+func waitDelivery(t *testing.T, s *Service, userID string, d Delivery, status Status) Delivery {
+	var result Delivery
+	require.Eventually(t, func() bool {
+		deliveries, err := s.Deliveries(userID, d.SubscriptionID)
+		require.NoError(t, err)
+		for _, v := range deliveries {
+			if v.ID == d.ID {
+				result = v
+			}
+		}
+		return result.Status == status
+	}, 5*time.Second, time.Millisecond)
+
+	return result
+}
+
+func TestCreate(t *testing.T) {
+	s := newTestService(t, nil, Options{MaxPerUser: 2})
+	ctx := context.Background()
+
+	invalid := []Subscription{
+		{URL: "ftp://example.com", Events: []Type{TypeCreated}},
+		{URL: "https:///path", Events: []Type{TypeCreated}},
+		{URL: "https://example.com"},
+		{URL: "https://example.com", Events: []Type{"expired"}},
+		{URL: "https://example.com", Events: []Type{TypeClicks}},
+		{URL: "https://example.com", Events: []Type{TypeCreated}, ClickThresholds: []int64{10}},
+		{URL: "https://example.com", Events: []Type{TypeClicks}, ClickThresholds: []int64{10, 0}},
+		{URL: "https://example.com", Events: []Type{TypeClicks}, ClickThresholds: []int64{10, 10}},
+	}
+	for _, sub := range invalid {
+		_, err := s.Create(ctx, "user1", sub)
+		assert.ErrorIs(t, err, failure.ErrInvalidWebhook, sub)
+	}
+
+	sub, err := s.Create(ctx, "user1", Subscription{
+		URL:             "https://example.com/hook",
+		Events:          []Type{TypeClicks, TypeCreated, TypeClicks},
+		ClickThresholds: []int64{100, 10},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, sub.ID)
+	assert.Len(t, sub.Secret, 64)
+	assert.Equal(t, []Type{TypeClicks, TypeCreated}, sub.Events)
+	assert.Equal(t, []int64{10, 100}, sub.ClickThresholds)
+
+	list := s.List("user1")
+	require.Len(t, list, 1)
+	assert.Equal(t, sub.ID, list[0].ID)
+	assert.Empty(t, list[0].Secret)
+	assert.Empty(t, s.List("user2"))
+
+	_, err = s.Create(ctx, "user1", Subscription{URL: "https://example.com/2", Secret: "secret", Events: []Type{TypeDeleted}})
+	require.NoError(t, err)
+	_, err = s.Create(ctx, "user1", Subscription{URL: "https://example.com/3", Events: []Type{TypeDeleted}})
+	assert.ErrorIs(t, err, failure.ErrInvalidWebhook)
+
+	assert.ErrorIs(t, s.Delete("user2", sub.ID), failure.ErrNotFound)
+	require.NoError(t, s.Delete("user1", sub.ID))
+	assert.Len(t, s.List("user1"), 1)
+}
+
+func TestPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "webhooks.json")
+
+	s := newTestService(t, nil, Options{File: file})
+	sub, err := s.Create(context.Background(), "user1", Subscription{URL: "https://example.com", Secret: "secret", Events: []Type{TypeCreated}})
+	require.NoError(t, err)
+
+	s = newTestService(t, nil, Options{File: file})
+	list := s.List("user1")
+	require.Len(t, list, 1)
+	assert.Equal(t, sub.ID, list[0].ID)
+	assert.Equal(t, "secret", s.subs[sub.ID].Secret)
+
+	require.NoError(t, s.Delete("user1", sub.ID))
+	s = newTestService(t, nil, Options{File: file})
+	assert.Empty(t, s.List("user1"))
+}
+
+func TestRetries(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	s := newTestService(t, rcv, Options{})
+	run(t, s, events.NewBus(0))
+
+	sub, err := s.Create(context.Background(), "user1", Subscription{URL: rcv.URL, Secret: "secret", Events: []Type{TypeCreated}})
+	require.NoError(t, err)
+
+	d, err := s.Test("user1", sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, d.Status)
+
+	d = waitDelivery(t, s, "user1", d, StatusDelivered)
+	require.Len(t, d.Attempts, 3)
+	assert.Equal(t, http.StatusInternalServerError, d.Attempts[0].StatusCode)
+	assert.Contains(t, d.Attempts[0].Error, "status 500")
+	assert.Equal(t, http.StatusOK, d.Attempts[2].StatusCode)
+	assert.Empty(t, d.Attempts[2].Error)
+	assert.Nil(t, d.NextAttempt)
+
+	requests := rcv.received()
+	require.Len(t, requests, 3)
+	last := requests[2]
+	assert.Equal(t, d.ID, last.header.Get(HeaderID))
+	assert.Equal(t, "ping", last.header.Get(HeaderEvent))
+	timestamp, err := strconv.ParseInt(last.header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, Sign("secret", timestamp, last.body), last.header.Get(HeaderSignature))
+	assert.JSONEq(t, string(d.Payload), string(last.body))
+
+	replay, err := s.Replay("user1", sub.ID, d.ID)
+	require.NoError(t, err)
+	assert.Equal(t, d.ID, replay.ReplayOf)
+	replay = waitDelivery(t, s, "user1", replay, StatusDelivered)
+	assert.Len(t, replay.Attempts, 1)
+
+	deliveries, err := s.Deliveries("user1", sub.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, replay.ID, deliveries[0].ID)
+
+	_, err = s.Replay("user1", sub.ID, "unknown")
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+	_, err = s.Deliveries("user2", sub.ID)
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+}
+
+func TestMaxAttempts(t *testing.T) {
+	rcv := newReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	s := newTestService(t, rcv, Options{MaxAttempts: 2, History: 1})
+	run(t, s, events.NewBus(0))
+
+	sub, err := s.Create(context.Background(), "user1", Subscription{URL: rcv.URL, Events: []Type{TypeCreated}})
+	require.NoError(t, err)
+
+	first, err := s.Test("user1", sub.ID)
+	require.NoError(t, err)
+	first = waitDelivery(t, s, "user1", first, StatusFailed)
+	assert.Len(t, first.Attempts, 2)
+
+	second, err := s.Test("user1", sub.ID)
+	require.NoError(t, err)
+	waitDelivery(t, s, "user1", second, StatusDelivered)
+
+	deliveries, err := s.Deliveries("user1", sub.ID)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, second.ID, deliveries[0].ID)
+
+	_, err = s.Replay("user1", sub.ID, first.ID)
+	assert.ErrorIs(t, err, failure.ErrNotFound)
+}
+
+func TestPrivateAddress(t *testing.T) {
+	rcv := newReceiver(t)
+	s, err := New(nil, Options{MaxAttempts: 1})
+	require.NoError(t, err)
+	run(t, s, events.NewBus(0))
+
+	sub, err := s.Create(context.Background(), "user1", Subscription{URL: rcv.URL, Events: []Type{TypeCreated}})
+	require.NoError(t, err)
+
+	d, err := s.Test("user1", sub.ID)
+	require.NoError(t, err)
+	d = waitDelivery(t, s, "user1", d, StatusFailed)
+	require.Len(t, d.Attempts, 1)
+	assert.Contains(t, d.Attempts[0].Error, errPrivateAddress.Error())
+	assert.Empty(t, rcv.received())
+}
+
+func TestRun(t *testing.T) {
+	rcv := newReceiver(t)
+	s := newTestService(t, rcv, Options{})
+
+	_, err := s.Create(context.Background(), "user1", Subscription{URL: rcv.URL, Events: []Type{TypeCreated}})
+	require.NoError(t, err)
+	_, err = s.Create(context.Background(), "user2", Subscription{URL: rcv.URL, Events: []Type{TypeDeleted}})
+	require.NoError(t, err)
+
+	bus := events.NewBus(0)
+	run(t, s, bus)
+
+	bus.Publish(events.Event{Type: events.TypeCreated, Short: "new", Original: "https://example.com/new", UserID: "user1"})
+	bus.Publish(events.Event{Type: events.TypeDeleted, Short: "new", UserID: "user1"})
+	bus.Publish(events.Event{Type: events.TypeCreated, Short: "other", UserID: "user3"})
+	bus.Publish(events.Event{Type: events.TypeRedirect, Short: "new"})
+	bus.Publish(events.Event{Type: events.TypeDeleted, Short: "xyz", UserID: "user2"})
+
+	require.Eventually(t, func() bool { return len(rcv.received()) == 2 }, 5*time.Second, time.Millisecond)
+	// Wait for unexpected deliveries.
+	time.Sleep(20 * time.Millisecond)
+
+	byShort := make(map[string][]Payload)
+	for _, r := range rcv.received() {
+		var p Payload
+		require.NoError(t, json.Unmarshal(r.body, &p))
+		assert.Equal(t, string(p.Type), r.header.Get(HeaderEvent))
+		byShort[p.Short] = append(byShort[p.Short], p)
+	}
+	require.Len(t, byShort["new"], 1)
+	require.Len(t, byShort["xyz"], 1)
+	assert.Equal(t, TypeCreated, byShort["new"][0].Type)
+	assert.Equal(t, "http://short.test/new", byShort["new"][0].ShortURL)
+	assert.Equal(t, "https://example.com/new", byShort["new"][0].Original)
+	assert.Equal(t, TypeDeleted, byShort["xyz"][0].Type)
+}
+
+func TestClicked(t *testing.T) {
+	rcv := newReceiver(t)
+	s := newTestService(t, rcv, Options{})
+	_, err := s.store.AddValue(context.Background(), storeInterface.AddValueOptions{Short: "abc", Original: "https://example.com", UserID: "user1"})
+	require.NoError(t, err)
+
+	_, err = s.Create(context.Background(), "user1", Subscription{
+		URL:             rcv.URL,
+		Events:          []Type{TypeCreated, TypeClicks},
+		ClickThresholds: []int64{2, 5, 10},
+	})
+	require.NoError(t, err)
+
+	run(t, s, events.NewBus(0))
+	// Links created after subscribing are resolved by the store as well.
+	for short, userID := range map[string]string{"new": "user1", "other": "user2"} {
+		_, err = s.store.AddValue(context.Background(), storeInterface.AddValueOptions{Short: short, Original: "https://example.com/" + short, UserID: userID})
+		require.NoError(t, err)
+	}
+
+	var nilService *Service
+	nilService.Clicked(context.Background(), map[string]int64{"abc": 1}, map[string]int64{"abc": 1})
+
+	s.Clicked(context.Background(), map[string]int64{"abc": 3, "other": 4}, map[string]int64{"abc": 3, "other": 4})
+	// Clicks flushed by another instance are included in totals, so thresholds they crossed are skipped.
+	s.Clicked(context.Background(), map[string]int64{"abc": 1, "new": 2}, map[string]int64{"abc": 7, "new": 2})
+	s.Clicked(context.Background(), map[string]int64{"abc": 4}, map[string]int64{"abc": 11})
+
+	require.Eventually(t, func() bool { return len(rcv.received()) == 3 }, 5*time.Second, time.Millisecond)
+	// Wait for unexpected deliveries.
+	time.Sleep(20 * time.Millisecond)
+
+	var clicks []Payload
+	for _, r := range rcv.received() {
+		var p Payload
+		require.NoError(t, json.Unmarshal(r.body, &p))
+		if p.Type == TypeClicks {
+			assert.Equal(t, "http://short.test/"+p.Short, p.ShortURL)
+			clicks = append(clicks, Payload{Short: p.Short, Clicks: p.Clicks})
+		}
+	}
+	assert.ElementsMatch(t, []Payload{{Short: "abc", Clicks: 2}, {Short: "abc", Clicks: 10}, {Short: "new", Clicks: 2}}, clicks)
+}
+
+func TestBackoff(t *testing.T) {
+	s := &Service{opts: Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}}
+
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		delay := s.backoff(attempts)
+		assert.GreaterOrEqual(t, delay, want)
+		assert.LessOrEqual(t, delay, want+want/10)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signature := Sign("secret", 1700000000, []byte(`{"type":"ping"}`))
+	assert.Equal(t, signature, Sign("secret", 1700000000, []byte(`{"type":"ping"}`)))
+	assert.NotEqual(t, signature, Sign("other", 1700000000, []byte(`{"type":"ping"}`)))
+	assert.NotEqual(t, signature, Sign("secret", 1700000001, []byte(`{"type":"ping"}`)))
+	assert.Len(t, signature, len("sha256=")+64)
+}